@@ -0,0 +1,132 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/bgrewell/dart/internal/config"
+	"github.com/bgrewell/dart/internal/docker"
+	"github.com/bgrewell/dart/internal/lxd"
+	"github.com/bgrewell/dart/internal/runlabel"
+	"github.com/docker/docker/client"
+)
+
+// runPlatform is a platform whose run-labelled resources gc can collect.
+type runPlatform interface {
+	RunResources() ([]runlabel.Resource, error)
+	RemoveRunResource(resource runlabel.Resource) error
+}
+
+// runGC implements `dart gc`: it finds every resource a run labelled, and
+// removes those whose run is dead. It needs no suite, so it reaches the
+// engines with their default endpoints.
+func runGC(args []string) int {
+	fs := flag.NewFlagSet("dart gc", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: dart gc [--older-than DURATION] [--include-kept] [--dry-run]\n\n"+
+			"Remove the containers, networks, instances, profiles and projects left by\n"+
+			"dart runs that are no longer running.\n\n")
+		fs.PrintDefaults()
+	}
+	olderThan := fs.Duration("older-than", 0, "Only collect runs created at least this long ago, such as 2h; required for runs from other hosts")
+	includeKept := fs.Bool("include-kept", false, "Also collect environments left up by --setup-only")
+	dryRun := fs.Bool("dry-run", false, "List what would be removed without removing it")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "\n%s unexpected argument %q\n\n", errorStyle.Sprint("Error:"), fs.Arg(0))
+		return 2
+	}
+	if *olderThan < 0 {
+		fmt.Fprintf(os.Stderr, "\n%s older-than must not be negative (got %s)\n\n", errorStyle.Sprint("Error:"), *olderThan)
+		return 1
+	}
+
+	host, _ := os.Hostname()
+	policy := runlabel.Policy{Host: host, OlderThan: *olderThan, Now: time.Now(), Alive: runlabel.ProcessAlive, IncludeKept: *includeKept}
+
+	// A platform that is not installed has nothing to collect; only a
+	// failure against one that is counts as an error
+	var platforms []runPlatform
+	if dw, err := docker.NewWrapper(&config.Configuration{}); err == nil {
+		platforms = append(platforms, dw)
+	}
+	if lw, err := lxd.NewWrapper(nil); err == nil {
+		platforms = append(platforms, lw)
+	}
+
+	failed := false
+	var resources []runlabel.Resource
+	owner := make(map[runlabel.Resource]runPlatform)
+	for _, platform := range platforms {
+		found, err := platform.RunResources()
+		if client.IsErrConnectionFailed(err) {
+			// No daemon listening: Docker is not running here
+			continue
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s %s\n", errorStyle.Sprint("Warning:"), err)
+			failed = true
+			continue
+		}
+		for _, resource := range found {
+			owner[resource] = platform
+		}
+		resources = append(resources, found...)
+	}
+	runlabel.SortForRemoval(resources)
+
+	removed, kept := 0, 0
+	for _, resource := range resources {
+		label := describeResource(resource, policy.Now)
+		dead, reason := policy.Dead(resource.Run)
+		switch {
+		case !dead:
+			kept++
+			fmt.Printf("kept          %s: %s\n", label, reason)
+		case *dryRun:
+			removed++
+			fmt.Printf("would remove  %s\n", label)
+		default:
+			if err := owner[resource].RemoveRunResource(resource); err != nil {
+				failed = true
+				fmt.Printf("failed        %s: %v\n", label, err)
+				continue
+			}
+			removed++
+			fmt.Printf("removed       %s\n", label)
+		}
+	}
+
+	verb := "removed"
+	if *dryRun {
+		verb = "would be removed"
+	}
+	fmt.Printf("%d %s, %d kept\n", removed, verb, kept)
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+// describeResource names a resource and the run it belongs to.
+func describeResource(resource runlabel.Resource, now time.Time) string {
+	name := resource.Name
+	if resource.Project != "" && resource.Project != lxd.DefaultProject {
+		name = resource.Project + "/" + name
+	}
+	run := resource.Run
+	age := "unknown age"
+	if !run.Created.IsZero() {
+		age = now.Sub(run.Created).Round(time.Minute).String() + " old"
+	}
+	suite := run.Suite
+	if suite == "" {
+		suite = "-"
+	}
+	return fmt.Sprintf("%s %s %s (run %s, suite %s, host %s, %s)",
+		resource.Platform, resource.Kind, name, run.ID, suite, run.Host, age)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/bgrewell/dart/internal"
+	"github.com/bgrewell/dart/internal/config"
+	"github.com/bgrewell/dart/internal/formatters"
+	"github.com/bgrewell/dart/internal/runlabel"
+	"github.com/bgrewell/dart/pkg/nodetypes"
+)
+
+// runGolden implements `dart golden build`: it runs a suite's setup, then
+// publishes one of its LXD nodes as the golden instance that other suites
+// copy with clone_from, and tears the run down again.
+func runGolden(args []string) int {
+	usage := "Usage: dart golden build -c SUITE [--node NAME] [--name GOLDEN] [--snapshot NAME] [--vars key=value,...]\n"
+	if len(args) == 0 || args[0] != "build" {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+
+	fs := flag.NewFlagSet("dart golden build", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), usage+"\n"+
+			"Create a suite's nodes and run its setup steps, then publish one LXD node as\n"+
+			"a golden instance, snapshotted, for clone_from to copy. A golden of the same\n"+
+			"name is replaced. Tests and teardown steps are not run.\n\n")
+		fs.PrintDefaults()
+	}
+	configFile := fs.String("c", "config.yaml", "The path to the suite that builds the golden")
+	nodeName := fs.String("node", "", "The LXD node to publish; required when the suite has several")
+	name := fs.String("name", "", "Name of the golden instance (default: the node's name)")
+	snapshot := fs.String("snapshot", "base", "Name of the golden's snapshot that clones copy")
+	vars := fs.String("vars", "", "Override suite variables: key=value[,key=value...]")
+	verbose := fs.Bool("v", false, "Enable verbose output")
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "\n%s unexpected argument %q\n\n", errorStyle.Sprint("Error:"), fs.Arg(0))
+		return 2
+	}
+
+	golden, err := buildGolden(*configFile, *nodeName, *name, *snapshot, *vars, *verbose)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "\n%s %s\n\n", errorStyle.Sprint("Error:"), err)
+		return 1
+	}
+	fmt.Printf("\nGolden: %s/%s (use with: clone_from: {instance: %s, snapshot: %s})\n", golden, *snapshot, golden, *snapshot)
+	return 0
+}
+
+// buildGolden sets the suite up, publishes the node, and tears the run
+// down, returning the golden's name. A failed setup has already cleaned
+// up after itself; once setup succeeded, teardown runs whether or not
+// publishing did.
+func buildGolden(configFile, nodeName, name, snapshot, varFlags string, verbose bool) (string, error) {
+	vars, err := parseVarFlags(varFlags)
+	if err != nil {
+		return "", err
+	}
+	cfg, err := config.LoadConfigurationWithVars(configFile, vars)
+	if err != nil {
+		return "", err
+	}
+	nodeCfg, err := nodetypes.GoldenBuildNode(cfg, nodeName)
+	if err != nil {
+		return "", err
+	}
+	if name == "" {
+		name = nodeCfg.Name
+	}
+	if _, err := runlabel.Start(cfg.Suite, ""); err != nil {
+		return "", err
+	}
+
+	dockerWrapper, err := DockerWrapper(cfg)
+	if err != nil {
+		return "", err
+	}
+	lxdWrapper, err := LxdWrapper(cfg)
+	if err != nil {
+		return "", err
+	}
+	nodes, err := Nodes(cfg, dockerWrapper, lxdWrapper)
+	if err != nil {
+		return "", err
+	}
+	node, ok := nodes[nodeCfg.Name].(*nodetypes.LxdNode)
+	if !ok {
+		return "", fmt.Errorf("node %s is not an lxd node", nodeCfg.Name)
+	}
+	platforms := platformManagers(dockerWrapper, lxdWrapper, NetnsWrapper(cfg))
+	formatter := formatters.NewStandardFormatter()
+
+	setup := internal.NewTestController(cfg.Suite, platforms, nodes, cfg.Nodes, cfg.Setup, nil, nil,
+		verbose, false, true, false, true, false, "", "exit", formatter)
+	setup.SetVars(cfg.Vars)
+	defer setup.Close()
+	if err := setup.Run(); err != nil {
+		return "", err
+	}
+
+	publishErr := node.PublishGolden(name, snapshot)
+	if publishErr != nil {
+		formatter.PrintError(publishErr)
+	}
+	teardown := internal.NewTestController(cfg.Suite, platforms, nodes, cfg.Nodes, nil, nil, nil,
+		verbose, false, false, false, false, true, "", "exit", formatter)
+	teardownErr := teardown.Run()
+	if publishErr != nil {
+		return "", fmt.Errorf("publishing golden %s: %w", name, publishErr)
+	}
+	return name, teardownErr
+}
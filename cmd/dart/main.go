@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"sort"
 	"strings"
 
 	"github.com/bgrewell/dart/internal"
@@ -15,7 +16,9 @@ import (
 	"github.com/bgrewell/dart/internal/formatters"
 	"github.com/bgrewell/dart/internal/logger"
 	"github.com/bgrewell/dart/internal/lxd"
+	"github.com/bgrewell/dart/internal/netns"
 	"github.com/bgrewell/dart/internal/report"
+	"github.com/bgrewell/dart/internal/runlabel"
 	"github.com/bgrewell/dart/internal/stream"
 	"github.com/bgrewell/dart/pkg/ifaces"
 	"github.com/bgrewell/dart/pkg/nodetypes"
@@ -54,6 +57,7 @@ type CmdlineFlags struct {
 	Only          *string
 	SkipTags      *string
 	Color         *string
+	RunID         *string
 }
 
 type ControllerParams struct {
@@ -62,6 +66,7 @@ type ControllerParams struct {
 	Nodes         map[string]ifaces.Node
 	DockerWrapper *docker.Wrapper `optional:"true"`
 	LxdWrapper    *lxd.Wrapper    `optional:"true"`
+	NetnsWrapper  *netns.Wrapper  `optional:"true"`
 	Formatter     formatters.Formatter
 	Flags         *CmdlineFlags
 }
@@ -84,6 +89,20 @@ func Configuration(cmdFlags *CmdlineFlags) (*config.Configuration, error) {
 	if err != nil {
 		return nil, err
 	}
+	// A fresh run ID would name objects the earlier run never created, so
+	// tearing down needs the ID of the run that set them up
+	if *cmdFlags.TeardownOnly && *cmdFlags.RunID == "" && nodetypes.CreatesRunScopedObjects(cfg) {
+		return nil, fmt.Errorf("--teardown-only needs the --run-id of the run to tear down; --setup-only prints it, and `dart gc` finds runs whose ID is lost")
+	}
+	// Everything the run creates from here on is named and labelled with it
+	if _, err := runlabel.Start(cfg.Suite, *cmdFlags.RunID); err != nil {
+		return nil, err
+	}
+	// The environment is left up for a later --teardown-only, so gc must
+	// not take the exited process for a crashed one
+	if *cmdFlags.SetupOnly && !*cmdFlags.TeardownOnly {
+		runlabel.Keep()
+	}
 	return cfg, nil
 }
 
@@ -182,15 +201,32 @@ func LxdWrapper(cfg *config.Configuration) (*lxd.Wrapper, error) {
 	return lw, nil
 }
 
-func Controller(params ControllerParams) (ctrl *internal.TestController, err error) {
-	// Build the list of platform managers
+func NetnsWrapper(cfg *config.Configuration) *netns.Wrapper {
+	// Only create the netns wrapper if the suite declares bridges
+	if cfg.Netns == nil {
+		return nil
+	}
+	return netns.NewWrapper(cfg.Netns)
+}
+
+// platformManagers lists the wrappers the suite uses as the controller's
+// platform managers.
+func platformManagers(dockerWrapper *docker.Wrapper, lxdWrapper *lxd.Wrapper, netnsWrapper *netns.Wrapper) []ifaces.PlatformManager {
 	var platforms []ifaces.PlatformManager
-	if params.DockerWrapper != nil {
-		platforms = append(platforms, params.DockerWrapper)
+	if dockerWrapper != nil {
+		platforms = append(platforms, dockerWrapper)
 	}
-	if params.LxdWrapper != nil {
-		platforms = append(platforms, params.LxdWrapper)
+	if lxdWrapper != nil {
+		platforms = append(platforms, lxdWrapper)
 	}
+	if netnsWrapper != nil {
+		platforms = append(platforms, netnsWrapper)
+	}
+	return platforms
+}
+
+func Controller(params ControllerParams) (ctrl *internal.TestController, err error) {
+	platforms := platformManagers(params.DockerWrapper, params.LxdWrapper, params.NetnsWrapper)
 
 	// Create the test controller with raw configs; steps/tests are created
 	// inside Run() after nodes are set up and facts are gathered.
@@ -227,6 +263,7 @@ func Controller(params ControllerParams) (ctrl *internal.TestController, err err
 		return nil, err
 	}
 	controller.SetTagFilters(onlyTags, skipTags)
+	controller.SetVars(params.Cfg.Vars)
 	return controller, nil
 }
 
@@ -271,6 +308,12 @@ func RegisterHooks(params RunParams) {
 				fmt.Fprintf(os.Stderr, "\n%s %s\n\n", errorStyle.Sprint("Error:"), lastErr)
 				return params.Shutdowner.Shutdown(fx.ExitCode(1))
 			}
+			if *params.Flags.SetupOnly && !*params.Flags.TeardownOnly {
+				// The environment is named after the run, so removing it
+				// later needs the ID
+				id := runlabel.Current().ID
+				fmt.Printf("\nRun ID: %s (remove with: dart -c %s --teardown-only --run-id %s)\n", id, *params.Flags.ConfigFile, id)
+			}
 			return params.Shutdowner.Shutdown()
 		},
 		OnStop: func(context context.Context) error {
@@ -286,6 +329,15 @@ func RegisterHooks(params RunParams) {
 
 func main() {
 
+	// The usage library has no subcommands, so gc and golden are
+	// dispatched before it sees the arguments
+	if len(os.Args) > 1 && os.Args[1] == "gc" {
+		os.Exit(runGC(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "golden" {
+		os.Exit(runGolden(os.Args[2:]))
+	}
+
 	u := usage.NewUsage(
 		usage.WithApplicationName("dart"),
 		usage.WithApplicationVersion(version),
@@ -314,6 +366,7 @@ func main() {
 	cfgFlags.Only = u.AddStringOption("o", "only", "", "Run only tests carrying one of these tags: tag=name[,name...]", "", nil)
 	cfgFlags.SkipTags = u.AddStringOption("sk", "skip", "", "Exclude tests carrying any of these tags: tag=name[,name...]", "", nil)
 	cfgFlags.Color = u.AddStringOption("co", "color", "auto", "Colorize output: auto (a terminal), always, or never", "", nil)
+	cfgFlags.RunID = u.AddStringOption("rid", "run-id", "", "Name this run's containers, networks, instances, profiles and projects after this ID (default: generated)", "", nil)
 
 	// DART declares no positional arguments, and the usage library indexes
 	// its (empty) argument list for every leftover it finds — so a stray
@@ -327,7 +380,7 @@ func main() {
 		if strings.HasSuffix(extra[0], ".yaml") || strings.HasSuffix(extra[0], ".yml") {
 			fmt.Fprintf(os.Stderr, "\nThe suite file goes after -c:\n    dart -c %s\n\n", extra[0])
 		} else {
-			fmt.Fprintf(os.Stderr, "\ndart takes options only; see dart --help.\n\n")
+			fmt.Fprintf(os.Stderr, "\ndart takes options only, apart from the gc and golden subcommands; see dart --help.\n\n")
 		}
 		os.Exit(2)
 	}
@@ -366,6 +419,12 @@ func main() {
 		fmt.Fprintf(os.Stderr, "\n%s until-behavior must be \"exit\" or \"pause\" (got %q)\n\n", errorStyle.Sprint("Error:"), *cfgFlags.UntilBehavior)
 		os.Exit(1)
 	}
+	if *cfgFlags.RunID != "" {
+		if err := runlabel.ValidateID(*cfgFlags.RunID); err != nil {
+			fmt.Fprintf(os.Stderr, "\n%s %s\n\n", errorStyle.Sprint("Error:"), err)
+			os.Exit(1)
+		}
+	}
 
 	if *cfgFlags.Version {
 		fmt.Printf("dart %s (%s, branch %s, built %s)\n", version, rev, branch, date)
@@ -392,6 +451,7 @@ func main() {
 			Nodes,
 			DockerWrapper,
 			LxdWrapper,
+			NetnsWrapper,
 			Configuration,
 			Formatter,
 			Controller,
@@ -460,8 +520,23 @@ func runCheck(cfgPath, reportValue, varsValue, onlyValue, skipValue string) int
 
 	// Constraints across the whole node list — duplicate names, more than
 	// one local node — are the same ones a real run enforces
+	if err := netns.ValidateConfig(cfg.Netns); err != nil {
+		fmt.Fprintf(os.Stderr, "\n%s %s\n\n", errorStyle.Sprint("Error:"), err)
+		return 1
+	}
+	if err := docker.ValidateConfig(cfg.Docker); err != nil {
+		fmt.Fprintf(os.Stderr, "\n%s %s\n\n", errorStyle.Sprint("Error:"), err)
+		return 1
+	}
+	if err := lxd.ValidateConfig(cfg.Lxd); err != nil {
+		fmt.Fprintf(os.Stderr, "\n%s %s\n\n", errorStyle.Sprint("Error:"), err)
+		return 1
+	}
 	if err := nodetypes.ValidateNodeSet(cfg.Nodes, nodetypes.NodeSetOptions{
 		HasLxdPlatform: cfg.Lxd != nil,
+		NetnsBridges:   netns.BridgeNames(cfg.Netns),
+		LxdVolumes:     lxd.DeclaredVolumes(cfg.Lxd),
+		LxdProject:     lxd.DeclaredProject(cfg.Lxd),
 	}); err != nil {
 		var cfgErr *config.ConfigError
 		if errors.As(err, &cfgErr) {
@@ -522,6 +597,17 @@ func runCheck(cfgPath, reportValue, varsValue, onlyValue, skipValue string) int
 	for _, node := range cfg.Nodes {
 		fmt.Printf("  - %s (%s)\n", node.Name, node.Type)
 	}
+	if len(cfg.Selectors) > 0 {
+		fmt.Printf("Selectors: %d\n", len(cfg.Selectors))
+		selectors := make([]string, 0, len(cfg.Selectors))
+		for selector := range cfg.Selectors {
+			selectors = append(selectors, selector)
+		}
+		sort.Strings(selectors)
+		for _, selector := range selectors {
+			fmt.Printf("  - %s -> %s\n", selector, strings.Join(cfg.Selectors[selector], ", "))
+		}
+	}
 	fmt.Printf("Setup steps: %d, Tests: %d, Teardown steps: %d\n", len(setup), len(tests), len(teardown))
 	fmt.Println("Configuration valid.")
 	return 0
@@ -12,27 +12,66 @@ import (
 	"strings"
 )
 
-// NodeReference can be either a single node name (string) or multiple node names ([]string)
+// NodeReference can be either a single node name (string) or multiple node names ([]string).
+// An entry starting with "@" is a label selector, resolved to the matching
+// nodes when the configuration is parsed (see resolveSelectors).
 type NodeReference []string
 
 // UnmarshalYAML implements custom unmarshaling for NodeReference
-// It accepts either a single string or an array of strings
+// It accepts a single string, a {selector: "..."} mapping, or an array of
+// either
 func (n *NodeReference) UnmarshalYAML(value *yaml.Node) error {
-	// Try unmarshaling as a string first
-	var single string
-	if err := value.Decode(&single); err == nil {
-		*n = NodeReference{single}
+	switch value.Kind {
+	case yaml.ScalarNode, yaml.MappingNode:
+		entry, err := decodeNodeReferenceEntry(value)
+		if err != nil {
+			return err
+		}
+		*n = NodeReference{entry}
 		return nil
-	}
-
-	// Try unmarshaling as an array of strings
-	var multiple []string
-	if err := value.Decode(&multiple); err == nil {
-		*n = NodeReference(multiple)
+	case yaml.SequenceNode:
+		refs := make(NodeReference, 0, len(value.Content))
+		for _, item := range value.Content {
+			entry, err := decodeNodeReferenceEntry(item)
+			if err != nil {
+				return err
+			}
+			refs = append(refs, entry)
+		}
+		*n = refs
 		return nil
 	}
 
-	return fmt.Errorf("node must be a string or array of strings")
+	return fmt.Errorf("node must be a string, a selector, or an array of them")
+}
+
+// decodeNodeReferenceEntry reads one node name or selector. The mapping
+// form is stored in the "@" form, so the rest of the parser handles one
+// spelling.
+func decodeNodeReferenceEntry(value *yaml.Node) (string, error) {
+	switch value.Kind {
+	case yaml.ScalarNode:
+		var name string
+		if err := value.Decode(&name); err != nil {
+			return "", err
+		}
+		return name, nil
+	case yaml.MappingNode:
+		var sel struct {
+			Selector string `yaml:"selector"`
+		}
+		if len(value.Content) != 2 || value.Content[0].Value != "selector" {
+			return "", fmt.Errorf("a node mapping takes exactly one key, selector")
+		}
+		if err := value.Decode(&sel); err != nil {
+			return "", err
+		}
+		if strings.TrimSpace(sel.Selector) == "" {
+			return "", fmt.Errorf("selector must not be empty")
+		}
+		return SelectorPrefix + sel.Selector, nil
+	}
+	return "", fmt.Errorf("node must be a string, a selector, or an array of them")
 }
 
 // MarshalYAML implements custom marshaling for NodeReference
@@ -47,14 +86,23 @@ func (n NodeReference) MarshalYAML() (interface{}, error) {
 // Configuration is the top-level configuration for the test suite
 type Configuration struct {
 	Suite    string            `json:"suite" yaml:"suite"`
-	Vars     map[string]string `json:"vars" yaml:"vars"`
+	Vars     map[string]string `json:"vars" yaml:"vars"` // Resolved values, --vars overrides included
 	Docker   *DockerConfig     `json:"docker" yaml:"docker"`
 	Lxd      *LxdConfig        `json:"lxd" yaml:"lxd"`
+	Netns    *NetnsConfig      `json:"netns" yaml:"netns"`
 	Setup    []*StepConfig     `json:"setup" yaml:"setup"`
 	Teardown []*StepConfig     `json:"teardown" yaml:"teardown"`
 	Nodes    []*NodeConfig     `json:"nodes" yaml:"nodes"`
 	Tests    []*TestConfig     `json:"tests" yaml:"tests"`
 
+	// Groups maps each replica group to its nodes' names, in index order.
+	// Steps and tests name a group to address every replica.
+	Groups map[string][]string `json:"-" yaml:"-"`
+
+	// Selectors maps each label selector used in a node reference, in its
+	// "@" form, to the nodes it resolved to, for --check to show.
+	Selectors map[string][]string `json:"-" yaml:"-"`
+
 	// SuiteDir is the directory holding the suite file. Every local path a
 	// suite writes resolves against it (see ResolveLocalPath), so a suite
 	// behaves the same regardless of where DART is invoked from. It is
@@ -64,8 +112,14 @@ type Configuration struct {
 
 // DockerConfig is the configuration for Docker
 type DockerConfig struct {
+	// Socket is the Unix socket of a Docker-compatible API (Docker or
+	// Podman). Empty means DOCKER_HOST, then auto-detection.
+	Socket   string           `json:"socket" yaml:"socket"`
 	Networks []*NetworkConfig `json:"networks" yaml:"networks"`
 	Images   []*ImageConfig   `json:"images" yaml:"images"`
+	// SubnetPool is an IPv4 range that networks without a subnet are
+	// given a /24 from. Empty leaves them to the daemon's own pools.
+	SubnetPool string `json:"subnet_pool" yaml:"subnet_pool"`
 }
 
 // LxdConfig is the configuration for LXD
@@ -75,6 +129,14 @@ type LxdConfig struct {
 	Networks []*LxdNetworkConfig `json:"networks" yaml:"networks"`
 	Profiles []*LxdProfileConfig `json:"profiles" yaml:"profiles"`
 	Images   []*LxdImageConfig   `json:"images" yaml:"images"`
+	// Storage pools the suite creates, and custom volumes nodes attach
+	StoragePools []*LxdStoragePoolConfig `json:"storage_pools" yaml:"storage_pools"`
+	Volumes      []*LxdVolumeConfig      `json:"volumes" yaml:"volumes"`
+	// Network ACLs the suite creates, for networks and NICs to apply
+	Acls []*LxdAclConfig `json:"acls" yaml:"acls"`
+	// SubnetPool is an IPv4 range that networks without a subnet are
+	// given a /24 from. Empty means 10.201.0.0/16.
+	SubnetPool string `json:"subnet_pool" yaml:"subnet_pool"`
 }
 
 // StepConfig is the configuration for a single setup/teardown step
@@ -107,8 +169,18 @@ type NodeConfig struct {
 	Type    string                 `json:"type" yaml:"type"`
 	Options map[string]interface{} `json:"options" yaml:"options"`
 	Facts   map[string]string      `json:"facts,omitempty" yaml:"facts,omitempty"`
-	Loc     SourceLocation         `json:"-" yaml:"-"`
-	TypeLoc SourceLocation         `json:"-" yaml:"-"`
+	// Count declares that many replicas of the node. The name must then be
+	// a template such as "worker-{{ .index }}", and string options may use
+	// .index (1-based), .count, and add/sub/mul.
+	Count int `json:"count,omitempty" yaml:"count,omitempty"`
+	// Group names the replicas collectively for steps and tests. It
+	// defaults to the name template's base, pluralised (see GroupName).
+	Group string `json:"group,omitempty" yaml:"group,omitempty"`
+	// Labels are matched by selectors in a step's or test's node, such
+	// as "@role=web". Replicas copy their template's labels.
+	Labels  map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
+	Loc     SourceLocation    `json:"-" yaml:"-"`
+	TypeLoc SourceLocation    `json:"-" yaml:"-"`
 	// SuiteDir carries the suite file's directory to node construction, so
 	// local paths in options resolve against it rather than the working
 	// directory.
@@ -158,6 +230,27 @@ type NetworkConfig struct {
 	Name    string `json:"name" yaml:"name"`
 	Subnet  string `json:"subnet" yaml:"subnet"`
 	Gateway string `json:"gateway" yaml:"gateway"`
+	// Subnets declares further IPAM pools, such as an IPv6 subnet beside
+	// the IPv4 one in Subnet.
+	Subnets []*SubnetConfig `json:"subnets" yaml:"subnets"`
+	// IPv6 enables IPv6 on the network. An IPv6 subnet enables it too;
+	// without one the daemon allocates from its default IPv6 pools.
+	IPv6 bool `json:"ipv6" yaml:"ipv6"`
+	// Internal networks have no route out: containers reach each other
+	// but nothing beyond the network.
+	Internal bool `json:"internal" yaml:"internal"`
+	// Driver is "bridge" (the default), "macvlan", or "ipvlan".
+	Driver     string            `json:"driver" yaml:"driver"`
+	DriverOpts map[string]string `json:"driver_opts" yaml:"driver_opts"` // e.g. parent: eth0
+}
+
+// SubnetConfig is one IPAM pool of a network
+type SubnetConfig struct {
+	Subnet  string `json:"subnet" yaml:"subnet"`
+	Gateway string `json:"gateway" yaml:"gateway"`
+	// IPRange limits dynamic allocation to part of the subnet, leaving
+	// the rest for static addresses.
+	IPRange string `json:"ip_range" yaml:"ip_range"`
 }
 
 // ImageConfig is the configuration for a single image
@@ -165,6 +258,14 @@ type ImageConfig struct {
 	Name       string `json:"name" yaml:"name"`
 	Tag        string `json:"tag" yaml:"tag"`
 	Dockerfile string `json:"dockerfile" yaml:"dockerfile"`
+	// Context is the build context directory. It defaults to the
+	// Dockerfile's directory.
+	Context string            `json:"context" yaml:"context"`
+	Args    map[string]string `json:"args" yaml:"args"`     // --build-arg values
+	Target  string            `json:"target" yaml:"target"` // stage of a multi-stage build
+	Labels  map[string]string `json:"labels" yaml:"labels"` // labels set on the image
+	// Platform builds for another platform, such as "linux/arm64".
+	Platform string `json:"platform" yaml:"platform"`
 }
 
 // SudoConfig is the configuration for sudo abilities on a node
@@ -174,16 +275,62 @@ type SudoConfig struct {
 	VaultSecret string `json:"vault_secret" yaml:"vault_secret"`
 }
 
+// NetnsConfig declares the host bridges that netns nodes attach to
+type NetnsConfig struct {
+	Bridges []*NetnsBridgeConfig `json:"bridges" yaml:"bridges"`
+	// Sudo runs the host-side ip commands through `sudo -n` for a DART
+	// that is not itself running as root.
+	Sudo bool `json:"sudo" yaml:"sudo"`
+}
+
+// NetnsBridgeConfig is a Linux bridge created on the host for the run
+type NetnsBridgeConfig struct {
+	Name string `json:"name" yaml:"name"`
+	// Address is assigned to the bridge in CIDR form (10.10.0.1/24), making
+	// the host reachable from the namespaces as their gateway. Optional.
+	Address string `json:"address" yaml:"address"`
+}
+
 // LxdNetworkConfig is the configuration for an LXD network
 type LxdNetworkConfig struct {
 	Name    string `json:"name" yaml:"name"`
-	Type    string `json:"type" yaml:"type"` // "bridge", "ovn", etc.
+	Type    string `json:"type" yaml:"type"` // "bridge" (default) or "ovn"
 	Subnet  string `json:"subnet" yaml:"subnet"`
 	Gateway string `json:"gateway" yaml:"gateway"`
 	// Nat controls ipv4.nat on the bridge. Defaults to true when omitted;
 	// set to false for air-gapped networks where instances must not reach
 	// the internet from the moment they boot.
 	Nat *bool `json:"nat,omitempty" yaml:"nat,omitempty"`
+	// Uplink is the network an OVN network routes out through: a bridge
+	// the suite declares, or an existing uplink such as lxdbr0
+	Uplink string `json:"uplink" yaml:"uplink"`
+	// Acls are applied to every NIC on the network
+	Acls   []string          `json:"acls" yaml:"acls"`
+	Config map[string]string `json:"config" yaml:"config"` // Further network keys, e.g. ipv4.ovn.ranges
+}
+
+// LxdAclConfig is the configuration for an LXD network ACL
+type LxdAclConfig struct {
+	Name        string              `json:"name" yaml:"name"`
+	Description string              `json:"description" yaml:"description"`
+	Ingress     []*LxdAclRuleConfig `json:"ingress" yaml:"ingress"`
+	Egress      []*LxdAclRuleConfig `json:"egress" yaml:"egress"`
+}
+
+// LxdAclRuleConfig is one ingress or egress rule of a network ACL. Source
+// and destination are comma-separated lists of addresses, ranges, ACL
+// names and the @internal and @external selectors.
+type LxdAclRuleConfig struct {
+	Action          string `json:"action" yaml:"action"` // "allow", "allow-stateless", "drop" or "reject"
+	Source          string `json:"source" yaml:"source"`
+	Destination     string `json:"destination" yaml:"destination"`
+	Protocol        string `json:"protocol" yaml:"protocol"` // "tcp", "udp", "icmp4" or "icmp6"; empty matches any
+	SourcePort      string `json:"source_port" yaml:"source_port"`
+	DestinationPort string `json:"destination_port" yaml:"destination_port"`
+	IcmpType        string `json:"icmp_type" yaml:"icmp_type"`
+	IcmpCode        string `json:"icmp_code" yaml:"icmp_code"`
+	Description     string `json:"description" yaml:"description"`
+	State           string `json:"state" yaml:"state"` // "enabled" (default), "disabled" or "logged"
 }
 
 // LxdProfileConfig is the configuration for an LXD profile
@@ -203,6 +350,28 @@ type LxdDeviceConfig struct {
 	Opts map[string]string `json:"opts,omitempty" yaml:"opts,omitempty"`
 }
 
+// LxdStoragePoolConfig is the configuration for an LXD storage pool
+type LxdStoragePoolConfig struct {
+	Name        string            `json:"name" yaml:"name"`
+	Driver      string            `json:"driver" yaml:"driver"` // "dir", "zfs", "btrfs", "lvm", ...
+	Description string            `json:"description" yaml:"description"`
+	Config      map[string]string `json:"config" yaml:"config"` // Driver keys, e.g. size for a loop-backed pool
+}
+
+// LxdVolumeConfig is the configuration for an LXD custom storage volume
+type LxdVolumeConfig struct {
+	Name string `json:"name" yaml:"name"`
+	// Pool is a storage_pools entry or an existing pool such as default
+	Pool        string `json:"pool" yaml:"pool"`
+	Description string `json:"description" yaml:"description"`
+	Size        string `json:"size" yaml:"size"`                 // e.g. 1GiB; the volume's size config key
+	ContentType string `json:"content_type" yaml:"content_type"` // "filesystem" (default) or "block"
+	// Source is a tarball made by `lxc storage volume export` that the
+	// volume is created from; empty creates an empty volume
+	Source string            `json:"source" yaml:"source"`
+	Config map[string]string `json:"config" yaml:"config"`
+}
+
 // LxdImageConfig is the configuration for an LXD image
 type LxdImageConfig struct {
 	Alias    string `json:"alias" yaml:"alias"`
@@ -279,7 +448,7 @@ func ParseConfigurationWithVars(data []byte, location string, cliVars map[string
 	}
 	data = processed
 
-	data, err = substituteVars(data, cliVars)
+	data, vars, err := substituteVars(data, cliVars)
 	if err != nil {
 		return nil, err
 	}
@@ -289,6 +458,7 @@ func ParseConfigurationWithVars(data []byte, location string, cliVars map[string
 	if err != nil {
 		return nil, err
 	}
+	config.Vars = vars
 
 	// Extract line numbers before expansion (indices match 1:1 with YAML
 	// sequences). Skipped when load_from inlined other files: the processed
@@ -298,6 +468,34 @@ func ParseConfigurationWithVars(data []byte, location string, cliVars map[string
 		extractLocations(data, filePath[0], config)
 	}
 
+	// Replicas are expanded before validation, so a replica whose name
+	// collides with a hand-written node is caught like any duplicate
+	config.Nodes, config.Groups, err = expandNodeReplicas(config.Nodes)
+	if err != nil {
+		return nil, err
+	}
+	// Labels are checked before selectors resolve against them
+	if err := validateLabels(config.Nodes); err != nil {
+		return nil, err
+	}
+	config.Selectors = map[string][]string{}
+	resolve := func(ref NodeReference, loc SourceLocation) (NodeReference, error) {
+		ref = expandGroupReferences(ref, config.Groups)
+		return resolveSelectors(ref, config.Nodes, config.Selectors, loc)
+	}
+	for _, steps := range [][]*StepConfig{config.Setup, config.Teardown} {
+		for _, step := range steps {
+			if step.Node, err = resolve(step.Node, step.NodeLoc); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, test := range config.Tests {
+		if test.Node, err = resolve(test.Node, test.NodeLoc); err != nil {
+			return nil, err
+		}
+	}
+
 	if err := validateConfiguration(config); err != nil {
 		return nil, err
 	}
@@ -325,16 +523,34 @@ func ParseConfigurationWithVars(data []byte, location string, cliVars map[string
 		node.SuiteDir = location
 	}
 
+	if config.Lxd != nil {
+		for _, volume := range config.Lxd.Volumes {
+			if volume.Source != "" {
+				resolved, err := ResolveLocalPath(location, volume.Source)
+				if err != nil {
+					return nil, err
+				}
+				volume.Source = resolved
+			}
+		}
+	}
+
 	if config.Docker != nil {
 		for _, image := range config.Docker.Images {
-			if image.Dockerfile == "" {
-				continue
+			if image.Dockerfile != "" {
+				resolved, err := ResolveLocalPath(location, image.Dockerfile)
+				if err != nil {
+					return nil, err
+				}
+				image.Dockerfile = resolved
 			}
-			resolved, err := ResolveLocalPath(location, image.Dockerfile)
-			if err != nil {
-				return nil, err
+			if image.Context != "" {
+				resolved, err := ResolveLocalPath(location, image.Context)
+				if err != nil {
+					return nil, err
+				}
+				image.Context = resolved
 			}
-			image.Dockerfile = resolved
 		}
 	}
 
@@ -361,7 +577,10 @@ const yamlRiskyChars = "#:\"'{}[]&*!|>%@`,"
 //   - a value containing YAML-significant characters may only substitute
 //     into a quoted position — unquoted, a '#' would silently truncate the
 //     line and a ':' would corrupt the mapping
-func substituteVars(data []byte, cliVars map[string]string) ([]byte, error) {
+//
+// The resolved vars are returned too, for text DART reads outside the suite
+// file; see ExpandVars.
+func substituteVars(data []byte, cliVars map[string]string) ([]byte, map[string]string, error) {
 	// The vars block is read pre-substitution; CLI overrides win. A failed
 	// head parse must not be swallowed: distinguish a broken document
 	// (report the real YAML error) from a malformed vars block.
@@ -371,9 +590,9 @@ func substituteVars(data []byte, cliVars map[string]string) ([]byte, error) {
 	if err := yaml.Unmarshal(data, &head); err != nil {
 		var generic map[string]interface{}
 		if gerr := yaml.Unmarshal(data, &generic); gerr != nil {
-			return nil, gerr
+			return nil, nil, gerr
 		}
-		return nil, fmt.Errorf("vars block is invalid: %w (quote values that contain {{...}} references)", err)
+		return nil, nil, fmt.Errorf("vars block is invalid: %w (quote values that contain {{...}} references)", err)
 	}
 	vars := make(map[string]string, len(head.Vars)+len(cliVars))
 	for k, v := range head.Vars {
@@ -408,7 +627,7 @@ func substituteVars(data []byte, cliVars map[string]string) ([]byte, error) {
 	// iteration turns definition cycles into errors instead of hangs.
 	for round := 0; ; round++ {
 		if round >= 10 {
-			return nil, fmt.Errorf("var definitions reference each other too deeply or circularly")
+			return nil, nil, fmt.Errorf("var definitions reference each other too deeply or circularly")
 		}
 		changed := false
 		for name, value := range vars {
@@ -424,16 +643,16 @@ func substituteVars(data []byte, cliVars map[string]string) ([]byte, error) {
 	if len(missing) > 0 {
 		slices.Sort(missing)
 		missing = slices.Compact(missing)
-		return nil, fmt.Errorf("unresolved references in var values: %s", strings.Join(missing, ", "))
+		return nil, nil, fmt.Errorf("unresolved references in var values: %s", strings.Join(missing, ", "))
 	}
 	for name, value := range vars {
 		if strings.ContainsAny(value, "\n\r") {
-			return nil, fmt.Errorf("var %q contains a newline; variable values must be single-line", name)
+			return nil, nil, fmt.Errorf("var %q contains a newline; variable values must be single-line", name)
 		}
 		// A cycle converges to a self-referential fixed point rather than
 		// iterating forever — any ref still present after resolution is one
 		if varRefRe.MatchString(value) {
-			return nil, fmt.Errorf("var %q could not be fully resolved (circular or self-referential definition)", name)
+			return nil, nil, fmt.Errorf("var %q could not be fully resolved (circular or self-referential definition)", name)
 		}
 	}
 
@@ -441,7 +660,7 @@ func substituteVars(data []byte, cliVars map[string]string) ([]byte, error) {
 	// comments and to reject risky values in unquoted positions.
 	matches := varRefRe.FindAllSubmatchIndex(data, -1)
 	if len(matches) == 0 && len(missing) == 0 {
-		return data, nil
+		return data, vars, nil
 	}
 	var out bytes.Buffer
 	last := 0
@@ -470,10 +689,10 @@ func substituteVars(data []byte, cliVars map[string]string) ([]byte, error) {
 			continue
 		}
 		if strings.ContainsAny(value, "\n\r") {
-			return nil, fmt.Errorf("%s.%s value contains a newline; variable values must be single-line", kind, name)
+			return nil, nil, fmt.Errorf("%s.%s value contains a newline; variable values must be single-line", kind, name)
 		}
 		if strings.ContainsAny(value, yamlRiskyChars) && !inQuotedContext(linePrefix) {
-			return nil, fmt.Errorf("%s.%s value %q contains YAML-significant characters; quote the reference (e.g. \"{{%s.%s}}\")", kind, name, value, kind, name)
+			return nil, nil, fmt.Errorf("%s.%s value %q contains YAML-significant characters; quote the reference (e.g. \"{{%s.%s}}\")", kind, name, value, kind, name)
 		}
 
 		out.Write(data[last:start])
@@ -485,9 +704,40 @@ func substituteVars(data []byte, cliVars map[string]string) ([]byte, error) {
 	if len(missing) > 0 {
 		slices.Sort(missing)
 		missing = slices.Compact(missing)
-		return nil, fmt.Errorf("unresolved references: %s (define in the vars block, pass --vars, or set the environment variable)", strings.Join(missing, ", "))
+		return nil, nil, fmt.Errorf("unresolved references: %s (define in the vars block, pass --vars, or set the environment variable)", strings.Join(missing, ", "))
 	}
-	return out.Bytes(), nil
+	return out.Bytes(), vars, nil
+}
+
+// ExpandVars replaces {{var.name}} and {{env.NAME}} references in text
+// DART reads from outside the suite file, such as a cloud-init user-data
+// file, using the resolved vars of a loaded suite. Unlike the suite file,
+// the text is not YAML that a value could restructure, so no quoting rules
+// apply; an unresolved reference is still an error.
+func ExpandVars(text string, vars map[string]string) (string, error) {
+	var missing []string
+	expanded := varRefRe.ReplaceAllStringFunc(text, func(ref string) string {
+		m := varRefRe.FindStringSubmatch(ref)
+		kind, name := m[1], m[2]
+		var value string
+		var ok bool
+		if kind == "var" {
+			value, ok = vars[name]
+		} else {
+			value, ok = os.LookupEnv(name)
+		}
+		if !ok {
+			missing = append(missing, kind+"."+name)
+			return ref
+		}
+		return value
+	})
+	if len(missing) > 0 {
+		slices.Sort(missing)
+		missing = slices.Compact(missing)
+		return "", fmt.Errorf("unresolved references: %s (define in the vars block, pass --vars, or set the environment variable)", strings.Join(missing, ", "))
+	}
+	return expanded, nil
 }
 
 // inYAMLComment reports whether the position after linePrefix sits in a
@@ -553,6 +803,14 @@ func validateConfiguration(cfg *Configuration) error {
 		}
 		seen[node.Name] = true
 	}
+	for group, members := range cfg.Groups {
+		if seen[group] {
+			return &ConfigError{
+				Message:  fmt.Sprintf("node group %q has the same name as a node; set group on the replicated node", group),
+				Location: nodeLocation(cfg.Nodes, members[0]),
+			}
+		}
+	}
 
 	for _, step := range cfg.Setup {
 		if len(step.Node) == 0 {
@@ -581,6 +839,16 @@ func validateConfiguration(cfg *Configuration) error {
 	return nil
 }
 
+// nodeLocation returns where the named node is declared.
+func nodeLocation(nodes []*NodeConfig, name string) SourceLocation {
+	for _, node := range nodes {
+		if node.Name == name {
+			return node.Loc
+		}
+	}
+	return SourceLocation{}
+}
+
 func processLoadFromDirectives(data []byte, location string) (processed []byte, fragments []string, err error) {
 	lines := strings.Split(string(data), "\n")
 	var outputLines []string
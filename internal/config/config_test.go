@@ -34,6 +34,23 @@ func TestNodeReference_UnmarshalYAML(t *testing.T) {
 			expected: NodeReference{"local"},
 			wantErr:  false,
 		},
+		{
+			name:     "selector mapping",
+			yaml:     "node: {selector: \"role=db,zone=a\"}",
+			expected: NodeReference{"@role=db,zone=a"},
+			wantErr:  false,
+		},
+		{
+			name:     "array mixing names and selectors",
+			yaml:     "node: [local, \"@role=web\", {selector: zone=b}]",
+			expected: NodeReference{"local", "@role=web", "@zone=b"},
+			wantErr:  false,
+		},
+		{
+			name:    "mapping without selector",
+			yaml:    "node: {name: local}",
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
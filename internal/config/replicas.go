@@ -0,0 +1,226 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// replicaFuncs are the functions a replica template may call, for deriving
+// per-replica values such as addresses and ports from the index.
+var replicaFuncs = template.FuncMap{
+	"add": func(a, b int) int { return a + b },
+	"sub": func(a, b int) int { return a - b },
+	"mul": func(a, b int) int { return a * b },
+}
+
+// templateAction matches a {{ ... }} action, for deriving a group name
+// from a name template.
+var templateAction = regexp.MustCompile(`\{\{.*?\}\}`)
+
+// replicaReference matches a use of .index or .count inside an action. An
+// option's action without one belongs to something else — a fact
+// reference, a jinja cloud-init template, a --format string — and is left
+// for it.
+var replicaReference = regexp.MustCompile(`(^|[^\w.)\]])\.(index|count)\b`)
+
+// replicaData is what a replica template sees: .index runs from 1 to
+// .count. A map rather than a struct, so a misspelt key is an error
+// instead of an empty value.
+type replicaData map[string]int
+
+// GroupName derives the group a node's replicas are addressed by: the
+// name template without its actions and the separators before them,
+// pluralised with an "s" — worker-{{ .index }} gives workers. An explicit
+// group wins.
+func GroupName(node *NodeConfig) string {
+	if node.Group != "" {
+		return node.Group
+	}
+	base := strings.TrimRight(templateAction.ReplaceAllString(node.Name, ""), "-_. ")
+	if base == "" || strings.HasSuffix(base, "s") {
+		return base
+	}
+	return base + "s"
+}
+
+// expandNodeReplicas replaces each node that sets count with its
+// replicas, rendering the name and the replica actions in its options per
+// replica, and
+// returns the replicas' names by group. A replica keeps its template's
+// source locations, so an error in one points at the block that made it.
+func expandNodeReplicas(nodes []*NodeConfig) ([]*NodeConfig, map[string][]string, error) {
+	expanded := make([]*NodeConfig, 0, len(nodes))
+	groups := map[string][]string{}
+
+	for _, node := range nodes {
+		templated := strings.Contains(node.Name, "{{")
+		switch {
+		case node.Count < 0:
+			return nil, nil, &ConfigError{Message: fmt.Sprintf("count must not be negative on node %q", node.Name), Location: node.Loc}
+		case node.Count == 0 && templated:
+			return nil, nil, &ConfigError{Message: fmt.Sprintf("node %q has a name template but no count", node.Name), Location: node.Loc}
+		case node.Count == 0 && node.Group != "":
+			return nil, nil, &ConfigError{Message: fmt.Sprintf("group is only meaningful with count, on node %q", node.Name), Location: node.Loc}
+		case node.Count == 0:
+			expanded = append(expanded, node)
+			continue
+		case !templated:
+			// Every replica would get the same name
+			return nil, nil, &ConfigError{
+				Message:  fmt.Sprintf("node %q sets count but its name has no template; use a name such as \"%s-{{ .index }}\"", node.Name, node.Name),
+				Location: node.Loc,
+			}
+		}
+
+		group := GroupName(node)
+		if group == "" {
+			return nil, nil, &ConfigError{Message: fmt.Sprintf("cannot derive a group name from %q; set group", node.Name), Location: node.Loc}
+		}
+		if _, exists := groups[group]; exists {
+			return nil, nil, &ConfigError{Message: fmt.Sprintf("duplicate node group %q", group), Location: node.Loc}
+		}
+
+		for index := 1; index <= node.Count; index++ {
+			data := replicaData{"index": index, "count": node.Count}
+			name, err := renderReplicaString(node.Name, data)
+			if err != nil {
+				return nil, nil, &ConfigError{Message: fmt.Sprintf("node name %q: %v", node.Name, err), Location: node.Loc}
+			}
+			options, err := renderReplicaValue(node.Options, data)
+			if err != nil {
+				return nil, nil, &ConfigError{Message: fmt.Sprintf("node %q options: %v", node.Name, err), Location: node.Loc}
+			}
+
+			replica := *node
+			replica.Name = name
+			replica.Count = 0
+			replica.Group = ""
+			replica.Options, _ = options.(map[string]interface{})
+			replica.Facts = cloneStringMap(node.Facts)
+			replica.Labels = cloneStringMap(node.Labels)
+			expanded = append(expanded, &replica)
+			groups[group] = append(groups[group], name)
+		}
+	}
+	return expanded, groups, nil
+}
+
+func renderReplicaString(text string, data replicaData) (string, error) {
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+	tmpl, err := template.New("replica").Funcs(replicaFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var out strings.Builder
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+// renderReplicaOption renders the actions in an option string that use
+// .index or .count, and copies every other action through as written.
+// Trim markers on a rendered action trim the text beside it, as they
+// would in a template.
+func renderReplicaOption(text string, data replicaData) (string, error) {
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+	var out strings.Builder
+	rest := 0
+	trimNext := false
+	for _, match := range templateAction.FindAllStringIndex(text, -1) {
+		action := text[match[0]:match[1]]
+		if !replicaReference.MatchString(action) {
+			continue
+		}
+		before := text[rest:match[0]]
+		if trimNext {
+			before = strings.TrimLeft(before, " \t\r\n")
+		}
+		if strings.HasPrefix(action, "{{- ") {
+			before = strings.TrimRight(before, " \t\r\n")
+		}
+		rendered, err := renderReplicaString(action, data)
+		if err != nil {
+			return "", err
+		}
+		out.WriteString(before)
+		out.WriteString(rendered)
+		rest = match[1]
+		trimNext = strings.HasSuffix(action, " -}}")
+	}
+	after := text[rest:]
+	if trimNext {
+		after = strings.TrimLeft(after, " \t\r\n")
+	}
+	out.WriteString(after)
+	return out.String(), nil
+}
+
+// renderReplicaValue copies an option value, rendering the replica
+// actions in every string in it, so replicas never share the template's
+// maps and slices.
+func renderReplicaValue(value interface{}, data replicaData) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		return renderReplicaOption(v, data)
+	case map[string]interface{}:
+		if v == nil {
+			return v, nil
+		}
+		out := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			rendered, err := renderReplicaValue(item, data)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", key, err)
+			}
+			out[key] = rendered
+		}
+		return out, nil
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			rendered, err := renderReplicaValue(item, data)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = rendered
+		}
+		return out, nil
+	default:
+		return value, nil
+	}
+}
+
+func cloneStringMap(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	out := make(map[string]string, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
+
+// expandGroupReferences replaces group names in a node reference with the
+// group's replicas, keeping the written order.
+func expandGroupReferences(ref NodeReference, groups map[string][]string) NodeReference {
+	if len(groups) == 0 {
+		return ref
+	}
+	expanded := make(NodeReference, 0, len(ref))
+	for _, name := range ref {
+		if members, ok := groups[name]; ok {
+			expanded = append(expanded, members...)
+			continue
+		}
+		expanded = append(expanded, name)
+	}
+	return expanded
+}
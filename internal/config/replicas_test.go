@@ -0,0 +1,139 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplicasExpandWithTemplatedOptions(t *testing.T) {
+	yamlData := `
+suite: replicas
+nodes:
+  - name: "worker-{{ .index }}"
+    type: docker
+    count: 3
+    options:
+      image: alpine
+      ip: 10.0.0.{{ add 10 .index }}
+      env:
+        ROLE: "worker {{ .index }} of {{ .count }}"
+  - name: controller
+    type: local
+tests:
+  - name: all workers answer
+    node: workers
+    type: execute
+    options:
+      command: hostname
+  - name: workers agree
+    node: [controller, workers]
+    type: consistency
+    options:
+      command: date +%Y
+`
+	cfg, err := ParseConfiguration([]byte(yamlData), ".")
+	require.NoError(t, err)
+
+	require.Len(t, cfg.Nodes, 4)
+	assert.Equal(t, "worker-1", cfg.Nodes[0].Name)
+	assert.Equal(t, "worker-3", cfg.Nodes[2].Name)
+	assert.Equal(t, "10.0.0.12", cfg.Nodes[1].Options["ip"])
+	assert.Equal(t, "worker 3 of 3", cfg.Nodes[2].Options["env"].(map[string]interface{})["ROLE"])
+	// Replicas do not share the template's maps
+	assert.Equal(t, "worker 1 of 3", cfg.Nodes[0].Options["env"].(map[string]interface{})["ROLE"])
+	assert.Equal(t, []string{"worker-1", "worker-2", "worker-3"}, cfg.Groups["workers"])
+
+	// A group expands like a node list: one test per replica, except for
+	// consistency, which keeps the whole list
+	require.Len(t, cfg.Tests, 4)
+	assert.Equal(t, NodeReference{"worker-2"}, cfg.Tests[1].Node)
+	assert.Equal(t, NodeReference{"controller", "worker-1", "worker-2", "worker-3"}, cfg.Tests[3].Node)
+}
+
+func TestReplicaOptionsKeepOtherTemplates(t *testing.T) {
+	yamlData := `
+suite: replicas
+nodes:
+  - name: db
+    type: lxd
+    options:
+      image: ubuntu:24.04
+  - name: "web-{{ .index }}"
+    type: lxd
+    count: 2
+    options:
+      image: ubuntu:24.04
+      config:
+        environment.DB_HOST: '{{ fact "db" "ipv4" }}'
+        user.status: "docker ps --format '{{.State}}'"
+        user.slot: "{{- .index -}} / {{ .count }}"
+      cloud_init:
+        user_data: |
+          ## template: jinja
+          #cloud-config
+          hostname: {{ v1.local_hostname }}-{{ .index }}
+          write_files:
+            - path: /etc/replica
+              content: "{{ ds.meta_data.count }} {{ .count }}"
+`
+	cfg, err := ParseConfiguration([]byte(yamlData), ".")
+	require.NoError(t, err)
+	require.Len(t, cfg.Nodes, 3)
+
+	web2 := cfg.Nodes[2].Options
+	instanceConfig := web2["config"].(map[string]interface{})
+	assert.Equal(t, `{{ fact "db" "ipv4" }}`, instanceConfig["environment.DB_HOST"], "a fact reference is left for setup")
+	assert.Equal(t, "docker ps --format '{{.State}}'", instanceConfig["user.status"])
+	assert.Equal(t, "2/ 2", instanceConfig["user.slot"])
+	assert.Equal(t, `## template: jinja
+#cloud-config
+hostname: {{ v1.local_hostname }}-2
+write_files:
+  - path: /etc/replica
+    content: "{{ ds.meta_data.count }} 2"
+`, web2["cloud_init"].(map[string]interface{})["user_data"], "jinja is left for cloud-init")
+}
+
+func TestReplicaGroupName(t *testing.T) {
+	assert.Equal(t, "workers", GroupName(&NodeConfig{Name: "worker-{{ .index }}"}))
+	assert.Equal(t, "nodes", GroupName(&NodeConfig{Name: "nodes_{{ .index }}"}))
+	assert.Equal(t, "pool", GroupName(&NodeConfig{Name: "db-{{ .index }}", Group: "pool"}))
+}
+
+func TestReplicaValidation(t *testing.T) {
+	cases := map[string]struct {
+		nodes string
+		want  string
+	}{
+		"count without template": {`
+  - name: worker
+    type: local
+    count: 2`, `node "worker" sets count but its name has no template`},
+		"template without count": {`
+  - name: "worker-{{ .index }}"
+    type: local`, "has a name template but no count"},
+		"unknown template key": {`
+  - name: "worker-{{ .idx }}"
+    type: local
+    count: 2`, `map has no entry for key "idx"`},
+		"group collides with node": {`
+  - name: workers
+    type: local
+  - name: "worker-{{ .index }}"
+    type: docker
+    count: 2`, `node group "workers" has the same name as a node`},
+		"replica collides with node": {`
+  - name: worker-2
+    type: local
+  - name: "worker-{{ .index }}"
+    type: docker
+    count: 2`, `duplicate node name "worker-2"`},
+	}
+	for name, tc := range cases {
+		_, err := ParseConfiguration([]byte("suite: replicas\nnodes:"+tc.nodes+"\n"), ".")
+		require.Error(t, err, name)
+		assert.Contains(t, err.Error(), tc.want, name)
+	}
+}
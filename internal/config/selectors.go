@@ -0,0 +1,152 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SelectorPrefix marks a node reference entry as a label selector rather
+// than a node name: "@role=web,zone=a".
+const SelectorPrefix = "@"
+
+// labelRequirement is one comma-separated term of a selector: key=value,
+// key!=value, or a bare key, which requires the label to be set.
+type labelRequirement struct {
+	key     string
+	value   string
+	negated bool
+	exists  bool
+}
+
+func (r labelRequirement) matches(labels map[string]string) bool {
+	value, ok := labels[r.key]
+	switch {
+	case r.exists:
+		return ok
+	case r.negated:
+		return !ok || value != r.value
+	default:
+		return ok && value == r.value
+	}
+}
+
+// IsSelector reports whether a node reference entry is a label selector.
+func IsSelector(entry string) bool {
+	return strings.HasPrefix(entry, SelectorPrefix)
+}
+
+// parseSelector splits a selector, without its "@", into requirements that
+// must all hold.
+func parseSelector(selector string) ([]labelRequirement, error) {
+	var reqs []labelRequirement
+	for _, term := range strings.Split(selector, ",") {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			return nil, fmt.Errorf("selector %q has an empty term", selector)
+		}
+		var req labelRequirement
+		if key, value, ok := strings.Cut(term, "!="); ok {
+			req = labelRequirement{key: strings.TrimSpace(key), value: strings.TrimSpace(value), negated: true}
+		} else if key, value, ok := strings.Cut(term, "="); ok {
+			req = labelRequirement{key: strings.TrimSpace(key), value: strings.TrimSpace(value)}
+		} else {
+			req = labelRequirement{key: term, exists: true}
+		}
+		if req.key == "" {
+			return nil, fmt.Errorf("selector %q has a term without a label key", selector)
+		}
+		reqs = append(reqs, req)
+	}
+	return reqs, nil
+}
+
+// resolveSelectors replaces each selector in a node reference with the
+// nodes whose labels match it, in declaration order, and records the
+// result in resolved. A node matched by more than one entry is kept once.
+// A selector that matches nothing is an error: a test that quietly runs
+// on no node would pass without testing anything.
+func resolveSelectors(ref NodeReference, nodes []*NodeConfig, resolved map[string][]string, loc SourceLocation) (NodeReference, error) {
+	if !hasSelector(ref) {
+		return ref, nil
+	}
+
+	expanded := make(NodeReference, 0, len(ref))
+	seen := map[string]bool{}
+	add := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			expanded = append(expanded, name)
+		}
+	}
+
+	for _, entry := range ref {
+		if !IsSelector(entry) {
+			add(entry)
+			continue
+		}
+		reqs, err := parseSelector(strings.TrimPrefix(entry, SelectorPrefix))
+		if err != nil {
+			return nil, &ConfigError{Message: err.Error(), Location: loc}
+		}
+		var matched []string
+		for _, node := range nodes {
+			if matchesAll(reqs, node.Labels) {
+				matched = append(matched, node.Name)
+			}
+		}
+		if len(matched) == 0 {
+			return nil, &ConfigError{Message: fmt.Sprintf("selector %q matches no node", entry), Location: loc}
+		}
+		resolved[entry] = matched
+		for _, name := range matched {
+			add(name)
+		}
+	}
+	return expanded, nil
+}
+
+func hasSelector(ref NodeReference) bool {
+	for _, entry := range ref {
+		if IsSelector(entry) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesAll(reqs []labelRequirement, labels map[string]string) bool {
+	for _, req := range reqs {
+		if !req.matches(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+// validateLabels rejects label keys and values a selector could not
+// express, and node names that would read as a selector.
+func validateLabels(nodes []*NodeConfig) error {
+	for _, node := range nodes {
+		if IsSelector(node.Name) {
+			return &ConfigError{
+				Message:  fmt.Sprintf("node name %q must not start with %q, which marks a label selector", node.Name, SelectorPrefix),
+				Location: node.Loc,
+			}
+		}
+		for key, value := range node.Labels {
+			if key == "" || strings.ContainsAny(key, "=!,@ \t") {
+				return &ConfigError{
+					Message:  fmt.Sprintf("node %q: label key %q must be non-empty and contain none of = ! , @ or spaces", node.Name, key),
+					Location: node.Loc,
+				}
+			}
+			if strings.Contains(value, ",") {
+				return &ConfigError{
+					Message:  fmt.Sprintf("node %q: label %s value %q must not contain a comma", node.Name, key, value),
+					Location: node.Loc,
+				}
+			}
+		}
+	}
+	return nil
+}
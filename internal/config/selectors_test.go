@@ -0,0 +1,125 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelectorsResolveToLabelledNodes(t *testing.T) {
+	yamlData := `
+suite: selectors
+nodes:
+  - name: web-1
+    type: local
+    labels: {role: web, zone: a}
+  - name: "db-{{ .index }}"
+    type: docker
+    count: 2
+    labels: {role: db, zone: a}
+    options:
+      image: postgres
+  - name: web-2
+    type: docker
+    labels: {role: web, zone: b}
+    options:
+      image: nginx
+setup:
+  - name: prepare databases
+    node: {selector: "role=db"}
+    step:
+      type: execute
+      options:
+        command: true
+tests:
+  - name: zone a answers
+    node: "@zone=a,role!=db"
+    type: execute
+    options:
+      command: hostname
+  - name: everyone agrees
+    node: ["@role=web", "@zone=a"]
+    type: consistency
+    options:
+      command: date +%Y
+`
+	cfg, err := ParseConfiguration([]byte(yamlData), ".")
+	require.NoError(t, err)
+
+	require.Len(t, cfg.Setup, 2)
+	assert.Equal(t, NodeReference{"db-1"}, cfg.Setup[0].Node)
+	assert.Equal(t, NodeReference{"db-2"}, cfg.Setup[1].Node)
+
+	require.Len(t, cfg.Tests, 2)
+	assert.Equal(t, NodeReference{"web-1"}, cfg.Tests[0].Node)
+	// Overlapping selectors name each node once, in declaration order
+	assert.Equal(t, NodeReference{"web-1", "web-2", "db-1", "db-2"}, cfg.Tests[1].Node)
+
+	assert.Equal(t, map[string][]string{
+		"@role=db":         {"db-1", "db-2"},
+		"@zone=a,role!=db": {"web-1"},
+		"@role=web":        {"web-1", "web-2"},
+		"@zone=a":          {"web-1", "db-1", "db-2"},
+	}, cfg.Selectors)
+}
+
+func TestSelectorRequirements(t *testing.T) {
+	labels := map[string]string{"role": "web", "zone": "a"}
+	cases := map[string]bool{
+		"role=web":        true,
+		"role=web,zone=a": true,
+		"role=web,zone=b": false,
+		"role!=db":        true,
+		"tier!=gold":      true,
+		"zone":            true,
+		"tier":            false,
+		" role = web ":    true,
+	}
+	for selector, want := range cases {
+		reqs, err := parseSelector(selector)
+		require.NoError(t, err, selector)
+		assert.Equal(t, want, matchesAll(reqs, labels), selector)
+	}
+}
+
+func TestSelectorValidation(t *testing.T) {
+	cases := map[string]struct {
+		suite string
+		want  string
+	}{
+		"matches nothing": {`
+nodes:
+  - name: web-1
+    type: local
+    labels: {role: web}
+tests:
+  - name: t
+    node: "@role=db"
+    type: execute
+    options: {command: true}`, `selector "@role=db" matches no node`},
+		"empty term": {`
+nodes:
+  - name: web-1
+    type: local
+tests:
+  - name: t
+    node: "@role=web,"
+    type: execute
+    options: {command: true}`, "has an empty term"},
+		"bad label key": {`
+nodes:
+  - name: web-1
+    type: local
+    labels: {"role=x": web}`, `label key "role=x"`},
+		"node named like a selector": {`
+nodes:
+  - name: "@web"
+    type: local`, "marks a label selector"},
+	}
+	for name, tc := range cases {
+		_, err := ParseConfiguration([]byte("suite: selectors"+tc.suite+"\n"), ".")
+		require.Error(t, err, name)
+		assert.Contains(t, err.Error(), tc.want, name)
+	}
+}
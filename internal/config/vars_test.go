@@ -233,3 +233,19 @@ func TestCommentReferencesIgnored(t *testing.T) {
 	require.NoError(t, err, "undefined refs in comments must not fail the load")
 	assert.Equal(t, "echo hunter2", cfg.Tests[0].Options["command"])
 }
+
+// Text read from outside the suite file sees the same values the suite
+// file did, --vars overrides included.
+func TestExpandVarsUsesResolvedVars(t *testing.T) {
+	cfg, err := ParseConfigurationWithVars([]byte(varsSuite), ".",
+		map[string]string{"target": "192.168.1.1"})
+	require.NoError(t, err)
+
+	t.Setenv("DART_TEST_REGION", "eu-west")
+	text, err := ExpandVars("#cloud-config\nruncmd:\n  - [curl, \"http://{{var.target}}:{{ var.port }}/{{env.DART_TEST_REGION}}\"]\n", cfg.Vars)
+	require.NoError(t, err)
+	assert.Equal(t, "#cloud-config\nruncmd:\n  - [curl, \"http://192.168.1.1:8080/eu-west\"]\n", text)
+
+	_, err = ExpandVars("{{var.missing}} {{ v1.instance_id }}", cfg.Vars)
+	assert.ErrorContains(t, err, "var.missing")
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
@@ -87,6 +88,50 @@ type TestController struct {
 	teardownOnly      bool
 	until             string
 	untilBehavior     string
+	vars              map[string]string
+}
+
+// SetVars gives the controller the suite's resolved vars, for the text
+// nodes read during setup that the suite file's own substitution never
+// saw.
+func (tc *TestController) SetVars(vars map[string]string) {
+	tc.vars = vars
+}
+
+// setupRenderer renders text a node reads during its own setup. Vars
+// resolve as they do in the suite file. Facts resolve against the nodes in
+// ready, which are gathered only when the text references one: most
+// setups reference none, and gathering runs the suite's fact commands.
+func (tc *TestController) setupRenderer(self string, ready []string) func(string) (string, error) {
+	// The slice grows as setup proceeds; the renderer sees the nodes that
+	// were ready when this node's setup began
+	ready = slices.Clone(ready)
+	return func(text string) (string, error) {
+		text, err := config.ExpandVars(text, tc.vars)
+		if err != nil {
+			return "", err
+		}
+		if !strings.Contains(text, "{{") {
+			return text, nil
+		}
+		nodes := make(map[string]ifaces.Node, len(ready))
+		var configs []*config.NodeConfig
+		for _, cfg := range tc.NodeConfigs {
+			if slices.Contains(ready, cfg.Name) {
+				nodes[cfg.Name] = tc.Nodes[cfg.Name]
+				configs = append(configs, cfg)
+			}
+		}
+		store, err := facts.GatherFacts(nodes, configs)
+		if err != nil {
+			return "", err
+		}
+		rendered, err := facts.RenderTemplate(text, store, self)
+		if err != nil {
+			return "", fmt.Errorf("%w (a node's setup sees the facts of the nodes declared before it)", err)
+		}
+		return rendered, nil
+	}
 }
 
 // SetReports configures machine-readable result outputs written after the
@@ -408,8 +453,22 @@ func (tc *TestController) Run() error {
 		}
 	}
 
+	// A node that keeps its prepared target between runs learns which
+	// setup it must reflect before it is created
+	cachers := tc.setupCachers()
+	hashes, err := setupHashes(tc.NodeConfigs, tc.SetupConfigs, tc.vars)
+	if err != nil {
+		return err
+	}
+	for name, cacher := range cachers {
+		cacher.UseSetupHashes(hashes[name])
+	}
+
 	for _, name := range tc.orderedNodeNames() {
 		node := tc.Nodes[name]
+		if templater, ok := node.(ifaces.SetupTemplater); ok {
+			templater.UseTemplateRenderer(tc.setupRenderer(name, setupCompletedNodes))
+		}
 	nodeRetry:
 		for {
 			c := tc.formatter.StartTask(nodeSetupMsg, name, "running")
@@ -477,9 +536,19 @@ func (tc *TestController) Run() error {
 
 	if len(tc.Setup) > 0 {
 		untilReachedInSetup := false
-		for _, step := range tc.Setup {
+		// Steps a node's target already reflects are not run again, and
+		// a target is kept once its hashed steps have all succeeded
+		cached := tc.cachedSetupSteps(cachers)
+		publishPoints := tc.setupPublishPoints(cachers, hashes)
+		failed := make(map[string]bool)
+		for _, name := range tc.orderedNodeNames() {
+			if cacher, ok := cachers[name]; ok && cacher.CachedSetupSteps() > 0 {
+				tc.formatter.StartTask(cachedSetupMsg(cacher.SetupCache(), cacher.CachedSetupSteps()), name, "running").Complete()
+			}
+		}
+		for i, step := range tc.Setup {
 		stepRetry:
-			for {
+			for !cached[i] {
 				f := tc.formatter.StartTask(step.Title(), step.NodeName(), "running")
 				err := step.Run(f)
 				if err != nil {
@@ -490,12 +559,18 @@ func (tc *TestController) Run() error {
 						continue stepRetry
 					}
 					if cont {
+						failed[tc.SetupConfigs[i].Node[0]] = true
 						break stepRetry
 					}
 					return err
 				}
 				break
 			}
+			if name, ok := publishPoints[i]; ok && !failed[name] {
+				if err := tc.publishSetup(name, cachers[name]); err != nil {
+					return err
+				}
+			}
 			if tc.until != "" && step.Title() == tc.until {
 				untilReachedInSetup = true
 				break
@@ -879,6 +954,15 @@ func (tc *TestController) computeTaskColumnWidth(nodeSetupMsg, nodeTeardownMsg s
 		}
 	}
 
+	// Include the messages of nodes that keep their setup
+	for _, cacher := range tc.setupCachers() {
+		for _, msg := range []string{cachedSetupMsg(cacher.SetupCache(), len(tc.SetupConfigs)), publishSetupMsg(cacher.SetupCache())} {
+			if len(msg) > maxWidth {
+				maxWidth = len(msg)
+			}
+		}
+	}
+
 	// Include platform messages
 	for _, platform := range tc.Platforms {
 		if platform.Configured() {
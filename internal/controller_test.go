@@ -576,3 +576,46 @@ func TestControllerTeardownOnlyCleanExitsZero(t *testing.T) {
 	require.NoError(t, tc.Run())
 	assert.Empty(t, f.formatter.errors)
 }
+
+// templatingNode renders text during Setup the way an LXD node renders its
+// cloud-init user-data.
+type templatingNode struct {
+	*trackingNode
+	text     string
+	render   func(string) (string, error)
+	rendered string
+}
+
+func (n *templatingNode) UseTemplateRenderer(render func(string) (string, error)) {
+	n.render = render
+}
+
+func (n *templatingNode) Setup() error {
+	rendered, err := n.render(n.text)
+	if err != nil {
+		return err
+	}
+	n.rendered = rendered
+	return n.trackingNode.Setup()
+}
+
+// Text a node reads at setup gets the suite's vars and the facts of the
+// nodes set up before it; a node declared later has none yet.
+func TestControllerSetupRendersVarsAndEarlierFacts(t *testing.T) {
+	f := newFixture("db", "app", "cache")
+	f.configs[0].Facts = map[string]string{"role": "echo ok"}
+	app := &templatingNode{trackingNode: f.nodes["app"].(*trackingNode), text: `port={{var.port}} db={{ fact "db" "role" }}`}
+	f.nodes["app"] = app
+	tc := f.controller(nil)
+	tc.SetVars(map[string]string{"port": "5432"})
+	require.NoError(t, tc.Run())
+	assert.Equal(t, "port=5432 db=ok", app.rendered)
+
+	f = newFixture("app", "db")
+	f.configs[1].Facts = map[string]string{"role": "echo ok"}
+	early := &templatingNode{trackingNode: f.nodes["app"].(*trackingNode), text: `{{ fact "db" "role" }}`}
+	f.nodes["app"] = early
+	err := f.controller(nil).Run()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "declared before it")
+}
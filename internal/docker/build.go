@@ -0,0 +1,385 @@
+package docker
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/bgrewell/dart/internal/config"
+	"github.com/bgrewell/dart/internal/execution"
+	"github.com/bgrewell/dart/internal/platform"
+	"github.com/bgrewell/dart/internal/stream"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/image"
+)
+
+// buildTagPrefix marks the content-hash tag every built image also carries
+// ("<name>:dart-<hash>"). A later run whose build inputs hash the same finds
+// that tag and reuses the image instead of building it again.
+const buildTagPrefix = "dart-"
+
+// imageRef is the reference the suite names the image by; the tag defaults
+// to latest, as it does for the daemon.
+func imageRef(img *config.ImageConfig) string {
+	tag := img.Tag
+	if tag == "" {
+		tag = "latest"
+	}
+	return img.Name + ":" + tag
+}
+
+// buildPaths returns the Dockerfile and build context of an image. Either
+// may be omitted: the context defaults to the Dockerfile's directory, and
+// the Dockerfile to "Dockerfile" in the context.
+func buildPaths(img *config.ImageConfig) (dockerfile, buildContext string, err error) {
+	switch {
+	case img.Name == "":
+		return "", "", fmt.Errorf("docker.images entry has no name")
+	case img.Dockerfile == "" && img.Context == "":
+		return "", "", fmt.Errorf("image %s needs a dockerfile or a context to build from", img.Name)
+	}
+	dockerfile, buildContext = img.Dockerfile, img.Context
+	if buildContext == "" {
+		buildContext = filepath.Dir(dockerfile)
+	}
+	if dockerfile == "" {
+		dockerfile = filepath.Join(buildContext, "Dockerfile")
+	}
+	return dockerfile, buildContext, nil
+}
+
+// buildArgs returns the arguments of a `docker build` (or `podman build`)
+// producing the image under each tag. Maps are sorted so the command, like
+// the hash, does not depend on iteration order.
+func buildArgs(img *config.ImageConfig, dockerfile string, tags ...string) []string {
+	args := []string{"build"}
+	for _, tag := range tags {
+		args = append(args, "-t", tag)
+	}
+	args = append(args, "-f", dockerfile)
+	for _, key := range sortedKeys(img.Args) {
+		args = append(args, "--build-arg", key+"="+img.Args[key])
+	}
+	for _, key := range sortedKeys(img.Labels) {
+		args = append(args, "--label", key+"="+img.Labels[key])
+	}
+	if img.Target != "" {
+		args = append(args, "--target", img.Target)
+	}
+	if img.Platform != "" {
+		args = append(args, "--platform", img.Platform)
+	}
+	return append(args, ".")
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// BuildHash hashes everything that decides what a build produces: the
+// Dockerfile, the files of the context the daemon would be sent (honouring
+// .dockerignore), and the build settings. Two builds with the same hash
+// produce the same image, so the second can be skipped.
+//
+// Inputs from outside the context — a base image moved to a newer digest
+// behind the same tag, a RUN that downloads something — are not seen. A
+// suite that needs those refreshed changes a build arg to force a rebuild.
+func BuildHash(img *config.ImageConfig) (string, error) {
+	dockerfile, buildContext, err := buildPaths(img)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+
+	content, err := os.ReadFile(dockerfile)
+	if err != nil {
+		return "", fmt.Errorf("could not read dockerfile for image %s: %w", img.Name, err)
+	}
+	fmt.Fprintf(h, "dockerfile %d\n", len(content))
+	h.Write(content)
+	for _, key := range sortedKeys(img.Args) {
+		fmt.Fprintf(h, "arg %q=%q\n", key, img.Args[key])
+	}
+	for _, key := range sortedKeys(img.Labels) {
+		fmt.Fprintf(h, "label %q=%q\n", key, img.Labels[key])
+	}
+	fmt.Fprintf(h, "target %q\nplatform %q\n", img.Target, img.Platform)
+
+	rules, err := readDockerignore(buildContext)
+	if err != nil {
+		return "", fmt.Errorf("could not read .dockerignore for image %s: %w", img.Name, err)
+	}
+	err = filepath.WalkDir(buildContext, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(buildContext, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rules.ignores(rel) {
+			// A negated rule may re-include something below an ignored
+			// directory, so only prune the walk when there is none
+			if entry.IsDir() && !rules.negates() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case entry.IsDir():
+			fmt.Fprintf(h, "dir %q %o\n", rel, info.Mode().Perm())
+		case info.Mode()&fs.ModeSymlink != 0:
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(h, "link %q %q\n", rel, target)
+		case info.Mode().IsRegular():
+			fmt.Fprintf(h, "file %q %o %d\n", rel, info.Mode().Perm(), info.Size())
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(h, f)
+			f.Close()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("could not hash build context for image %s: %w", img.Name, err)
+	}
+	return hex.EncodeToString(h.Sum(nil))[:12], nil
+}
+
+// ignoreRule is one line of a .dockerignore file.
+type ignoreRule struct {
+	segments []string
+	negate   bool
+}
+
+type ignoreRules []ignoreRule
+
+// readDockerignore reads the context's .dockerignore, if any.
+func readDockerignore(buildContext string) (ignoreRules, error) {
+	f, err := os.Open(filepath.Join(buildContext, ".dockerignore"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var rules ignoreRules
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule := ignoreRule{}
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = strings.TrimSpace(line[1:])
+		}
+		pattern := strings.Trim(filepath.ToSlash(filepath.Clean(line)), "/")
+		if pattern == "" || pattern == "." {
+			continue
+		}
+		rule.segments = strings.Split(pattern, "/")
+		rules = append(rules, rule)
+	}
+	return rules, scanner.Err()
+}
+
+// ignores reports whether the daemon would leave a context path out. As
+// with docker, the last matching rule wins, and a rule matching a
+// directory covers everything below it.
+func (r ignoreRules) ignores(rel string) bool {
+	name := strings.Split(rel, "/")
+	ignored := false
+	for _, rule := range r {
+		for n := len(name); n > 0; n-- {
+			if matchIgnore(rule.segments, name[:n]) {
+				ignored = !rule.negate
+				break
+			}
+		}
+	}
+	return ignored
+}
+
+func (r ignoreRules) negates() bool {
+	for _, rule := range r {
+		if rule.negate {
+			return true
+		}
+	}
+	return false
+}
+
+// matchIgnore matches path segments against a pattern's, where "**"
+// matches any number of directories.
+func matchIgnore(pattern, name []string) bool {
+	if len(pattern) == 0 {
+		return len(name) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(name); i++ {
+			if matchIgnore(pattern[1:], name[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(name) == 0 {
+		return false
+	}
+	ok, _ := filepath.Match(pattern[0], name[0])
+	return ok && matchIgnore(pattern[1:], name[1:])
+}
+
+// BuildImage builds an image from the suite's docker.images entry. The image
+// is tagged both as the suite names it and with the hash of its build
+// inputs; when an image with that hash tag already exists, it is tagged
+// again instead of being rebuilt.
+func (w *Wrapper) BuildImage(img *config.ImageConfig) error {
+	ctx := context.Background()
+	dockerfile, buildContext, err := buildPaths(img)
+	if err != nil {
+		return err
+	}
+	hash, err := BuildHash(img)
+	if err != nil {
+		return err
+	}
+	ref := imageRef(img)
+	cached := img.Name + ":" + buildTagPrefix + hash
+
+	present, err := ImageExists(ctx, w.cli, cached)
+	if err != nil {
+		return fmt.Errorf("could not check for image %s: %w", cached, err)
+	}
+	if present {
+		if err := w.cli.ImageTag(ctx, cached, ref); err != nil {
+			return fmt.Errorf("could not tag image %s as %s: %w", cached, ref, err)
+		}
+		return nil
+	}
+
+	// Podman hosts often have no docker CLI; its own builds into the same
+	// storage the API socket serves
+	cli := "docker"
+	if w.Runtime() == platform.RuntimePodman {
+		cli = "podman"
+	}
+	cmd := exec.Command(cli, buildArgs(img, dockerfile, ref, cached)...)
+	cmd.Dir = buildContext
+	stdout := stream.NewTeeWriter(stream.StreamStdout, "build "+ref, execution.IsDebugMode())
+	stderr := stream.NewTeeWriter(stream.StreamStderr, "build "+ref, execution.IsDebugMode())
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	if err := cmd.Run(); err != nil {
+		return buildError(ref, err, stdout.Buffer().String()+"\n"+stderr.Buffer().String())
+	}
+
+	w.pruneBuildTags(ctx, img.Name, cached)
+	return nil
+}
+
+// pruneBuildTags removes the hash tags of earlier builds of an image, so
+// changing a Dockerfile does not leave every superseded build behind. It
+// is best-effort: a tag still used by a container is left for `docker
+// image prune`.
+func (w *Wrapper) pruneBuildTags(ctx context.Context, name, keep string) {
+	images, err := w.cli.ImageList(ctx, image.ListOptions{Filters: filters.NewArgs(filters.Arg("reference", name))})
+	if err != nil {
+		return
+	}
+	for _, summary := range images {
+		for _, tag := range summary.RepoTags {
+			if tag != keep && strings.HasPrefix(tag, name+":"+buildTagPrefix) {
+				_, _ = w.cli.ImageRemove(ctx, tag, image.RemoveOptions{})
+			}
+		}
+	}
+}
+
+var (
+	// BuildKit quotes the failing Dockerfile line as "  4 | >>> RUN make"
+	buildkitFailedLine = regexp.MustCompile(`^\s*(\d+)\s*\|\s*>>>\s?(.*)$`)
+	// The classic builder and buildah announce each instruction before
+	// running it, so the last one announced is the one that failed
+	legacyStep   = regexp.MustCompile(`^(?:Step|STEP) \d+/\d+\s?: (.*)$`)
+	builderError = regexp.MustCompile(`^(?:ERROR|Error|error):\s*(.*)$|^(The command .* returned a non-zero code.*)$`)
+)
+
+// failedInstruction finds the Dockerfile instruction a failed build stopped
+// at, and the builder's reason, in the build output. line is zero when
+// the builder does not report it.
+func failedInstruction(output string) (instruction string, line int, reason string) {
+	for _, text := range strings.Split(output, "\n") {
+		text = strings.TrimRight(text, "\r")
+		if m := buildkitFailedLine.FindStringSubmatch(text); m != nil {
+			if instruction == "" || line == 0 {
+				instruction = strings.TrimSpace(m[2])
+				fmt.Sscanf(m[1], "%d", &line)
+			}
+			continue
+		}
+		if m := legacyStep.FindStringSubmatch(strings.TrimSpace(text)); m != nil && line == 0 {
+			instruction = strings.TrimSpace(m[1])
+			continue
+		}
+		if m := builderError.FindStringSubmatch(strings.TrimSpace(text)); m != nil {
+			reason = m[1] + m[2]
+		}
+	}
+	return instruction, line, reason
+}
+
+// buildError reports a failed build by the instruction that failed, rather
+// than by the exit status of the build command.
+func buildError(ref string, err error, output string) error {
+	instruction, line, reason := failedInstruction(output)
+	if reason == "" {
+		reason = lastLine(output)
+	}
+	switch {
+	case instruction != "" && line > 0:
+		return fmt.Errorf("could not build image %s: Dockerfile line %d: %s: %s", ref, line, instruction, reason)
+	case instruction != "":
+		return fmt.Errorf("could not build image %s: %s: %s", ref, instruction, reason)
+	case reason != "":
+		return fmt.Errorf("could not build image %s: %v (%s)", ref, err, reason)
+	}
+	return fmt.Errorf("could not build image %s: %v", ref, err)
+}
+
+func lastLine(output string) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
@@ -0,0 +1,162 @@
+package docker
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bgrewell/dart/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeContext(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+	return dir
+}
+
+// Only what reaches the daemon counts: a change to an ignored file must
+// not force a rebuild, and any other change must.
+func TestBuildHashTracksBuildInputs(t *testing.T) {
+	dir := writeContext(t, map[string]string{
+		"Dockerfile":        "FROM alpine\nCOPY app.txt /\n",
+		"app.txt":           "v1",
+		".dockerignore":     "logs\n*.tmp\n!keep.tmp\n",
+		"logs/run.log":      "noise",
+		"scratch.tmp":       "noise",
+		"keep.tmp":          "kept",
+		"nested/deep/a.tmp": "noise",
+	})
+	img := &config.ImageConfig{Name: "app", Context: dir}
+	base, err := BuildHash(img)
+	require.NoError(t, err)
+	again, err := BuildHash(img)
+	require.NoError(t, err)
+	assert.Equal(t, base, again, "the hash is stable")
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "logs", "run.log"), []byte("more noise"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "scratch.tmp"), []byte("more noise"), 0o644))
+	ignored, err := BuildHash(img)
+	require.NoError(t, err)
+	assert.Equal(t, base, ignored, "ignored files do not change the hash")
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "keep.tmp"), []byte("changed"), 0o644))
+	reincluded, err := BuildHash(img)
+	require.NoError(t, err)
+	assert.NotEqual(t, base, reincluded, "a negated pattern re-includes the file")
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "app.txt"), []byte("v2"), 0o644))
+	changed, err := BuildHash(img)
+	require.NoError(t, err)
+	assert.NotEqual(t, reincluded, changed)
+
+	img.Args = map[string]string{"VERSION": "2"}
+	withArg, err := BuildHash(img)
+	require.NoError(t, err)
+	assert.NotEqual(t, changed, withArg, "build args are inputs too")
+}
+
+func TestDockerignoreMatching(t *testing.T) {
+	rules := ignoreRules{
+		{segments: []string{"**", "*.pyc"}},
+		{segments: []string{"build"}},
+		{segments: []string{"build", "keep"}, negate: true},
+	}
+	assert.True(t, rules.ignores("a/b/c.pyc"))
+	assert.True(t, rules.ignores("c.pyc"))
+	assert.True(t, rules.ignores("build/out.o"), "a directory match covers its contents")
+	assert.False(t, rules.ignores("build/keep"))
+	assert.False(t, rules.ignores("src/build.go"))
+}
+
+func TestBuildArgs(t *testing.T) {
+	img := &config.ImageConfig{
+		Name: "app", Target: "test", Platform: "linux/arm64",
+		Args:   map[string]string{"B": "2", "A": "1"},
+		Labels: map[string]string{"suite": "smoke"},
+	}
+	assert.Equal(t, []string{
+		"build", "-t", "app:latest", "-t", "app:dart-abc", "-f", "/src/Dockerfile",
+		"--build-arg", "A=1", "--build-arg", "B=2", "--label", "suite=smoke",
+		"--target", "test", "--platform", "linux/arm64", ".",
+	}, buildArgs(img, "/src/Dockerfile", "app:latest", "app:dart-abc"))
+
+	dockerfile, buildContext, err := buildPaths(&config.ImageConfig{Name: "app", Dockerfile: "/src/docker/app.dockerfile"})
+	require.NoError(t, err)
+	assert.Equal(t, "/src/docker/app.dockerfile", dockerfile)
+	assert.Equal(t, "/src/docker", buildContext, "the context defaults to the Dockerfile's directory")
+
+	dockerfile, _, err = buildPaths(&config.ImageConfig{Name: "app", Context: "/src"})
+	require.NoError(t, err)
+	assert.Equal(t, "/src/Dockerfile", dockerfile)
+
+	_, _, err = buildPaths(&config.ImageConfig{Name: "app"})
+	assert.ErrorContains(t, err, "needs a dockerfile or a context")
+}
+
+func TestBuildErrorNamesFailedInstruction(t *testing.T) {
+	buildkit := `#5 [2/3] RUN make
+#5 0.311 make: *** No targets specified and no makefile found.  Stop.
+#5 ERROR: process "/bin/sh -c make" did not complete successfully: exit code: 2
+------
+ > [2/3] RUN make:
+------
+Dockerfile:3
+--------------------
+   1 |     FROM alpine
+   2 |     WORKDIR /src
+   3 | >>> RUN make
+   4 |     CMD ["app"]
+--------------------
+ERROR: failed to solve: process "/bin/sh -c make" did not complete successfully: exit code: 2`
+	err := buildError("app:latest", assert.AnError, buildkit)
+	assert.EqualError(t, err, `could not build image app:latest: Dockerfile line 3: RUN make: failed to solve: process "/bin/sh -c make" did not complete successfully: exit code: 2`)
+
+	legacy := `Step 1/3 : FROM alpine
+ ---> 1d34ffeaf190
+Step 2/3 : RUN make
+ ---> Running in 3c5a1c1e2f0b
+The command '/bin/sh -c make' returned a non-zero code: 2`
+	err = buildError("app:latest", assert.AnError, legacy)
+	assert.EqualError(t, err, `could not build image app:latest: RUN make: The command '/bin/sh -c make' returned a non-zero code: 2`)
+
+	podman := `STEP 1/3: FROM alpine
+STEP 2/3: RUN make
+make: not found
+Error: building at STEP "RUN make": while running runtime: exit status 127`
+	err = buildError("app:latest", assert.AnError, podman)
+	assert.EqualError(t, err, `could not build image app:latest: RUN make: building at STEP "RUN make": while running runtime: exit status 127`)
+}
+
+// buildRecorder reports images as present and records tags, so the cached
+// path of BuildImage runs without a daemon or a build CLI.
+type buildRecorder struct {
+	pullRecorder
+	tagged [][2]string
+}
+
+func (b *buildRecorder) ImageTag(ctx context.Context, source, target string) error {
+	b.tagged = append(b.tagged, [2]string{source, target})
+	return nil
+}
+
+// An image whose inputs hash the same as an existing build is tagged, not
+// rebuilt.
+func TestBuildImageReusesUnchangedBuild(t *testing.T) {
+	dir := writeContext(t, map[string]string{"Dockerfile": "FROM alpine\n"})
+	img := &config.ImageConfig{Name: "app", Tag: "v1", Dockerfile: filepath.Join(dir, "Dockerfile")}
+	hash, err := BuildHash(img)
+	require.NoError(t, err)
+
+	rec := &buildRecorder{pullRecorder: pullRecorder{present: map[string]bool{"app:dart-" + hash: true}}}
+	w := &Wrapper{cli: rec}
+	require.NoError(t, w.BuildImage(img))
+	assert.Equal(t, [][2]string{{"app:dart-" + hash, "app:v1"}}, rec.tagged)
+}
@@ -2,19 +2,26 @@ package docker
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"github.com/bgrewell/dart/internal/helpers"
 	"github.com/bgrewell/go-execute/v2"
 	"github.com/docker/docker/client"
 	"io"
+	"os"
 	"path/filepath"
 	"strings"
 )
 
 // ComposeStack represents a Docker Compose stack
 type ComposeStack struct {
-	Name         string
-	ComposeFile  string
-	ProjectName  string
+	Name        string
+	ComposeFile string
+	ProjectName string
+	// Labels go on every service's containers and every network the stack
+	// creates, through an override file generated at Up, so a stack
+	// named after its run is found by dart gc like any container
+	Labels       map[string]string
 	cli          client.APIClient
 	containerIDs map[string]string // service name -> container ID
 }
@@ -43,7 +50,17 @@ func (cs *ComposeStack) Up() error {
 		execute.WithWorkingDir(dir),
 	)
 
-	cmd := fmt.Sprintf("docker compose -f %s -p %s up -d", file, cs.ProjectName)
+	files := "-f " + file
+	if len(cs.Labels) > 0 {
+		override, err := cs.writeLabelOverride(executor, file)
+		if err != nil {
+			return err
+		}
+		defer os.Remove(override)
+		files += " -f " + helpers.ShellQuote(override)
+	}
+
+	cmd := fmt.Sprintf("docker compose %s -p %s up -d", files, cs.ProjectName)
 	_, eout, err := executor.ExecuteSeparate(cmd)
 	if err != nil {
 		if eout != "" {
@@ -60,6 +77,66 @@ func (cs *ComposeStack) Up() error {
 	return nil
 }
 
+// writeLabelOverride writes a compose file adding the stack's labels to
+// the project as compose resolves it, and returns its path.
+func (cs *ComposeStack) writeLabelOverride(executor execute.Executor, file string) (string, error) {
+	cmd := fmt.Sprintf("docker compose -f %s -p %s config --format json", file, cs.ProjectName)
+	out, eout, err := executor.ExecuteSeparate(cmd)
+	if err != nil {
+		if eout != "" {
+			return "", fmt.Errorf("could not read compose project: %v (%s)", err, eout)
+		}
+		return "", fmt.Errorf("could not read compose project: %v", err)
+	}
+	override, err := labelOverride([]byte(out), cs.Labels)
+	if err != nil {
+		return "", err
+	}
+	f, err := os.CreateTemp("", "dart-compose-*.json")
+	if err != nil {
+		return "", fmt.Errorf("could not write compose label override: %v", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(override); err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("could not write compose label override: %v", err)
+	}
+	return f.Name(), nil
+}
+
+// labelOverride builds a compose override, from a project as `docker
+// compose config --format json` prints it, that adds labels to each
+// service and to each network the project creates. An external network
+// belongs to someone else and is left alone.
+func labelOverride(project []byte, labels map[string]string) ([]byte, error) {
+	var resolved struct {
+		Services map[string]json.RawMessage `json:"services"`
+		Networks map[string]struct {
+			External bool `json:"external"`
+		} `json:"networks"`
+	}
+	if err := json.Unmarshal(project, &resolved); err != nil {
+		return nil, fmt.Errorf("could not parse compose project: %v", err)
+	}
+
+	type labelled struct {
+		Labels map[string]string `json:"labels"`
+	}
+	override := struct {
+		Services map[string]labelled `json:"services"`
+		Networks map[string]labelled `json:"networks,omitempty"`
+	}{Services: make(map[string]labelled), Networks: make(map[string]labelled)}
+	for name := range resolved.Services {
+		override.Services[name] = labelled{labels}
+	}
+	for name, network := range resolved.Networks {
+		if !network.External {
+			override.Networks[name] = labelled{labels}
+		}
+	}
+	return json.Marshal(override)
+}
+
 // Down stops and removes the compose stack
 func (cs *ComposeStack) Down() error {
 	dir := filepath.Dir(cs.ComposeFile)
@@ -102,3 +102,24 @@ func TestListServices(t *testing.T) {
 	assert.Contains(t, services, "web")
 	assert.Contains(t, services, "db")
 }
+
+// A stack named after its run carries the run's labels on its containers
+// and the networks it creates, so dart gc finds it; a network the stack
+// only joins is not its to label.
+func TestComposeLabelOverride(t *testing.T) {
+	project := []byte(`{
+		"name": "shop-3f2a9c1b7d4e",
+		"services": {"web": {"image": "nginx", "labels": {"tier": "front"}}, "db": {"image": "postgres"}},
+		"networks": {"default": {"name": "shop-3f2a9c1b7d4e_default"}, "shared": {"name": "shared", "external": true}}
+	}`)
+	labels := map[string]string{"dart.run-id": "3f2a9c1b7d4e"}
+	override, err := labelOverride(project, labels)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"services": {"web": {"labels": {"dart.run-id": "3f2a9c1b7d4e"}}, "db": {"labels": {"dart.run-id": "3f2a9c1b7d4e"}}},
+		"networks": {"default": {"labels": {"dart.run-id": "3f2a9c1b7d4e"}}}
+	}`, string(override))
+
+	_, err = labelOverride([]byte("not json"), labels)
+	assert.ErrorContains(t, err, "could not parse compose project")
+}
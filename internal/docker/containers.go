@@ -5,6 +5,7 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"strings"
 	"time"
 
 	"github.com/bgrewell/dart/internal/stream"
@@ -33,14 +34,30 @@ type containerOptions struct {
 	command      []string
 	entrypoint   []string
 	networks     []NetworkAttachment
+	// Resource limits and runtime options; see resources.go
+	resources     container.Resources
+	sysctls       map[string]string
+	tmpfs         map[string]string
+	shmSize       int64
+	user          string
+	workingDir    string
+	dns           []string
+	extraHosts    []string
+	init          *bool
+	restartPolicy container.RestartPolicy
 }
 
-// NetworkAttachment names a network the container joins, optionally with a
-// fixed address on it. A static address requires the network to define a
-// subnet, which the suite's docker.networks block is what provides.
+// NetworkAttachment names a network the container joins, optionally with
+// fixed addresses on it. A static address requires the network to define a
+// subnet of its family, which the suite's docker.networks block is what
+// provides.
 type NetworkAttachment struct {
 	Name string
 	IPv4 string
+	IPv6 string
+	// Aliases are further names the container answers to on the network,
+	// such as the node name when the container's own name is run-scoped
+	Aliases []string
 }
 
 // WithDetach is a function that sets the detach option for creating a container.
@@ -73,6 +90,34 @@ func ValidatePortSpecs(ports []string) error {
 	return nil
 }
 
+// PrivilegedHostPorts returns the specs that bind a host port below 1024.
+// A rootless runtime cannot bind those, and the engine only says so once
+// the container starts, so callers check up front. Specs without a host
+// port get an ephemeral one and never match.
+func PrivilegedHostPorts(ports []string) ([]string, error) {
+	var privileged []string
+	for _, spec := range ports {
+		mappings, err := nat.ParsePortSpec(spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid port specification: %w", err)
+		}
+		for _, mapping := range mappings {
+			if mapping.Binding.HostPort == "" {
+				continue
+			}
+			start, _, err := nat.ParsePortRangeToInt(mapping.Binding.HostPort)
+			if err != nil {
+				return nil, fmt.Errorf("invalid port specification: %w", err)
+			}
+			if start > 0 && start < 1024 {
+				privileged = append(privileged, spec)
+				break
+			}
+		}
+	}
+	return privileged, nil
+}
+
 // WithVolumes sets bind mounts in Docker's host:container[:opts] form.
 func WithVolumes(volumes []string) ContainerOptions {
 	return func(o *containerOptions) {
@@ -190,6 +235,23 @@ func RemoveContainer(ctx context.Context, cli client.APIClient, containerID stri
 	return cli.ContainerRemove(ctx, containerID, container.RemoveOptions{})
 }
 
+// containerShell is what RunCommandInContainer runs commands through.
+const containerShell = "/bin/sh"
+
+// HasShell reports whether a container has the shell commands run
+// through. A distroless or scratch image has none: files can still be
+// copied in and out of it, but no command runs.
+func HasShell(ctx context.Context, cli client.APIClient, containerID string) (bool, error) {
+	_, err := cli.ContainerStatPath(ctx, containerID, containerShell)
+	if IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
 // RunCommandInContainer runs a command in a specified Docker container
 func RunCommandInContainer(cli client.APIClient, containerID string, command string) (exitCode int, stdout, stderr io.Reader, err error) {
 	ctx := context.Background()
@@ -285,6 +347,13 @@ type ContainerReadinessConfig struct {
 	Timeout time.Duration
 	// PollInterval is how often to check the container state
 	PollInterval time.Duration
+	// WaitForHealthy also requires the image's HEALTHCHECK to report
+	// healthy. An unhealthy container fails the wait at once.
+	WaitForHealthy bool
+	// ReadyCommand must exit zero, run through sh -c, for the container to
+	// count as ready. Empty means "true": any command runs, or, in a
+	// container with no shell, nothing beyond the state checks.
+	ReadyCommand string
 }
 
 // DefaultContainerReadinessConfig returns sensible defaults for readiness checking
@@ -298,7 +367,8 @@ func DefaultContainerReadinessConfig() *ContainerReadinessConfig {
 // WaitForContainerReady waits for a container to be fully ready to accept commands.
 // This checks that:
 // 1. The container state is "running"
-// 2. A simple command can be executed successfully (indicating the container is responsive)
+// 2. With WaitForHealthy, the image's healthcheck reports healthy
+// 3. The ready command (by default "true", or none in a container with no shell) exits zero
 func WaitForContainerReady(ctx context.Context, cli client.APIClient, containerID string, config *ContainerReadinessConfig) error {
 	if config == nil {
 		config = DefaultContainerReadinessConfig()
@@ -311,41 +381,102 @@ func WaitForContainerReady(ctx context.Context, cli client.APIClient, containerI
 	ticker := time.NewTicker(config.PollInterval)
 	defer ticker.Stop()
 
+	// The last reason the container was not ready goes into the timeout
+	// error, so a ready command that never passes says why
+	pending := ""
 	for {
 		select {
 		case <-ctx.Done():
+			if pending != "" {
+				return fmt.Errorf("timeout waiting for container %s to become ready (%s): %w", containerID, pending, ctx.Err())
+			}
 			return fmt.Errorf("timeout waiting for container %s to become ready: %w", containerID, ctx.Err())
 		case <-ticker.C:
-			ready, err := isContainerReady(ctx, cli, containerID)
+			ready, reason, err := isContainerReady(ctx, cli, containerID, config)
 			if err != nil {
-				// Log but continue - the container may still be initializing
-				continue
+				return err
 			}
 			if ready {
 				return nil
 			}
+			pending = reason
 		}
 	}
 }
 
-// isContainerReady checks if a container is fully ready to accept commands
-func isContainerReady(ctx context.Context, cli client.APIClient, containerID string) (bool, error) {
+// isContainerReady checks if a container is fully ready to accept commands.
+// A container that is not ready yet returns the reason; an error means it
+// never will be.
+func isContainerReady(ctx context.Context, cli client.APIClient, containerID string, config *ContainerReadinessConfig) (bool, string, error) {
 	// Check container state
 	inspect, err := cli.ContainerInspect(ctx, containerID)
 	if err != nil {
-		return false, fmt.Errorf("failed to inspect container: %w", err)
+		// The container may still be initializing
+		return false, fmt.Sprintf("failed to inspect container: %v", err), nil
 	}
 
 	// Container must be running
-	if inspect.State == nil || !inspect.State.Running {
-		return false, nil
+	if inspect.ContainerJSONBase == nil || inspect.State == nil || !inspect.State.Running {
+		return false, "container is not running", nil
 	}
 
-	// Try to execute a simple command to verify the container is responsive
-	exitCode, _, _, err := RunCommandInContainer(cli, containerID, "true")
+	if config.WaitForHealthy {
+		health := inspect.State.Health
+		if health == nil || health.Status == container.NoHealthcheck {
+			return false, "", fmt.Errorf("container %s has no healthcheck to wait for: the image defines no HEALTHCHECK", containerID)
+		}
+		switch health.Status {
+		case container.Unhealthy:
+			return false, "", fmt.Errorf("container %s is unhealthy%s", containerID, healthLog(health))
+		case container.Healthy:
+		default:
+			return false, "health status is " + health.Status, nil
+		}
+	}
+
+	// Try to execute a command to verify the container is responsive. A
+	// container with no shell, such as a distroless image, can run no
+	// command, so being up is all the default check can ask of it
+	command := config.ReadyCommand
+	if command == "" {
+		hasShell, err := HasShell(ctx, cli, containerID)
+		if err != nil {
+			return false, err.Error(), nil
+		}
+		if !hasShell {
+			return true, "", nil
+		}
+		command = "true"
+	}
+	exitCode, _, stderr, err := RunCommandInContainer(cli, containerID, command)
 	if err != nil {
-		return false, nil // Container not ready yet
+		return false, err.Error(), nil // Container not ready yet
+	}
+	if exitCode != 0 {
+		reason := fmt.Sprintf("ready command exited %d", exitCode)
+		if stderr != nil {
+			if output, _ := io.ReadAll(stderr); len(bytes.TrimSpace(output)) > 0 {
+				reason += ": " + string(bytes.TrimSpace(output))
+			}
+		}
+		return false, reason, nil
 	}
+	return true, "", nil
+}
 
-	return exitCode == 0, nil
+// healthLog formats the results of the most recent health checks, which
+// the daemon keeps a handful of, for an error message.
+func healthLog(health *container.Health) string {
+	if len(health.Log) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("; last health checks:")
+	for _, result := range health.Log {
+		if result == nil {
+			continue
+		}
+		fmt.Fprintf(&b, "\n  exit %d: %s", result.ExitCode, strings.TrimSpace(result.Output))
+	}
+	return b.String()
 }
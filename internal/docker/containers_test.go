@@ -1,14 +1,20 @@
 package docker
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"fmt"
+	"net"
 	"testing"
 	"time"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // MockClient simulates Docker client operations for testing
@@ -107,3 +113,141 @@ func TestDefaultContainerReadinessConfig(t *testing.T) {
 	assert.Equal(t, 2*time.Minute, config.Timeout)
 	assert.Equal(t, 1*time.Second, config.PollInterval)
 }
+
+// readinessClient reports a sequence of container states, one per inspect
+// (the last repeats), and answers every exec with a fixed exit code.
+type readinessClient struct {
+	client.Client
+	states   []*container.State
+	inspects int
+	exitCode int
+	stderr   string
+	commands []string
+	noShell  bool
+}
+
+func (r *readinessClient) ContainerStatPath(ctx context.Context, id, path string) (container.PathStat, error) {
+	if r.noShell {
+		return container.PathStat{}, fmt.Errorf("Error: No such container:path: %s:%s", id, path)
+	}
+	return container.PathStat{Name: "sh"}, nil
+}
+
+func (r *readinessClient) ContainerInspect(ctx context.Context, id string) (container.InspectResponse, error) {
+	state := r.states[min(r.inspects, len(r.states)-1)]
+	r.inspects++
+	return container.InspectResponse{ContainerJSONBase: &container.ContainerJSONBase{ID: id, State: state}}, nil
+}
+
+func (r *readinessClient) ContainerExecCreate(ctx context.Context, id string, options container.ExecOptions) (container.ExecCreateResponse, error) {
+	r.commands = append(r.commands, options.Cmd[len(options.Cmd)-1])
+	return container.ExecCreateResponse{ID: "exec"}, nil
+}
+
+func (r *readinessClient) ContainerExecAttach(ctx context.Context, id string, options container.ExecAttachOptions) (types.HijackedResponse, error) {
+	var frames bytes.Buffer
+	stdcopy.NewStdWriter(&frames, stdcopy.Stderr).Write([]byte(r.stderr))
+	conn, peer := net.Pipe()
+	peer.Close()
+	return types.HijackedResponse{Conn: conn, Reader: bufio.NewReader(&frames)}, nil
+}
+
+func (r *readinessClient) ContainerExecInspect(ctx context.Context, id string) (container.ExecInspect, error) {
+	return container.ExecInspect{ExitCode: r.exitCode}, nil
+}
+
+func fastReadiness(config ContainerReadinessConfig) *ContainerReadinessConfig {
+	config.PollInterval = time.Millisecond
+	if config.Timeout == 0 {
+		config.Timeout = time.Second
+	}
+	return &config
+}
+
+func healthState(status string, log ...*container.HealthcheckResult) *container.State {
+	return &container.State{Running: true, Health: &container.Health{Status: status, Log: log}}
+}
+
+// A container still in its start period is not ready; once healthy, the
+// ready command decides.
+func TestWaitForContainerHealthy(t *testing.T) {
+	cli := &readinessClient{states: []*container.State{
+		healthState(container.Starting), healthState(container.Starting), healthState(container.Healthy),
+	}}
+	err := WaitForContainerReady(context.Background(), cli, "app", fastReadiness(ContainerReadinessConfig{
+		WaitForHealthy: true, ReadyCommand: "pg_isready",
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, 3, cli.inspects)
+	assert.Equal(t, []string{"pg_isready"}, cli.commands, "the ready command runs only once the container is healthy")
+}
+
+func TestWaitForContainerUnhealthyFailsWithLog(t *testing.T) {
+	cli := &readinessClient{states: []*container.State{healthState(container.Unhealthy,
+		&container.HealthcheckResult{ExitCode: 1, Output: "connection refused\n"},
+		&container.HealthcheckResult{ExitCode: 1, Output: "config: missing key"},
+	)}}
+	err := WaitForContainerReady(context.Background(), cli, "app", fastReadiness(ContainerReadinessConfig{WaitForHealthy: true}))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "container app is unhealthy")
+	assert.Contains(t, err.Error(), "exit 1: connection refused")
+	assert.Contains(t, err.Error(), "exit 1: config: missing key")
+	assert.Equal(t, 1, cli.inspects, "an unhealthy container fails at once")
+}
+
+func TestWaitForContainerHealthyWithoutHealthcheck(t *testing.T) {
+	cli := &readinessClient{states: []*container.State{{Running: true}}}
+	err := WaitForContainerReady(context.Background(), cli, "app", fastReadiness(ContainerReadinessConfig{WaitForHealthy: true}))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no HEALTHCHECK")
+}
+
+// A ready command that never passes times out with its last failure.
+func TestWaitForContainerReadyCommandTimeout(t *testing.T) {
+	cli := &readinessClient{states: []*container.State{{Running: true}}, exitCode: 2, stderr: "still migrating\n"}
+	err := WaitForContainerReady(context.Background(), cli, "app", fastReadiness(ContainerReadinessConfig{
+		ReadyCommand: "test -f /ready", Timeout: 50 * time.Millisecond,
+	}))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "timeout waiting for container app")
+	assert.Contains(t, err.Error(), "ready command exited 2: still migrating")
+}
+
+// An adopted container is never started by DART, so a stopped one fails
+// setup at once instead of waiting out the readiness timeout.
+func TestAdoptContainerRequiresRunning(t *testing.T) {
+	w := &Wrapper{cli: &readinessClient{states: []*container.State{{Status: container.StateExited}}}, containerNamesToId: map[string]string{}}
+	assert.ErrorContains(t, w.AdoptContainer("staging"), "container staging is exited")
+
+	w = &Wrapper{cli: &readinessClient{states: []*container.State{{Running: true}}}, containerNamesToId: map[string]string{}}
+	require.NoError(t, w.AdoptContainer("staging"))
+	assert.Equal(t, "staging", w.containerRef("staging"))
+}
+
+// A distroless container runs no command, so one DART adopts or starts is
+// ready once it is running, or healthy when asked; an explicit ready
+// command is still required to pass.
+func TestWaitForShellLessContainer(t *testing.T) {
+	cli := &readinessClient{states: []*container.State{{Running: false}, {Running: true}}, noShell: true}
+	w := &Wrapper{cli: cli, containerNamesToId: map[string]string{}}
+	require.NoError(t, w.WaitForContainerReady("app", fastReadiness(ContainerReadinessConfig{})))
+	assert.Empty(t, cli.commands, "no command is run in a container without a shell")
+	assert.Equal(t, 2, cli.inspects)
+
+	cli = &readinessClient{states: []*container.State{{Running: true}}, noShell: true}
+	w = &Wrapper{cli: cli, containerNamesToId: map[string]string{}}
+	require.NoError(t, w.AdoptContainer("app"))
+	require.NoError(t, w.WaitForContainerReady("app", fastReadiness(ContainerReadinessConfig{})))
+	assert.Empty(t, cli.commands)
+
+	cli = &readinessClient{states: []*container.State{healthState(container.Starting), healthState(container.Healthy)}, noShell: true}
+	err := WaitForContainerReady(context.Background(), cli, "app", fastReadiness(ContainerReadinessConfig{WaitForHealthy: true}))
+	require.NoError(t, err)
+	assert.Equal(t, 2, cli.inspects, "a shell-less container still waits to be healthy")
+
+	cli = &readinessClient{states: []*container.State{{Running: true}}, noShell: true, exitCode: 127}
+	err = WaitForContainerReady(context.Background(), cli, "app", fastReadiness(ContainerReadinessConfig{
+		ReadyCommand: "test -f /ready", Timeout: 50 * time.Millisecond,
+	}))
+	assert.ErrorContains(t, err, "ready command exited 127")
+}
@@ -0,0 +1,70 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/bgrewell/dart/internal/runlabel"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/network"
+)
+
+// RunResources lists the containers and networks any run created, stopped
+// or not. Built images are not listed: their content-hash tag is what lets
+// the next run skip an unchanged build, and pruneBuildTags bounds them.
+func (w *Wrapper) RunResources() ([]runlabel.Resource, error) {
+	ctx := context.Background()
+	labelled := filters.NewArgs(filters.Arg("label", runlabel.KeyRunID))
+
+	containers, err := w.cli.ContainerList(ctx, container.ListOptions{All: true, Filters: labelled})
+	if err != nil {
+		return nil, fmt.Errorf("could not list containers: %w", err)
+	}
+	var resources []runlabel.Resource
+	for _, c := range containers {
+		run, ok := runlabel.FromLabels(c.Labels)
+		if !ok {
+			continue
+		}
+		name := c.ID
+		if len(c.Names) > 0 {
+			name = strings.TrimPrefix(c.Names[0], "/")
+		}
+		resources = append(resources, runlabel.Resource{Platform: "docker", Kind: "container", Name: name, Run: run})
+	}
+
+	networks, err := w.cli.NetworkList(ctx, network.ListOptions{Filters: labelled})
+	if err != nil {
+		return nil, fmt.Errorf("could not list networks: %w", err)
+	}
+	for _, n := range networks {
+		run, ok := runlabel.FromLabels(n.Labels)
+		if !ok {
+			continue
+		}
+		resources = append(resources, runlabel.Resource{Platform: "docker", Kind: "network", Name: n.Name, Run: run})
+	}
+	return resources, nil
+}
+
+// RemoveRunResource removes one resource listed by RunResources. A
+// container is removed even if running, since its run is gone; callers
+// remove containers before networks so no endpoint holds a network open.
+func (w *Wrapper) RemoveRunResource(resource runlabel.Resource) error {
+	ctx := context.Background()
+	var err error
+	switch resource.Kind {
+	case "container":
+		err = w.cli.ContainerRemove(ctx, resource.Name, container.RemoveOptions{Force: true, RemoveVolumes: true})
+	case "network":
+		err = w.cli.NetworkRemove(ctx, resource.Name)
+	default:
+		return fmt.Errorf("cannot remove docker %s %s", resource.Kind, resource.Name)
+	}
+	if err != nil && !IsNotFound(err) {
+		return fmt.Errorf("could not remove %s %s: %w", resource.Kind, resource.Name, err)
+	}
+	return nil
+}
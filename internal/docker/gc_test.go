@@ -0,0 +1,95 @@
+package docker
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bgrewell/dart/internal/config"
+	"github.com/bgrewell/dart/internal/runlabel"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// gcClient serves labelled containers and networks and records what is
+// created and removed.
+type gcClient struct {
+	client.Client
+	containers      []container.Summary
+	networks        []network.Summary
+	createdLabels   map[string]string
+	networkLabels   map[string]string
+	removed         []string
+	forcedContainer bool
+}
+
+func (c *gcClient) ContainerCreate(ctx context.Context, cfg *container.Config, host *container.HostConfig,
+	net *network.NetworkingConfig, platform *ocispec.Platform, name string) (container.CreateResponse, error) {
+	c.createdLabels = cfg.Labels
+	return container.CreateResponse{ID: "container-id"}, nil
+}
+
+func (c *gcClient) NetworkCreate(ctx context.Context, name string, options network.CreateOptions) (network.CreateResponse, error) {
+	c.networkLabels = options.Labels
+	return network.CreateResponse{ID: "network-id"}, nil
+}
+
+func (c *gcClient) ContainerList(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+	return c.containers, nil
+}
+
+func (c *gcClient) NetworkList(ctx context.Context, options network.ListOptions) ([]network.Summary, error) {
+	return c.networks, nil
+}
+
+func (c *gcClient) ContainerRemove(ctx context.Context, containerID string, options container.RemoveOptions) error {
+	c.removed = append(c.removed, containerID)
+	c.forcedContainer = options.Force
+	return nil
+}
+
+func (c *gcClient) NetworkRemove(ctx context.Context, networkID string) error {
+	c.removed = append(c.removed, networkID)
+	return nil
+}
+
+func TestCreatedResourcesCarryRunLabels(t *testing.T) {
+	rec := &gcClient{}
+	w := &Wrapper{cli: rec, containerNamesToId: map[string]string{}, networkNamesToId: map[string]string{}}
+	run := runlabel.Current()
+
+	require.NoError(t, w.CreateContainer("web", "web", "nginx:alpine"))
+	assert.Equal(t, run.Labels(), rec.createdLabels)
+
+	require.NoError(t, w.CreateNetwork(&config.NetworkConfig{Name: "frontend"}))
+	assert.Equal(t, run.Labels(), rec.networkLabels)
+}
+
+func TestRunResourcesRoundTrip(t *testing.T) {
+	labels := runlabel.Run{ID: "3f2a9c1b7d4e", Suite: "smoke", Host: "ci-04", PID: 7}.Labels()
+	rec := &gcClient{
+		containers: []container.Summary{
+			{ID: "c1", Names: []string{"/web"}, Labels: labels},
+			{ID: "c2", Names: []string{"/compose-web-1"}, Labels: map[string]string{"com.docker.compose.project": "web"}},
+		},
+		networks: []network.Summary{{Name: "frontend", Labels: labels}},
+	}
+	w := &Wrapper{cli: rec}
+
+	resources, err := w.RunResources()
+	require.NoError(t, err)
+	require.Len(t, resources, 2, "an unlabelled container is not the run's")
+	assert.Equal(t, "web", resources[0].Name)
+	assert.Equal(t, "container", resources[0].Kind)
+	assert.Equal(t, "3f2a9c1b7d4e", resources[0].Run.ID)
+	assert.Equal(t, "frontend", resources[1].Name)
+
+	for _, resource := range resources {
+		require.NoError(t, w.RemoveRunResource(resource))
+	}
+	assert.Equal(t, []string{"web", "frontend"}, rec.removed)
+	assert.True(t, rec.forcedContainer, "a dead run's container may still be running")
+}
@@ -2,6 +2,11 @@ package docker
 
 import (
 	"context"
+	"fmt"
+	"net/netip"
+
+	"github.com/bgrewell/dart/internal/config"
+	"github.com/bgrewell/dart/internal/subnetpool"
 	"github.com/docker/docker/api/types/network"
 	"github.com/docker/docker/client"
 )
@@ -45,3 +50,98 @@ func DetachNetwork(ctx context.Context, cli client.APIClient, networkID string,
 
 	return nil
 }
+
+// networkDrivers are the drivers a suite network may name. Overlay and
+// plugin drivers need a swarm or extra daemon setup that a test run does
+// not do, so they are rejected rather than failing at creation.
+var networkDrivers = map[string]bool{"": true, "bridge": true, "macvlan": true, "ipvlan": true}
+
+// ipamPools lists a network's address pools: the top-level subnet and
+// gateway first, then any further subnets.
+func ipamPools(net *config.NetworkConfig) []config.SubnetConfig {
+	var pools []config.SubnetConfig
+	if net.Subnet != "" || net.Gateway != "" {
+		pools = append(pools, config.SubnetConfig{Subnet: net.Subnet, Gateway: net.Gateway})
+	}
+	for _, pool := range net.Subnets {
+		if pool != nil {
+			pools = append(pools, *pool)
+		}
+	}
+	return pools
+}
+
+// enablesIPv6 reports whether a network carries IPv6, asked for directly
+// or implied by an IPv6 subnet.
+func enablesIPv6(net *config.NetworkConfig) bool {
+	if net.IPv6 {
+		return true
+	}
+	for _, pool := range ipamPools(net) {
+		if prefix, err := netip.ParsePrefix(pool.Subnet); err == nil && prefix.Addr().Is6() {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateConfig checks the docker block without contacting the daemon, so
+// --check reports a malformed subnet before a run creates half the
+// networks.
+func ValidateConfig(cfg *config.DockerConfig) error {
+	if cfg == nil {
+		return nil
+	}
+	if cfg.SubnetPool != "" {
+		if _, err := subnetpool.Parse(cfg.SubnetPool); err != nil {
+			return fmt.Errorf("docker: %w", err)
+		}
+	}
+	seen := make(map[string]bool, len(cfg.Networks))
+	for _, net := range cfg.Networks {
+		if net.Name == "" {
+			return fmt.Errorf("a docker.networks entry is missing name")
+		}
+		if seen[net.Name] {
+			return fmt.Errorf("docker network %q is declared twice", net.Name)
+		}
+		seen[net.Name] = true
+		if err := validateNetwork(net); err != nil {
+			return fmt.Errorf("docker network %s: %w", net.Name, err)
+		}
+	}
+	return nil
+}
+
+func validateNetwork(net *config.NetworkConfig) error {
+	if !networkDrivers[net.Driver] {
+		return fmt.Errorf("unsupported driver %q (supported: bridge, macvlan, ipvlan)", net.Driver)
+	}
+	for _, pool := range net.Subnets {
+		if pool == nil || pool.Subnet == "" {
+			return fmt.Errorf("a subnets entry is missing subnet")
+		}
+	}
+	for _, pool := range ipamPools(net) {
+		if pool.Subnet == "" {
+			continue
+		}
+		prefix, err := netip.ParsePrefix(pool.Subnet)
+		if err != nil {
+			return fmt.Errorf("invalid subnet %q: use CIDR form, e.g. 172.30.0.0/24 or fd00:30::/64", pool.Subnet)
+		}
+		if pool.Gateway != "" {
+			gateway, err := netip.ParseAddr(pool.Gateway)
+			if err != nil || !prefix.Contains(gateway) {
+				return fmt.Errorf("gateway %q is not an address in subnet %s", pool.Gateway, pool.Subnet)
+			}
+		}
+		if pool.IPRange != "" {
+			ipRange, err := netip.ParsePrefix(pool.IPRange)
+			if err != nil || ipRange.Bits() < prefix.Bits() || !prefix.Contains(ipRange.Addr()) {
+				return fmt.Errorf("ip_range %q is not a CIDR range within subnet %s", pool.IPRange, pool.Subnet)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package docker
+
+import (
+	"testing"
+
+	"github.com/bgrewell/dart/internal/config"
+	"github.com/bgrewell/dart/internal/platform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// A dual-stack network is one create call carrying both pools, with IPv6
+// switched on by the v6 subnet alone.
+func TestDualStackNetwork(t *testing.T) {
+	w, rec := newRuntimeWrapper(platform.RuntimeDocker)
+
+	require.NoError(t, w.CreateNetwork(&config.NetworkConfig{
+		Name: "dual", Subnet: "172.30.0.0/24", Gateway: "172.30.0.1",
+		Subnets:  []*config.SubnetConfig{{Subnet: "fd00:30::/64", Gateway: "fd00:30::1", IPRange: "fd00:30::/80"}},
+		Internal: true,
+	}))
+
+	require.NotNil(t, rec.networkCreate.EnableIPv6)
+	assert.True(t, *rec.networkCreate.EnableIPv6)
+	assert.True(t, rec.networkCreate.Internal)
+	require.Len(t, rec.networkCreate.IPAM.Config, 2)
+	assert.Equal(t, "172.30.0.0/24", rec.networkCreate.IPAM.Config[0].Subnet)
+	assert.Equal(t, "fd00:30::/64", rec.networkCreate.IPAM.Config[1].Subnet)
+	assert.Equal(t, "fd00:30::/80", rec.networkCreate.IPAM.Config[1].IPRange)
+}
+
+func TestNetworkDriverOptions(t *testing.T) {
+	w, rec := newRuntimeWrapper(platform.RuntimeDocker)
+
+	require.NoError(t, w.CreateNetwork(&config.NetworkConfig{
+		Name: "lan", Driver: "macvlan", DriverOpts: map[string]string{"parent": "eth0"},
+	}))
+
+	assert.Equal(t, "macvlan", rec.networkCreate.Driver)
+	assert.Equal(t, map[string]string{"parent": "eth0"}, rec.networkCreate.Options)
+	assert.Nil(t, rec.networkCreate.EnableIPv6, "IPv6 stays the daemon's default")
+	assert.Nil(t, rec.networkCreate.IPAM)
+}
+
+func TestValidateConfigRejectsBadNetworks(t *testing.T) {
+	check := func(net *config.NetworkConfig) error {
+		return ValidateConfig(&config.DockerConfig{Networks: []*config.NetworkConfig{net}})
+	}
+	assert.NoError(t, check(&config.NetworkConfig{Name: "ok", Subnet: "fd00::/64", Gateway: "fd00::1"}))
+	assert.ErrorContains(t, check(&config.NetworkConfig{Name: "n", Subnet: "172.30.0.0"}), "use CIDR form")
+	assert.ErrorContains(t, check(&config.NetworkConfig{Name: "n", Subnet: "172.30.0.0/24", Gateway: "172.31.0.1"}), "not an address in subnet")
+	assert.ErrorContains(t, check(&config.NetworkConfig{Name: "n", Driver: "overlay"}), "unsupported driver")
+	assert.ErrorContains(t, check(&config.NetworkConfig{Name: "n", Subnets: []*config.SubnetConfig{{Gateway: "fd00::1"}}}), "missing subnet")
+	assert.ErrorContains(t, check(&config.NetworkConfig{Name: "n",
+		Subnets: []*config.SubnetConfig{{Subnet: "fd00::/64", IPRange: "fd01::/80"}}}), "ip_range")
+
+	err := ValidateConfig(&config.DockerConfig{Networks: []*config.NetworkConfig{{Name: "n"}, {Name: "n"}}})
+	assert.ErrorContains(t, err, "declared twice")
+}
@@ -72,6 +72,18 @@ func TestCreateContainerAppliesStaticAddress(t *testing.T) {
 	assert.Equal(t, "172.30.0.10", endpoint.IPAMConfig.IPv4Address)
 }
 
+func TestCreateContainerAppliesStaticIPv6Address(t *testing.T) {
+	w, rec := newRecordingWrapper()
+
+	require.NoError(t, w.CreateContainer("web", "web", "nginx:alpine",
+		WithNetworks([]NetworkAttachment{{Name: "dual", IPv4: "172.30.0.10", IPv6: "fd00:30::10"}})))
+
+	endpoint := rec.createdNetworking.EndpointsConfig["dual"]
+	require.NotNil(t, endpoint.IPAMConfig)
+	assert.Equal(t, "172.30.0.10", endpoint.IPAMConfig.IPv4Address)
+	assert.Equal(t, "fd00:30::10", endpoint.IPAMConfig.IPv6Address)
+}
+
 // Docker accepts one endpoint at creation, so additional networks have to be
 // connected afterwards or they are silently lost.
 func TestCreateContainerConnectsAdditionalNetworks(t *testing.T) {
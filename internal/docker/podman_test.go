@@ -0,0 +1,101 @@
+package docker
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bgrewell/dart/internal/config"
+	"github.com/bgrewell/dart/internal/platform"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// createRecorder captures what the wrapper asks the engine to create.
+type createRecorder struct {
+	client.Client
+	host          *container.HostConfig
+	networkCreate *network.CreateOptions
+}
+
+func (c *createRecorder) ContainerCreate(ctx context.Context, cfg *container.Config, host *container.HostConfig,
+	net *network.NetworkingConfig, platform *ocispec.Platform, name string) (container.CreateResponse, error) {
+	c.host = host
+	return container.CreateResponse{ID: "container-id"}, nil
+}
+
+func (c *createRecorder) NetworkCreate(ctx context.Context, name string, options network.CreateOptions) (network.CreateResponse, error) {
+	c.networkCreate = &options
+	return network.CreateResponse{ID: "network-id"}, nil
+}
+
+func newRuntimeWrapper(runtime platform.Runtime) (*Wrapper, *createRecorder) {
+	rec := &createRecorder{}
+	return &Wrapper{
+		cli:                rec,
+		runtime:            runtime,
+		containerNamesToId: map[string]string{},
+		networkNamesToId:   map[string]string{},
+	}, rec
+}
+
+// Podman's default capability set omits NET_RAW, so ping inside a
+// container that works on Docker fails with "operation not permitted".
+func TestPodmanContainerGetsDockerDefaultCapabilities(t *testing.T) {
+	w, rec := newRuntimeWrapper(platform.RuntimePodman)
+
+	require.NoError(t, w.CreateContainer("web", "web", "alpine", WithCapabilities([]string{"NET_ADMIN", "cap_net_raw"})))
+
+	assert.ElementsMatch(t, []string{"NET_ADMIN", "cap_net_raw", "AUDIT_WRITE", "MKNOD"}, rec.host.CapAdd)
+}
+
+func TestDockerContainerCapabilitiesUnchanged(t *testing.T) {
+	w, rec := newRuntimeWrapper(platform.RuntimeDocker)
+
+	require.NoError(t, w.CreateContainer("web", "web", "alpine", WithCapabilities([]string{"NET_ADMIN"})))
+
+	assert.Equal(t, []string{"NET_ADMIN"}, []string(rec.host.CapAdd))
+}
+
+// Podman rejects an IPAM entry without a subnet, which is what a network
+// declared with no addressing used to send.
+func TestPodmanNetworkOmitsEmptyIPAM(t *testing.T) {
+	w, rec := newRuntimeWrapper(platform.RuntimePodman)
+
+	require.NoError(t, w.CreateNetwork(&config.NetworkConfig{Name: "test-net"}))
+
+	assert.Equal(t, "bridge", rec.networkCreate.Driver)
+	assert.Nil(t, rec.networkCreate.IPAM)
+	assert.Equal(t, "network-id", w.networkRef("test-net"))
+}
+
+func TestPodmanNetworkKeepsDeclaredSubnet(t *testing.T) {
+	w, rec := newRuntimeWrapper(platform.RuntimePodman)
+
+	require.NoError(t, w.CreateNetwork(&config.NetworkConfig{Name: "test-net", Subnet: "172.30.0.0/24", Gateway: "172.30.0.1"}))
+
+	require.NotNil(t, rec.networkCreate.IPAM)
+	assert.Equal(t, "172.30.0.0/24", rec.networkCreate.IPAM.Config[0].Subnet)
+	assert.Equal(t, "172.30.0.1", rec.networkCreate.IPAM.Config[0].Gateway)
+}
+
+func TestPodmanNetworkRejectsGatewayWithoutSubnet(t *testing.T) {
+	w, rec := newRuntimeWrapper(platform.RuntimePodman)
+
+	err := w.CreateNetwork(&config.NetworkConfig{Name: "test-net", Gateway: "172.30.0.1"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "without a subnet")
+	assert.Nil(t, rec.networkCreate, "nothing is sent to the engine")
+}
+
+func TestPrivilegedHostPorts(t *testing.T) {
+	privileged, err := PrivilegedHostPorts([]string{"8080:80", "80:8080", "53", "127.0.0.1:443:443/tcp", "1000-1030:1000-1030"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"80:8080", "127.0.0.1:443:443/tcp", "1000-1030:1000-1030"}, privileged)
+
+	_, err = PrivilegedHostPorts([]string{"not-a-port"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,220 @@
+package docker
+
+import (
+	"fmt"
+	"net"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/go-units"
+)
+
+// The parsers below read resource limits and runtime options in the
+// notation of the docker CLI ("512m", "nofile=1024:2048", "on-failure:3").
+// They need no daemon, so the same calls serve --check and container
+// creation.
+
+// ParseByteSize parses a size such as "256m", "1g", or "512MiB" into bytes.
+// A bare number is bytes.
+func ParseByteSize(value string) (int64, error) {
+	size, err := units.RAMInBytes(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q (use a number with an optional unit, e.g. \"512m\" or \"1g\")", value)
+	}
+	if size <= 0 {
+		return 0, fmt.Errorf("invalid size %q: must be positive", value)
+	}
+	return size, nil
+}
+
+// ParseMemorySwap parses a memory+swap limit: a size, or "-1" for
+// unlimited swap.
+func ParseMemorySwap(value string) (int64, error) {
+	if value == "-1" {
+		return -1, nil
+	}
+	return ParseByteSize(value)
+}
+
+// ParseUlimits parses ulimits in name=soft[:hard] form.
+func ParseUlimits(specs []string) ([]*container.Ulimit, error) {
+	ulimits := make([]*container.Ulimit, 0, len(specs))
+	for _, spec := range specs {
+		ulimit, err := units.ParseUlimit(spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ulimit %q: %v", spec, err)
+		}
+		ulimits = append(ulimits, ulimit)
+	}
+	return ulimits, nil
+}
+
+// ParseTmpfs parses tmpfs mounts in path[:options] form, where options are
+// the mount options ("size=64m,mode=1777").
+func ParseTmpfs(specs []string) (map[string]string, error) {
+	mounts := make(map[string]string, len(specs))
+	for _, spec := range specs {
+		target, options, _ := strings.Cut(spec, ":")
+		if !path.IsAbs(target) {
+			return nil, fmt.Errorf("invalid tmpfs %q: the mount point must be an absolute path", spec)
+		}
+		if _, ok := mounts[target]; ok {
+			return nil, fmt.Errorf("invalid tmpfs %q: %s is mounted twice", spec, target)
+		}
+		mounts[target] = options
+	}
+	return mounts, nil
+}
+
+// ParseRestartPolicy parses "no", "always", "unless-stopped", or
+// "on-failure[:max-retries]".
+func ParseRestartPolicy(value string) (container.RestartPolicy, error) {
+	name, retries, hasRetries := strings.Cut(value, ":")
+	policy := container.RestartPolicy{Name: container.RestartPolicyMode(name)}
+	if hasRetries {
+		count, err := strconv.Atoi(retries)
+		if err != nil {
+			return policy, fmt.Errorf("invalid restart policy %q: the retry count must be a number", value)
+		}
+		policy.MaximumRetryCount = count
+	}
+	if name == "" {
+		return policy, fmt.Errorf("invalid restart policy %q", value)
+	}
+	if err := container.ValidateRestartPolicy(policy); err != nil {
+		return policy, err
+	}
+	return policy, nil
+}
+
+// ValidateDNSServers checks that every DNS server is an IP address.
+func ValidateDNSServers(servers []string) error {
+	for _, server := range servers {
+		if net.ParseIP(server) == nil {
+			return fmt.Errorf("invalid dns server %q: must be an IP address", server)
+		}
+	}
+	return nil
+}
+
+// ValidateExtraHosts checks extra /etc/hosts entries in host:ip form. The
+// address may also be "host-gateway", which the daemon replaces with the
+// host's own address.
+func ValidateExtraHosts(hosts []string) error {
+	for _, entry := range hosts {
+		name, address, ok := strings.Cut(entry, ":")
+		if !ok || name == "" {
+			return fmt.Errorf("invalid extra host %q: use host:ip", entry)
+		}
+		if address != "host-gateway" && net.ParseIP(strings.Trim(address, "[]")) == nil {
+			return fmt.Errorf("invalid extra host %q: %q is not an IP address", entry, address)
+		}
+	}
+	return nil
+}
+
+// WithMemory limits the container's memory, in bytes.
+func WithMemory(limit int64) ContainerOptions {
+	return func(o *containerOptions) {
+		o.resources.Memory = limit
+	}
+}
+
+// WithMemorySwap limits memory plus swap, in bytes; -1 allows unlimited
+// swap. Setting it equal to the memory limit disables swap, so the limit
+// triggers the OOM killer rather than swapping.
+func WithMemorySwap(limit int64) ContainerOptions {
+	return func(o *containerOptions) {
+		o.resources.MemorySwap = limit
+	}
+}
+
+// WithCPUs limits the container to a number of CPUs, which may be
+// fractional.
+func WithCPUs(cpus float64) ContainerOptions {
+	return func(o *containerOptions) {
+		o.resources.NanoCPUs = int64(cpus * 1e9)
+	}
+}
+
+// WithPidsLimit caps the number of processes in the container.
+func WithPidsLimit(limit int64) ContainerOptions {
+	return func(o *containerOptions) {
+		o.resources.PidsLimit = &limit
+	}
+}
+
+// WithUlimits sets resource ulimits.
+func WithUlimits(ulimits []*container.Ulimit) ContainerOptions {
+	return func(o *containerOptions) {
+		o.resources.Ulimits = ulimits
+	}
+}
+
+// WithSysctls sets namespaced kernel parameters.
+func WithSysctls(sysctls map[string]string) ContainerOptions {
+	return func(o *containerOptions) {
+		o.sysctls = sysctls
+	}
+}
+
+// WithTmpfs mounts tmpfs filesystems, keyed by mount point.
+func WithTmpfs(mounts map[string]string) ContainerOptions {
+	return func(o *containerOptions) {
+		o.tmpfs = mounts
+	}
+}
+
+// WithShmSize sets the size of /dev/shm, in bytes.
+func WithShmSize(size int64) ContainerOptions {
+	return func(o *containerOptions) {
+		o.shmSize = size
+	}
+}
+
+// WithUser runs the container's process, and commands executed in it, as
+// a user (name or uid[:gid]).
+func WithUser(user string) ContainerOptions {
+	return func(o *containerOptions) {
+		o.user = user
+	}
+}
+
+// WithWorkingDir sets the container's working directory.
+func WithWorkingDir(dir string) ContainerOptions {
+	return func(o *containerOptions) {
+		o.workingDir = dir
+	}
+}
+
+// WithDNS sets the container's DNS servers.
+func WithDNS(servers []string) ContainerOptions {
+	return func(o *containerOptions) {
+		o.dns = servers
+	}
+}
+
+// WithExtraHosts adds /etc/hosts entries in host:ip form.
+func WithExtraHosts(hosts []string) ContainerOptions {
+	return func(o *containerOptions) {
+		o.extraHosts = hosts
+	}
+}
+
+// WithInit runs an init process as PID 1, which reaps zombies and
+// forwards signals for entrypoints that do neither.
+func WithInit() ContainerOptions {
+	return func(o *containerOptions) {
+		enabled := true
+		o.init = &enabled
+	}
+}
+
+// WithRestartPolicy sets the daemon's restart policy for the container.
+func WithRestartPolicy(policy container.RestartPolicy) ContainerOptions {
+	return func(o *containerOptions) {
+		o.restartPolicy = policy
+	}
+}
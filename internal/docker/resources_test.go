@@ -0,0 +1,66 @@
+package docker
+
+import (
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseByteSize(t *testing.T) {
+	size, err := ParseByteSize("512m")
+	require.NoError(t, err)
+	assert.Equal(t, int64(512*1024*1024), size)
+
+	size, err = ParseByteSize("1g")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1024*1024*1024), size)
+
+	_, err = ParseByteSize("512q")
+	assert.ErrorContains(t, err, `invalid size "512q"`)
+
+	swap, err := ParseMemorySwap("-1")
+	require.NoError(t, err)
+	assert.Equal(t, int64(-1), swap, "-1 is unlimited swap")
+}
+
+func TestParseUlimitsAndTmpfs(t *testing.T) {
+	ulimits, err := ParseUlimits([]string{"nofile=1024:2048", "nproc=512"})
+	require.NoError(t, err)
+	require.Len(t, ulimits, 2)
+	assert.Equal(t, container.Ulimit{Name: "nofile", Soft: 1024, Hard: 2048}, *ulimits[0])
+	assert.Equal(t, int64(512), ulimits[1].Hard, "a single value sets both limits")
+
+	_, err = ParseUlimits([]string{"nofile"})
+	assert.ErrorContains(t, err, `invalid ulimit "nofile"`)
+
+	mounts, err := ParseTmpfs([]string{"/run:size=64m", "/tmp"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"/run": "size=64m", "/tmp": ""}, mounts)
+
+	_, err = ParseTmpfs([]string{"run"})
+	assert.ErrorContains(t, err, "absolute path")
+}
+
+func TestParseRestartPolicy(t *testing.T) {
+	policy, err := ParseRestartPolicy("on-failure:3")
+	require.NoError(t, err)
+	assert.Equal(t, container.RestartPolicyOnFailure, policy.Name)
+	assert.Equal(t, 3, policy.MaximumRetryCount)
+
+	_, err = ParseRestartPolicy("always:2")
+	assert.Error(t, err, "only on-failure takes a retry count")
+
+	_, err = ParseRestartPolicy("sometimes")
+	assert.Error(t, err)
+}
+
+func TestValidateHostsAndDNS(t *testing.T) {
+	assert.NoError(t, ValidateExtraHosts([]string{"db:10.0.0.5", "host.docker.internal:host-gateway", "v6:[::1]"}))
+	assert.ErrorContains(t, ValidateExtraHosts([]string{"db"}), "use host:ip")
+	assert.ErrorContains(t, ValidateExtraHosts([]string{"db:nowhere"}), "not an IP address")
+
+	assert.NoError(t, ValidateDNSServers([]string{"1.1.1.1", "2606:4700::1111"}))
+	assert.ErrorContains(t, ValidateDNSServers([]string{"dns.example.com"}), "must be an IP address")
+}
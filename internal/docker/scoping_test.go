@@ -0,0 +1,117 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"testing"
+
+	"github.com/bgrewell/dart/internal/config"
+	"github.com/bgrewell/dart/internal/runlabel"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// scopeClient records the names objects are created under. The first
+// overlaps network creates fail the way a daemon does when a concurrent
+// run took the subnet first.
+type scopeClient struct {
+	client.Client
+	existing   []network.Summary
+	overlaps   int
+	networks   []string
+	subnets    []string
+	endpoints  map[string]*network.EndpointSettings
+	containers []string
+}
+
+func (c *scopeClient) NetworkList(ctx context.Context, options network.ListOptions) ([]network.Summary, error) {
+	return c.existing, nil
+}
+
+func (c *scopeClient) NetworkCreate(ctx context.Context, name string, options network.CreateOptions) (network.CreateResponse, error) {
+	subnet := ""
+	if options.IPAM != nil {
+		subnet = options.IPAM.Config[0].Subnet
+	}
+	c.subnets = append(c.subnets, subnet)
+	if c.overlaps > 0 {
+		c.overlaps--
+		return network.CreateResponse{}, errors.New("Error response from daemon: Pool overlaps with other one on this address space")
+	}
+	c.networks = append(c.networks, name)
+	return network.CreateResponse{ID: "network-id"}, nil
+}
+
+func (c *scopeClient) ContainerCreate(ctx context.Context, cfg *container.Config, host *container.HostConfig,
+	net *network.NetworkingConfig, platform *ocispec.Platform, name string) (container.CreateResponse, error) {
+	c.containers = append(c.containers, name)
+	c.endpoints = net.EndpointsConfig
+	return container.CreateResponse{ID: "container-id"}, nil
+}
+
+func newScopeWrapper(cfg *config.DockerConfig) (*Wrapper, *scopeClient) {
+	rec := &scopeClient{}
+	return &Wrapper{
+		cli:                rec,
+		cfg:                cfg,
+		containerNamesToId: map[string]string{},
+		networkNamesToId:   map[string]string{},
+	}, rec
+}
+
+// Suite networks are created under run-scoped names; containers still
+// join them by the name the suite uses, and networks from outside the
+// suite keep theirs.
+func TestNetworksAreRunScoped(t *testing.T) {
+	_, err := runlabel.Start("scoping", "ci-1234")
+	require.NoError(t, err)
+	w, rec := newScopeWrapper(&config.DockerConfig{Networks: []*config.NetworkConfig{{Name: "frontend"}}})
+
+	assert.Equal(t, "frontend-ci-1234", w.networkRef("frontend"), "a teardown-only run addresses the scoped name")
+	assert.Equal(t, "bridge", w.networkRef("bridge"))
+
+	require.NoError(t, w.CreateNetwork(w.cfg.Networks[0]))
+	assert.Equal(t, []string{"frontend-ci-1234"}, rec.networks)
+	assert.Equal(t, []string{""}, rec.subnets, "without a pool the daemon allocates")
+
+	require.NoError(t, w.CreateContainer("web-ci-1234", "web", "nginx:alpine",
+		WithNetworks([]NetworkAttachment{{Name: "frontend", Aliases: []string{"web"}}})))
+	require.Contains(t, rec.endpoints, "network-id")
+	assert.Equal(t, []string{"web"}, rec.endpoints["network-id"].Aliases, "peers still reach the node by its name")
+
+	assert.Equal(t, "frontend", w.suiteNetworkName("frontend-ci-1234"), "facts keep the suite's network name")
+}
+
+// With a pool set, an unpinned network is given a /24 that neither the
+// suite nor the daemon uses, and a block a concurrent run took first is
+// retried with another.
+func TestNetworkSubnetFromPool(t *testing.T) {
+	_, err := runlabel.Start("scoping", "ci-1234")
+	require.NoError(t, err)
+	w, rec := newScopeWrapper(&config.DockerConfig{
+		SubnetPool: "10.201.0.0/22",
+		Networks: []*config.NetworkConfig{
+			{Name: "frontend"},
+			{Name: "pinned", Subnet: "10.201.0.0/24", Gateway: "10.201.0.1"},
+		},
+	})
+	existing := network.Summary{Name: "other-run"}
+	existing.IPAM.Config = []network.IPAMConfig{{Subnet: "10.201.1.0/24"}}
+	rec.existing = []network.Summary{existing}
+	rec.overlaps = 1
+
+	require.NoError(t, w.CreateNetwork(w.cfg.Networks[0]))
+	require.Len(t, rec.subnets, 2)
+	assert.NotEqual(t, rec.subnets[0], rec.subnets[1], "the raced block is not tried again")
+	for _, subnet := range rec.subnets {
+		prefix := netip.MustParsePrefix(subnet)
+		assert.False(t, prefix.Overlaps(netip.MustParsePrefix("10.201.0.0/24")), "pinned by the suite")
+		assert.False(t, prefix.Overlaps(netip.MustParsePrefix("10.201.1.0/24")), "used on the daemon")
+	}
+	assert.Equal(t, []string{"frontend-ci-1234"}, rec.networks)
+}
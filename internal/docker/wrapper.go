@@ -5,15 +5,19 @@ import (
 	"fmt"
 	"github.com/bgrewell/dart/internal/config"
 	"github.com/bgrewell/dart/internal/helpers"
+	"github.com/bgrewell/dart/internal/platform"
+	"github.com/bgrewell/dart/internal/runlabel"
+	"github.com/bgrewell/dart/internal/subnetpool"
 	"github.com/bgrewell/dart/pkg/ifaces"
-	"github.com/bgrewell/go-execute/v2"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/network"
 	"github.com/docker/docker/client"
 	"github.com/docker/go-connections/nat"
 	"io"
-	"path/filepath"
+	"net/netip"
+	"os"
 	"sort"
+	"strings"
 )
 
 // Ensure Wrapper implements the PlatformManager interface
@@ -21,8 +25,22 @@ var _ ifaces.PlatformManager = &Wrapper{}
 
 func NewWrapper(cfg *config.Configuration) (wrapper *Wrapper, err error) {
 
+	// Pick the API endpoint: an explicit socket, then DOCKER_HOST, then
+	// detection. Detection only changes the endpoint when it finds Podman;
+	// a missing Docker socket keeps the client's default so the error
+	// surfaces where it always has, on first use.
+	endpoint, err := resolveEndpoint(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	clientOpts := []client.Opt{client.FromEnv, client.WithAPIVersionNegotiation()}
+	if endpoint.SocketPath != "" {
+		clientOpts = append(clientOpts, client.WithHost("unix://"+endpoint.SocketPath))
+	}
+
 	// Create a Docker client
-	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	cli, err := client.NewClientWithOpts(clientOpts...)
 	if err != nil {
 		return nil, fmt.Errorf("Could not create Docker client: %v", err)
 	}
@@ -31,17 +49,69 @@ func NewWrapper(cfg *config.Configuration) (wrapper *Wrapper, err error) {
 	return &Wrapper{
 		cli:                cli,
 		cfg:                cfg.Docker,
+		runtime:            endpoint.Runtime,
+		rootless:           endpoint.Rootless,
 		networkNamesToId:   make(map[string]string),
 		containerNamesToId: make(map[string]string),
 		composeRegistry:    NewComposeStackRegistry(),
 	}, nil
 }
 
+// NewWrapperWithClient returns a wrapper with no platform configuration
+// that talks to the daemon through cli, such as a fake standing in for
+// one.
+func NewWrapperWithClient(cli client.APIClient) *Wrapper {
+	return &Wrapper{
+		cli:                cli,
+		networkNamesToId:   make(map[string]string),
+		containerNamesToId: make(map[string]string),
+		composeRegistry:    NewComposeStackRegistry(),
+	}
+}
+
+// resolveEndpoint decides which Docker-compatible API the wrapper talks to.
+// A suite with podman nodes must reach Podman, so it fails here with the
+// paths that were checked rather than mid-run against a Docker daemon.
+func resolveEndpoint(cfg *config.Configuration) (platform.DetectionResult, error) {
+	if cfg.Docker != nil && cfg.Docker.Socket != "" {
+		return platform.InferContainerRuntime(cfg.Docker.Socket), nil
+	}
+	if host := os.Getenv("DOCKER_HOST"); host != "" {
+		// The client reads DOCKER_HOST itself; only the runtime is needed
+		result := platform.InferContainerRuntime(host)
+		result.SocketPath = ""
+		return result, nil
+	}
+
+	wantsPodman := false
+	for _, node := range cfg.Nodes {
+		if node.Type == "podman" {
+			wantsPodman = true
+			break
+		}
+	}
+	if wantsPodman {
+		result, err := platform.DetectPodmanRuntime()
+		if err != nil {
+			return platform.DetectionResult{}, fmt.Errorf("podman nodes need a Podman API socket (start it with `systemctl --user start podman.socket`): %w", err)
+		}
+		return *result, nil
+	}
+
+	result, err := platform.DetectContainerRuntime()
+	if err != nil {
+		return platform.DetectionResult{Runtime: platform.RuntimeDocker}, nil
+	}
+	return *result, nil
+}
+
 type Wrapper struct {
 	// cli is the interface rather than the concrete client so the wrapper's
 	// call sequences can be asserted without a daemon
 	cli                client.APIClient
 	cfg                *config.DockerConfig
+	runtime            platform.Runtime
+	rootless           bool
 	networkNamesToId   map[string]string
 	containerNamesToId map[string]string
 	composeRegistry    *ComposeStackRegistry
@@ -57,6 +127,19 @@ func (w *Wrapper) Name() string {
 	return "docker"
 }
 
+// Runtime reports which engine serves the API: docker or podman.
+func (w *Wrapper) Runtime() platform.Runtime {
+	if w.runtime == "" {
+		return platform.RuntimeDocker
+	}
+	return w.runtime
+}
+
+// Rootless reports whether the API is a rootless Podman socket.
+func (w *Wrapper) Rootless() bool {
+	return w.rootless
+}
+
 // GetClient returns the Docker client
 func (w *Wrapper) GetClient() client.APIClient {
 	return w.cli
@@ -71,7 +154,7 @@ func (w *Wrapper) GetComposeRegistry() *ComposeStackRegistry {
 func (w *Wrapper) Setup() error {
 	// Create the networks
 	for _, net := range w.cfg.Networks {
-		if err := w.CreateNetwork(net.Name, net.Subnet, net.Gateway); err != nil {
+		if err := w.CreateNetwork(net); err != nil {
 			return err
 		}
 
@@ -79,7 +162,7 @@ func (w *Wrapper) Setup() error {
 
 	// Build the images
 	for _, image := range w.cfg.Images {
-		if err := w.BuildImage(image.Name, image.Tag, image.Dockerfile); err != nil {
+		if err := w.BuildImage(image); err != nil {
 			return err
 		}
 	}
@@ -99,9 +182,10 @@ func (w *Wrapper) Teardown() error {
 		}
 	}
 
-	// Remove the images
+	// Remove the images. Only the suite's own tag is removed: the image
+	// keeps its content-hash tag, so an unchanged build is reused next run
 	for _, image := range w.cfg.Images {
-		if err := w.RemoveImage(image.Name); err != nil && !IsNotFound(err) {
+		if err := w.RemoveImage(imageRef(image)); err != nil && !IsNotFound(err) {
 			return err
 		}
 	}
@@ -120,34 +204,45 @@ func (w *Wrapper) containerRef(name string) string {
 	return name
 }
 
-// networkRef resolves a network name to its recorded ID, falling back to
-// the name. See containerRef.
+// networkRef resolves a network name to its recorded ID. A network the
+// suite declares falls back to its run-scoped name, which is what a
+// --teardown-only run must address; any other network, such as one that
+// exists outside the suite, keeps its own name. See containerRef.
 func (w *Wrapper) networkRef(name string) string {
 	if id, ok := w.networkNamesToId[name]; ok && id != "" {
 		return id
 	}
+	if w.declaresNetwork(name) {
+		return runlabel.Current().Scoped(name)
+	}
 	return name
 }
 
-func (w *Wrapper) BuildImage(name string, tag string, dockerFilePath string) error {
-
-	dir, filename := filepath.Split(dockerFilePath)
-
-	executor := execute.NewExecutor(
-		execute.WithDefaultShell(),
-		execute.WithWorkingDir(dir),
-	)
-	cmd := fmt.Sprintf("docker build -t %s:%s -f %s .", name, tag, filename)
-
-	_, eout, err := executor.ExecuteSeparate(cmd)
-	if err != nil {
-		if eout != "" {
-			return fmt.Errorf("could not build image: %v (%s)", err, eout)
+// declaresNetwork reports whether the suite's docker.networks block
+// creates this network.
+func (w *Wrapper) declaresNetwork(name string) bool {
+	if w.cfg == nil {
+		return false
+	}
+	for _, net := range w.cfg.Networks {
+		if net.Name == name {
+			return true
 		}
-		return fmt.Errorf("could not build image: %v", err)
 	}
+	return false
+}
 
-	return nil
+// suiteNetworkName maps a network's name on the daemon back to the name
+// the suite uses, so per-network facts keep their documented keys.
+func (w *Wrapper) suiteNetworkName(name string) string {
+	if w.cfg != nil {
+		for _, net := range w.cfg.Networks {
+			if runlabel.Current().Scoped(net.Name) == name {
+				return net.Name
+			}
+		}
+	}
+	return name
 }
 
 func (w *Wrapper) CreateContainer(name, hostname, image string, options ...ContainerOptions) error {
@@ -165,12 +260,26 @@ func (w *Wrapper) CreateContainer(name, hostname, image string, options ...Conta
 		Env:        c.env,
 		Cmd:        c.command,
 		Entrypoint: c.entrypoint,
+		User:       c.user,
+		WorkingDir: c.workingDir,
+		Labels:     runlabel.Current().Labels(),
 	}
 	hostCfg := &container.HostConfig{
-		Privileged:  c.priviliged,
-		CapAdd:      c.capabilities,
-		NetworkMode: container.NetworkMode(c.networkMode),
-		Binds:       c.volumes,
+		Privileged:    c.priviliged,
+		CapAdd:        c.capabilities,
+		NetworkMode:   container.NetworkMode(c.networkMode),
+		Binds:         c.volumes,
+		Resources:     c.resources,
+		Sysctls:       c.sysctls,
+		Tmpfs:         c.tmpfs,
+		ShmSize:       c.shmSize,
+		DNS:           c.dns,
+		ExtraHosts:    c.extraHosts,
+		Init:          c.init,
+		RestartPolicy: c.restartPolicy,
+	}
+	if w.Runtime() == platform.RuntimePodman && !c.priviliged {
+		hostCfg.CapAdd = withDockerDefaultCapabilities(c.capabilities)
 	}
 
 	if len(c.ports) > 0 {
@@ -186,7 +295,7 @@ func (w *Wrapper) CreateContainer(name, hostname, image string, options ...Conta
 	networkCfg := &network.NetworkingConfig{}
 	if len(c.networks) > 0 {
 		networkCfg.EndpointsConfig = map[string]*network.EndpointSettings{
-			c.networks[0].Name: endpointSettings(c.networks[0]),
+			w.networkRef(c.networks[0].Name): endpointSettings(c.networks[0]),
 		}
 	}
 
@@ -197,19 +306,47 @@ func (w *Wrapper) CreateContainer(name, hostname, image string, options ...Conta
 	w.containerNamesToId[name] = id
 
 	for _, attachment := range c.networks[min(1, len(c.networks)):] {
-		if err := AttachNetwork(ctx, w.cli, attachment.Name, id, endpointSettings(attachment)); err != nil {
+		if err := AttachNetwork(ctx, w.cli, w.networkRef(attachment.Name), id, endpointSettings(attachment)); err != nil {
 			return fmt.Errorf("could not attach container %s to network %s: %w", name, attachment.Name, err)
 		}
 	}
 	return nil
 }
 
-// endpointSettings renders one attachment, carrying a fixed address when the
-// suite asked for one.
+// dockerOnlyCapabilities are granted to every container by Docker but left
+// out of Podman's default set. Adding them back on Podman keeps a suite's
+// ping (NET_RAW) and device setup (MKNOD) working the same on both.
+var dockerOnlyCapabilities = []string{"AUDIT_WRITE", "MKNOD", "NET_RAW"}
+
+// withDockerDefaultCapabilities appends dockerOnlyCapabilities to the
+// requested list, skipping any the suite already names.
+func withDockerDefaultCapabilities(requested []string) []string {
+	caps := append([]string{}, requested...)
+	have := make(map[string]bool, len(requested))
+	for _, capability := range requested {
+		have[strings.TrimPrefix(strings.ToUpper(capability), "CAP_")] = true
+	}
+	for _, capability := range dockerOnlyCapabilities {
+		if !have[capability] {
+			caps = append(caps, capability)
+		}
+	}
+	return caps
+}
+
+// endpointSettings renders one attachment, carrying fixed addresses when the
+// suite asked for them. Aliases are left off the predefined networks, which
+// reject them.
 func endpointSettings(attachment NetworkAttachment) *network.EndpointSettings {
 	settings := &network.EndpointSettings{}
-	if attachment.IPv4 != "" {
-		settings.IPAMConfig = &network.EndpointIPAMConfig{IPv4Address: attachment.IPv4}
+	if container.NetworkMode(attachment.Name).IsUserDefined() {
+		settings.Aliases = attachment.Aliases
+	}
+	if attachment.IPv4 != "" || attachment.IPv6 != "" {
+		settings.IPAMConfig = &network.EndpointIPAMConfig{
+			IPv4Address: attachment.IPv4,
+			IPv6Address: attachment.IPv6,
+		}
 	}
 	return settings
 }
@@ -222,9 +359,34 @@ func (w *Wrapper) StartContainer(name string) error {
 	return nil
 }
 
-func (w *Wrapper) WaitForContainerReady(name string) error {
+// AdoptContainer attaches to a container the suite did not create. It must
+// already exist and be running: DART neither creates nor starts a
+// container it does not own.
+func (w *Wrapper) AdoptContainer(name string) error {
 	ctx := context.Background()
-	if err := WaitForContainerReady(ctx, w.cli, w.containerRef(name), nil); err != nil {
+	inspect, err := w.cli.ContainerInspect(ctx, name)
+	if err != nil {
+		if IsNotFound(err) {
+			return fmt.Errorf("container %s does not exist: an unmanaged node adopts a container that is already running", name)
+		}
+		return fmt.Errorf("could not inspect container %s: %w", name, err)
+	}
+	if inspect.ContainerJSONBase == nil || inspect.State == nil || !inspect.State.Running {
+		status := "not running"
+		if inspect.ContainerJSONBase != nil && inspect.State != nil && inspect.State.Status != "" {
+			status = string(inspect.State.Status)
+		}
+		return fmt.Errorf("container %s is %s: an unmanaged node is not started by DART, so start it first", name, status)
+	}
+	w.containerNamesToId[name] = inspect.ID
+	return nil
+}
+
+// WaitForContainerReady blocks until the container accepts commands; a nil
+// config uses the defaults.
+func (w *Wrapper) WaitForContainerReady(name string, config *ContainerReadinessConfig) error {
+	ctx := context.Background()
+	if err := WaitForContainerReady(ctx, w.cli, w.containerRef(name), config); err != nil {
 		return fmt.Errorf("container %s not ready: %v", name, err)
 	}
 	return nil
@@ -265,8 +427,9 @@ func (w *Wrapper) ContainerNetworkFacts(name string) (map[string]string, error)
 	}
 	sort.Strings(networkNames)
 
-	for _, network := range networkNames {
-		settings := inspect.NetworkSettings.Networks[network]
+	for _, name := range networkNames {
+		settings := inspect.NetworkSettings.Networks[name]
+		network := w.suiteNetworkName(name)
 		if settings.IPAddress != "" {
 			if _, exists := facts["ipv4"]; !exists {
 				facts["ipv4"] = settings.IPAddress
@@ -291,23 +454,137 @@ func (w *Wrapper) RemoveImage(name string) error {
 	return nil
 }
 
-func (w *Wrapper) CreateNetwork(name string, subnet string, gateway string) error {
+// CreateNetwork creates a suite network under its run-scoped name. A
+// network with no subnet is given one from docker.subnet_pool when the
+// suite sets a pool; a pick that a concurrent run took first is retried
+// with the next free block.
+func (w *Wrapper) CreateNetwork(net *config.NetworkConfig) error {
 	ctx := context.Background()
-	id, err := CreateNetwork(ctx, w.cli, name, network.CreateOptions{
-		IPAM: &network.IPAM{
-			Config: []network.IPAMConfig{
-				{
-					Subnet:  subnet,
-					Gateway: gateway,
-				},
-			},
-		},
-	})
+	if err := validateNetwork(net); err != nil {
+		return fmt.Errorf("could not create network %s: %w", net.Name, err)
+	}
+	pool, allocate, err := w.subnetPool(net)
 	if err != nil {
-		return fmt.Errorf("could not create network: %v", err)
+		return fmt.Errorf("could not create network %s: %w", net.Name, err)
 	}
-	w.networkNamesToId[name] = id
-	return nil
+
+	var taken []netip.Prefix
+	for attempt := 0; ; attempt++ {
+		request := net
+		if allocate {
+			subnet, err := w.allocateSubnet(ctx, pool, taken)
+			if err != nil {
+				return fmt.Errorf("could not create network %s: %w", net.Name, err)
+			}
+			taken = append(taken, subnet)
+			allocated := *net
+			allocated.Subnet = subnet.String()
+			allocated.Gateway = subnetpool.Gateway(subnet).String()
+			request = &allocated
+		}
+		options, err := w.networkCreateOptions(request)
+		if err != nil {
+			return fmt.Errorf("could not create network %s: %w", net.Name, err)
+		}
+		id, err := CreateNetwork(ctx, w.cli, runlabel.Current().Scoped(net.Name), options)
+		if err != nil {
+			if allocate && attempt < maxAllocationAttempts-1 && strings.Contains(err.Error(), "overlaps") {
+				continue
+			}
+			return fmt.Errorf("could not create network: %v", err)
+		}
+		w.networkNamesToId[net.Name] = id
+		return nil
+	}
+}
+
+// maxAllocationAttempts bounds the retries when concurrent runs race for
+// the same free block.
+const maxAllocationAttempts = 3
+
+// subnetPool reports whether the network's IPv4 subnet is allocated from
+// docker.subnet_pool: the suite must set a pool, leave the network
+// unpinned, and use a bridge, since macvlan and ipvlan networks share a
+// real LAN's addressing.
+func (w *Wrapper) subnetPool(net *config.NetworkConfig) (subnetpool.Pool, bool, error) {
+	if w.cfg == nil || w.cfg.SubnetPool == "" || net.Subnet != "" || net.Gateway != "" {
+		return subnetpool.Pool{}, false, nil
+	}
+	if net.Driver != "" && net.Driver != "bridge" {
+		return subnetpool.Pool{}, false, nil
+	}
+	for _, pool := range net.Subnets {
+		if prefix, err := netip.ParsePrefix(pool.Subnet); err == nil && prefix.Addr().Is4() {
+			return subnetpool.Pool{}, false, nil
+		}
+	}
+	pool, err := subnetpool.Parse(w.cfg.SubnetPool)
+	return pool, err == nil, err
+}
+
+// allocateSubnet picks a block no existing network or host interface uses.
+func (w *Wrapper) allocateSubnet(ctx context.Context, pool subnetpool.Pool, taken []netip.Prefix) (netip.Prefix, error) {
+	networks, err := w.cli.NetworkList(ctx, network.ListOptions{})
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("could not list networks to allocate a subnet: %w", err)
+	}
+	inUse := append(subnetpool.HostPrefixes(), taken...)
+	for _, existing := range networks {
+		for _, ipam := range existing.IPAM.Config {
+			if prefix, err := netip.ParsePrefix(ipam.Subnet); err == nil {
+				inUse = append(inUse, prefix)
+			}
+		}
+	}
+	for _, declared := range w.cfg.Networks {
+		for _, pool := range ipamPools(declared) {
+			if prefix, err := netip.ParsePrefix(pool.Subnet); err == nil {
+				inUse = append(inUse, prefix)
+			}
+		}
+	}
+	return pool.Allocate(runlabel.Current().ID, inUse)
+}
+
+// networkCreateOptions renders a suite network for the engine in use.
+// Podman's compat API differs from Docker's in two ways that matter here:
+// it has no default driver to fall back on when none is named, and it
+// will not allocate from an IPAM entry that carries no subnet — Docker
+// treats that entry as "pick one", Podman as an invalid range.
+func (w *Wrapper) networkCreateOptions(net *config.NetworkConfig) (network.CreateOptions, error) {
+	options := network.CreateOptions{
+		Driver:   net.Driver,
+		Internal: net.Internal,
+		Options:  net.DriverOpts,
+		Labels:   runlabel.Current().Labels(),
+	}
+	if enablesIPv6(net) {
+		enabled := true
+		options.EnableIPv6 = &enabled
+	}
+
+	pools := ipamPools(net)
+	if w.Runtime() == platform.RuntimePodman {
+		if options.Driver == "" {
+			options.Driver = "bridge"
+		}
+		if len(pools) > 0 && pools[0].Subnet == "" {
+			return options, fmt.Errorf("gateway %s is set without a subnet, which Podman cannot allocate around: add the subnet", pools[0].Gateway)
+		}
+	}
+	if len(pools) == 0 {
+		return options, nil
+	}
+
+	options.IPAM = &network.IPAM{}
+	for _, pool := range pools {
+		options.IPAM.Config = append(options.IPAM.Config, network.IPAMConfig{
+			Subnet:  pool.Subnet,
+			Gateway: pool.Gateway,
+			IPRange: pool.IPRange,
+		})
+	}
+	return options, nil
 }
 
 func (w *Wrapper) RemoveNetwork(name string) error {
@@ -1,9 +1,40 @@
 package helpers
 
-import "strings"
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bgrewell/go-execute/v2"
+)
 
 // ShellQuote wraps s in single quotes, escaping embedded single quotes, so
 // arbitrary values survive interpolation into a POSIX shell command.
 func ShellQuote(s string) string {
 	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
 }
+
+// HostRunner runs one command on the machine running DART and returns its
+// stdout. Code that manages host objects (namespaces, bridges, rootfs
+// trees) takes one so its command sequences can be asserted without root.
+type HostRunner func(command string) (stdout string, err error)
+
+// NewHostRunner returns a HostRunner executing through the host shell,
+// prefixed with `sudo -n` when sudo is set. A failing command's stderr is
+// carried in the error, since tools like iproute2 say nothing useful on
+// stdout.
+func NewHostRunner(sudo bool) HostRunner {
+	return func(command string) (string, error) {
+		if sudo {
+			command = "sudo -n " + command
+		}
+		executor := execute.NewExecutor(execute.WithDefaultShell())
+		out, eout, err := executor.ExecuteSeparate(command)
+		if err != nil {
+			if eout = strings.TrimSpace(eout); eout != "" {
+				return out, fmt.Errorf("%s: %v (%s)", command, err, eout)
+			}
+			return out, fmt.Errorf("%s: %v", command, err)
+		}
+		return out, nil
+	}
+}
@@ -0,0 +1,214 @@
+package lxd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/bgrewell/dart/internal/config"
+	"github.com/bgrewell/dart/internal/runlabel"
+	lxd "github.com/canonical/lxd/client"
+	"github.com/canonical/lxd/shared/api"
+)
+
+// CreateNetworkACL creates a network ACL without rules, labelled with the
+// current run. Rules are set by SetNetworkACLRules once every ACL they
+// may refer to exists.
+func CreateNetworkACL(ctx context.Context, server lxd.InstanceServer, name, description string) error {
+	req := api.NetworkACLsPost{
+		NetworkACLPost: api.NetworkACLPost{Name: name},
+		NetworkACLPut: api.NetworkACLPut{
+			Description: description,
+			Config:      runlabel.Current().WithLxdConfig(nil),
+		},
+	}
+	if err := server.CreateNetworkACL(req); err != nil {
+		return fmt.Errorf("failed to create network ACL %s: %w", name, err)
+	}
+	return nil
+}
+
+// SetNetworkACLRules replaces a network ACL's ingress and egress rules
+func SetNetworkACLRules(ctx context.Context, server lxd.InstanceServer, name string, ingress, egress []api.NetworkACLRule) error {
+	acl, etag, err := server.GetNetworkACL(name)
+	if err != nil {
+		return fmt.Errorf("failed to get network ACL %s: %w", name, err)
+	}
+	put := acl.Writable()
+	put.Ingress, put.Egress = ingress, egress
+	if err := server.UpdateNetworkACL(name, put, etag); err != nil {
+		return fmt.Errorf("failed to set rules of network ACL %s: %w", name, err)
+	}
+	return nil
+}
+
+// DeleteNetworkACL deletes a network ACL. LXD refuses to delete an ACL
+// another ACL's rules refer to, so its rules are cleared first, which lets
+// ACLs that refer to each other be removed one at a time.
+func DeleteNetworkACL(ctx context.Context, server lxd.InstanceServer, name string) error {
+	acl, _, err := server.GetNetworkACL(name)
+	if err != nil {
+		return fmt.Errorf("failed to get network ACL %s: %w", name, err)
+	}
+	if len(acl.Ingress) > 0 || len(acl.Egress) > 0 {
+		if err := SetNetworkACLRules(ctx, server, name, nil, nil); err != nil {
+			return err
+		}
+	}
+	if err := server.DeleteNetworkACL(name); err != nil {
+		return fmt.Errorf("failed to delete network ACL %s: %w", name, err)
+	}
+	return nil
+}
+
+// validateAcls checks the acls entries and their rules.
+func validateAcls(cfg *config.LxdConfig) error {
+	names := make(map[string]bool, len(cfg.Acls))
+	for _, acl := range cfg.Acls {
+		if acl.Name == "" {
+			return fmt.Errorf("an lxd.acls entry is missing name")
+		}
+		if names[acl.Name] {
+			return fmt.Errorf("lxd ACL %q is declared twice", acl.Name)
+		}
+		names[acl.Name] = true
+		for i, rule := range acl.Ingress {
+			if err := validateAclRule(rule); err != nil {
+				return fmt.Errorf("lxd ACL %s: ingress rule %d: %w", acl.Name, i+1, err)
+			}
+		}
+		for i, rule := range acl.Egress {
+			if err := validateAclRule(rule); err != nil {
+				return fmt.Errorf("lxd ACL %s: egress rule %d: %w", acl.Name, i+1, err)
+			}
+		}
+	}
+	return nil
+}
+
+// validateAclRule checks one rule against what LXD accepts, so a typo
+// fails --check rather than setup.
+func validateAclRule(rule *config.LxdAclRuleConfig) error {
+	switch rule.Action {
+	case "allow", "allow-stateless", "drop", "reject":
+	case "":
+		return fmt.Errorf("action is required (allow, allow-stateless, drop or reject)")
+	default:
+		return fmt.Errorf("action must be allow, allow-stateless, drop or reject (got %q)", rule.Action)
+	}
+	switch rule.State {
+	case "", "enabled", "disabled", "logged":
+	default:
+		return fmt.Errorf("state must be enabled, disabled or logged (got %q)", rule.State)
+	}
+	switch rule.Protocol {
+	case "", "tcp", "udp", "icmp4", "icmp6":
+	default:
+		return fmt.Errorf("protocol must be tcp, udp, icmp4 or icmp6 (got %q)", rule.Protocol)
+	}
+	if (rule.SourcePort != "" || rule.DestinationPort != "") && rule.Protocol != "tcp" && rule.Protocol != "udp" {
+		return fmt.Errorf("source_port and destination_port need protocol tcp or udp")
+	}
+	if (rule.IcmpType != "" || rule.IcmpCode != "") && rule.Protocol != "icmp4" && rule.Protocol != "icmp6" {
+		return fmt.Errorf("icmp_type and icmp_code need protocol icmp4 or icmp6")
+	}
+	for _, subjects := range []string{rule.Source, rule.Destination} {
+		for _, subject := range splitList(subjects) {
+			if strings.HasPrefix(subject, "@") && subject != "@internal" && subject != "@external" {
+				return fmt.Errorf("%q is not a selector LXD knows; use @internal or @external", subject)
+			}
+		}
+	}
+	return nil
+}
+
+// setupAcls creates the suite's ACLs, then sets their rules, so a rule may
+// refer to any of them, its own ACL included.
+func (w *Wrapper) setupAcls(ctx context.Context) error {
+	for _, acl := range w.cfg.Acls {
+		if err := CreateNetworkACL(ctx, w.server, w.AclRef(acl.Name), acl.Description); err != nil {
+			return err
+		}
+	}
+	for _, acl := range w.cfg.Acls {
+		if len(acl.Ingress) == 0 && len(acl.Egress) == 0 {
+			continue
+		}
+		if err := SetNetworkACLRules(ctx, w.server, w.AclRef(acl.Name), w.scopedRules(acl.Ingress), w.scopedRules(acl.Egress)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// teardownAcls removes the suite's ACLs, once the networks and instances
+// that applied them are gone.
+func (w *Wrapper) teardownAcls(ctx context.Context) error {
+	for _, acl := range w.cfg.Acls {
+		if err := DeleteNetworkACL(ctx, w.server, w.AclRef(acl.Name)); err != nil && !IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// scopedRules renders ACL rules for the server, with any of the suite's
+// ACLs named in a source or destination under its run-scoped name.
+func (w *Wrapper) scopedRules(rules []*config.LxdAclRuleConfig) []api.NetworkACLRule {
+	scoped := make([]api.NetworkACLRule, 0, len(rules))
+	for _, rule := range rules {
+		state := rule.State
+		if state == "" {
+			state = "enabled"
+		}
+		scoped = append(scoped, api.NetworkACLRule{
+			Action:          rule.Action,
+			Source:          w.AclRefs(splitList(rule.Source)),
+			Destination:     w.AclRefs(splitList(rule.Destination)),
+			Protocol:        rule.Protocol,
+			SourcePort:      rule.SourcePort,
+			DestinationPort: rule.DestinationPort,
+			ICMPType:        rule.IcmpType,
+			ICMPCode:        rule.IcmpCode,
+			Description:     rule.Description,
+			State:           state,
+		})
+	}
+	return scoped
+}
+
+// AclRef is the server-side name of a network ACL: an ACL the suite
+// declares is scoped by the run ID, and any other keeps its own name.
+func (w *Wrapper) AclRef(name string) string {
+	if w.cfg != nil {
+		for _, acl := range w.cfg.Acls {
+			if acl.Name == name {
+				return runlabel.Current().Scoped(name)
+			}
+		}
+	}
+	return name
+}
+
+// AclRefs renders a list of ACL names as the comma-separated value of a
+// security.acls key, under their server-side names. Entries that are not
+// ACLs, such as addresses in a rule, pass through unchanged.
+func (w *Wrapper) AclRefs(names []string) string {
+	refs := make([]string, len(names))
+	for i, name := range names {
+		refs[i] = w.AclRef(name)
+	}
+	return strings.Join(refs, ",")
+}
+
+// splitList splits a comma-separated list, dropping the blanks around its
+// entries.
+func splitList(list string) []string {
+	var entries []string
+	for _, entry := range strings.Split(list, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
@@ -0,0 +1,141 @@
+package lxd
+
+import (
+	"testing"
+
+	"github.com/bgrewell/dart/internal/config"
+	"github.com/bgrewell/dart/internal/runlabel"
+	lxd "github.com/canonical/lxd/client"
+	"github.com/canonical/lxd/shared/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// aclServer keeps ACLs in memory and records the calls Setup and Teardown
+// make for ACLs and networks.
+type aclServer struct {
+	lxd.InstanceServer
+	calls    []string
+	acls     map[string]*api.NetworkACL
+	networks map[string]api.NetworksPost
+}
+
+func (s *aclServer) CreateNetworkACL(req api.NetworkACLsPost) error {
+	s.calls = append(s.calls, "create acl "+req.Name)
+	s.acls[req.Name] = &api.NetworkACL{NetworkACLPost: req.NetworkACLPost, NetworkACLPut: req.NetworkACLPut}
+	return nil
+}
+
+func (s *aclServer) GetNetworkACL(name string) (*api.NetworkACL, string, error) {
+	return s.acls[name], "etag", nil
+}
+
+func (s *aclServer) UpdateNetworkACL(name string, put api.NetworkACLPut, etag string) error {
+	s.calls = append(s.calls, "update acl "+name)
+	s.acls[name].NetworkACLPut = put
+	return nil
+}
+
+func (s *aclServer) DeleteNetworkACL(name string) error {
+	s.calls = append(s.calls, "delete acl "+name)
+	return nil
+}
+
+func (s *aclServer) CreateNetwork(req api.NetworksPost) error {
+	s.calls = append(s.calls, "create network "+req.Name+" "+req.Type)
+	s.networks[req.Name] = req
+	return nil
+}
+
+func (s *aclServer) DeleteNetwork(name string) error {
+	s.calls = append(s.calls, "delete network "+name)
+	return nil
+}
+
+func TestAclsAndOvnNetworks(t *testing.T) {
+	_, err := runlabel.Start("firewall", "ci-1234")
+	require.NoError(t, err)
+	server := &aclServer{acls: map[string]*api.NetworkACL{}, networks: map[string]api.NetworksPost{}}
+	w := &Wrapper{server: server, networkNamesToId: map[string]string{}, cfg: &config.LxdConfig{
+		Acls: []*config.LxdAclConfig{
+			{Name: "web", Ingress: []*config.LxdAclRuleConfig{
+				{Action: "allow", Source: "clients, 10.0.0.0/8", Protocol: "tcp", DestinationPort: "80"},
+			}},
+			{Name: "clients"},
+		},
+		Networks: []*config.LxdNetworkConfig{
+			{Name: "tenant", Type: "ovn", Uplink: "uplink", Subnet: "10.50.0.0/24", Gateway: "10.50.0.1", Acls: []string{"web"}},
+			{Name: "uplink", Subnet: "10.60.0.0/24", Gateway: "10.60.0.1", Config: map[string]string{"ipv4.ovn.ranges": "10.60.0.100-10.60.0.150"}},
+		},
+	}}
+
+	require.NoError(t, w.Setup())
+	assert.Equal(t, []string{
+		"create acl web-ci-1234",
+		"create acl clients-ci-1234",
+		"update acl web-ci-1234",
+		"create network uplink-ci-1234 bridge",
+		"create network tenant-ci-1234 ovn",
+	}, server.calls, "rules are set once every ACL exists, and the uplink comes before its OVN network")
+
+	rule := server.acls["web-ci-1234"].Ingress[0]
+	assert.Equal(t, "clients-ci-1234,10.0.0.0/8", rule.Source, "a rule naming one of the suite's ACLs gets its run-scoped name")
+	assert.Equal(t, "enabled", rule.State)
+	assert.Equal(t, "ci-1234", server.acls["clients-ci-1234"].Config[runlabel.LxdPrefix+runlabel.KeyRunID])
+
+	tenant := server.networks["tenant-ci-1234"].Config
+	assert.Equal(t, "uplink-ci-1234", tenant["network"])
+	assert.Equal(t, "web-ci-1234", tenant["security.acls"])
+	assert.Equal(t, "10.50.0.1/24", tenant["ipv4.address"])
+	assert.Equal(t, "10.60.0.100-10.60.0.150", server.networks["uplink-ci-1234"].Config["ipv4.ovn.ranges"])
+
+	server.calls = nil
+	require.NoError(t, w.Teardown())
+	assert.Equal(t, []string{
+		"delete network tenant-ci-1234",
+		"delete network uplink-ci-1234",
+		"update acl web-ci-1234",
+		"delete acl web-ci-1234",
+		"delete acl clients-ci-1234",
+	}, server.calls, "an ACL's rules are cleared before it goes, as another ACL's rules may name it")
+}
+
+func TestValidateNetworksAndAcls(t *testing.T) {
+	validate := func(cfg config.LxdConfig) error { return ValidateConfig(&cfg) }
+	networks := func(networks ...*config.LxdNetworkConfig) config.LxdConfig {
+		return config.LxdConfig{Networks: networks}
+	}
+	rule := func(r config.LxdAclRuleConfig) config.LxdConfig {
+		return config.LxdConfig{Acls: []*config.LxdAclConfig{{Name: "web", Egress: []*config.LxdAclRuleConfig{&r}}}}
+	}
+	uplink := &config.LxdNetworkConfig{Name: "uplink", Subnet: "10.60.0.0/24", Gateway: "10.60.0.1",
+		Config: map[string]string{"ipv4.ovn.ranges": "10.60.0.100-10.60.0.150"}}
+
+	assert.NoError(t, validate(networks(&config.LxdNetworkConfig{Name: "tenant", Type: "ovn", Uplink: "lxdbr0"})))
+	assert.NoError(t, validate(networks(&config.LxdNetworkConfig{Name: "tenant", Type: "ovn", Uplink: "uplink"}, uplink)))
+	assert.ErrorContains(t, validate(networks(&config.LxdNetworkConfig{Name: "tenant", Type: "macvlan"})),
+		`type must be bridge or ovn (got "macvlan")`)
+	assert.ErrorContains(t, validate(networks(&config.LxdNetworkConfig{Name: "tenant", Type: "ovn"})),
+		"an ovn network needs uplink")
+	assert.ErrorContains(t, validate(networks(&config.LxdNetworkConfig{Name: "br", Uplink: "lxdbr0"})),
+		"uplink applies only to type ovn")
+	assert.ErrorContains(t, validate(networks(
+		&config.LxdNetworkConfig{Name: "tenant", Type: "ovn", Uplink: "uplink"},
+		&config.LxdNetworkConfig{Name: "uplink"},
+	)), "uplink uplink needs ipv4.ovn.ranges")
+	inProject := networks(&config.LxdNetworkConfig{Name: "tenant", Type: "ovn", Uplink: "uplink"}, uplink)
+	inProject.Project = &config.LxdProjectConfig{Name: "qa"}
+	assert.ErrorContains(t, validate(inProject), "an uplink must be in the default project")
+	assert.ErrorContains(t, validate(networks(&config.LxdNetworkConfig{Name: "a"}, &config.LxdNetworkConfig{Name: "a"})),
+		`lxd network "a" is declared twice`)
+
+	assert.NoError(t, validate(rule(config.LxdAclRuleConfig{Action: "reject", Destination: "@external", Protocol: "icmp4", IcmpType: "8"})))
+	assert.ErrorContains(t, validate(rule(config.LxdAclRuleConfig{Protocol: "tcp"})), "egress rule 1: action is required")
+	assert.ErrorContains(t, validate(rule(config.LxdAclRuleConfig{Action: "deny"})), `action must be allow, allow-stateless, drop or reject (got "deny")`)
+	assert.ErrorContains(t, validate(rule(config.LxdAclRuleConfig{Action: "allow", DestinationPort: "443"})),
+		"need protocol tcp or udp")
+	assert.ErrorContains(t, validate(rule(config.LxdAclRuleConfig{Action: "allow", Protocol: "tcp", IcmpType: "8"})),
+		"need protocol icmp4 or icmp6")
+	assert.ErrorContains(t, validate(rule(config.LxdAclRuleConfig{Action: "allow", Source: "@world"})),
+		`"@world" is not a selector LXD knows`)
+}
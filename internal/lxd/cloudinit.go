@@ -0,0 +1,78 @@
+package lxd
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	lxd "github.com/canonical/lxd/client"
+)
+
+// Instance config keys cloud-init reads its first-boot data from.
+const (
+	CloudInitUserData      = "cloud-init.user-data"
+	CloudInitNetworkConfig = "cloud-init.network-config"
+	CloudInitVendorData    = "cloud-init.vendor-data"
+)
+
+// cloudInitOutputLog is where cloud-init writes the output of the modules
+// it runs, which is where a failing runcmd or package install shows.
+const cloudInitOutputLog = "/var/log/cloud-init-output.log"
+
+// cloudInitLogLines is how much of the output log a failure reports.
+const cloudInitLogLines = 40
+
+// WaitForCloudInit blocks until cloud-init has finished in the instance,
+// bounded by timeout. A failed run is reported with cloud-init's own status
+// and the tail of its output log, so the failing module can be seen without
+// attaching to the instance. Finishing with recoverable errors, such as a
+// deprecated key, counts as success.
+func WaitForCloudInit(server lxd.InstanceServer, name string, timeout time.Duration) error {
+	seconds := max(int(timeout.Round(time.Second).Seconds()), 1)
+	command := []string{"timeout", strconv.Itoa(seconds), "cloud-init", "status", "--wait", "--long"}
+
+	var stdout, stderr bytes.Buffer
+	exitCode, err := ExecInInstance(server, name, command, &stdout, &stderr)
+	if err != nil {
+		return fmt.Errorf("could not wait for cloud-init in instance %s: %w", name, err)
+	}
+
+	switch exitCode {
+	case 0, 2:
+		// 2 is cloud-init's "done, with recoverable errors"
+		return nil
+	case 124:
+		return fmt.Errorf("cloud-init in instance %s did not finish within %s%s",
+			name, timeout, cloudInitLogTail(server, name))
+	case 126, 127:
+		return fmt.Errorf("instance %s cannot run cloud-init: cloud_init needs an image that ships it, such as ubuntu:24.04 or an images: remote's /cloud variant", name)
+	}
+
+	// --wait prints a dot per poll before the status itself
+	status := strings.TrimSpace(strings.TrimLeft(stdout.String(), ".\n"))
+	if status == "" {
+		status = strings.TrimSpace(stderr.String())
+	}
+	return fmt.Errorf("cloud-init failed in instance %s (exit code %d):\n%s%s",
+		name, exitCode, indent(status), cloudInitLogTail(server, name))
+}
+
+// cloudInitLogTail returns the end of the instance's cloud-init output log
+// for an error message, or nothing when it cannot be read.
+func cloudInitLogTail(server lxd.InstanceServer, name string) string {
+	var stdout, stderr bytes.Buffer
+	command := []string{"tail", "-n", strconv.Itoa(cloudInitLogLines), cloudInitOutputLog}
+	exitCode, err := ExecInInstance(server, name, command, &stdout, &stderr)
+	tail := strings.TrimRight(stdout.String(), "\n")
+	if err != nil || exitCode != 0 || tail == "" {
+		return ""
+	}
+	return fmt.Sprintf("\nlast lines of %s:\n%s", cloudInitOutputLog, indent(tail))
+}
+
+// indent sets multi-line output off from the message around it.
+func indent(text string) string {
+	return "  " + strings.ReplaceAll(text, "\n", "\n  ")
+}
@@ -0,0 +1,71 @@
+package lxd
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	lxd "github.com/canonical/lxd/client"
+	"github.com/canonical/lxd/shared/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// execServer answers exec requests by the command's first word after
+// timeout, and records every command it ran.
+type execServer struct {
+	lxd.InstanceServer
+	results map[string]execResult
+	ran     [][]string
+}
+
+type execResult struct {
+	exitCode int
+	stdout   string
+}
+
+type exitedOperation struct {
+	lxd.Operation
+	exitCode int
+}
+
+func (o exitedOperation) Wait() error { return nil }
+
+func (o exitedOperation) Get() api.Operation {
+	return api.Operation{Metadata: map[string]any{"return": float64(o.exitCode)}}
+}
+
+func (s *execServer) ExecInstance(name string, exec api.InstanceExecPost, args *lxd.InstanceExecArgs) (lxd.Operation, error) {
+	s.ran = append(s.ran, exec.Command)
+	program := exec.Command[0]
+	if program == "timeout" {
+		program = exec.Command[2]
+	}
+	result := s.results[program]
+	_, _ = io.WriteString(args.Stdout, result.stdout)
+	return exitedOperation{exitCode: result.exitCode}, nil
+}
+
+func TestWaitForCloudInit(t *testing.T) {
+	done := &execServer{results: map[string]execResult{"cloud-init": {0, "..\nstatus: done\n"}}}
+	require.NoError(t, WaitForCloudInit(done, "web", 90*time.Second))
+	assert.Equal(t, []string{"timeout", "90", "cloud-init", "status", "--wait", "--long"}, done.ran[0])
+
+	degraded := &execServer{results: map[string]execResult{"cloud-init": {2, "status: done\nrecoverable_errors: ..."}}}
+	assert.NoError(t, WaitForCloudInit(degraded, "web", time.Minute), "recoverable errors are not a failed boot")
+
+	failed := &execServer{results: map[string]execResult{
+		"cloud-init": {1, "...\nstatus: error\nerrors:\n\t('scripts_user', RuntimeError('Runparts: 1 failures'))\n"},
+		"tail":       {0, "+ make install\nmake: *** No rule to make target 'install'.  Stop.\n"},
+	}}
+	err := WaitForCloudInit(failed, "web", time.Minute)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "cloud-init failed in instance web (exit code 1):\n  status: error")
+	assert.Contains(t, err.Error(), "last lines of /var/log/cloud-init-output.log:\n  + make install\n  make: *** No rule")
+
+	slow := &execServer{results: map[string]execResult{"cloud-init": {124, ""}}}
+	assert.ErrorContains(t, WaitForCloudInit(slow, "web", time.Minute), "did not finish within 1m0s")
+
+	missing := &execServer{results: map[string]execResult{"cloud-init": {127, ""}}}
+	assert.ErrorContains(t, WaitForCloudInit(missing, "web", time.Minute), "needs an image that ships it")
+}
@@ -0,0 +1,164 @@
+package lxd
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/bgrewell/dart/internal/runlabel"
+	"github.com/canonical/lxd/shared/api"
+)
+
+// RunResources lists the instances, volumes, profiles, networks, network
+// ACLs, storage pools and projects any run created, across every project.
+// A project without its own profiles, networks or volumes sees the default
+// project's, so those are listed once, under the project that owns them;
+// ACLs go with networks.
+// A volume is named pool/volume, as volume names are only unique within a
+// pool.
+func (w *Wrapper) RunResources() ([]runlabel.Resource, error) {
+	projects, err := w.server.GetProjects()
+	if err != nil {
+		return nil, fmt.Errorf("could not list projects: %w", err)
+	}
+
+	pools, err := w.server.GetStoragePools()
+	if err != nil {
+		return nil, fmt.Errorf("could not list storage pools: %w", err)
+	}
+
+	var resources []runlabel.Resource
+	add := func(kind, name, project string, config map[string]string) {
+		// The default project and profiles can never be deleted, whoever
+		// last wrote their config
+		if name == DefaultProject {
+			return
+		}
+		if run, ok := runlabel.FromLxdConfig(config); ok {
+			resources = append(resources, runlabel.Resource{Platform: "lxd", Kind: kind, Name: name, Project: project, Run: run})
+		}
+	}
+
+	for _, project := range projects {
+		server := w.server.UseProject(project.Name)
+		add("project", project.Name, "", project.Config)
+
+		if ownsFeature(project, "features.storage.volumes") {
+			for _, pool := range pools {
+				volumes, err := server.GetStoragePoolVolumes(pool.Name)
+				if err != nil {
+					return nil, fmt.Errorf("could not list volumes of pool %s in project %s: %w", pool.Name, project.Name, err)
+				}
+				for _, volume := range volumes {
+					if volume.Type == customVolume {
+						add("volume", pool.Name+"/"+volume.Name, project.Name, volume.Config)
+					}
+				}
+			}
+		}
+
+		instances, err := server.GetInstances(api.InstanceTypeAny)
+		if err != nil {
+			return nil, fmt.Errorf("could not list instances in project %s: %w", project.Name, err)
+		}
+		for _, instance := range instances {
+			add("instance", instance.Name, project.Name, instance.Config)
+		}
+
+		if ownsFeature(project, "features.profiles") {
+			profiles, err := server.GetProfiles()
+			if err != nil {
+				return nil, fmt.Errorf("could not list profiles in project %s: %w", project.Name, err)
+			}
+			for _, profile := range profiles {
+				add("profile", profile.Name, project.Name, profile.Config)
+			}
+		}
+
+		if ownsFeature(project, "features.networks") {
+			networks, err := server.GetNetworks()
+			if err != nil {
+				return nil, fmt.Errorf("could not list networks in project %s: %w", project.Name, err)
+			}
+			// An OVN network goes before the bridge it may use as uplink
+			bridge := func(network api.Network) int {
+				if network.Type == "ovn" {
+					return 0
+				}
+				return 1
+			}
+			slices.SortStableFunc(networks, func(a, b api.Network) int { return bridge(a) - bridge(b) })
+			for _, network := range networks {
+				// Host interfaces are listed too but are not LXD's to delete
+				if network.Managed {
+					add("network", network.Name, project.Name, network.Config)
+				}
+			}
+
+			acls, err := server.GetNetworkACLs()
+			if err != nil {
+				return nil, fmt.Errorf("could not list network ACLs in project %s: %w", project.Name, err)
+			}
+			for _, acl := range acls {
+				add("network-acl", acl.Name, project.Name, acl.Config)
+			}
+		}
+	}
+
+	// Pools belong to no project
+	for _, pool := range pools {
+		add("storage-pool", pool.Name, "", pool.Config)
+	}
+	return resources, nil
+}
+
+// ownsFeature reports whether a project holds its own set of a resource
+// kind rather than sharing the default project's.
+func ownsFeature(project api.Project, feature string) bool {
+	return project.Name == DefaultProject || project.Config[feature] == "true"
+}
+
+// RemoveRunResource removes one resource listed by RunResources. An
+// instance is stopped first, since its run is gone and nothing else will.
+// Callers remove instances, then volumes, profiles and networks, then
+// ACLs, then pools and projects, as LXD refuses to delete anything still
+// in use.
+func (w *Wrapper) RemoveRunResource(resource runlabel.Resource) error {
+	ctx := context.Background()
+	server := w.server.UseProject(resource.Project)
+	if resource.Project == "" {
+		server = w.server.UseProject(DefaultProject)
+	}
+
+	var err error
+	switch resource.Kind {
+	case "instance":
+		state, _, stateErr := GetInstanceState(ctx, server, resource.Name)
+		if stateErr == nil && state.Status != "Stopped" {
+			if err = StopInstance(ctx, server, resource.Name, true); err != nil {
+				break
+			}
+		}
+		err = DeleteInstance(ctx, server, resource.Name)
+	case "profile":
+		err = DeleteProfile(ctx, server, resource.Name)
+	case "network":
+		err = DeleteNetwork(ctx, server, resource.Name)
+	case "network-acl":
+		err = DeleteNetworkACL(ctx, server, resource.Name)
+	case "volume":
+		pool, volume, _ := strings.Cut(resource.Name, "/")
+		err = DeleteStorageVolume(ctx, server, pool, volume)
+	case "storage-pool":
+		err = DeleteStoragePool(ctx, server, resource.Name)
+	case "project":
+		err = DeleteProject(ctx, server, resource.Name)
+	default:
+		return fmt.Errorf("cannot remove lxd %s %s", resource.Kind, resource.Name)
+	}
+	if err != nil && !IsNotFound(err) {
+		return err
+	}
+	return nil
+}
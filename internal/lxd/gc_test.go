@@ -0,0 +1,185 @@
+package lxd
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/bgrewell/dart/internal/runlabel"
+	lxd "github.com/canonical/lxd/client"
+	"github.com/canonical/lxd/shared/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// gcServer serves one project's view of a fixed set of resources, and
+// records deletions. Anything else hits the nil embedded interface.
+type gcServer struct {
+	lxd.InstanceServer
+	project   string
+	projects  []api.Project
+	instances map[string][]api.Instance
+	profiles  map[string][]api.Profile
+	networks  map[string][]api.Network
+	acls      map[string][]api.NetworkACL
+	pools     []api.StoragePool
+	volumes   map[string][]api.StorageVolume // by pool, in the default project
+	deleted   *[]string
+}
+
+func (s *gcServer) UseProject(name string) lxd.InstanceServer {
+	clone := *s
+	clone.project = name
+	return &clone
+}
+
+func (s *gcServer) GetProjects() ([]api.Project, error) { return s.projects, nil }
+
+func (s *gcServer) GetInstances(api.InstanceType) ([]api.Instance, error) {
+	return s.instances[s.project], nil
+}
+
+func (s *gcServer) GetProfiles() ([]api.Profile, error) { return s.profiles[s.project], nil }
+
+func (s *gcServer) GetNetworks() ([]api.Network, error) { return s.networks[s.project], nil }
+
+func (s *gcServer) GetNetworkACLs() ([]api.NetworkACL, error) { return s.acls[s.project], nil }
+
+func (s *gcServer) GetNetworkACL(name string) (*api.NetworkACL, string, error) {
+	for _, acl := range s.acls[s.project] {
+		if acl.Name == name {
+			return &acl, "", nil
+		}
+	}
+	return nil, "", api.StatusErrorf(http.StatusNotFound, "Network ACL not found")
+}
+
+func (s *gcServer) DeleteNetworkACL(name string) error {
+	*s.deleted = append(*s.deleted, s.project+"/network-acl/"+name)
+	return nil
+}
+
+func (s *gcServer) GetStoragePools() ([]api.StoragePool, error) { return s.pools, nil }
+
+func (s *gcServer) GetStoragePoolVolumes(pool string) ([]api.StorageVolume, error) {
+	return s.volumes[pool], nil
+}
+
+func (s *gcServer) DeleteStoragePoolVolume(pool, volType, name string) error {
+	*s.deleted = append(*s.deleted, s.project+"/volume/"+pool+"/"+name)
+	return nil
+}
+
+func (s *gcServer) DeleteProfile(name string) error {
+	*s.deleted = append(*s.deleted, s.project+"/profile/"+name)
+	return nil
+}
+
+func (s *gcServer) DeleteNetwork(name string) error {
+	*s.deleted = append(*s.deleted, s.project+"/network/"+name)
+	return nil
+}
+
+func TestRunResourcesAcrossProjects(t *testing.T) {
+	labels := runlabel.Run{ID: "3f2a9c1b7d4e", Host: "ci-04"}.LxdConfig()
+	project := func(name string, config map[string]string) api.Project {
+		p := api.Project{Name: name}
+		p.Config = config
+		return p
+	}
+	instance := func(name string, config map[string]string) api.Instance {
+		i := api.Instance{Name: name}
+		i.Config = config
+		return i
+	}
+	profile := func(name string, config map[string]string) api.Profile {
+		p := api.Profile{Name: name}
+		p.Config = config
+		return p
+	}
+	network := func(name, networkType string, managed bool, config map[string]string) api.Network {
+		n := api.Network{Name: name, Type: networkType, Managed: managed}
+		n.Config = config
+		return n
+	}
+	acl := func(name string, config map[string]string) api.NetworkACL {
+		a := api.NetworkACL{}
+		a.Name = name
+		a.Config = config
+		return a
+	}
+	pool := func(name string, config map[string]string) api.StoragePool {
+		p := api.StoragePool{Name: name}
+		p.Config = config
+		return p
+	}
+	volume := func(name, volType string, config map[string]string) api.StorageVolume {
+		v := api.StorageVolume{Name: name, Type: volType}
+		v.Config = config
+		return v
+	}
+
+	var deleted []string
+	server := &gcServer{
+		deleted: &deleted,
+		projects: []api.Project{
+			project("default", labels),
+			project("qa", runlabel.Run{ID: "3f2a9c1b7d4e"}.WithLxdConfig(map[string]string{"features.profiles": "true"})),
+		},
+		instances: map[string][]api.Instance{
+			"default": {instance("vm1", labels), instance("pet", nil)},
+			"qa":      {instance("vm2", labels)},
+		},
+		profiles: map[string][]api.Profile{
+			"default": {profile("default", labels), profile("web", labels)},
+			"qa":      {profile("default", nil), profile("db", labels)},
+		},
+		// qa shares the default project's networks, so it must not list
+		// them a second time
+		// The OVN network must go before the bridge it routes out through
+		networks: map[string][]api.Network{
+			"default": {network("dartbr0", "bridge", true, labels), network("eth0", "physical", false, labels), network("dartovn0", "ovn", true, labels)},
+			"qa":      {network("dartbr0", "bridge", true, labels)},
+		},
+		acls: map[string][]api.NetworkACL{
+			"default": {acl("web-3f2a9c1b7d4e", labels), acl("site-policy", nil)},
+		},
+		pools: []api.StoragePool{pool("default", nil), pool("fast-3f2a9c1b7d4e", labels)},
+		// An instance's own volume carries its config, labels included,
+		// but goes with the instance
+		volumes: map[string][]api.StorageVolume{
+			"default":           {volume("vm1", "virtual-machine", labels)},
+			"fast-3f2a9c1b7d4e": {volume("data-3f2a9c1b7d4e", "custom", labels)},
+		},
+	}
+	w := &Wrapper{server: server}
+
+	resources, err := w.RunResources()
+	require.NoError(t, err)
+	var found []string
+	for _, resource := range resources {
+		found = append(found, resource.Kind+" "+resource.Project+"/"+resource.Name)
+	}
+	assert.Equal(t, []string{
+		"volume default/fast-3f2a9c1b7d4e/data-3f2a9c1b7d4e",
+		"instance default/vm1",
+		"profile default/web",
+		"network default/dartovn0",
+		"network default/dartbr0",
+		"network-acl default/web-3f2a9c1b7d4e",
+		"project /qa",
+		"instance qa/vm2",
+		"profile qa/db",
+		"storage-pool /fast-3f2a9c1b7d4e",
+	}, found, "the default project and profiles, host interfaces and unlabelled instances are left alone")
+
+	require.NoError(t, w.RemoveRunResource(resources[8]))
+	require.NoError(t, w.RemoveRunResource(resources[4]))
+	require.NoError(t, w.RemoveRunResource(resources[5]))
+	require.NoError(t, w.RemoveRunResource(resources[0]))
+	assert.Equal(t, []string{
+		"qa/profile/db",
+		"default/network/dartbr0",
+		"default/network-acl/web-3f2a9c1b7d4e",
+		"default/volume/fast-3f2a9c1b7d4e/data-3f2a9c1b7d4e",
+	}, deleted)
+}
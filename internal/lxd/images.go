@@ -67,6 +67,36 @@ func CopyImageFromRemote(ctx context.Context, server lxd.InstanceServer, remoteS
 	return nil
 }
 
+// PublishInstance publishes a stopped instance as a local image carrying
+// the given properties, and returns the image's fingerprint
+func PublishInstance(ctx context.Context, server lxd.InstanceServer, name string, properties map[string]string) (string, error) {
+	req := api.ImagesPost{
+		ImagePut: api.ImagePut{
+			Properties: properties,
+		},
+		Source: &api.ImagesPostSource{
+			Type: "instance",
+			Name: name,
+		},
+	}
+
+	op, err := server.CreateImage(req, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to publish instance %s: %w", name, err)
+	}
+
+	if err := op.Wait(); err != nil {
+		return "", fmt.Errorf("failed waiting for instance %s to publish: %w", name, err)
+	}
+
+	fingerprint, ok := op.Get().Metadata["fingerprint"].(string)
+	if !ok {
+		return "", fmt.Errorf("failed to get fingerprint of the image published from %s", name)
+	}
+
+	return fingerprint, nil
+}
+
 // DeleteImage deletes an image by fingerprint
 func DeleteImage(ctx context.Context, server lxd.InstanceServer, fingerprint string) error {
 	op, err := server.DeleteImage(fingerprint)
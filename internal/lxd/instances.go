@@ -7,6 +7,7 @@ import (
 	"io"
 	"time"
 
+	"github.com/bgrewell/dart/internal/runlabel"
 	lxd "github.com/canonical/lxd/client"
 	"github.com/canonical/lxd/shared/api"
 )
@@ -49,7 +50,8 @@ func GetInstance(ctx context.Context, server lxd.InstanceServer, name string) (*
 	return instance, etag, nil
 }
 
-// CreateInstance creates a new instance (container or VM)
+// CreateInstance creates a new instance (container or VM), labelled with
+// the current run
 func CreateInstance(ctx context.Context, server lxd.InstanceServer, config *InstanceConfig) error {
 	// Build the instance source
 	source := api.InstanceSource{
@@ -88,7 +90,7 @@ func CreateInstance(ctx context.Context, server lxd.InstanceServer, config *Inst
 		InstanceType: config.Architecture,
 		InstancePut: api.InstancePut{
 			Profiles:  config.Profiles,
-			Config:    config.Config,
+			Config:    runlabel.Current().WithLxdConfig(config.Config),
 			Devices:   devices,
 			Ephemeral: config.Ephemeral,
 		},
@@ -165,6 +167,27 @@ func RestartInstance(ctx context.Context, server lxd.InstanceServer, name string
 	return nil
 }
 
+// MigrateInstance moves an instance to another member of a cluster. With
+// live set a running instance keeps running across the move, which LXD
+// supports for virtual machines with migration.stateful set; without it
+// the instance must be stopped first.
+func MigrateInstance(ctx context.Context, server lxd.InstanceServer, name, member string, live bool) error {
+	op, err := server.UseTarget(member).MigrateInstance(name, api.InstancePost{
+		Name:      name,
+		Migration: true,
+		Live:      live,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to migrate instance %s to %s: %w", name, member, err)
+	}
+
+	if err := op.Wait(); err != nil {
+		return fmt.Errorf("failed waiting for instance %s to migrate to %s: %w", name, member, err)
+	}
+
+	return nil
+}
+
 // DeleteInstance deletes an instance
 func DeleteInstance(ctx context.Context, server lxd.InstanceServer, name string) error {
 	// force=false reproduces the pre-upgrade request exactly; callers stop
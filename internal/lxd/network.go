@@ -3,9 +3,12 @@ package lxd
 import (
 	"context"
 	"fmt"
+	"maps"
 	"net"
 	"strconv"
 
+	"github.com/bgrewell/dart/internal/config"
+	"github.com/bgrewell/dart/internal/runlabel"
 	lxd "github.com/canonical/lxd/client"
 	"github.com/canonical/lxd/shared/api"
 )
@@ -28,11 +31,9 @@ func GetNetwork(ctx context.Context, server lxd.InstanceServer, name string) (*a
 	return network, etag, nil
 }
 
-// CreateNetwork creates a new network
+// CreateNetwork creates a new network, labelled with the current run
 func CreateNetwork(ctx context.Context, server lxd.InstanceServer, name, networkType string, config map[string]string) error {
-	if config == nil {
-		config = make(map[string]string)
-	}
+	config = runlabel.Current().WithLxdConfig(config)
 
 	req := api.NetworksPost{
 		Name: name,
@@ -58,6 +59,25 @@ func CreateNetwork(ctx context.Context, server lxd.InstanceServer, name, network
 // The subnet and gateway are validated here so a malformed config fails with
 // a clear message instead of an obscure server-side error.
 func CreateBridgeNetwork(ctx context.Context, server lxd.InstanceServer, name, subnet, gateway string, nat bool) error {
+	return createAddressedNetwork(ctx, server, name, "bridge", subnet, gateway, nat, nil)
+}
+
+// CreateOvnNetwork creates an OVN network with specific subnet and gateway,
+// routed out through uplink. nat applies where the network's router meets
+// the uplink. Further config keys, such as security.acls, are passed
+// through.
+func CreateOvnNetwork(ctx context.Context, server lxd.InstanceServer, name, uplink, subnet, gateway string, nat bool, config map[string]string) error {
+	keys := maps.Clone(config)
+	if keys == nil {
+		keys = make(map[string]string)
+	}
+	keys["network"] = uplink
+	return createAddressedNetwork(ctx, server, name, "ovn", subnet, gateway, nat, keys)
+}
+
+// createAddressedNetwork creates a network whose IPv4 address is gateway on
+// subnet, with NAT for both families set by nat, over any further config.
+func createAddressedNetwork(ctx context.Context, server lxd.InstanceServer, name, networkType, subnet, gateway string, nat bool, config map[string]string) error {
 	if _, _, err := net.ParseCIDR(subnet); err != nil {
 		return fmt.Errorf("network %s: subnet %q is not valid CIDR notation: %w", name, subnet, err)
 	}
@@ -65,13 +85,15 @@ func CreateBridgeNetwork(ctx context.Context, server lxd.InstanceServer, name, s
 		return fmt.Errorf("network %s: gateway %q is not a valid IP address", name, gateway)
 	}
 
-	config := map[string]string{
-		"ipv4.address": gateway + "/" + getSubnetMask(subnet),
-		"ipv4.nat":     strconv.FormatBool(nat),
-		"ipv6.nat":     strconv.FormatBool(nat),
+	keys := maps.Clone(config)
+	if keys == nil {
+		keys = make(map[string]string)
 	}
+	keys["ipv4.address"] = gateway + "/" + getSubnetMask(subnet)
+	keys["ipv4.nat"] = strconv.FormatBool(nat)
+	keys["ipv6.nat"] = strconv.FormatBool(nat)
 
-	return CreateNetwork(ctx, server, name, "bridge", config)
+	return CreateNetwork(ctx, server, name, networkType, keys)
 }
 
 // UpdateNetwork updates an existing network configuration
@@ -189,6 +211,54 @@ func DetachNetworkFromInstance(ctx context.Context, server lxd.InstanceServer, i
 	return nil
 }
 
+// validateNetworks checks the networks entries: a gateway needs its
+// subnet, and an OVN network needs an uplink it can use.
+func validateNetworks(cfg *config.LxdConfig) error {
+	declared := make(map[string]*config.LxdNetworkConfig, len(cfg.Networks))
+	for _, network := range cfg.Networks {
+		if network.Name == "" {
+			return fmt.Errorf("an lxd.networks entry is missing name")
+		}
+		if declared[network.Name] != nil {
+			return fmt.Errorf("lxd network %q is declared twice", network.Name)
+		}
+		declared[network.Name] = network
+	}
+
+	for _, network := range cfg.Networks {
+		if network.Gateway != "" && network.Subnet == "" {
+			return fmt.Errorf("network %s: gateway %s is set without a subnet: add the subnet, or drop both to have one allocated", network.Name, network.Gateway)
+		}
+		switch network.Type {
+		case "", "bridge":
+			if network.Uplink != "" {
+				return fmt.Errorf("lxd network %s: uplink applies only to type ovn", network.Name)
+			}
+		case "ovn":
+			if network.Uplink == "" {
+				return fmt.Errorf("lxd network %s: an ovn network needs uplink, a network with ipv4.ovn.ranges set such as lxdbr0", network.Name)
+			}
+			uplink, ok := declared[network.Uplink]
+			if !ok {
+				continue
+			}
+			// LXD takes uplinks from the default project only, and needs
+			// addresses on them to give the OVN routers
+			switch {
+			case uplink.Type == "ovn":
+				return fmt.Errorf("lxd network %s: uplink %s is an ovn network itself; name a bridge", network.Name, uplink.Name)
+			case cfg.Project != nil && cfg.Project.Config["features.networks"] != "false":
+				return fmt.Errorf("lxd network %s: uplink %s would be created in project %s, but an uplink must be in the default project; set features.networks: \"false\" on the project, or name an existing uplink", network.Name, uplink.Name, cfg.Project.Name)
+			case uplink.Config["ipv4.ovn.ranges"] == "":
+				return fmt.Errorf("lxd network %s: uplink %s needs ipv4.ovn.ranges under its config, the addresses OVN routers take on it", network.Name, uplink.Name)
+			}
+		default:
+			return fmt.Errorf("lxd network %s: type must be bridge or ovn (got %q)", network.Name, network.Type)
+		}
+	}
+	return nil
+}
+
 // getSubnetMask extracts the CIDR mask from a subnet string (e.g., "10.0.0.0/24" -> "24")
 func getSubnetMask(subnet string) string {
 	for i := len(subnet) - 1; i >= 0; i-- {
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/bgrewell/dart/internal/runlabel"
 	lxd "github.com/canonical/lxd/client"
 	"github.com/canonical/lxd/shared/api"
 )
@@ -26,7 +27,7 @@ func GetProfile(ctx context.Context, server lxd.InstanceServer, name string) (*a
 	return profile, etag, nil
 }
 
-// CreateProfile creates a new profile
+// CreateProfile creates a new profile, labelled with the current run
 func CreateProfile(ctx context.Context, server lxd.InstanceServer, profile *Profile) error {
 	// Build device map
 	devices := make(map[string]map[string]string)
@@ -53,7 +54,7 @@ func CreateProfile(ctx context.Context, server lxd.InstanceServer, profile *Prof
 		Name: profile.Name,
 		ProfilePut: api.ProfilePut{
 			Description: profile.Description,
-			Config:      profile.Config,
+			Config:      runlabel.Current().WithLxdConfig(profile.Config),
 			Devices:     devices,
 		},
 	}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/bgrewell/dart/internal/runlabel"
 	lxd "github.com/canonical/lxd/client"
 	"github.com/canonical/lxd/shared/api"
 )
@@ -26,11 +27,10 @@ func GetProject(ctx context.Context, server lxd.InstanceServer, name string) (*a
 	return project, etag, nil
 }
 
-// CreateProject creates a new project with the given name and configuration
+// CreateProject creates a new project with the given name and configuration,
+// labelled with the current run
 func CreateProject(ctx context.Context, server lxd.InstanceServer, name string, config map[string]string, description string) error {
-	if config == nil {
-		config = make(map[string]string)
-	}
+	config = runlabel.Current().WithLxdConfig(config)
 
 	// Set default project features if not specified
 	if _, ok := config["features.images"]; !ok {
@@ -0,0 +1,98 @@
+package lxd
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/bgrewell/dart/internal/config"
+	"github.com/bgrewell/dart/internal/runlabel"
+	lxd "github.com/canonical/lxd/client"
+	"github.com/canonical/lxd/shared/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupServer records the networks and profiles Setup creates.
+type setupServer struct {
+	lxd.InstanceServer
+	existing []api.Network
+	networks []api.NetworksPost
+	profiles []api.ProfilesPost
+}
+
+func (s *setupServer) GetNetworks() ([]api.Network, error) { return s.existing, nil }
+
+func (s *setupServer) CreateNetwork(network api.NetworksPost) error {
+	s.networks = append(s.networks, network)
+	return nil
+}
+
+func (s *setupServer) CreateProfile(profile api.ProfilesPost) error {
+	s.profiles = append(s.profiles, profile)
+	return nil
+}
+
+func TestSuiteObjectsAreRunScoped(t *testing.T) {
+	_, err := runlabel.Start("scoping", "ci-1234")
+	require.NoError(t, err)
+	cfg := &config.LxdConfig{
+		Project:  &config.LxdProjectConfig{Name: "qa"},
+		Networks: []*config.LxdNetworkConfig{{Name: "br0"}, {Name: "dartbr-frontend"}},
+		Profiles: []*config.LxdProfileConfig{
+			{Name: "default"},
+			{Name: "web", Devices: map[string]*config.LxdDeviceConfig{
+				"eth0": {Type: "nic", Opts: map[string]string{"network": "dartbr-frontend"}},
+			}},
+		},
+	}
+	w := &Wrapper{cfg: cfg}
+
+	assert.Equal(t, "qa-ci-1234", w.ProjectRef("qa"))
+	assert.Equal(t, "staging", w.ProjectRef("staging"), "a project the suite does not create keeps its name")
+	assert.Equal(t, "br0-ci-1234", w.NetworkRef("br0"))
+	assert.Len(t, w.NetworkRef("dartbr-frontend"), maxBridgeName, "a bridge name must fit the kernel's limit")
+	assert.Equal(t, "lxdbr0", w.NetworkRef("lxdbr0"))
+	assert.Equal(t, "default", w.ProfileRef("default"))
+	assert.Equal(t, "web-ci-1234", w.ProfileRef("web"))
+
+	profile := w.scopedProfile(cfg.Profiles[1])
+	assert.Equal(t, "web-ci-1234", profile.Name)
+	assert.Equal(t, w.NetworkRef("dartbr-frontend"), profile.Devices["eth0"].Opts["network"])
+	assert.Equal(t, "dartbr-frontend", cfg.Profiles[1].Devices["eth0"].Opts["network"], "the suite's config is untouched")
+}
+
+// Unpinned networks are given distinct blocks from the pool, clear of
+// networks already on the server.
+func TestSetupAllocatesUnpinnedSubnets(t *testing.T) {
+	_, err := runlabel.Start("scoping", "ci-1234")
+	require.NoError(t, err)
+	existing := api.Network{Name: "other-run"}
+	existing.Config = map[string]string{"ipv4.address": "10.201.1.1/24"}
+	server := &setupServer{existing: []api.Network{existing}}
+	w := &Wrapper{
+		server:           server,
+		networkNamesToId: map[string]string{},
+		cfg: &config.LxdConfig{
+			SubnetPool: "10.201.0.0/22",
+			Networks:   []*config.LxdNetworkConfig{{Name: "a"}, {Name: "b"}},
+		},
+	}
+
+	require.NoError(t, w.Setup())
+	require.Len(t, server.networks, 2)
+	var blocks []netip.Prefix
+	for _, network := range server.networks {
+		gateway, err := netip.ParsePrefix(network.Config["ipv4.address"])
+		require.NoError(t, err)
+		assert.Equal(t, gateway.Masked().Addr().Next(), gateway.Addr(), "the bridge takes the first host address")
+		blocks = append(blocks, gateway.Masked())
+	}
+	assert.NotEqual(t, blocks[0], blocks[1])
+	for _, block := range blocks {
+		assert.NotEqual(t, "10.201.1.0/24", block.String())
+	}
+	assert.Equal(t, "a-ci-1234", server.networks[0].Name)
+
+	w.cfg.Networks = []*config.LxdNetworkConfig{{Name: "c", Gateway: "10.201.2.1"}}
+	assert.ErrorContains(t, w.Setup(), "gateway 10.201.2.1 is set without a subnet")
+}
@@ -0,0 +1,439 @@
+package lxd
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/bgrewell/dart/internal/config"
+	"github.com/bgrewell/dart/internal/runlabel"
+	lxd "github.com/canonical/lxd/client"
+	"github.com/canonical/lxd/shared/api"
+	"github.com/pkg/sftp"
+)
+
+// customVolume is the volume type of the volumes a suite declares, as
+// opposed to the ones LXD keeps for instances and images.
+const customVolume = "custom"
+
+// CreateStoragePool creates a storage pool, labelled with the current run
+func CreateStoragePool(ctx context.Context, server lxd.InstanceServer, name, driver, description string, config map[string]string) error {
+	req := api.StoragePoolsPost{
+		Name:   name,
+		Driver: driver,
+		StoragePoolPut: api.StoragePoolPut{
+			Config:      runlabel.Current().WithLxdConfig(config),
+			Description: description,
+		},
+	}
+	if err := server.CreateStoragePool(req); err != nil {
+		return fmt.Errorf("failed to create storage pool %s: %w", name, err)
+	}
+	return nil
+}
+
+// DeleteStoragePool deletes a storage pool
+func DeleteStoragePool(ctx context.Context, server lxd.InstanceServer, name string) error {
+	if err := server.DeleteStoragePool(name); err != nil {
+		return fmt.Errorf("failed to delete storage pool %s: %w", name, err)
+	}
+	return nil
+}
+
+// CreateStorageVolume creates an empty custom volume, labelled with the
+// current run
+func CreateStorageVolume(ctx context.Context, server lxd.InstanceServer, pool, name, contentType, description string, config map[string]string) error {
+	req := api.StorageVolumesPost{
+		Name:        name,
+		Type:        customVolume,
+		ContentType: contentType,
+		StorageVolumePut: api.StorageVolumePut{
+			Config:      runlabel.Current().WithLxdConfig(config),
+			Description: description,
+		},
+	}
+	if err := server.CreateStoragePoolVolume(pool, req); err != nil {
+		return fmt.Errorf("failed to create volume %s in pool %s: %w", name, pool, err)
+	}
+	return nil
+}
+
+// ImportStorageVolume creates a custom volume from a tarball made by
+// `lxc storage volume export`. The export carries its own config, so the
+// run labels and any config given here are applied to the imported
+// volume afterwards.
+func ImportStorageVolume(ctx context.Context, server lxd.InstanceServer, pool, name, tarball, description string, config map[string]string) error {
+	file, err := os.Open(tarball)
+	if err != nil {
+		return fmt.Errorf("failed to import volume %s: %w", name, err)
+	}
+	defer file.Close()
+
+	op, err := server.CreateStoragePoolVolumeFromBackup(pool, lxd.StoragePoolVolumeBackupArgs{BackupFile: file, Name: name})
+	if err != nil {
+		return fmt.Errorf("failed to import volume %s into pool %s: %w", name, pool, err)
+	}
+	if err := op.Wait(); err != nil {
+		return fmt.Errorf("failed waiting for volume %s import: %w", name, err)
+	}
+
+	volume, etag, err := server.GetStoragePoolVolume(pool, customVolume, name)
+	if err != nil {
+		return fmt.Errorf("failed to get imported volume %s: %w", name, err)
+	}
+	put := volume.Writable()
+	if put.Config == nil {
+		put.Config = make(map[string]string)
+	}
+	for key, value := range runlabel.Current().WithLxdConfig(config) {
+		put.Config[key] = value
+	}
+	if description != "" {
+		put.Description = description
+	}
+	if err := server.UpdateStoragePoolVolume(pool, customVolume, name, put, etag); err != nil {
+		return fmt.Errorf("failed to configure imported volume %s: %w", name, err)
+	}
+	return nil
+}
+
+// UnpackStorageVolume creates a filesystem custom volume, labelled with
+// the current run, and unpacks a plain tarball of files into it through
+// the server's SFTP access to the volume, keeping each entry's mode and
+// owner. Symlinks and hard links are recreated; devices and other special
+// files are skipped.
+func UnpackStorageVolume(ctx context.Context, server lxd.InstanceServer, pool, name, tarball, description string, config map[string]string) error {
+	if err := CreateStorageVolume(ctx, server, pool, name, "filesystem", description, config); err != nil {
+		return err
+	}
+	archive, closer, err := openArchive(tarball)
+	if err != nil {
+		return fmt.Errorf("failed to unpack %s into volume %s: %w", tarball, name, err)
+	}
+	defer closer.Close()
+
+	files, err := server.GetStoragePoolVolumeFileSFTP(pool, customVolume, name)
+	if err != nil {
+		return fmt.Errorf("failed to open volume %s for unpacking: %w", name, err)
+	}
+	defer files.Close()
+	if err := unpackArchive(files, "/", archive); err != nil {
+		return fmt.Errorf("failed to unpack %s into volume %s: %w", tarball, name, err)
+	}
+	return nil
+}
+
+// unpackArchive writes the entries of archive below root. Directory
+// modes are set last, deepest first, so a read-only directory is filled
+// before it is restricted. An entry cannot reach above root.
+func unpackArchive(files *sftp.Client, root string, archive *tar.Reader) error {
+	var dirs []*tar.Header
+	for {
+		header, err := archive.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		name := path.Clean("/" + header.Name)
+		if name == "/" {
+			continue
+		}
+		target := path.Join(root, name)
+		if err := files.MkdirAll(path.Dir(target)); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := files.MkdirAll(target); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			header.Name = target
+			dirs = append(dirs, header)
+			continue
+		case tar.TypeReg:
+			file, err := files.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			_, err = io.Copy(file, archive)
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			if err := files.Chmod(target, os.FileMode(header.Mode).Perm()); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+		case tar.TypeSymlink:
+			if err := files.Symlink(header.Linkname, target); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			// Chown would follow the link
+			continue
+		case tar.TypeLink:
+			if err := files.Link(path.Join(root, path.Clean("/"+header.Linkname)), target); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			continue
+		default:
+			continue
+		}
+		if err := files.Chown(target, header.Uid, header.Gid); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+
+	for i := len(dirs) - 1; i >= 0; i-- {
+		dir := dirs[i]
+		if err := files.Chown(dir.Name, dir.Uid, dir.Gid); err != nil {
+			return fmt.Errorf("%s: %w", dir.Name, err)
+		}
+		if err := files.Chmod(dir.Name, os.FileMode(dir.Mode).Perm()); err != nil {
+			return fmt.Errorf("%s: %w", dir.Name, err)
+		}
+	}
+	return nil
+}
+
+// DeleteStorageVolume deletes a custom volume
+func DeleteStorageVolume(ctx context.Context, server lxd.InstanceServer, pool, name string) error {
+	if err := server.DeleteStoragePoolVolume(pool, customVolume, name); err != nil {
+		return fmt.Errorf("failed to delete volume %s from pool %s: %w", name, pool, err)
+	}
+	return nil
+}
+
+// volumeConfig is the config a volume is created with: its config keys,
+// with size set from the size field.
+func volumeConfig(cfg *config.LxdVolumeConfig) map[string]string {
+	keys := make(map[string]string, len(cfg.Config)+1)
+	for key, value := range cfg.Config {
+		keys[key] = value
+	}
+	if cfg.Size != "" {
+		keys["size"] = cfg.Size
+	}
+	return keys
+}
+
+// sizePattern matches the sizes LXD accepts, such as 500MiB or 10GB.
+var sizePattern = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?\s*([kMGTPE]i?B|B)?$`)
+
+// validateStorage checks the storage_pools and volumes entries.
+func validateStorage(cfg *config.LxdConfig) error {
+	pools := make(map[string]bool, len(cfg.StoragePools))
+	for _, pool := range cfg.StoragePools {
+		if pool.Name == "" {
+			return fmt.Errorf("an lxd.storage_pools entry is missing name")
+		}
+		if pools[pool.Name] {
+			return fmt.Errorf("lxd storage pool %q is declared twice", pool.Name)
+		}
+		pools[pool.Name] = true
+		if pool.Driver == "" {
+			return fmt.Errorf("lxd storage pool %s: driver is required (dir, zfs, btrfs, lvm, ...)", pool.Name)
+		}
+	}
+
+	volumes := make(map[string]bool, len(cfg.Volumes))
+	for _, volume := range cfg.Volumes {
+		if volume.Name == "" {
+			return fmt.Errorf("an lxd.volumes entry is missing name")
+		}
+		if volumes[volume.Name] {
+			return fmt.Errorf("lxd volume %q is declared twice", volume.Name)
+		}
+		volumes[volume.Name] = true
+		if volume.Pool == "" {
+			return fmt.Errorf("lxd volume %s: pool is required: a storage_pools entry, or an existing pool such as default", volume.Name)
+		}
+		switch volume.ContentType {
+		case "", "filesystem", "block":
+		default:
+			return fmt.Errorf("lxd volume %s: content_type must be filesystem or block (got %q)", volume.Name, volume.ContentType)
+		}
+		if volume.Size != "" && !sizePattern.MatchString(volume.Size) {
+			return fmt.Errorf("lxd volume %s: size %q is not a size such as 500MiB or 10GiB", volume.Name, volume.Size)
+		}
+		if volume.Source != "" {
+			export, err := isVolumeExport(volume.Source)
+			if err != nil {
+				return fmt.Errorf("lxd volume %s: %w", volume.Name, err)
+			}
+			if export && volume.ContentType != "" {
+				return fmt.Errorf("lxd volume %s: content_type comes from the source export; remove it", volume.Name)
+			}
+			if !export && volume.ContentType == "block" {
+				return fmt.Errorf("lxd volume %s: source %s is a tarball of files, which unpacks into a filesystem volume, not a block one", volume.Name, volume.Source)
+			}
+		}
+	}
+	return nil
+}
+
+// openArchive opens an uncompressed or gzipped tarball, chosen by its
+// extension. It reports os.ErrInvalid for any other file.
+func openArchive(source string) (*tar.Reader, io.Closer, error) {
+	file, err := os.Open(source)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch {
+	case strings.HasSuffix(source, ".tar.gz"), strings.HasSuffix(source, ".tgz"):
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			file.Close()
+			return nil, nil, err
+		}
+		return tar.NewReader(gz), file, nil
+	case strings.HasSuffix(source, ".tar"):
+		return tar.NewReader(file), file, nil
+	}
+	file.Close()
+	return nil, nil, os.ErrInvalid
+}
+
+// isVolumeExport reports whether source is a volume export made by `lxc
+// storage volume export`, which LXD imports whole, rather than a plain
+// tarball of files to unpack into a new volume. Only an uncompressed or
+// gzipped tarball can be read here, so a file in any other format is
+// taken to be an export and left for LXD to read.
+func isVolumeExport(source string) (bool, error) {
+	if _, err := os.Stat(source); err != nil {
+		return false, fmt.Errorf("source: %w", err)
+	}
+	archive, closer, err := openArchive(source)
+	if errors.Is(err, os.ErrInvalid) {
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("source %s: %w", source, err)
+	}
+	defer closer.Close()
+
+	for {
+		header, err := archive.Next()
+		if errors.Is(err, io.EOF) {
+			return false, nil
+		}
+		if err != nil {
+			return false, fmt.Errorf("source %s: %w", source, err)
+		}
+		if strings.TrimPrefix(header.Name, "./") == "backup/index.yaml" {
+			return true, nil
+		}
+	}
+}
+
+// setupStorage creates the suite's storage pools, then its volumes.
+func (w *Wrapper) setupStorage(ctx context.Context) error {
+	for _, pool := range w.cfg.StoragePools {
+		if err := CreateStoragePool(ctx, w.server, w.PoolRef(pool.Name), pool.Driver, pool.Description, pool.Config); err != nil {
+			return err
+		}
+	}
+	for _, volume := range w.cfg.Volumes {
+		pool, name := w.PoolRef(volume.Pool), w.VolumeRef(volume.Name)
+		var err error
+		export := false
+		if volume.Source != "" {
+			if export, err = isVolumeExport(volume.Source); err != nil {
+				return fmt.Errorf("lxd volume %s: %w", volume.Name, err)
+			}
+		}
+		switch {
+		case export:
+			err = ImportStorageVolume(ctx, w.server, pool, name, volume.Source, volume.Description, volumeConfig(volume))
+		case volume.Source != "":
+			err = UnpackStorageVolume(ctx, w.server, pool, name, volume.Source, volume.Description, volumeConfig(volume))
+		default:
+			err = CreateStorageVolume(ctx, w.server, pool, name, volume.ContentType, volume.Description, volumeConfig(volume))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// teardownStorage removes the suite's volumes, then its storage pools.
+// The volumes live in the suite's project, which a teardown-only run has
+// not switched to, so they are addressed through it explicitly.
+func (w *Wrapper) teardownStorage(ctx context.Context) error {
+	server := w.server
+	if w.cfg.Project != nil && w.projectName == "" {
+		server = w.server.UseProject(w.ProjectRef(w.cfg.Project.Name))
+	}
+	for _, volume := range w.cfg.Volumes {
+		if err := DeleteStorageVolume(ctx, server, w.PoolRef(volume.Pool), w.VolumeRef(volume.Name)); err != nil && !IsNotFound(err) {
+			return err
+		}
+	}
+	for _, pool := range w.cfg.StoragePools {
+		if err := DeleteStoragePool(ctx, w.server, w.PoolRef(pool.Name)); err != nil && !IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// PoolRef is the server-side name of a storage pool: a pool the suite
+// declares is scoped by the run ID, and any other, such as default, keeps
+// its own name.
+func (w *Wrapper) PoolRef(name string) string {
+	if w.cfg != nil {
+		for _, pool := range w.cfg.StoragePools {
+			if pool.Name == name {
+				return runlabel.Current().Scoped(name)
+			}
+		}
+	}
+	return name
+}
+
+// VolumeRef is the server-side name of a custom volume: a volume the suite
+// declares is scoped by the run ID, and any other keeps its own name.
+func (w *Wrapper) VolumeRef(name string) string {
+	if w.Volume(name) != nil {
+		return runlabel.Current().Scoped(name)
+	}
+	return name
+}
+
+// DeclaredVolumes maps the names of the volumes the lxd block declares to
+// their declarations, for checking node volume entries without a server.
+func DeclaredVolumes(cfg *config.LxdConfig) map[string]*config.LxdVolumeConfig {
+	volumes := map[string]*config.LxdVolumeConfig{}
+	if cfg == nil {
+		return volumes
+	}
+	for _, volume := range cfg.Volumes {
+		volumes[volume.Name] = volume
+	}
+	return volumes
+}
+
+// Volume returns the suite's declaration of a volume, or nil when the
+// suite does not declare it.
+func (w *Wrapper) Volume(name string) *config.LxdVolumeConfig {
+	if w.cfg == nil {
+		return nil
+	}
+	for _, volume := range w.cfg.Volumes {
+		if volume.Name == name {
+			return volume
+		}
+	}
+	return nil
+}
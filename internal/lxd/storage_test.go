@@ -0,0 +1,275 @@
+package lxd
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bgrewell/dart/internal/config"
+	"github.com/bgrewell/dart/internal/runlabel"
+	lxd "github.com/canonical/lxd/client"
+	"github.com/canonical/lxd/shared/api"
+	"github.com/pkg/sftp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// storageServer keeps pools and volumes in memory and records the calls
+// Setup and Teardown make.
+type storageServer struct {
+	lxd.InstanceServer
+	calls   []string
+	volumes map[string]*api.StorageVolume
+}
+
+func (s *storageServer) CreateStoragePool(pool api.StoragePoolsPost) error {
+	s.calls = append(s.calls, "create pool "+pool.Name+" "+pool.Driver)
+	return nil
+}
+
+func (s *storageServer) DeleteStoragePool(name string) error {
+	s.calls = append(s.calls, "delete pool "+name)
+	return nil
+}
+
+func (s *storageServer) CreateStoragePoolVolume(pool string, volume api.StorageVolumesPost) error {
+	s.calls = append(s.calls, "create volume "+pool+"/"+volume.Name)
+	s.volumes[volume.Name] = &api.StorageVolume{Name: volume.Name, StorageVolumePut: volume.StorageVolumePut}
+	return nil
+}
+
+func (s *storageServer) CreateStoragePoolVolumeFromBackup(pool string, args lxd.StoragePoolVolumeBackupArgs) (lxd.Operation, error) {
+	if _, err := io.ReadAll(args.BackupFile); err != nil {
+		return nil, err
+	}
+	s.calls = append(s.calls, "import volume "+pool+"/"+args.Name)
+	volume := &api.StorageVolume{Name: args.Name}
+	volume.Config = map[string]string{"size": "1GiB"}
+	s.volumes[args.Name] = volume
+	return exitedOperation{}, nil
+}
+
+func (s *storageServer) GetStoragePoolVolume(pool, volType, name string) (*api.StorageVolume, string, error) {
+	return s.volumes[name], "etag", nil
+}
+
+func (s *storageServer) UpdateStoragePoolVolume(pool, volType, name string, volume api.StorageVolumePut, etag string) error {
+	s.volumes[name].StorageVolumePut = volume
+	return nil
+}
+
+func (s *storageServer) DeleteStoragePoolVolume(pool, volType, name string) error {
+	s.calls = append(s.calls, "delete volume "+pool+"/"+name)
+	return nil
+}
+
+func (s *storageServer) GetStoragePoolVolumeFileSFTP(pool, volType, name string) (*sftp.Client, error) {
+	s.calls = append(s.calls, "open files "+pool+"/"+name)
+	return nil, errors.New("sftp unavailable")
+}
+
+// writeExport writes a tarball holding the given file names.
+func writeExport(t *testing.T, path string, names ...string) {
+	t.Helper()
+	file, err := os.Create(path)
+	require.NoError(t, err)
+	defer file.Close()
+	gz := gzip.NewWriter(file)
+	archive := tar.NewWriter(gz)
+	for _, name := range names {
+		require.NoError(t, archive.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: 1}))
+		_, err := archive.Write([]byte("x"))
+		require.NoError(t, err)
+	}
+	require.NoError(t, archive.Close())
+	require.NoError(t, gz.Close())
+}
+
+func TestStorageSetupAndTeardown(t *testing.T) {
+	_, err := runlabel.Start("storage", "ci-1234")
+	require.NoError(t, err)
+	export := filepath.Join(t.TempDir(), "seed.tar.gz")
+	writeExport(t, export, "backup/index.yaml", "backup/volume/data.db")
+
+	server := &storageServer{volumes: map[string]*api.StorageVolume{}}
+	w := &Wrapper{server: server, cfg: &config.LxdConfig{
+		StoragePools: []*config.LxdStoragePoolConfig{{Name: "small", Driver: "btrfs", Config: map[string]string{"size": "2GiB"}}},
+		Volumes: []*config.LxdVolumeConfig{
+			{Name: "scratch", Pool: "small", Size: "500MiB"},
+			{Name: "seed", Pool: "default", Source: export},
+		},
+		Profiles: []*config.LxdProfileConfig{{Name: "web", Devices: map[string]*config.LxdDeviceConfig{
+			"root": {Type: "disk", Path: "/", Pool: "small"},
+			"data": {Type: "disk", Path: "/data", Pool: "small", Opts: map[string]string{"source": "scratch"}},
+		}}},
+	}}
+
+	assert.Equal(t, "small-ci-1234", w.PoolRef("small"))
+	assert.Equal(t, "default", w.PoolRef("default"), "a pool the suite does not create keeps its name")
+	assert.Equal(t, "scratch-ci-1234", w.VolumeRef("scratch"))
+	assert.Equal(t, "shared", w.VolumeRef("shared"))
+	profile := w.scopedProfile(w.cfg.Profiles[0])
+	assert.Equal(t, "small-ci-1234", profile.Devices["root"].Pool)
+	assert.Equal(t, "scratch-ci-1234", profile.Devices["data"].Opts["source"])
+
+	require.NoError(t, w.setupStorage(t.Context()))
+	assert.Equal(t, []string{
+		"create pool small-ci-1234 btrfs",
+		"create volume small-ci-1234/scratch-ci-1234",
+		"import volume default/seed-ci-1234",
+	}, server.calls)
+	assert.Equal(t, "500MiB", server.volumes["scratch-ci-1234"].Config["size"])
+	assert.Equal(t, "ci-1234", server.volumes["scratch-ci-1234"].Config[runlabel.LxdPrefix+runlabel.KeyRunID])
+	assert.Equal(t, "ci-1234", server.volumes["seed-ci-1234"].Config[runlabel.LxdPrefix+runlabel.KeyRunID],
+		"an imported volume is labelled after the import, so dart gc can find it")
+	assert.Equal(t, "1GiB", server.volumes["seed-ci-1234"].Config["size"], "the export's own config is kept")
+
+	server.calls = nil
+	require.NoError(t, w.teardownStorage(t.Context()))
+	assert.Equal(t, []string{
+		"delete volume small-ci-1234/scratch-ci-1234",
+		"delete volume default/seed-ci-1234",
+		"delete pool small-ci-1234",
+	}, server.calls)
+}
+
+func TestValidateStorageConfig(t *testing.T) {
+	dir := t.TempDir()
+	export := filepath.Join(dir, "seed.tar.gz")
+	writeExport(t, export, "backup/index.yaml")
+	plain := filepath.Join(dir, "files.tar.gz")
+	writeExport(t, plain, "data/one.txt")
+
+	validate := func(cfg config.LxdConfig) error { return ValidateConfig(&cfg) }
+	volume := func(v config.LxdVolumeConfig) config.LxdConfig {
+		return config.LxdConfig{Volumes: []*config.LxdVolumeConfig{&v}}
+	}
+
+	assert.NoError(t, validate(config.LxdConfig{
+		StoragePools: []*config.LxdStoragePoolConfig{{Name: "small", Driver: "zfs"}},
+		Volumes: []*config.LxdVolumeConfig{
+			{Name: "scratch", Pool: "small", Size: "1.5GiB"},
+			{Name: "disk", Pool: "small", ContentType: "block", Size: "10GB"},
+			{Name: "seed", Pool: "default", Source: export},
+		},
+	}))
+	assert.ErrorContains(t, validate(config.LxdConfig{StoragePools: []*config.LxdStoragePoolConfig{{Name: "small"}}}),
+		"driver is required")
+	assert.ErrorContains(t, validate(volume(config.LxdVolumeConfig{Name: "scratch"})), "pool is required")
+	assert.ErrorContains(t, validate(volume(config.LxdVolumeConfig{Name: "scratch", Pool: "default", Size: "lots"})),
+		`size "lots" is not a size`)
+	assert.ErrorContains(t, validate(volume(config.LxdVolumeConfig{Name: "scratch", Pool: "default", ContentType: "iso"})),
+		"content_type must be filesystem or block")
+	assert.NoError(t, validate(volume(config.LxdVolumeConfig{Name: "seed", Pool: "default", Source: plain})),
+		"a plain tarball is unpacked into a new volume")
+	assert.NoError(t, validate(volume(config.LxdVolumeConfig{Name: "seed", Pool: "default", Source: plain, ContentType: "filesystem"})))
+	assert.ErrorContains(t, validate(volume(config.LxdVolumeConfig{Name: "seed", Pool: "default", Source: plain, ContentType: "block"})),
+		"unpacks into a filesystem volume")
+	assert.ErrorContains(t, validate(volume(config.LxdVolumeConfig{Name: "seed", Pool: "default", Source: export, ContentType: "filesystem"})),
+		"content_type comes from the source export")
+	assert.ErrorContains(t, validate(volume(config.LxdVolumeConfig{Name: "seed", Pool: "default", Source: filepath.Join(dir, "missing.tar.gz")})),
+		"no such file")
+}
+
+// A plain tarball of files becomes an empty filesystem volume, labelled
+// like any other, that the files are then unpacked into; an export is
+// still imported whole.
+func TestStorageSetupUnpacksPlainTarball(t *testing.T) {
+	_, err := runlabel.Start("storage", "ci-1234")
+	require.NoError(t, err)
+	plain := filepath.Join(t.TempDir(), "fixtures.tar.gz")
+	writeExport(t, plain, "data/one.txt")
+
+	server := &storageServer{volumes: map[string]*api.StorageVolume{}}
+	w := &Wrapper{server: server, cfg: &config.LxdConfig{
+		Volumes: []*config.LxdVolumeConfig{{Name: "fixtures", Pool: "default", Source: plain}},
+	}}
+	err = w.setupStorage(t.Context())
+	assert.ErrorContains(t, err, "failed to open volume fixtures-ci-1234 for unpacking: sftp unavailable")
+	assert.Equal(t, []string{
+		"create volume default/fixtures-ci-1234",
+		"open files default/fixtures-ci-1234",
+	}, server.calls)
+	assert.Equal(t, "ci-1234", server.volumes["fixtures-ci-1234"].Config[runlabel.LxdPrefix+runlabel.KeyRunID])
+}
+
+// newTestSFTPClient connects a client to an SFTP server over an in-memory
+// pipe, the protocol LXD serves a volume's files over.
+func newTestSFTPClient(t *testing.T) *sftp.Client {
+	t.Helper()
+	serverConn, clientConn := net.Pipe()
+	server, err := sftp.NewServer(serverConn)
+	require.NoError(t, err)
+	go server.Serve()
+
+	client, err := sftp.NewClientPipe(clientConn, clientConn)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+	return client
+}
+
+func TestUnpackArchive(t *testing.T) {
+	uid, gid := os.Getuid(), os.Getgid()
+	var buf bytes.Buffer
+	archive := tar.NewWriter(&buf)
+	entries := []struct {
+		header tar.Header
+		body   string
+	}{
+		{tar.Header{Typeflag: tar.TypeDir, Name: "./"}, ""},
+		{tar.Header{Typeflag: tar.TypeDir, Name: "./shared/", Mode: 0o775}, ""},
+		{tar.Header{Typeflag: tar.TypeReg, Name: "./shared/seed.sql", Mode: 0o640}, "INSERT 1;\n"},
+		{tar.Header{Typeflag: tar.TypeDir, Name: "./readonly/", Mode: 0o555}, ""},
+		{tar.Header{Typeflag: tar.TypeReg, Name: "./readonly/ref.txt", Mode: 0o444}, "ref\n"},
+		{tar.Header{Typeflag: tar.TypeSymlink, Name: "./current", Linkname: "shared/seed.sql"}, ""},
+		{tar.Header{Typeflag: tar.TypeLink, Name: "./shared/copy.sql", Linkname: "./shared/seed.sql"}, ""},
+		{tar.Header{Typeflag: tar.TypeFifo, Name: "./pipe", Mode: 0o600}, ""},
+		{tar.Header{Typeflag: tar.TypeReg, Name: "../../escape.txt", Mode: 0o644}, "contained\n"},
+	}
+	for _, entry := range entries {
+		header := entry.header
+		header.Uid, header.Gid, header.Size = uid, gid, int64(len(entry.body))
+		require.NoError(t, archive.WriteHeader(&header))
+		_, err := archive.Write([]byte(entry.body))
+		require.NoError(t, err)
+	}
+	require.NoError(t, archive.Close())
+
+	root := t.TempDir()
+	require.NoError(t, unpackArchive(newTestSFTPClient(t), root, tar.NewReader(&buf)))
+
+	mode := func(name string) os.FileMode {
+		info, err := os.Lstat(filepath.Join(root, name))
+		require.NoError(t, err)
+		return info.Mode()
+	}
+	data, err := os.ReadFile(filepath.Join(root, "shared", "seed.sql"))
+	require.NoError(t, err)
+	assert.Equal(t, "INSERT 1;\n", string(data))
+	assert.Equal(t, os.FileMode(0o640), mode("shared/seed.sql").Perm())
+	assert.Equal(t, os.ModeDir|0o775, mode("shared"), "a group-writable directory keeps its mode")
+	assert.Equal(t, os.ModeDir|0o555, mode("readonly"), "a read-only directory is restricted after it is filled")
+	assert.Equal(t, os.FileMode(0o444), mode("readonly/ref.txt").Perm())
+	target, err := os.Readlink(filepath.Join(root, "current"))
+	require.NoError(t, err)
+	assert.Equal(t, "shared/seed.sql", target)
+	data, err = os.ReadFile(filepath.Join(root, "shared", "copy.sql"))
+	require.NoError(t, err)
+	assert.Equal(t, "INSERT 1;\n", string(data))
+	_, err = os.Lstat(filepath.Join(root, "pipe"))
+	assert.True(t, os.IsNotExist(err), "special files are skipped")
+	data, err = os.ReadFile(filepath.Join(root, "escape.txt"))
+	require.NoError(t, err, "an entry cannot climb above the volume's root")
+	assert.Equal(t, "contained\n", string(data))
+
+	require.NoError(t, os.Chmod(filepath.Join(root, "readonly"), 0o755))
+}
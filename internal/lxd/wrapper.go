@@ -5,9 +5,14 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"maps"
+	"net/netip"
+	"slices"
 
 	"github.com/bgrewell/dart/internal/config"
 	"github.com/bgrewell/dart/internal/platform"
+	"github.com/bgrewell/dart/internal/runlabel"
+	"github.com/bgrewell/dart/internal/subnetpool"
 	"github.com/bgrewell/dart/pkg/ifaces"
 	lxd "github.com/canonical/lxd/client"
 	"github.com/canonical/lxd/shared/api"
@@ -155,20 +160,44 @@ func (w *Wrapper) GetRuntime() platform.Runtime {
 	return w.runtime
 }
 
-// Setup configures the LXD wrapper by creating networks and profiles
+// ValidateConfig checks the lxd block without contacting the server, so
+// --check reports a malformed entry before a run creates half of it.
+func ValidateConfig(cfg *config.LxdConfig) error {
+	if cfg == nil {
+		return nil
+	}
+	if cfg.SubnetPool != "" {
+		if _, err := subnetpool.Parse(cfg.SubnetPool); err != nil {
+			return fmt.Errorf("lxd: %w", err)
+		}
+	}
+	if err := validateNetworks(cfg); err != nil {
+		return err
+	}
+	if err := validateAcls(cfg); err != nil {
+		return err
+	}
+	return validateStorage(cfg)
+}
+
+// Setup configures the LXD wrapper by creating storage, network ACLs,
+// networks and profiles
 func (w *Wrapper) Setup() error {
 	if w.cfg == nil {
 		return nil
 	}
+	if err := ValidateConfig(w.cfg); err != nil {
+		return err
+	}
 
 	ctx := context.Background()
 
 	// Create the project if configured
 	if w.cfg.Project != nil {
-		projectName := w.cfg.Project.Name
-		if projectName == "" {
+		if w.cfg.Project.Name == "" {
 			return fmt.Errorf("project name cannot be empty")
 		}
+		projectName := w.ProjectRef(w.cfg.Project.Name)
 
 		// Create the project
 		if err := CreateProject(ctx, w.server, projectName, w.cfg.Project.Config, w.cfg.Project.Description); err != nil {
@@ -186,19 +215,49 @@ func (w *Wrapper) Setup() error {
 		w.server = w.server.UseProject(projectName)
 	}
 
-	// Create the networks
-	for _, net := range w.cfg.Networks {
+	// Storage comes before the instances that attach its volumes
+	if err := w.setupStorage(ctx); err != nil {
+		return err
+	}
+
+	// ACLs come before the networks and instances that apply them
+	if err := w.setupAcls(ctx); err != nil {
+		return err
+	}
+
+	// Create the networks, bridges before the OVN networks that may route
+	// out through them. One without a subnet is given a free /24 from the
+	// pool; a pick that a concurrent run took first fails to create, and
+	// is retried with the next free block
+	var taken []netip.Prefix
+	for _, net := range w.networksInOrder() {
 		// NAT defaults to true; nat: false yields an air-gapped bridge
 		nat := net.Nat == nil || *net.Nat
-		if err := w.CreateNetwork(net.Name, net.Subnet, net.Gateway, nat); err != nil {
-			return err
+		if net.Subnet != "" {
+			if err := w.createNetwork(ctx, net, net.Subnet, net.Gateway, nat); err != nil {
+				return err
+			}
+			continue
+		}
+		for attempt := 1; ; attempt++ {
+			subnet, err := w.allocateSubnet(ctx, taken)
+			if err != nil {
+				return fmt.Errorf("network %s: %w", net.Name, err)
+			}
+			taken = append(taken, subnet)
+			err = w.createNetwork(ctx, net, subnet.String(), subnetpool.Gateway(subnet).String(), nat)
+			if err == nil {
+				break
+			}
+			if attempt == maxAllocationAttempts {
+				return err
+			}
 		}
 	}
 
-	// Create the profiles
+	// Create the profiles under their run-scoped names
 	for _, profileCfg := range w.cfg.Profiles {
-		profile := configToProfile(profileCfg)
-		if err := CreateProfile(ctx, w.server, profile); err != nil {
+		if err := CreateProfile(ctx, w.server, w.scopedProfile(profileCfg)); err != nil {
 			return err
 		}
 	}
@@ -206,8 +265,8 @@ func (w *Wrapper) Setup() error {
 	return nil
 }
 
-// Teardown removes the profiles and networks created by the wrapper, in
-// reverse creation order (profiles may reference networks). Resources that
+// Teardown removes the profiles, networks, ACLs and storage created by the
+// wrapper, in reverse creation order (profiles may reference networks). Resources that
 // no longer exist — a partial setup, or a previous run's cleanup — count
 // as already removed rather than failing the remaining teardown.
 func (w *Wrapper) Teardown() error {
@@ -220,19 +279,30 @@ func (w *Wrapper) Teardown() error {
 	// Remove the profiles first (skip default profiles)
 	for _, profile := range w.cfg.Profiles {
 		if profile.Name != "default" {
-			if err := DeleteProfile(ctx, w.server, profile.Name); err != nil && !IsNotFound(err) {
+			if err := DeleteProfile(ctx, w.server, w.ProfileRef(profile.Name)); err != nil && !IsNotFound(err) {
 				return err
 			}
 		}
 	}
 
-	// Remove the networks
-	for _, net := range w.cfg.Networks {
-		if err := w.RemoveNetwork(net.Name); err != nil && !IsNotFound(err) {
+	// Remove the networks, OVN networks before their uplinks
+	networks := w.networksInOrder()
+	for i := len(networks) - 1; i >= 0; i-- {
+		if err := w.RemoveNetwork(networks[i].Name); err != nil && !IsNotFound(err) {
 			return err
 		}
 	}
 
+	// Remove the ACLs, which nothing applies any more
+	if err := w.teardownAcls(ctx); err != nil {
+		return err
+	}
+
+	// Remove the volumes, which node teardown has detached, and the pools
+	if err := w.teardownStorage(ctx); err != nil {
+		return err
+	}
+
 	// Delete the project if it was created
 	if w.projectName != "" {
 		// Note: Instances should be deleted by node teardown before this point.
@@ -318,21 +388,58 @@ func (w *Wrapper) RemoveInstance(name string) error {
 	return nil
 }
 
-// CreateNetwork creates a new network. nat controls ipv4.nat on the bridge;
-// pass false for air-gapped networks.
+// CreateNetwork creates a new network under the name NetworkRef gives it.
+// nat controls ipv4.nat on the bridge; pass false for air-gapped networks.
 func (w *Wrapper) CreateNetwork(name string, subnet string, gateway string, nat bool) error {
 	ctx := context.Background()
-	if err := CreateBridgeNetwork(ctx, w.server, name, subnet, gateway, nat); err != nil {
+	if err := CreateBridgeNetwork(ctx, w.server, w.NetworkRef(name), subnet, gateway, nat); err != nil {
+		return fmt.Errorf("could not create network: %w", err)
+	}
+	w.networkNamesToId[name] = w.NetworkRef(name)
+	return nil
+}
+
+// createNetwork creates one of the suite's networks under the name
+// NetworkRef gives it, with its ACLs, uplink and further config.
+func (w *Wrapper) createNetwork(ctx context.Context, cfg *config.LxdNetworkConfig, subnet, gateway string, nat bool) error {
+	keys := maps.Clone(cfg.Config)
+	if len(cfg.Acls) > 0 {
+		if keys == nil {
+			keys = make(map[string]string)
+		}
+		keys["security.acls"] = w.AclRefs(cfg.Acls)
+	}
+	var err error
+	if cfg.Type == "ovn" {
+		err = CreateOvnNetwork(ctx, w.server, w.NetworkRef(cfg.Name), w.NetworkRef(cfg.Uplink), subnet, gateway, nat, keys)
+	} else {
+		err = createAddressedNetwork(ctx, w.server, w.NetworkRef(cfg.Name), "bridge", subnet, gateway, nat, keys)
+	}
+	if err != nil {
 		return fmt.Errorf("could not create network: %w", err)
 	}
-	w.networkNamesToId[name] = name
+	w.networkNamesToId[cfg.Name] = w.NetworkRef(cfg.Name)
 	return nil
 }
 
+// networksInOrder lists the suite's networks in creation order: bridges
+// first, then the OVN networks that may use them as uplinks.
+func (w *Wrapper) networksInOrder() []*config.LxdNetworkConfig {
+	ovn := func(net *config.LxdNetworkConfig) int {
+		if net.Type == "ovn" {
+			return 1
+		}
+		return 0
+	}
+	ordered := slices.Clone(w.cfg.Networks)
+	slices.SortStableFunc(ordered, func(a, b *config.LxdNetworkConfig) int { return ovn(a) - ovn(b) })
+	return ordered
+}
+
 // RemoveNetwork removes a network
 func (w *Wrapper) RemoveNetwork(name string) error {
 	ctx := context.Background()
-	if err := DeleteNetwork(ctx, w.server, name); err != nil {
+	if err := DeleteNetwork(ctx, w.server, w.NetworkRef(name)); err != nil {
 		return fmt.Errorf("could not remove network: %w", err)
 	}
 	delete(w.networkNamesToId, name)
@@ -350,7 +457,7 @@ func (w *Wrapper) ConnectInstanceToNetworkWithIP(instanceName, networkName, devi
 	if deviceName == "" {
 		deviceName = "eth-" + networkName
 	}
-	return AttachNetworkToInstanceWithIP(ctx, w.server, instanceName, networkName, deviceName, ipAddress)
+	return AttachNetworkToInstanceWithIP(ctx, w.server, instanceName, w.NetworkRef(networkName), deviceName, ipAddress)
 }
 
 // DisconnectInstanceFromNetwork disconnects an instance from a network
@@ -417,6 +524,127 @@ func (w *Wrapper) DeleteSnapshot(instanceName, snapshotName string) error {
 	return DeleteInstanceSnapshot(ctx, w.server, instanceName, snapshotName)
 }
 
+// maxBridgeName is the kernel's limit on an interface name, which an LXD
+// bridge network's name becomes.
+const maxBridgeName = 15
+
+// maxAllocationAttempts bounds the retries when concurrent runs race for
+// the same free block.
+const maxAllocationAttempts = 3
+
+// NetworkRef is the server-side name of a network. A network the suite
+// declares is scoped by the run ID, shortened to fit a bridge name; any
+// other network, such as lxdbr0, keeps its own name.
+func (w *Wrapper) NetworkRef(name string) string {
+	if w.cfg != nil {
+		for _, net := range w.cfg.Networks {
+			if net.Name == name {
+				return runlabel.Current().ScopedShort(name, maxBridgeName)
+			}
+		}
+	}
+	return name
+}
+
+// ProfileRef is the server-side name of a profile. A profile the suite
+// declares is scoped by the run ID; default and any other profile keep
+// their own names.
+func (w *Wrapper) ProfileRef(name string) string {
+	if w.cfg != nil && name != "default" {
+		for _, profile := range w.cfg.Profiles {
+			if profile.Name == name {
+				return runlabel.Current().Scoped(name)
+			}
+		}
+	}
+	return name
+}
+
+// ProjectRef is the server-side name of a project: the suite's own project
+// is scoped by the run ID, and any other keeps its name.
+func (w *Wrapper) ProjectRef(name string) string {
+	if w.cfg != nil && w.cfg.Project != nil && w.cfg.Project.Name == name && name != DefaultProject {
+		return runlabel.Current().Scoped(name)
+	}
+	return name
+}
+
+// DeclaredProject returns the name of the project the lxd block creates
+// for each run, or "" when it declares none, for checking nodes without a
+// server.
+func DeclaredProject(cfg *config.LxdConfig) string {
+	if cfg == nil || cfg.Project == nil || cfg.Project.Name == DefaultProject {
+		return ""
+	}
+	return cfg.Project.Name
+}
+
+// scopedProfile renders a suite profile under its run-scoped name, with
+// NIC devices pointed at the run's networks and ACLs, and disk devices at
+// its pools and volumes. The suite's config is left untouched.
+func (w *Wrapper) scopedProfile(cfg *config.LxdProfileConfig) *Profile {
+	profile := configToProfile(cfg)
+	profile.Name = w.ProfileRef(profile.Name)
+	for name, device := range profile.Devices {
+		if network, ok := device.Opts["network"]; ok {
+			opts := make(map[string]string, len(device.Opts))
+			for key, value := range device.Opts {
+				opts[key] = value
+			}
+			opts["network"] = w.NetworkRef(network)
+			if acls, ok := opts["security.acls"]; ok {
+				opts["security.acls"] = w.AclRefs(splitList(acls))
+			}
+			device.Opts = opts
+			profile.Devices[name] = device
+		}
+		// A disk on one of the suite's pools, such as a root disk on a
+		// small pool for disk-full tests, or one of its volumes
+		if device.Pool != "" {
+			device.Pool = w.PoolRef(device.Pool)
+			if source, ok := device.Opts["source"]; ok {
+				opts := make(map[string]string, len(device.Opts))
+				for key, value := range device.Opts {
+					opts[key] = value
+				}
+				opts["source"] = w.VolumeRef(source)
+				device.Opts = opts
+			}
+			profile.Devices[name] = device
+		}
+	}
+	return profile
+}
+
+// allocateSubnet picks a block from lxd.subnet_pool that no LXD network,
+// host interface, pinned suite network or earlier pick uses.
+func (w *Wrapper) allocateSubnet(ctx context.Context, taken []netip.Prefix) (netip.Prefix, error) {
+	poolRange := w.cfg.SubnetPool
+	if poolRange == "" {
+		poolRange = subnetpool.DefaultPool
+	}
+	pool, err := subnetpool.Parse(poolRange)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	networks, err := ListNetworks(ctx, w.server)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("could not list networks to allocate a subnet: %w", err)
+	}
+	inUse := append(subnetpool.HostPrefixes(), taken...)
+	for _, network := range networks {
+		if prefix, err := netip.ParsePrefix(network.Config["ipv4.address"]); err == nil {
+			inUse = append(inUse, prefix.Masked())
+		}
+	}
+	for _, net := range w.cfg.Networks {
+		if prefix, err := netip.ParsePrefix(net.Subnet); err == nil {
+			inUse = append(inUse, prefix)
+		}
+	}
+	return pool.Allocate(runlabel.Current().ID, inUse)
+}
+
 // InstanceOption is a function type that sets options for creating an instance
 type InstanceOption func(*InstanceConfig)
 
@@ -0,0 +1,245 @@
+// Package netns manages Linux network namespaces and the host bridges that
+// connect them, by driving iproute2 on the machine running DART.
+//
+// Rationale: a routing or firewall topology needs many hosts but little
+// else of them. A namespace has its own interfaces, addresses, routes, and
+// netfilter state, and costs milliseconds to create where a container
+// costs seconds, so a suite can model dozens of hosts cheaply.
+package netns
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/bgrewell/dart/internal/helpers"
+)
+
+// MaxInterfaceName is the kernel's limit on an interface name (IFNAMSIZ
+// less the terminating NUL).
+const MaxInterfaceName = 15
+
+// IsNotFound reports whether an iproute2 error means the namespace or
+// device is already gone, which teardown treats as done.
+func IsNotFound(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "Cannot find device") ||
+		strings.Contains(msg, "No such file or directory") ||
+		strings.Contains(msg, "does not exist")
+}
+
+// ExecCommand wraps a shell command so it runs inside the namespace. The
+// command is quoted whole, so pipes and redirects apply inside rather than
+// to the ip process.
+func ExecCommand(namespace, command string, sudo bool) string {
+	prefix := ""
+	if sudo {
+		prefix = "sudo -n "
+	}
+	return fmt.Sprintf("%sip netns exec %s sh -c %s", prefix, helpers.ShellQuote(namespace), helpers.ShellQuote(command))
+}
+
+// HostVethName derives the host-side name of a namespace's veth. Names are
+// limited to 15 bytes, too few for the namespace name, so it is a short
+// hash of the namespace plus the interface index — stable across runs, so
+// a teardown-only run finds the same device.
+func HostVethName(namespace string, index int) string {
+	h := fnv.New32a()
+	h.Write([]byte(namespace))
+	return fmt.Sprintf("dn%08x%d", h.Sum32(), index)
+}
+
+// CreateNamespace adds the namespace and brings its loopback up; a fresh
+// namespace has lo down, which breaks anything binding to localhost.
+func CreateNamespace(run helpers.HostRunner, namespace string) error {
+	if _, err := run(fmt.Sprintf("ip netns add %s", helpers.ShellQuote(namespace))); err != nil {
+		return fmt.Errorf("failed to create namespace %s: %w", namespace, err)
+	}
+	if _, err := run(fmt.Sprintf("ip -n %s link set lo up", helpers.ShellQuote(namespace))); err != nil {
+		return fmt.Errorf("failed to bring up loopback in namespace %s: %w", namespace, err)
+	}
+	return nil
+}
+
+// DeleteNamespace removes the namespace. Its veth ends go with it, and the
+// kernel removes their host-side peers in turn.
+func DeleteNamespace(run helpers.HostRunner, namespace string) error {
+	if _, err := run(fmt.Sprintf("ip netns del %s", helpers.ShellQuote(namespace))); err != nil {
+		return fmt.Errorf("failed to delete namespace %s: %w", namespace, err)
+	}
+	return nil
+}
+
+// Interface describes one veth link from a namespace to a host bridge.
+type Interface struct {
+	// Name is the interface name inside the namespace
+	Name string
+	// HostName is the peer's name on the host
+	HostName string
+	Bridge   string
+	// Address is assigned inside the namespace in CIDR form. Optional.
+	Address string
+}
+
+// AddInterface creates a veth pair with one end already in the namespace,
+// addresses and raises that end, and enslaves the host end to the bridge.
+func AddInterface(run helpers.HostRunner, namespace string, iface Interface) error {
+	ns := helpers.ShellQuote(namespace)
+	commands := []string{
+		fmt.Sprintf("ip link add %s type veth peer name %s netns %s",
+			helpers.ShellQuote(iface.HostName), helpers.ShellQuote(iface.Name), ns),
+	}
+	if iface.Address != "" {
+		commands = append(commands, fmt.Sprintf("ip -n %s addr add %s dev %s",
+			ns, helpers.ShellQuote(iface.Address), helpers.ShellQuote(iface.Name)))
+	}
+	commands = append(commands,
+		fmt.Sprintf("ip -n %s link set %s up", ns, helpers.ShellQuote(iface.Name)),
+		fmt.Sprintf("ip link set %s master %s", helpers.ShellQuote(iface.HostName), helpers.ShellQuote(iface.Bridge)),
+		fmt.Sprintf("ip link set %s up", helpers.ShellQuote(iface.HostName)),
+	)
+
+	for _, command := range commands {
+		if _, err := run(command); err != nil {
+			return fmt.Errorf("failed to connect %s in namespace %s to bridge %s: %w", iface.Name, namespace, iface.Bridge, err)
+		}
+	}
+	return nil
+}
+
+// AddRoute installs a route inside the namespace, written as `ip route add`
+// takes it ("default via 10.10.0.1", "10.20.0.0/24 via 10.10.0.2").
+func AddRoute(run helpers.HostRunner, namespace, route string) error {
+	// The route is split into words rather than quoted whole: ip parses
+	// it as separate arguments
+	args := make([]string, 0, 4)
+	for _, field := range strings.Fields(route) {
+		args = append(args, helpers.ShellQuote(field))
+	}
+	if _, err := run(fmt.Sprintf("ip -n %s route add %s", helpers.ShellQuote(namespace), strings.Join(args, " "))); err != nil {
+		return fmt.Errorf("failed to add route %q in namespace %s: %w", route, namespace, err)
+	}
+	return nil
+}
+
+// SetSysctl sets a kernel parameter scoped to the namespace, such as
+// net.ipv4.ip_forward for a router.
+func SetSysctl(run helpers.HostRunner, namespace, key, value string) error {
+	command := fmt.Sprintf("ip netns exec %s sysctl -w %s", helpers.ShellQuote(namespace), helpers.ShellQuote(key+"="+value))
+	if _, err := run(command); err != nil {
+		return fmt.Errorf("failed to set %s in namespace %s: %w", key, namespace, err)
+	}
+	return nil
+}
+
+// resolvConfDir is where `ip netns exec` looks for per-namespace files to
+// bind over /etc.
+const resolvConfDir = "/etc/netns"
+
+// WriteResolvConf gives the namespace its own resolvers. `ip netns exec`
+// bind-mounts /etc/netns/<name>/resolv.conf over /etc/resolv.conf, so DNS
+// probes run on the node see these servers rather than the host's.
+func WriteResolvConf(run helpers.HostRunner, namespace string, nameservers []string) error {
+	var contents strings.Builder
+	for _, server := range nameservers {
+		fmt.Fprintf(&contents, "nameserver %s\n", server)
+	}
+	dir := resolvConfDir + "/" + namespace
+	command := fmt.Sprintf("mkdir -p %s && printf '%%s' %s > %s",
+		helpers.ShellQuote(dir), helpers.ShellQuote(contents.String()), helpers.ShellQuote(dir+"/resolv.conf"))
+	if _, err := run(command); err != nil {
+		return fmt.Errorf("failed to write resolvers for namespace %s: %w", namespace, err)
+	}
+	return nil
+}
+
+// RemoveNamespaceFiles deletes the /etc/netns entry WriteResolvConf made.
+func RemoveNamespaceFiles(run helpers.HostRunner, namespace string) error {
+	if _, err := run(fmt.Sprintf("rm -rf %s", helpers.ShellQuote(resolvConfDir+"/"+namespace))); err != nil {
+		return fmt.Errorf("failed to remove files for namespace %s: %w", namespace, err)
+	}
+	return nil
+}
+
+// AddressFacts reads the namespace's addresses from `ip -j addr show`.
+// Loopback and link-local addresses are skipped; the first global address
+// per family becomes the bare "ipv4"/"ipv6" fact, and every address is
+// also exposed per interface ("ipv4.eth0"), matching the other node types.
+func AddressFacts(run helpers.HostRunner, namespace string) (map[string]string, error) {
+	out, err := run(fmt.Sprintf("ip -n %s -j addr show", helpers.ShellQuote(namespace)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read addresses in namespace %s: %w", namespace, err)
+	}
+	return ParseAddressFacts(out)
+}
+
+// ParseAddressFacts turns `ip -j addr show` output into facts.
+func ParseAddressFacts(out string) (map[string]string, error) {
+	var links []struct {
+		IfName   string `json:"ifname"`
+		AddrInfo []struct {
+			Family string `json:"family"`
+			Local  string `json:"local"`
+			Scope  string `json:"scope"`
+		} `json:"addr_info"`
+	}
+	if err := json.Unmarshal([]byte(out), &links); err != nil {
+		return nil, fmt.Errorf("could not parse ip address output: %w", err)
+	}
+	sort.SliceStable(links, func(i, j int) bool { return links[i].IfName < links[j].IfName })
+
+	facts := make(map[string]string)
+	for _, link := range links {
+		if link.IfName == "lo" {
+			continue
+		}
+		for _, addr := range link.AddrInfo {
+			if addr.Scope != "global" {
+				continue
+			}
+			family := "ipv4"
+			if addr.Family == "inet6" {
+				family = "ipv6"
+			}
+			if _, exists := facts[family]; !exists {
+				facts[family] = addr.Local
+			}
+			key := fmt.Sprintf("%s.%s", family, link.IfName)
+			if _, exists := facts[key]; !exists {
+				facts[key] = addr.Local
+			}
+		}
+	}
+	return facts, nil
+}
+
+// ValidateInterfaceName checks a name against the kernel's rules, which
+// iproute2 otherwise reports as a bare "Invalid argument".
+func ValidateInterfaceName(name string) error {
+	if name == "" {
+		return fmt.Errorf("interface name is empty")
+	}
+	if len(name) > MaxInterfaceName {
+		return fmt.Errorf("interface name %q is longer than %d characters", name, MaxInterfaceName)
+	}
+	if strings.ContainsAny(name, "/: \t") {
+		return fmt.Errorf("interface name %q contains a character Linux does not allow", name)
+	}
+	return nil
+}
+
+// ValidateAddress checks an interface address is in CIDR form: without a
+// prefix length the kernel assumes /32, and the namespace can reach
+// nothing on the bridge.
+func ValidateAddress(address string) error {
+	if _, _, err := net.ParseCIDR(address); err != nil {
+		return fmt.Errorf("address %q must be in CIDR form, e.g. 10.10.0.2/24", address)
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package netns
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recorder captures the commands a sequence issues and answers each from
+// a canned output, so the sequences can be asserted without root.
+type recorder struct {
+	commands []string
+	outputs  map[string]string
+	failOn   map[string]error
+}
+
+func (r *recorder) run(command string) (string, error) {
+	r.commands = append(r.commands, command)
+	if err, ok := r.failOn[command]; ok {
+		return "", err
+	}
+	return r.outputs[command], nil
+}
+
+func TestCreateNamespaceRaisesLoopback(t *testing.T) {
+	rec := &recorder{}
+	require.NoError(t, CreateNamespace(rec.run, "dart-r1"))
+	assert.Equal(t, []string{
+		"ip netns add 'dart-r1'",
+		"ip -n 'dart-r1' link set lo up",
+	}, rec.commands)
+}
+
+// The namespace end is created in place, then the host end joins the
+// bridge; addressing only happens when the suite asks for it.
+func TestAddInterfaceSequence(t *testing.T) {
+	rec := &recorder{}
+	require.NoError(t, AddInterface(rec.run, "dart-r1", Interface{
+		Name: "eth0", HostName: "dnabc0", Bridge: "br-lab", Address: "10.10.0.2/24",
+	}))
+	assert.Equal(t, []string{
+		"ip link add 'dnabc0' type veth peer name 'eth0' netns 'dart-r1'",
+		"ip -n 'dart-r1' addr add '10.10.0.2/24' dev 'eth0'",
+		"ip -n 'dart-r1' link set 'eth0' up",
+		"ip link set 'dnabc0' master 'br-lab'",
+		"ip link set 'dnabc0' up",
+	}, rec.commands)
+
+	rec = &recorder{}
+	require.NoError(t, AddInterface(rec.run, "dart-r1", Interface{Name: "eth0", HostName: "dnabc0", Bridge: "br-lab"}))
+	assert.NotContains(t, rec.commands, "ip -n 'dart-r1' addr add '' dev 'eth0'")
+	assert.Len(t, rec.commands, 4)
+}
+
+func TestAddInterfaceNamesTheBridgeOnFailure(t *testing.T) {
+	rec := &recorder{failOn: map[string]error{
+		"ip link set 'dnabc0' master 'br-missing'": errors.New("Cannot find device \"br-missing\""),
+	}}
+	err := AddInterface(rec.run, "dart-r1", Interface{Name: "eth0", HostName: "dnabc0", Bridge: "br-missing"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "bridge br-missing")
+}
+
+// A route is split into ip's arguments, each quoted, so a value arriving
+// from a var cannot run anything on the host.
+func TestAddRouteQuotesEachWord(t *testing.T) {
+	rec := &recorder{}
+	require.NoError(t, AddRoute(rec.run, "dart-r1", "default via 10.10.0.1"))
+	assert.Equal(t, []string{"ip -n 'dart-r1' route add 'default' 'via' '10.10.0.1'"}, rec.commands)
+}
+
+func TestExecCommandQuotesWholeCommand(t *testing.T) {
+	assert.Equal(t, `ip netns exec 'dart-r1' sh -c 'ping -c1 10.0.0.1 | grep '\''1 received'\'''`,
+		ExecCommand("dart-r1", "ping -c1 10.0.0.1 | grep '1 received'", false))
+	assert.Equal(t, "sudo -n ip netns exec 'dart-r1' sh -c 'true'", ExecCommand("dart-r1", "true", true))
+}
+
+// Host-side names must fit the kernel's 15-byte limit and be the same on
+// every run, so a teardown-only run finds the device it made.
+func TestHostVethNameIsShortAndStable(t *testing.T) {
+	name := HostVethName("dart-a-very-long-namespace-name", 12)
+	assert.LessOrEqual(t, len(name), MaxInterfaceName)
+	assert.Equal(t, name, HostVethName("dart-a-very-long-namespace-name", 12))
+	assert.NotEqual(t, name, HostVethName("dart-another", 12))
+}
+
+func TestParseAddressFacts(t *testing.T) {
+	out := `[
+ {"ifname":"lo","addr_info":[{"family":"inet","local":"127.0.0.1","scope":"host"}]},
+ {"ifname":"eth1","addr_info":[{"family":"inet","local":"10.20.0.2","scope":"global"}]},
+ {"ifname":"eth0","addr_info":[
+   {"family":"inet","local":"10.10.0.2","scope":"global"},
+   {"family":"inet6","local":"fd00::2","scope":"global"},
+   {"family":"inet6","local":"fe80::1","scope":"link"}]}
+]`
+	facts, err := ParseAddressFacts(out)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"ipv4":      "10.10.0.2",
+		"ipv4.eth0": "10.10.0.2",
+		"ipv4.eth1": "10.20.0.2",
+		"ipv6":      "fd00::2",
+		"ipv6.eth0": "fd00::2",
+	}, facts)
+}
+
+func TestIsNotFound(t *testing.T) {
+	assert.True(t, IsNotFound(errors.New(`Cannot find device "br-lab"`)))
+	assert.True(t, IsNotFound(errors.New(`Cannot remove namespace file "/run/netns/x": No such file or directory`)))
+	assert.False(t, IsNotFound(errors.New("Operation not permitted")))
+	assert.False(t, IsNotFound(nil))
+}
+
+func TestValidateAddressRequiresPrefix(t *testing.T) {
+	assert.NoError(t, ValidateAddress("10.10.0.2/24"))
+	assert.ErrorContains(t, ValidateAddress("10.10.0.2"), "CIDR")
+}
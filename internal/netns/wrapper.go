@@ -0,0 +1,108 @@
+package netns
+
+import (
+	"fmt"
+
+	"github.com/bgrewell/dart/internal/config"
+	"github.com/bgrewell/dart/internal/helpers"
+	"github.com/bgrewell/dart/pkg/ifaces"
+)
+
+// Ensure Wrapper implements the PlatformManager interface
+var _ ifaces.PlatformManager = &Wrapper{}
+
+// NewWrapper creates the manager for the suite's netns block. It touches
+// nothing until Setup.
+func NewWrapper(cfg *config.NetnsConfig) *Wrapper {
+	sudo := cfg != nil && cfg.Sudo
+	return &Wrapper{
+		cfg: cfg,
+		run: helpers.NewHostRunner(sudo),
+	}
+}
+
+// Wrapper creates and removes the host bridges netns nodes attach to.
+type Wrapper struct {
+	cfg *config.NetnsConfig
+	run helpers.HostRunner
+}
+
+// Configured returns true if the suite declares a netns block
+func (w *Wrapper) Configured() bool {
+	return w.cfg != nil
+}
+
+// Name returns the name of this platform manager
+func (w *Wrapper) Name() string {
+	return "netns"
+}
+
+// Setup creates each declared bridge, assigns its address, and brings it up
+func (w *Wrapper) Setup() error {
+	if err := ValidateConfig(w.cfg); err != nil {
+		return err
+	}
+	for _, bridge := range w.cfg.Bridges {
+		name := helpers.ShellQuote(bridge.Name)
+		commands := []string{fmt.Sprintf("ip link add name %s type bridge", name)}
+		if bridge.Address != "" {
+			commands = append(commands, fmt.Sprintf("ip addr add %s dev %s", helpers.ShellQuote(bridge.Address), name))
+		}
+		commands = append(commands, fmt.Sprintf("ip link set %s up", name))
+
+		for _, command := range commands {
+			if _, err := w.run(command); err != nil {
+				return fmt.Errorf("failed to create bridge %s: %w", bridge.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Teardown removes the declared bridges. A bridge that no longer exists
+// counts as already removed, as for the other platforms.
+func (w *Wrapper) Teardown() error {
+	for _, bridge := range w.cfg.Bridges {
+		if _, err := w.run(fmt.Sprintf("ip link del %s", helpers.ShellQuote(bridge.Name))); err != nil && !IsNotFound(err) {
+			return fmt.Errorf("failed to remove bridge %s: %w", bridge.Name, err)
+		}
+	}
+	return nil
+}
+
+// ValidateConfig checks the netns block without touching the host, so
+// --check reports a bad bridge before a run creates half of them.
+func ValidateConfig(cfg *config.NetnsConfig) error {
+	if cfg == nil {
+		return nil
+	}
+	seen := make(map[string]bool, len(cfg.Bridges))
+	for _, bridge := range cfg.Bridges {
+		if err := ValidateInterfaceName(bridge.Name); err != nil {
+			return fmt.Errorf("netns bridge: %w", err)
+		}
+		if seen[bridge.Name] {
+			return fmt.Errorf("netns bridge %q is declared twice", bridge.Name)
+		}
+		seen[bridge.Name] = true
+		if bridge.Address != "" {
+			if err := ValidateAddress(bridge.Address); err != nil {
+				return fmt.Errorf("netns bridge %s: %w", bridge.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// BridgeNames lists the bridges a netns block declares, for checking the
+// nodes that reference them.
+func BridgeNames(cfg *config.NetnsConfig) map[string]bool {
+	names := map[string]bool{}
+	if cfg == nil {
+		return names
+	}
+	for _, bridge := range cfg.Bridges {
+		names[bridge.Name] = true
+	}
+	return names
+}
@@ -0,0 +1,59 @@
+package netns
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/bgrewell/dart/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWrapperSetupCreatesBridges(t *testing.T) {
+	rec := &recorder{}
+	w := &Wrapper{
+		cfg: &config.NetnsConfig{Bridges: []*config.NetnsBridgeConfig{
+			{Name: "br-lab", Address: "10.10.0.1/24"},
+			{Name: "br-wan"},
+		}},
+		run: rec.run,
+	}
+
+	require.NoError(t, w.Setup())
+	assert.Equal(t, []string{
+		"ip link add name 'br-lab' type bridge",
+		"ip addr add '10.10.0.1/24' dev 'br-lab'",
+		"ip link set 'br-lab' up",
+		"ip link add name 'br-wan' type bridge",
+		"ip link set 'br-wan' up",
+	}, rec.commands)
+}
+
+// A bridge already gone — partial setup, teardown-only run — is not an
+// error, matching the docker and lxd platforms.
+func TestWrapperTeardownToleratesMissingBridge(t *testing.T) {
+	rec := &recorder{failOn: map[string]error{
+		"ip link del 'br-lab'": errors.New(`Cannot find device "br-lab"`),
+	}}
+	w := &Wrapper{
+		cfg: &config.NetnsConfig{Bridges: []*config.NetnsBridgeConfig{{Name: "br-lab"}, {Name: "br-wan"}}},
+		run: rec.run,
+	}
+
+	require.NoError(t, w.Teardown())
+	assert.Equal(t, []string{"ip link del 'br-lab'", "ip link del 'br-wan'"}, rec.commands)
+}
+
+func TestValidateConfig(t *testing.T) {
+	assert.NoError(t, ValidateConfig(nil))
+	assert.NoError(t, ValidateConfig(&config.NetnsConfig{Bridges: []*config.NetnsBridgeConfig{{Name: "br-lab", Address: "10.10.0.1/24"}}}))
+
+	err := ValidateConfig(&config.NetnsConfig{Bridges: []*config.NetnsBridgeConfig{{Name: "br-much-too-long-name"}}})
+	assert.ErrorContains(t, err, "longer than 15")
+
+	err = ValidateConfig(&config.NetnsConfig{Bridges: []*config.NetnsBridgeConfig{{Name: "br-lab"}, {Name: "br-lab"}}})
+	assert.ErrorContains(t, err, "declared twice")
+
+	err = ValidateConfig(&config.NetnsConfig{Bridges: []*config.NetnsBridgeConfig{{Name: "br-lab", Address: "10.10.0.1"}}})
+	assert.ErrorContains(t, err, "CIDR")
+}
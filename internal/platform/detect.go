@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 )
@@ -12,21 +14,30 @@ import (
 type Runtime string
 
 const (
-	RuntimeLXD   Runtime = "lxd"
-	RuntimeIncus Runtime = "incus"
+	RuntimeLXD    Runtime = "lxd"
+	RuntimeIncus  Runtime = "incus"
+	RuntimeDocker Runtime = "docker"
+	RuntimePodman Runtime = "podman"
 )
 
 // DetectionResult contains the detection outcome
 type DetectionResult struct {
 	Runtime    Runtime
 	SocketPath string
+	// Rootless is set for a Podman socket owned by an unprivileged user.
+	// Such a runtime cannot bind host ports below 1024 and its privileged
+	// containers hold only the invoking user's privileges.
+	Rootless bool
 }
 
-// socketPaths defines the socket paths to check in priority order
-var socketPaths = []struct {
+// socketCandidate is one socket path to probe and the runtime it implies
+type socketCandidate struct {
 	path    string
 	runtime Runtime
-}{
+}
+
+// socketPaths defines the socket paths to check in priority order
+var socketPaths = []socketCandidate{
 	{"/var/lib/incus/unix.socket", RuntimeIncus},
 	{"/var/snap/lxd/common/lxd/unix.socket", RuntimeLXD},
 	{"/var/lib/lxd/unix.socket", RuntimeLXD},
@@ -95,6 +106,84 @@ func isSocketAccessible(path string) bool {
 	return true
 }
 
+// containerSocketPaths lists the Docker-compatible API sockets in priority
+// order. The rootless Podman socket lives under the user's runtime
+// directory, so the list is built per call rather than fixed.
+func containerSocketPaths() []socketCandidate {
+	paths := []socketCandidate{{"/var/run/docker.sock", RuntimeDocker}}
+	if dir := userRuntimeDir(); dir != "" {
+		paths = append(paths, socketCandidate{filepath.Join(dir, "podman", "podman.sock"), RuntimePodman})
+	}
+	return append(paths, socketCandidate{"/run/podman/podman.sock", RuntimePodman})
+}
+
+// userRuntimeDir returns $XDG_RUNTIME_DIR, falling back to the systemd
+// default for the current user. Root has no per-user Podman socket.
+func userRuntimeDir() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return dir
+	}
+	if uid := os.Getuid(); uid > 0 {
+		return fmt.Sprintf("/run/user/%d", uid)
+	}
+	return ""
+}
+
+// DetectContainerRuntime finds a Docker-compatible API socket: the Docker
+// daemon first, then rootless Podman, then system Podman. Unlike
+// DetectRuntime the result is not cached — the docker wrapper asks once
+// per process, and tests move $XDG_RUNTIME_DIR between calls.
+func DetectContainerRuntime() (*DetectionResult, error) {
+	return detectContainerSocket("")
+}
+
+// DetectPodmanRuntime is DetectContainerRuntime restricted to Podman
+// sockets, for suites that pin the runtime with podman nodes.
+func DetectPodmanRuntime() (*DetectionResult, error) {
+	return detectContainerSocket(RuntimePodman)
+}
+
+func detectContainerSocket(only Runtime) (*DetectionResult, error) {
+	checked := make([]string, 0, 3)
+	for _, s := range containerSocketPaths() {
+		if only != "" && s.runtime != only {
+			continue
+		}
+		checked = append(checked, s.path)
+		if isSocketAccessible(s.path) {
+			// podman-docker installs /var/run/docker.sock as a link to the
+			// Podman socket; classify by what the path resolves to
+			target := s.path
+			if resolved, err := filepath.EvalSymlinks(s.path); err == nil {
+				target = resolved
+			}
+			result := InferContainerRuntime(target)
+			result.SocketPath = s.path
+			return &result, nil
+		}
+	}
+	name := "Docker or Podman"
+	if only == RuntimePodman {
+		name = "Podman"
+	}
+	return nil, fmt.Errorf("no %s API socket detected; checked paths: %s", name, strings.Join(checked, ", "))
+}
+
+// InferContainerRuntime classifies an explicitly configured socket path or
+// DOCKER_HOST value. Podman is recognized by its socket name, and a socket
+// under a per-user runtime directory is a rootless one.
+func InferContainerRuntime(socket string) DetectionResult {
+	path := strings.TrimPrefix(socket, "unix://")
+	result := DetectionResult{Runtime: RuntimeDocker, SocketPath: path}
+	if strings.Contains(filepath.Base(path), "podman") || strings.Contains(path, "/podman/") {
+		result.Runtime = RuntimePodman
+		dir := userRuntimeDir()
+		result.Rootless = strings.HasPrefix(path, "/run/user/") ||
+			(dir != "" && strings.HasPrefix(path, dir+string(filepath.Separator)))
+	}
+	return result
+}
+
 // ClearCache clears the cached detection result. Useful for testing.
 func ClearCache() {
 	cacheMutex.Lock()
@@ -1,9 +1,13 @@
 package platform
 
 import (
+	"net"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestTranslateImage(t *testing.T) {
@@ -72,3 +76,62 @@ func TestRuntimeConstants(t *testing.T) {
 	assert.Equal(t, Runtime("lxd"), RuntimeLXD)
 	assert.Equal(t, Runtime("incus"), RuntimeIncus)
 }
+
+func TestInferContainerRuntime(t *testing.T) {
+	t.Setenv("XDG_RUNTIME_DIR", "/run/user/1000")
+
+	tests := []struct {
+		name     string
+		socket   string
+		runtime  Runtime
+		rootless bool
+	}{
+		{"docker socket", "/var/run/docker.sock", RuntimeDocker, false},
+		{"docker host url", "unix:///var/run/docker.sock", RuntimeDocker, false},
+		{"rootful podman", "/run/podman/podman.sock", RuntimePodman, false},
+		{"rootless podman", "unix:///run/user/1000/podman/podman.sock", RuntimePodman, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := InferContainerRuntime(tt.socket)
+			assert.Equal(t, tt.runtime, result.Runtime)
+			assert.Equal(t, tt.rootless, result.Rootless)
+		})
+	}
+}
+
+// The rootless socket lives under the user's runtime directory, so it is
+// found there rather than at a fixed path.
+func TestDetectPodmanRuntimeFindsRootlessSocket(t *testing.T) {
+	// t.TempDir can exceed the 108-byte limit on a Unix socket path
+	dir, err := os.MkdirTemp("", "xdg")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	t.Setenv("XDG_RUNTIME_DIR", dir)
+
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "podman"), 0o700))
+	socket := filepath.Join(dir, "podman", "podman.sock")
+	listener, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+	defer listener.Close()
+
+	result, err := DetectPodmanRuntime()
+	require.NoError(t, err)
+	assert.Equal(t, RuntimePodman, result.Runtime)
+	assert.Equal(t, socket, result.SocketPath)
+	assert.True(t, result.Rootless)
+}
+
+func TestDetectPodmanRuntimeReportsCheckedPaths(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_RUNTIME_DIR", dir)
+	if isSocketAccessible("/run/podman/podman.sock") {
+		t.Skip("a system Podman socket is present")
+	}
+
+	_, err := DetectPodmanRuntime()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), filepath.Join(dir, "podman", "podman.sock"))
+	assert.Contains(t, err.Error(), "/run/podman/podman.sock")
+}
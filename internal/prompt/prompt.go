@@ -0,0 +1,295 @@
+// Package prompt drives an interactive vendor command line — a switch,
+// router, or appliance CLI — over a byte stream, using the device's prompt
+// to tell where one command's output ends.
+//
+// Rationale: a vendor CLI has no exit status and no end-of-output marker.
+// The only reliable signal that a command has finished is the prompt coming
+// back, so every read waits for it, answering pagers (--More--) on the way.
+package prompt
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultPrompt matches the usual shapes: R1>, R1#, R1(config-if)#,
+	// and user@router>.
+	DefaultPrompt = `^[\w.@:/()\[\]~-]+ ?[>#] ?$`
+	// DefaultPager matches --More--, -- More --, ---(more 45%)---, and
+	// <--- More --->.
+	DefaultPager = `\s*<?-+ ?\(?[Mm]ore[^-]*-+>?\s*$`
+	// DefaultPagerResponse pages forward one screen
+	DefaultPagerResponse = " "
+	// DefaultPasswordPrompt matches an enable password prompt
+	DefaultPasswordPrompt = `[Pp]assword: ?$`
+	// DefaultTimeout bounds each wait for the prompt
+	DefaultTimeout = 30 * time.Second
+)
+
+// DefaultErrorPatterns mark a command as failed: IOS, NX-OS, and EOS
+// report errors on lines starting "% ", Junos with "error: ".
+var DefaultErrorPatterns = []string{`^% `, `^error: `}
+
+// Options configures a Session. Prompt is required; a nil Pager disables
+// paging.
+type Options struct {
+	// Prompt is matched against the last line of output
+	Prompt *regexp.Regexp
+	// Pager is matched against the last line of output; each match is
+	// answered with PagerResponse and removed from the output
+	Pager         *regexp.Regexp
+	PagerResponse string
+	// Errors are matched line by line against a command's output; any
+	// match makes the command fail
+	Errors []*regexp.Regexp
+	// Timeout bounds each wait for the prompt. Zero uses DefaultTimeout.
+	Timeout time.Duration
+}
+
+// ErrTimeout marks a wait for the prompt that ran out of time.
+var ErrTimeout = errors.New("timed out waiting for the prompt")
+
+// Session is one interactive CLI. Commands are serialised: the device has
+// a single prompt, so two commands in flight would interleave.
+type Session struct {
+	in     io.Writer
+	opts   Options
+	chunks chan []byte
+	// readErr is set before chunks is closed, so it is safe to read once a
+	// receive reports the channel closed
+	readErr error
+	mu      sync.Mutex
+}
+
+// NewSession starts reading the device's output. Nothing is written until
+// the first call.
+func NewSession(out io.Reader, in io.Writer, opts Options) *Session {
+	if opts.PagerResponse == "" {
+		opts.PagerResponse = DefaultPagerResponse
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	s := &Session{
+		in:     in,
+		opts:   opts,
+		chunks: make(chan []byte, 64),
+	}
+	go s.pump(out)
+	return s
+}
+
+func (s *Session) pump(out io.Reader) {
+	buf := make([]byte, 4096)
+	for {
+		n, err := out.Read(buf)
+		if n > 0 {
+			s.chunks <- append([]byte(nil), buf[:n]...)
+		}
+		if err != nil {
+			s.readErr = err
+			close(s.chunks)
+			return
+		}
+	}
+}
+
+// WaitForPrompt consumes output — a login banner, say — until the prompt
+// appears.
+func (s *Session) WaitForPrompt() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, _, err := s.readUntil(nil)
+	return err
+}
+
+// Run sends a command and returns its output, without the echoed command
+// line and the closing prompt. failed reports whether an error pattern
+// matched the output.
+func (s *Session) Run(command string) (output string, failed bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Output still arriving from a command that timed out belongs to that
+	// command, not this one
+	s.discardPending()
+	if _, err := io.WriteString(s.in, command+"\n"); err != nil {
+		return "", false, fmt.Errorf("failed to send %q: %w", command, err)
+	}
+	text, _, err := s.readUntil(nil)
+	if err != nil {
+		return "", false, fmt.Errorf("%q: %w", command, err)
+	}
+	output = commandOutput(text, command)
+	return output, s.hasError(output), nil
+}
+
+// Enable enters privileged mode with command, answering a password prompt
+// when one appears.
+func (s *Session) Enable(command, password string, passwordPrompt *regexp.Regexp) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.discardPending()
+	if _, err := io.WriteString(s.in, command+"\n"); err != nil {
+		return fmt.Errorf("failed to send %q: %w", command, err)
+	}
+	text, asked, err := s.readUntil(passwordPrompt)
+	if err != nil {
+		return fmt.Errorf("%q: %w", command, err)
+	}
+	if asked {
+		if password == "" {
+			return fmt.Errorf("%q asked for a password and none is configured", command)
+		}
+		if _, err := io.WriteString(s.in, password+"\n"); err != nil {
+			return fmt.Errorf("failed to send the enable password: %w", err)
+		}
+		if text, _, err = s.readUntil(nil); err != nil {
+			return fmt.Errorf("%q: %w", command, err)
+		}
+	}
+	if output := commandOutput(text, command); s.hasError(output) {
+		return fmt.Errorf("%q failed: %s", command, strings.TrimSpace(output))
+	}
+	return nil
+}
+
+func (s *Session) discardPending() {
+	for {
+		select {
+		case _, ok := <-s.chunks:
+			if !ok {
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
+// readUntil reads until the last line matches the prompt, or extra when
+// it is set, answering pagers along the way. It returns the cleaned text
+// and whether extra was what matched.
+func (s *Session) readUntil(extra *regexp.Regexp) (string, bool, error) {
+	timer := time.NewTimer(s.opts.Timeout)
+	defer timer.Stop()
+
+	text := ""
+	erasePending := false
+	paged := -1
+	for {
+		last := strings.TrimRight(lastLine(text), "\r")
+		if s.opts.Pager != nil && len(text) != paged {
+			if loc := s.opts.Pager.FindStringIndex(last); loc != nil {
+				// The pager prompt is not output. Cut it, and swallow the
+				// sequence the device sends to erase it from the screen.
+				text = text[:len(text)-len(lastLine(text))+loc[0]]
+				paged = len(text)
+				erasePending = true
+				if _, err := io.WriteString(s.in, s.opts.PagerResponse); err != nil {
+					return text, false, fmt.Errorf("failed to answer the pager: %w", err)
+				}
+				continue
+			}
+		}
+		if extra != nil && extra.MatchString(last) {
+			return text, true, nil
+		}
+		if s.opts.Prompt.MatchString(last) {
+			return text, false, nil
+		}
+
+		select {
+		case chunk, ok := <-s.chunks:
+			if !ok {
+				return text, false, fmt.Errorf("connection closed before the prompt: %w", s.readErr)
+			}
+			data := string(chunk)
+			if erasePending {
+				data = pagerErase.ReplaceAllString(data, "")
+				erasePending = false
+			}
+			text = Clean(text + data)
+		case <-timer.C:
+			return text, false, fmt.Errorf("%w after %s (last line %q)", ErrTimeout, s.opts.Timeout, last)
+		}
+	}
+}
+
+func (s *Session) hasError(output string) bool {
+	for _, line := range strings.Split(output, "\n") {
+		for _, pattern := range s.opts.Errors {
+			if pattern.MatchString(line) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// pagerErase matches what devices send after a pager is answered to wipe
+// it from the screen: backspaces over it (IOS), a carriage return and
+// erase-line (EOS), or a carriage return and spaces (Junos) — or just a
+// newline.
+var pagerErase = regexp.MustCompile(`^(?:\x08+ *\x08*|\r(?:\x1b\[K| +\r)?|\x1b\[K)*(?:\r?\n)?`)
+
+var escapeSequence = regexp.MustCompile(`\x1b\[[0-9;?]*[A-Za-z]|\x07`)
+
+// Clean turns terminal output into plain text: escape sequences are
+// dropped, backspaces delete, and a carriage return not followed by a
+// newline starts its line over, as it would on screen. A trailing carriage
+// return is kept, since its newline may be in the next read.
+func Clean(text string) string {
+	text = escapeSequence.ReplaceAllString(text, "")
+	out := make([]rune, 0, len(text))
+	lineStart := 0
+	runes := []rune(text)
+	for i, r := range runes {
+		switch r {
+		case '\b':
+			if len(out) > lineStart {
+				out = out[:len(out)-1]
+			}
+		case '\r':
+			switch {
+			case i == len(runes)-1:
+				out = append(out, r)
+			case runes[i+1] == '\n':
+			default:
+				out = out[:lineStart]
+			}
+		case '\n':
+			out = append(out, r)
+			lineStart = len(out)
+		default:
+			out = append(out, r)
+		}
+	}
+	return string(out)
+}
+
+func lastLine(text string) string {
+	return text[strings.LastIndex(text, "\n")+1:]
+}
+
+// commandOutput strips the echoed command from the top of text and the
+// prompt from the bottom.
+func commandOutput(text, command string) string {
+	lines := strings.Split(text, "\n")
+	// The last line is the prompt
+	lines = lines[:len(lines)-1]
+	if len(lines) > 0 && strings.HasSuffix(strings.TrimSpace(lines[0]), strings.TrimSpace(command)) {
+		lines = lines[1:]
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
@@ -0,0 +1,132 @@
+package prompt
+
+import (
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// device is a scripted CLI: each input it receives is answered with the
+// listed output, as a switch would echo the command and print the result.
+type device struct {
+	out     *io.PipeWriter
+	replies map[string][]string
+	mu      sync.Mutex
+	inputs  []string
+}
+
+func (d *device) Write(p []byte) (int, error) {
+	d.mu.Lock()
+	d.inputs = append(d.inputs, string(p))
+	d.mu.Unlock()
+	if chunks, ok := d.replies[string(p)]; ok {
+		go func() {
+			for _, chunk := range chunks {
+				d.out.Write([]byte(chunk))
+			}
+		}()
+	}
+	return len(p), nil
+}
+
+func newTestSession(t *testing.T, banner string, replies map[string][]string, timeout time.Duration) (*Session, *device) {
+	t.Helper()
+	r, w := io.Pipe()
+	t.Cleanup(func() { w.Close() })
+	d := &device{out: w, replies: replies}
+	errors := make([]*regexp.Regexp, 0, len(DefaultErrorPatterns))
+	for _, pattern := range DefaultErrorPatterns {
+		errors = append(errors, regexp.MustCompile(pattern))
+	}
+	s := NewSession(r, d, Options{
+		Prompt:  regexp.MustCompile(DefaultPrompt),
+		Pager:   regexp.MustCompile(DefaultPager),
+		Errors:  errors,
+		Timeout: timeout,
+	})
+	if banner != "" {
+		go w.Write([]byte(banner))
+		require.NoError(t, s.WaitForPrompt())
+	}
+	return s, d
+}
+
+func TestRunStripsEchoAndPrompt(t *testing.T) {
+	s, _ := newTestSession(t, "Welcome\r\nR1>", map[string][]string{
+		"show clock\n": {"show clock\r\n", "*10:02:11.123 UTC Sat Oct 18 2026\r\n", "R1>"},
+	}, time.Second)
+
+	output, failed, err := s.Run("show clock")
+	require.NoError(t, err)
+	assert.False(t, failed)
+	assert.Equal(t, "*10:02:11.123 UTC Sat Oct 18 2026\n", output)
+}
+
+// Each pager is answered and the erase sequence the device sends after it
+// does not eat real output.
+func TestRunPagesThroughMore(t *testing.T) {
+	s, d := newTestSession(t, "R1#", map[string][]string{
+		"show run\n": {"show run\r\nhostname R1\r\n --More-- "},
+		" ":          {"\x08\x08\x08\x08\x08\x08\x08\x08\x08\x08          \x08\x08\x08\x08\x08\x08\x08\x08\x08\x08interface Gi0/1\r\nend\r\nR1#"},
+	}, time.Second)
+
+	output, _, err := s.Run("show run")
+	require.NoError(t, err)
+	assert.Equal(t, "hostname R1\ninterface Gi0/1\nend\n", output)
+	assert.Equal(t, []string{"show run\n", " "}, d.inputs)
+}
+
+func TestRunReportsErrorPatterns(t *testing.T) {
+	s, _ := newTestSession(t, "R1#", map[string][]string{
+		"show bogus\n": {"show bogus\r\n        ^\r\n% Invalid input detected at '^' marker.\r\n\r\nR1#"},
+	}, time.Second)
+
+	output, failed, err := s.Run("show bogus")
+	require.NoError(t, err)
+	assert.True(t, failed)
+	assert.Contains(t, output, "% Invalid input")
+}
+
+func TestEnableAnswersPasswordPrompt(t *testing.T) {
+	s, d := newTestSession(t, "R1>", map[string][]string{
+		"enable\n": {"enable\r\nPassword: "},
+		"s3cret\n": {"\r\nR1#"},
+	}, time.Second)
+
+	require.NoError(t, s.Enable("enable", "s3cret", regexp.MustCompile(DefaultPasswordPrompt)))
+	assert.Equal(t, []string{"enable\n", "s3cret\n"}, d.inputs)
+}
+
+func TestEnableWithoutPasswordFails(t *testing.T) {
+	s, _ := newTestSession(t, "R1>", map[string][]string{
+		"enable\n": {"enable\r\nPassword: "},
+	}, time.Second)
+
+	err := s.Enable("enable", "", regexp.MustCompile(DefaultPasswordPrompt))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "none is configured")
+}
+
+func TestRunTimesOutWithoutPrompt(t *testing.T) {
+	s, _ := newTestSession(t, "R1#", map[string][]string{
+		"reload\n": {"reload\r\nProceed with reload? [confirm]"},
+	}, 50*time.Millisecond)
+
+	_, _, err := s.Run("reload")
+	require.ErrorIs(t, err, ErrTimeout)
+	assert.Contains(t, err.Error(), "[confirm]")
+}
+
+func TestCleanAppliesTerminalControls(t *testing.T) {
+	assert.Equal(t, "abd\n", Clean("abc\x08d\r\n"))
+	assert.Equal(t, "new\n", Clean("old line\rnew\r\n"))
+	assert.Equal(t, "colour\n", Clean("\x1b[1mcolour\x1b[0m\n"))
+	// The newline for a trailing carriage return may be in the next read
+	assert.True(t, strings.HasSuffix(Clean("line\r"), "\r"))
+}
@@ -0,0 +1,231 @@
+// Package rootfs prepares per-run copies of a root filesystem and runs
+// commands inside them with systemd-nspawn or chroot, for testing packages
+// and install scripts on hosts where neither Docker nor LXD is available
+// but root is.
+//
+// Rationale: a test that installs packages mutates the tree it runs in.
+// Every run therefore works on its own copy of the source rootfs, so the
+// source stays pristine and the next run starts from the same state.
+package rootfs
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/bgrewell/dart/internal/helpers"
+)
+
+// Engine selects how commands enter the tree.
+type Engine string
+
+const (
+	// EngineAuto uses systemd-nspawn when the host has it, chroot otherwise
+	EngineAuto   Engine = "auto"
+	EngineNspawn Engine = "nspawn"
+	EngineChroot Engine = "chroot"
+)
+
+// ParseEngine validates a raw engine value. Empty selects EngineAuto.
+func ParseEngine(raw string) (Engine, bool) {
+	switch Engine(raw) {
+	case "", EngineAuto:
+		return EngineAuto, true
+	case EngineNspawn, EngineChroot:
+		return Engine(raw), true
+	default:
+		return "", false
+	}
+}
+
+// DetectEngine resolves EngineAuto on the host.
+func DetectEngine(run helpers.HostRunner) Engine {
+	if _, err := run("command -v systemd-nspawn"); err == nil {
+		return EngineNspawn
+	}
+	return EngineChroot
+}
+
+// tarballSuffixes are the archive forms tar extracts by itself.
+var tarballSuffixes = []string{".tar", ".tar.gz", ".tgz", ".tar.xz", ".txz", ".tar.bz2", ".tbz2", ".tar.zst"}
+
+// IsTarball reports whether a source path names an archive rather than a
+// directory tree.
+func IsTarball(path string) bool {
+	for _, suffix := range tarballSuffixes {
+		if strings.HasSuffix(path, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+var machineNameInvalid = regexp.MustCompile(`[^A-Za-z0-9-]+`)
+
+// MachineName derives the systemd machine name for a node. machined only
+// accepts hostname-like names, so anything else becomes a dash.
+func MachineName(node string) string {
+	return "dart-" + strings.Trim(machineNameInvalid.ReplaceAllString(node, "-"), "-")
+}
+
+// Prepare makes dest a private copy of source: an archive is extracted, a
+// directory copied. Ownership, modes, and device nodes are preserved, and
+// a copy-on-write filesystem shares blocks rather than duplicating them.
+func Prepare(run helpers.HostRunner, source, dest string) error {
+	var command string
+	if IsTarball(source) {
+		command = fmt.Sprintf("mkdir -p %s && tar --numeric-owner -xpf %s -C %s",
+			helpers.ShellQuote(dest), helpers.ShellQuote(source), helpers.ShellQuote(dest))
+	} else {
+		command = fmt.Sprintf("mkdir -p %s && cp -a --reflink=auto %s %s",
+			helpers.ShellQuote(filepath.Dir(dest)), helpers.ShellQuote(strings.TrimSuffix(source, "/")+"/."), helpers.ShellQuote(dest))
+	}
+	if _, err := run(command); err != nil {
+		return fmt.Errorf("failed to prepare rootfs %s from %s: %w", dest, source, err)
+	}
+	return nil
+}
+
+// Copy duplicates a prepared tree, for snapshots. It stays on the tree's
+// own filesystem, so a chroot's /proc, /sys, and /dev mounts are not
+// copied along with it.
+func Copy(run helpers.HostRunner, source, dest string) error {
+	command := fmt.Sprintf("mkdir -p %s && cp -a -x --reflink=auto %s %s",
+		helpers.ShellQuote(filepath.Dir(dest)), helpers.ShellQuote(source), helpers.ShellQuote(dest))
+	if _, err := run(command); err != nil {
+		return fmt.Errorf("failed to copy %s to %s: %w", source, dest, err)
+	}
+	return nil
+}
+
+// Remove deletes a tree. It refuses to cross into another filesystem, so
+// a bind mount left behind by an interrupted run costs a failed teardown
+// rather than the host's /dev.
+func Remove(run helpers.HostRunner, path string) error {
+	if _, err := run(fmt.Sprintf("rm -rf --one-file-system %s", helpers.ShellQuote(path))); err != nil {
+		return fmt.Errorf("failed to remove %s: %w", path, err)
+	}
+	return nil
+}
+
+// Exists reports whether a path exists on the host.
+func Exists(run helpers.HostRunner, path string) bool {
+	_, err := run(fmt.Sprintf("test -e %s", helpers.ShellQuote(path)))
+	return err == nil
+}
+
+// apiMounts are the kernel filesystems a chroot needs for ordinary tools
+// to work. systemd-nspawn provides its own.
+var apiMounts = []struct {
+	target  string
+	command string
+}{
+	{"proc", "mount -t proc proc %s"},
+	{"sys", "mount -t sysfs sysfs %s"},
+	{"dev", "mount --bind /dev %s"},
+}
+
+// MountAPI mounts /proc, /sys, and /dev into a chroot tree.
+func MountAPI(run helpers.HostRunner, root string) error {
+	for _, m := range apiMounts {
+		target := helpers.ShellQuote(root + "/" + m.target)
+		if _, err := run(fmt.Sprintf("mkdir -p %s && "+m.command, target, target)); err != nil {
+			return fmt.Errorf("failed to mount /%s in %s: %w", m.target, root, err)
+		}
+	}
+	return nil
+}
+
+// UnmountAPI reverses MountAPI. Targets that are not mounted are skipped,
+// so it is safe on a tree whose setup failed part way or never ran.
+func UnmountAPI(run helpers.HostRunner, root string) error {
+	for i := len(apiMounts) - 1; i >= 0; i-- {
+		target := helpers.ShellQuote(root + "/" + apiMounts[i].target)
+		command := fmt.Sprintf("if mountpoint -q %s; then umount %s; fi", target, target)
+		if _, err := run(command); err != nil {
+			return fmt.Errorf("failed to unmount /%s in %s: %w", apiMounts[i].target, root, err)
+		}
+	}
+	return nil
+}
+
+// ExecCommand wraps a shell command so it runs inside the tree. A booted
+// machine is entered through systemd-run, which waits for the command and
+// passes its exit status back; otherwise each command gets a fresh
+// nspawn or chroot invocation.
+func ExecCommand(engine Engine, root, machine string, booted bool, command string, sudo bool) string {
+	prefix := ""
+	if sudo {
+		prefix = "sudo -n "
+	}
+	quoted := helpers.ShellQuote(command)
+	switch {
+	case booted:
+		return fmt.Sprintf("%ssystemd-run --machine=%s --quiet --wait --pipe -- /bin/sh -c %s",
+			prefix, helpers.ShellQuote(machine), quoted)
+	case engine == EngineNspawn:
+		return fmt.Sprintf("%ssystemd-nspawn --quiet --register=no --console=pipe -D %s /bin/sh -c %s",
+			prefix, helpers.ShellQuote(root), quoted)
+	default:
+		return fmt.Sprintf("%schroot %s /bin/sh -c %s", prefix, helpers.ShellQuote(root), quoted)
+	}
+}
+
+// Boot starts the tree's init as a registered machine in a transient
+// unit, returning once systemd-run has started it.
+func Boot(run helpers.HostRunner, root, machine string) error {
+	command := fmt.Sprintf("systemd-run --unit=%s --collect --property=KillMode=mixed -- systemd-nspawn --boot --quiet --keep-unit --machine=%s -D %s",
+		helpers.ShellQuote(machine), helpers.ShellQuote(machine), helpers.ShellQuote(root))
+	if _, err := run(command); err != nil {
+		return fmt.Errorf("failed to boot %s: %w", machine, err)
+	}
+	return nil
+}
+
+// WaitForBoot polls until the booted machine runs a command, or the
+// timeout passes.
+func WaitForBoot(run helpers.HostRunner, machine string, timeout, interval time.Duration) error {
+	probe := ExecCommand(EngineNspawn, "", machine, true, "true", false)
+	deadline := time.Now().Add(timeout)
+	var lastErr error
+	for {
+		if _, lastErr = run(probe); lastErr == nil {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("machine %s did not accept commands within %s: %w", machine, timeout, lastErr)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// MachineRunning reports whether machined knows a machine by this name.
+func MachineRunning(run helpers.HostRunner, machine string) bool {
+	_, err := run(fmt.Sprintf("machinectl show %s", helpers.ShellQuote(machine)))
+	return err == nil
+}
+
+// Terminate stops a booted machine and waits for machined to forget it,
+// so the tree is no longer in use when the caller touches it. A machine
+// that is not running counts as stopped.
+func Terminate(run helpers.HostRunner, machine string, timeout time.Duration) error {
+	name := helpers.ShellQuote(machine)
+	if _, err := run(fmt.Sprintf("machinectl terminate %s", name)); err != nil {
+		if strings.Contains(err.Error(), "No machine") {
+			return nil
+		}
+		return fmt.Errorf("failed to stop %s: %w", machine, err)
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		if _, err := run(fmt.Sprintf("machinectl show %s", name)); err != nil {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("machine %s did not stop within %s", machine, timeout)
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
@@ -0,0 +1,100 @@
+package rootfs
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recorder captures the commands a sequence issues, failing the ones
+// listed, so the sequences can be asserted without root.
+type recorder struct {
+	commands []string
+	failOn   map[string]error
+}
+
+func (r *recorder) run(command string) (string, error) {
+	r.commands = append(r.commands, command)
+	if err, ok := r.failOn[command]; ok {
+		return "", err
+	}
+	return "", nil
+}
+
+func TestParseEngine(t *testing.T) {
+	for raw, want := range map[string]Engine{"": EngineAuto, "auto": EngineAuto, "nspawn": EngineNspawn, "chroot": EngineChroot} {
+		engine, ok := ParseEngine(raw)
+		assert.True(t, ok, raw)
+		assert.Equal(t, want, engine, raw)
+	}
+	_, ok := ParseEngine("docker")
+	assert.False(t, ok)
+}
+
+func TestDetectEngineFallsBackToChroot(t *testing.T) {
+	rec := &recorder{}
+	assert.Equal(t, EngineNspawn, DetectEngine(rec.run))
+
+	rec = &recorder{failOn: map[string]error{"command -v systemd-nspawn": errors.New("exit status 1")}}
+	assert.Equal(t, EngineChroot, DetectEngine(rec.run))
+}
+
+func TestMachineNameIsHostnameSafe(t *testing.T) {
+	assert.Equal(t, "dart-web-1", MachineName("web_1"))
+	assert.Equal(t, "dart-db", MachineName("db."))
+}
+
+func TestPrepareExtractsOrCopies(t *testing.T) {
+	rec := &recorder{}
+	require.NoError(t, Prepare(rec.run, "/src/debian.tar.gz", "/w/dart-n/rootfs"))
+	assert.Equal(t, []string{
+		"mkdir -p '/w/dart-n/rootfs' && tar --numeric-owner -xpf '/src/debian.tar.gz' -C '/w/dart-n/rootfs'",
+	}, rec.commands)
+
+	// A directory's contents are copied, not the directory itself
+	rec = &recorder{}
+	require.NoError(t, Prepare(rec.run, "/src/debian/", "/w/dart-n/rootfs"))
+	assert.Equal(t, []string{
+		"mkdir -p '/w/dart-n' && cp -a --reflink=auto '/src/debian/.' '/w/dart-n/rootfs'",
+	}, rec.commands)
+}
+
+// Unmounting runs in reverse and only touches what is mounted, so it is
+// safe on a tree that was never set up.
+func TestUnmountAPIReversesMounts(t *testing.T) {
+	rec := &recorder{}
+	require.NoError(t, UnmountAPI(rec.run, "/w/r"))
+	assert.Equal(t, []string{
+		"if mountpoint -q '/w/r/dev'; then umount '/w/r/dev'; fi",
+		"if mountpoint -q '/w/r/sys'; then umount '/w/r/sys'; fi",
+		"if mountpoint -q '/w/r/proc'; then umount '/w/r/proc'; fi",
+	}, rec.commands)
+}
+
+func TestExecCommandPerEngine(t *testing.T) {
+	assert.Equal(t, "chroot '/w/r' /bin/sh -c 'id -u'",
+		ExecCommand(EngineChroot, "/w/r", "dart-n", false, "id -u", false))
+	assert.Equal(t, "sudo -n systemd-nspawn --quiet --register=no --console=pipe -D '/w/r' /bin/sh -c 'id -u'",
+		ExecCommand(EngineNspawn, "/w/r", "dart-n", false, "id -u", true))
+	assert.Equal(t, "systemd-run --machine='dart-n' --quiet --wait --pipe -- /bin/sh -c 'id -u'",
+		ExecCommand(EngineNspawn, "/w/r", "dart-n", true, "id -u", false))
+}
+
+func TestWaitForBootTimesOut(t *testing.T) {
+	probe := ExecCommand(EngineNspawn, "", "dart-n", true, "true", false)
+	rec := &recorder{failOn: map[string]error{probe: errors.New("Failed to connect to bus")}}
+	err := WaitForBoot(rec.run, "dart-n", 0, time.Millisecond)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Failed to connect to bus")
+}
+
+func TestTerminateToleratesMissingMachine(t *testing.T) {
+	rec := &recorder{failOn: map[string]error{
+		"machinectl terminate 'dart-n'": errors.New("No machine 'dart-n' known"),
+	}}
+	require.NoError(t, Terminate(rec.run, "dart-n", time.Second))
+	assert.Len(t, rec.commands, 1)
+}
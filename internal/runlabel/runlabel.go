@@ -0,0 +1,293 @@
+// Package runlabel identifies the run that created a container, network,
+// instance, profile or project, so the leftovers of a crashed run can be
+// found and removed later by `dart gc`.
+package runlabel
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Label keys carried by every resource a run creates. Docker and Podman
+// take them as labels; LXD takes them as config keys under LxdPrefix,
+// the only namespace it accepts free-form keys in.
+const (
+	KeyRunID   = "dart.run-id"
+	KeySuite   = "dart.suite"
+	KeyCreated = "dart.created"
+	KeyHost    = "dart.host"
+	KeyPID     = "dart.pid"
+	KeyKeep    = "dart.keep"
+
+	LxdPrefix = "user."
+)
+
+// Run is the identity of one dart process.
+type Run struct {
+	ID      string
+	Suite   string
+	Host    string
+	PID     int
+	Created time.Time
+	// Keep marks a run that leaves its environment up on purpose, as
+	// --setup-only does, so its exit does not make it garbage
+	Keep bool
+}
+
+var (
+	currentMu sync.Mutex
+	current   *Run
+)
+
+// Start records the identity of this process's run and returns it. An
+// empty id generates a fresh one; --run-id passes one in so a later
+// process can address the same objects. It is called once the suite is
+// loaded; resources created before that, or in tests, get a run with a
+// generated ID and no suite name.
+func Start(suite, id string) (Run, error) {
+	if id != "" {
+		if err := ValidateID(id); err != nil {
+			return Run{}, err
+		}
+	}
+	currentMu.Lock()
+	defer currentMu.Unlock()
+	run := newRun(suite)
+	if id != "" {
+		run.ID = id
+	}
+	current = &run
+	return run, nil
+}
+
+// Keep marks this process's run as leaving its environment up on
+// purpose. It is called before anything is created, so every resource
+// carries the mark.
+func Keep() {
+	currentMu.Lock()
+	defer currentMu.Unlock()
+	if current == nil {
+		run := newRun("")
+		current = &run
+	}
+	current.Keep = true
+}
+
+// maxIDLength keeps a scoped instance name inside LXD's 63-character
+// hostname limit for any reasonable node name.
+const maxIDLength = 24
+
+// ValidateID checks a --run-id. It becomes part of container, instance,
+// network and project names, so it is held to what all of them accept:
+// lowercase letters, digits and inner hyphens.
+func ValidateID(id string) error {
+	if id == "" || len(id) > maxIDLength {
+		return fmt.Errorf("run-id must be 1 to %d characters (got %q)", maxIDLength, id)
+	}
+	for i, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+		case r == '-' && i > 0 && i < len(id)-1:
+		default:
+			return fmt.Errorf("run-id may contain only lowercase letters, digits and inner hyphens (got %q)", id)
+		}
+	}
+	return nil
+}
+
+// Current returns the identity of this process's run.
+func Current() Run {
+	currentMu.Lock()
+	defer currentMu.Unlock()
+	if current == nil {
+		run := newRun("")
+		current = &run
+	}
+	return *current
+}
+
+func newRun(suite string) Run {
+	host, _ := os.Hostname()
+	return Run{
+		ID:      newID(),
+		Suite:   suite,
+		Host:    host,
+		PID:     os.Getpid(),
+		Created: time.Now().UTC().Truncate(time.Second),
+	}
+}
+
+// newID returns 12 random hex characters: short enough to read in a
+// listing, long enough that concurrent runs on a shared host never meet.
+func newID() string {
+	buf := make([]byte, 6)
+	if _, err := rand.Read(buf); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+	return hex.EncodeToString(buf)
+}
+
+// Scoped qualifies an object name with the run ID, so concurrent runs of
+// one suite on one host never ask for the same name.
+func (r Run) Scoped(name string) string {
+	return name + "-" + r.ID
+}
+
+// ScopedShort is Scoped for names with a length limit, such as an LXD
+// bridge, which is a kernel interface of at most 15 characters. A name
+// that does not fit keeps a readable prefix and ends in a hash of the
+// name and run ID instead.
+func (r Run) ScopedShort(name string, limit int) string {
+	if scoped := r.Scoped(name); len(scoped) <= limit {
+		return scoped
+	}
+	sum := sha256.Sum256([]byte(name + "/" + r.ID))
+	hash := hex.EncodeToString(sum[:])[:8]
+	prefix := name[:min(len(name), max(limit-len(hash)-1, 0))]
+	if prefix == "" {
+		return hash[:min(len(hash), limit)]
+	}
+	return prefix + "-" + hash
+}
+
+// Labels renders the run as container-engine labels. KeyKeep is only
+// set on a kept run.
+func (r Run) Labels() map[string]string {
+	labels := map[string]string{
+		KeyRunID:   r.ID,
+		KeySuite:   r.Suite,
+		KeyCreated: r.Created.Format(time.RFC3339),
+		KeyHost:    r.Host,
+		KeyPID:     strconv.Itoa(r.PID),
+	}
+	if r.Keep {
+		labels[KeyKeep] = "true"
+	}
+	return labels
+}
+
+// LxdConfig renders the run as LXD config keys.
+func (r Run) LxdConfig() map[string]string {
+	config := make(map[string]string, 5)
+	for key, value := range r.Labels() {
+		config[LxdPrefix+key] = value
+	}
+	return config
+}
+
+// WithLxdConfig returns a copy of config with the run's config keys added.
+// The caller's map is left untouched, since it is often the suite's own.
+func (r Run) WithLxdConfig(config map[string]string) map[string]string {
+	merged := make(map[string]string, len(config)+5)
+	for key, value := range config {
+		merged[key] = value
+	}
+	for key, value := range r.LxdConfig() {
+		merged[key] = value
+	}
+	return merged
+}
+
+// FromLabels reads a run back from container-engine labels. It reports
+// false for a resource no run created.
+func FromLabels(labels map[string]string) (Run, bool) {
+	id := labels[KeyRunID]
+	if id == "" {
+		return Run{}, false
+	}
+	run := Run{ID: id, Suite: labels[KeySuite], Host: labels[KeyHost]}
+	run.PID, _ = strconv.Atoi(labels[KeyPID])
+	run.Created, _ = time.Parse(time.RFC3339, labels[KeyCreated])
+	run.Keep = labels[KeyKeep] == "true"
+	return run, true
+}
+
+// FromLxdConfig reads a run back from LXD config keys.
+func FromLxdConfig(config map[string]string) (Run, bool) {
+	labels := make(map[string]string, 6)
+	for _, key := range []string{KeyRunID, KeySuite, KeyCreated, KeyHost, KeyPID, KeyKeep} {
+		labels[key] = config[LxdPrefix+key]
+	}
+	return FromLabels(labels)
+}
+
+// Resource is one labelled resource found on a platform.
+type Resource struct {
+	Platform string // docker or lxd
+	Kind     string // container, network, network-acl, instance, volume, profile, storage-pool or project
+	Name     string
+	Project  string // LXD project; empty elsewhere
+	Run      Run
+}
+
+// removalRank orders kinds so nothing is removed while another resource
+// still uses it: workloads first, then what they attach to, then the
+// projects that hold it all.
+var removalRank = map[string]int{"container": 0, "instance": 0, "volume": 1, "profile": 1, "network": 2, "network-acl": 3, "storage-pool": 4, "project": 4}
+
+// SortForRemoval orders resources for removal, keeping each kind's listed
+// order.
+func SortForRemoval(resources []Resource) {
+	sort.SliceStable(resources, func(i, j int) bool {
+		return removalRank[resources[i].Kind] < removalRank[resources[j].Kind]
+	})
+}
+
+// Policy decides which runs `dart gc` treats as dead.
+type Policy struct {
+	// Host is the machine gc runs on
+	Host string
+	// OlderThan, when set, spares runs younger than it
+	OlderThan time.Duration
+	// Now is the reference time for OlderThan
+	Now time.Time
+	// Alive reports whether a process on this host is still running
+	Alive func(pid int) bool
+	// IncludeKept also collects runs that left their environment up on
+	// purpose, under the same rules as any other run
+	IncludeKept bool
+}
+
+// Dead reports whether the run's resources can be removed, and when they
+// cannot, why not. A kept run is never dead unless --include-kept says
+// otherwise: its process has exited, but its environment is still in
+// use. A run on this host is dead once its process is gone. A run from
+// another host cannot be checked, so age is the only evidence: it is
+// removed only when --older-than says it is old enough.
+func (p Policy) Dead(run Run) (bool, string) {
+	if run.Keep && !p.IncludeKept {
+		return false, "left up by --setup-only (use --include-kept to collect)"
+	}
+	age := p.Now.Sub(run.Created)
+	if p.OlderThan > 0 && !run.Created.IsZero() && age < p.OlderThan {
+		return false, "younger than --older-than"
+	}
+	if run.Host == p.Host {
+		if run.PID > 0 && p.Alive(run.PID) {
+			return false, "run still in progress"
+		}
+		return true, ""
+	}
+	if p.OlderThan == 0 {
+		return false, "run on host " + run.Host + " (use --older-than to collect)"
+	}
+	if run.Created.IsZero() {
+		return false, "run on host " + run.Host + " has no creation time"
+	}
+	return true, ""
+}
+
+// ProcessAlive reports whether a process with this PID exists on this host.
+func ProcessAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
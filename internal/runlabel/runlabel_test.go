@@ -0,0 +1,123 @@
+package runlabel
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunRoundTrip(t *testing.T) {
+	run := Run{ID: "3f2a9c1b7d4e", Suite: "smoke", Host: "ci-04", PID: 4242,
+		Created: time.Date(2026, 10, 18, 9, 30, 0, 0, time.UTC)}
+
+	fromLabels, ok := FromLabels(run.Labels())
+	require.True(t, ok)
+	assert.Equal(t, run, fromLabels)
+
+	config := run.WithLxdConfig(map[string]string{"limits.cpu": "2"})
+	assert.Equal(t, "3f2a9c1b7d4e", config["user.dart.run-id"])
+	assert.Equal(t, "2", config["limits.cpu"])
+	fromConfig, ok := FromLxdConfig(config)
+	require.True(t, ok)
+	assert.Equal(t, run, fromConfig)
+
+	_, ok = FromLabels(map[string]string{"com.docker.compose.project": "web"})
+	assert.False(t, ok, "resources no run created are not claimed")
+}
+
+func TestWithLxdConfigLeavesSuiteConfig(t *testing.T) {
+	suite := map[string]string{"limits.cpu": "2"}
+	Current().WithLxdConfig(suite)
+	assert.Equal(t, map[string]string{"limits.cpu": "2"}, suite)
+}
+
+func TestPolicyDead(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	policy := Policy{Host: "ci-04", Now: now, Alive: func(pid int) bool { return pid == 100 }}
+	run := func(host string, pid int, age time.Duration) Run {
+		return Run{ID: "abc", Host: host, PID: pid, Created: now.Add(-age)}
+	}
+
+	dead, _ := policy.Dead(run("ci-04", 200, time.Minute))
+	assert.True(t, dead, "a run on this host is dead once its process is gone")
+	dead, reason := policy.Dead(run("ci-04", 100, 48*time.Hour))
+	assert.False(t, dead)
+	assert.Equal(t, "run still in progress", reason)
+	dead, reason = policy.Dead(run("ci-07", 200, 48*time.Hour))
+	assert.False(t, dead, "another host's processes cannot be checked")
+	assert.Contains(t, reason, "--older-than")
+
+	policy.OlderThan = 24 * time.Hour
+	dead, _ = policy.Dead(run("ci-07", 200, 48*time.Hour))
+	assert.True(t, dead, "age alone condemns another host's run")
+	dead, reason = policy.Dead(run("ci-04", 200, time.Hour))
+	assert.False(t, dead)
+	assert.Equal(t, "younger than --older-than", reason)
+}
+
+// A --setup-only environment outlives its process on purpose, so gc keeps
+// it until asked to collect kept runs.
+func TestPolicyKeepsRetainedRuns(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	policy := Policy{Host: "ci-04", Now: now, OlderThan: time.Hour, Alive: func(int) bool { return false }}
+	kept := Run{ID: "dev", Host: "ci-04", PID: 200, Created: now.Add(-48 * time.Hour), Keep: true}
+
+	dead, reason := policy.Dead(kept)
+	assert.False(t, dead, "a kept run is not dead because its process exited")
+	assert.Contains(t, reason, "--include-kept")
+
+	policy.IncludeKept = true
+	dead, _ = policy.Dead(kept)
+	assert.True(t, dead)
+
+	fromLabels, ok := FromLabels(kept.Labels())
+	require.True(t, ok)
+	assert.True(t, fromLabels.Keep, "the mark survives the round trip")
+	fromConfig, ok := FromLxdConfig(kept.LxdConfig())
+	require.True(t, ok)
+	assert.True(t, fromConfig.Keep)
+	assert.NotContains(t, Run{ID: "abc"}.Labels(), KeyKeep)
+}
+
+func TestSortForRemoval(t *testing.T) {
+	resources := []Resource{
+		{Kind: "project", Name: "qa"},
+		{Kind: "network", Name: "br0"},
+		{Kind: "instance", Name: "vm1"},
+		{Kind: "profile", Name: "web"},
+		{Kind: "instance", Name: "vm2"},
+	}
+	SortForRemoval(resources)
+	var names []string
+	for _, resource := range resources {
+		names = append(names, resource.Name)
+	}
+	assert.Equal(t, []string{"vm1", "vm2", "web", "br0", "qa"}, names)
+}
+
+func TestValidateID(t *testing.T) {
+	assert.NoError(t, ValidateID("ci-1234"))
+	assert.NoError(t, ValidateID("3f2a9c1b7d4e"))
+	assert.ErrorContains(t, ValidateID("CI_1234"), "lowercase letters")
+	assert.ErrorContains(t, ValidateID("-1234"), "inner hyphens")
+	assert.ErrorContains(t, ValidateID("1234-"), "inner hyphens")
+	assert.ErrorContains(t, ValidateID("a-very-long-run-id-for-one-job"), "1 to 24")
+
+	_, err := Start("smoke", "Bad ID")
+	assert.Error(t, err, "an invalid --run-id never names anything")
+}
+
+func TestScopedNames(t *testing.T) {
+	run := Run{ID: "ci-1234"}
+	assert.Equal(t, "web-ci-1234", run.Scoped("web"))
+	assert.Equal(t, "br0-ci-1234", run.ScopedShort("br0", 15), "a name that fits is scoped as usual")
+
+	long := run.ScopedShort("dartbr-frontend", 15)
+	assert.Len(t, long, 15)
+	assert.Regexp(t, `^dartbr-[0-9a-f]{8}$`, long)
+	assert.Equal(t, long, run.ScopedShort("dartbr-frontend", 15), "the short name is stable, so teardown finds it")
+	assert.NotEqual(t, long, run.ScopedShort("dartbr-backend", 15))
+	assert.NotEqual(t, long, Run{ID: "ci-5678"}.ScopedShort("dartbr-frontend", 15))
+}
@@ -0,0 +1,154 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/bgrewell/dart/internal/config"
+	"github.com/bgrewell/dart/pkg/ifaces"
+	"github.com/bgrewell/dart/pkg/nodetypes"
+	"github.com/bgrewell/dart/pkg/steptypes"
+)
+
+// setupHashes returns, per node, a hash for each setup step targeting it
+// that an image can stand for. A node's chain starts from its type,
+// options, and the local files its own setup reads, and each step's hash
+// covers that, the step's options, the contents of the local files it
+// pushes, and every earlier step on the node, so an image recording one
+// hash reflects exactly the steps up to it: changing a step or a file it
+// pushes changes its hash and every later one. A step whose options hold
+// a fact reference, resolved only once nodes are up, ends its node's
+// chain, as does a node whose own setup renders one.
+func setupHashes(nodes []*config.NodeConfig, steps []*config.StepConfig, vars map[string]string) (map[string][]string, error) {
+	chains := make(map[string][]string, len(nodes))
+	last := make(map[string]string, len(nodes))
+	for _, node := range nodes {
+		inputs, ok := nodetypes.SetupInputs(node, vars)
+		if !ok {
+			continue
+		}
+		seed, err := json.Marshal(struct {
+			Type    string                 `json:"type"`
+			Options map[string]interface{} `json:"options"`
+			Inputs  map[string]string      `json:"inputs,omitempty"`
+		}{node.Type, node.Options, inputs})
+		if err != nil {
+			return nil, fmt.Errorf("hashing node %s for its setup cache: %w", node.Name, err)
+		}
+		sum := sha256.Sum256(seed)
+		last[node.Name] = hex.EncodeToString(sum[:])
+	}
+
+	// After expansion every step targets exactly one node
+	for _, step := range steps {
+		name := step.Node[0]
+		previous, ok := last[name]
+		if !ok {
+			continue
+		}
+		inputs, ok := steptypes.SetupInputs(step)
+		if !ok {
+			delete(last, name)
+			continue
+		}
+		content, err := json.Marshal(struct {
+			Previous string                 `json:"previous"`
+			Type     string                 `json:"type"`
+			Options  map[string]interface{} `json:"options"`
+			Inputs   map[string]string      `json:"inputs,omitempty"`
+		}{previous, step.Step.Type, step.Step.Options, inputs})
+		if err != nil {
+			return nil, fmt.Errorf("hashing setup step %q for its node's setup cache: %w", step.Name, err)
+		}
+		sum := sha256.Sum256(content)
+		last[name] = hex.EncodeToString(sum[:])
+		chains[name] = append(chains[name], last[name])
+	}
+	return chains, nil
+}
+
+// setupCachers returns the nodes that keep their prepared target between
+// runs, by name.
+func (tc *TestController) setupCachers() map[string]ifaces.SetupCacher {
+	cachers := make(map[string]ifaces.SetupCacher)
+	for name, node := range tc.Nodes {
+		if cacher, ok := node.(ifaces.SetupCacher); ok && cacher.SetupCache() != "" {
+			cachers[name] = cacher
+		}
+	}
+	return cachers
+}
+
+// cachedSetupSteps returns the indexes of the setup steps a node's target
+// already reflects, after node setup: the first CachedSetupSteps of the
+// steps on each caching node.
+func (tc *TestController) cachedSetupSteps(cachers map[string]ifaces.SetupCacher) map[int]bool {
+	remaining := make(map[string]int, len(cachers))
+	for name, cacher := range cachers {
+		remaining[name] = cacher.CachedSetupSteps()
+	}
+	cached := make(map[int]bool)
+	for i, step := range tc.SetupConfigs {
+		name := step.Node[0]
+		if remaining[name] > 0 {
+			cached[i] = true
+			remaining[name]--
+		}
+	}
+	return cached
+}
+
+// setupPublishPoints returns, by the index of the setup step that ends
+// it, each caching node whose hashed steps the run has yet to add to its
+// image: once that step has run, the node's target reflects them and no
+// step after them.
+func (tc *TestController) setupPublishPoints(cachers map[string]ifaces.SetupCacher, hashes map[string][]string) map[int]string {
+	seen := make(map[string]int, len(cachers))
+	points := make(map[int]string)
+	for i, step := range tc.SetupConfigs {
+		name := step.Node[0]
+		cacher, ok := cachers[name]
+		if !ok {
+			continue
+		}
+		seen[name]++
+		if seen[name] == len(hashes[name]) && cacher.CachedSetupSteps() < seen[name] {
+			points[i] = name
+		}
+	}
+	return points
+}
+
+// publishSetup keeps the target of a caching node whose hashed setup steps
+// have all run.
+func (tc *TestController) publishSetup(name string, cacher ifaces.SetupCacher) error {
+	for {
+		t := tc.formatter.StartTask(publishSetupMsg(cacher.SetupCache()), name, "running")
+		if err := cacher.PublishSetup(); err != nil {
+			t.Error()
+			tc.formatter.PrintError(err)
+			retry, cont := tc.handleSetupError(fmt.Sprintf("node '%s' publish", name), err)
+			if retry {
+				continue
+			}
+			if cont {
+				return nil
+			}
+			return err
+		}
+		t.Complete()
+		return nil
+	}
+}
+
+// cachedSetupMsg reports the setup steps a node's target came with.
+func cachedSetupMsg(cache string, steps int) string {
+	return fmt.Sprintf("steps cached in %s: %d", cache, steps)
+}
+
+// publishSetupMsg reports a node's target being kept.
+func publishSetupMsg(cache string) string {
+	return "publishing " + cache
+}
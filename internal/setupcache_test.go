@@ -0,0 +1,220 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/bgrewell/dart/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// cachingNode keeps its "image" as the hash it was published with, and
+// starts from it the way an LXD node with publish_as does.
+type cachingNode struct {
+	*trackingNode
+	image     *string
+	hashes    []string
+	cached    int
+	published int
+}
+
+func (n *cachingNode) SetupCache() string             { return "n1-base" }
+func (n *cachingNode) UseSetupHashes(hashes []string) { n.hashes = hashes }
+func (n *cachingNode) CachedSetupSteps() int          { return n.cached }
+
+func (n *cachingNode) Setup() error {
+	n.cached = 0
+	for covered := len(n.hashes); covered > 0; covered-- {
+		if n.hashes[covered-1] == *n.image {
+			n.cached = covered
+			break
+		}
+	}
+	return n.trackingNode.Setup()
+}
+
+func (n *cachingNode) PublishSetup() error {
+	*n.image = n.hashes[len(n.hashes)-1]
+	n.published++
+	return nil
+}
+
+func setupStep(name, node, command string) *config.StepConfig {
+	return &config.StepConfig{
+		Name: name,
+		Node: config.NodeReference{node},
+		Step: config.StepDetails{Type: "execute", Options: map[string]interface{}{"command": command}},
+	}
+}
+
+func TestSetupHashesChainPerNode(t *testing.T) {
+	nodes := []*config.NodeConfig{
+		{Name: "db", Type: "lxd", Options: map[string]interface{}{"image": "ubuntu:24.04"}},
+		{Name: "web", Type: "lxd", Options: map[string]interface{}{"image": "ubuntu:24.04"}},
+	}
+	steps := []*config.StepConfig{
+		setupStep("install", "db", "apt-get install -y postgresql"),
+		setupStep("serve", "web", "true"),
+		setupStep("seed", "db", "psql -f seed.sql"),
+	}
+	hashes, err := setupHashes(nodes, steps, nil)
+	require.NoError(t, err)
+	require.Len(t, hashes["db"], 2)
+	require.Len(t, hashes["web"], 1)
+
+	steps[1] = setupStep("serve", "web", "false")
+	changed, err := setupHashes(nodes, steps, nil)
+	require.NoError(t, err)
+	assert.Equal(t, hashes["db"], changed["db"], "another node's steps do not change a node's hashes")
+	assert.NotEqual(t, hashes["web"], changed["web"])
+
+	steps[2] = setupStep("reseed", "db", "psql -f seed.sql")
+	renamed, err := setupHashes(nodes, steps, nil)
+	require.NoError(t, err)
+	assert.Equal(t, hashes["db"], renamed["db"], "a step is hashed by what it does, not its title")
+
+	steps[0] = setupStep("install", "db", "apt-get install -y postgresql-16")
+	edited, err := setupHashes(nodes, steps, nil)
+	require.NoError(t, err)
+	assert.NotEqual(t, hashes["db"][0], edited["db"][0])
+	assert.NotEqual(t, hashes["db"][1], edited["db"][1], "changing a step changes every later hash")
+
+	nodes[0].Options["image"] = "ubuntu:22.04"
+	rebased, err := setupHashes(nodes, steps[:1], nil)
+	require.NoError(t, err)
+	assert.NotEqual(t, edited["db"][0], rebased["db"][0], "the node's own options start the chain")
+}
+
+func TestSetupHashesCoverPushedFiles(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "app.conf"), []byte("port: 80\n"), 0o644))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "site"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "site", "index.html"), []byte("hello\n"), 0o644))
+
+	nodes := []*config.NodeConfig{{Name: "web", Type: "lxd", Options: map[string]interface{}{"image": "ubuntu:24.04"}}}
+	steps := []*config.StepConfig{
+		{Name: "config", Node: config.NodeReference{"web"}, SuiteDir: dir, Step: config.StepDetails{
+			Type: "file_push", Options: map[string]interface{}{"source": "app.conf", "dest": "/etc/app.conf"}}},
+		{Name: "site", Node: config.NodeReference{"web"}, SuiteDir: dir, Step: config.StepDetails{
+			Type: "dir_push", Options: map[string]interface{}{"source": "site", "dest": "/srv/www"}}},
+	}
+	hashes, err := setupHashes(nodes, steps, nil)
+	require.NoError(t, err)
+	require.Len(t, hashes["web"], 2)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "app.conf"), []byte("port: 8080\n"), 0o644))
+	edited, err := setupHashes(nodes, steps, nil)
+	require.NoError(t, err)
+	assert.NotEqual(t, hashes["web"][0], edited["web"][0], "changing a pushed file's contents changes its step's hash")
+	assert.NotEqual(t, hashes["web"][1], edited["web"][1])
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "site", "about.html"), []byte("about\n"), 0o644))
+	grown, err := setupHashes(nodes, steps, nil)
+	require.NoError(t, err)
+	assert.Equal(t, edited["web"][0], grown["web"][0])
+	assert.NotEqual(t, edited["web"][1], grown["web"][1], "adding a file to a pushed tree changes its step's hash")
+}
+
+func TestSetupHashesStopAtFactReferences(t *testing.T) {
+	nodes := []*config.NodeConfig{{Name: "web", Type: "lxd", Options: map[string]interface{}{"image": "ubuntu:24.04"}}}
+	steps := []*config.StepConfig{
+		setupStep("install", "web", "apt-get install -y nginx"),
+		setupStep("upstream", "web", `echo {{ fact "db" "ipv4" }} > /etc/upstream`),
+		setupStep("reload", "web", "systemctl reload nginx"),
+	}
+	hashes, err := setupHashes(nodes, steps, nil)
+	require.NoError(t, err)
+	assert.Len(t, hashes["web"], 1, "a step reading a fact ends the steps an image can stand for")
+
+	copyStep := func(from, to map[string]interface{}) *config.StepConfig {
+		return &config.StepConfig{Name: "ca", Node: config.NodeReference{"web"}, Step: config.StepDetails{
+			Type: "file_copy", Options: map[string]interface{}{"from": from, "to": to}}}
+	}
+	steps[1] = copyStep(map[string]interface{}{"node": "ca", "path": "/etc/ca/ca.crt"}, map[string]interface{}{"path": "/etc/ssl/ca.crt"})
+	hashes, err = setupHashes(nodes, steps, nil)
+	require.NoError(t, err)
+	assert.Len(t, hashes["web"], 1, "a file copied from another node may be new each run")
+
+	steps[1] = copyStep(map[string]interface{}{"path": "/etc/app/token"}, map[string]interface{}{"node": "worker", "path": "/etc/join-token"})
+	hashes, err = setupHashes(nodes, steps, nil)
+	require.NoError(t, err)
+	assert.Len(t, hashes["web"], 1, "a file copied to another node must reach it every run")
+
+	steps[1] = copyStep(map[string]interface{}{"node": "web", "path": "/etc/app.conf"}, map[string]interface{}{"path": "/etc/app.conf.bak"})
+	hashes, err = setupHashes(nodes, steps, nil)
+	require.NoError(t, err)
+	assert.Len(t, hashes["web"], 3, "a copy within the node is as static as any step")
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "user-data"), []byte("#cloud-config\nhostname: {{ fact \"db\" \"ipv4\" }}\n"), 0o644))
+	nodes[0].SuiteDir = dir
+	nodes[0].Options["cloud_init"] = map[string]interface{}{"user_data": "user-data"}
+	hashes, err = setupHashes(nodes, steps, nil)
+	require.NoError(t, err)
+	assert.Empty(t, hashes["web"], "a node whose cloud-init reads a fact caches no steps")
+}
+
+func TestControllerPublishesBeforeFactSteps(t *testing.T) {
+	var image string
+	f := newFixture("n1")
+	node := &cachingNode{trackingNode: f.nodes["n1"].(*trackingNode), image: &image}
+	f.nodes["n1"] = node
+	tc := f.controller(nil)
+	tc.SetupConfigs = []*config.StepConfig{
+		setupStep("install", "n1", "echo ok"),
+		setupStep("greet", "n1", `{{ "true" }}`),
+	}
+	require.NoError(t, tc.Run())
+	assert.Equal(t, 1, node.published)
+	assert.Len(t, node.hashes, 1)
+	assert.Equal(t, node.hashes[0], image)
+	tasks := f.formatter.tasks
+	publish := slices.Index(tasks, "publishing n1-base@n1")
+	require.NotEqual(t, -1, publish)
+	assert.Less(t, slices.Index(tasks, "install@n1"), publish)
+	assert.Less(t, publish, slices.Index(tasks, "greet@n1"), "the image is published before a step it cannot stand for runs")
+}
+
+func TestControllerSkipsCachedSetupSteps(t *testing.T) {
+	var image string
+	attempt := func(steps ...*config.StepConfig) (*cachingNode, []string, error) {
+		f := newFixture("n1")
+		node := &cachingNode{trackingNode: f.nodes["n1"].(*trackingNode), image: &image}
+		f.nodes["n1"] = node
+		tc := f.controller(nil)
+		tc.SetupConfigs = steps
+		err := tc.Run()
+		return node, f.formatter.tasks, err
+	}
+	run := func(steps ...*config.StepConfig) (*cachingNode, []string) {
+		node, tasks, err := attempt(steps...)
+		require.NoError(t, err)
+		return node, tasks
+	}
+	install := setupStep("install", "n1", "echo ok")
+	build := setupStep("build", "n1", "true")
+
+	node, tasks := run(install, build)
+	assert.Subset(t, tasks, []string{"install@n1", "build@n1", "publishing n1-base@n1"})
+	assert.Equal(t, 1, node.published)
+
+	node, tasks = run(install, build)
+	assert.NotContains(t, tasks, "install@n1")
+	assert.NotContains(t, tasks, "build@n1")
+	assert.Contains(t, tasks, "steps cached in n1-base: 2@n1")
+	assert.Zero(t, node.published, "an image that covers every step is kept as it is")
+
+	node, tasks = run(install, build, setupStep("test data", "n1", "echo ok"))
+	assert.NotContains(t, tasks, "build@n1")
+	assert.Contains(t, tasks, "test data@n1", "only the steps the image does not cover run")
+	assert.Equal(t, 1, node.published)
+
+	published := image
+	node, _, err := attempt(install, setupStep("build", "n1", "false"))
+	require.Error(t, err)
+	assert.Zero(t, node.published, "a failed setup is not published")
+	assert.Equal(t, published, image)
+}
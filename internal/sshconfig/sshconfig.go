@@ -0,0 +1,317 @@
+// Package sshconfig reads the subset of OpenSSH client configuration
+// (ssh_config(5)) that DART's ssh nodes honour: Host and Match blocks,
+// Include, HostName, User, Port, IdentityFile, ProxyJump, and ForwardAgent.
+package sshconfig
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Settings are the values that apply to one host. As with ssh, the first
+// value obtained for each keyword wins, except IdentityFile, which
+// accumulates.
+type Settings struct {
+	HostName      string
+	User          string
+	Port          int
+	IdentityFiles []string
+	// ProxyJump is the raw comma-separated jump list; "none" is reported
+	// as empty
+	ProxyJump    string
+	ForwardAgent bool
+}
+
+// DefaultPath returns ~/.ssh/config.
+func DefaultPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".ssh", "config"), nil
+}
+
+// Lookup reads the configuration file at file and returns the settings
+// that apply to host, the name as written in the suite.
+func Lookup(file, host string) (*Settings, error) {
+	l := &lookup{host: host, set: map[string]bool{}, settings: &Settings{}}
+	if err := l.read(file, 0); err != nil {
+		return nil, err
+	}
+	if l.proxyJump == "none" {
+		l.settings.ProxyJump = ""
+	} else {
+		l.settings.ProxyJump = l.proxyJump
+	}
+	return l.settings, nil
+}
+
+// maxIncludeDepth bounds Include recursion, as ssh does, so a file that
+// includes itself is an error rather than a hang.
+const maxIncludeDepth = 16
+
+type lookup struct {
+	host      string
+	set       map[string]bool
+	settings  *Settings
+	proxyJump string
+}
+
+func (l *lookup) read(file string, depth int) error {
+	if depth > maxIncludeDepth {
+		return fmt.Errorf("%s: Include nested too deeply", file)
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// Lines before the first Host or Match apply to every host
+	active := true
+	scanner := bufio.NewScanner(f)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		keyword, args, err := splitLine(scanner.Text())
+		if err != nil {
+			return fmt.Errorf("%s:%d: %w", file, lineNum, err)
+		}
+		if keyword == "" {
+			continue
+		}
+
+		switch keyword {
+		case "host":
+			active = matchHost(l.host, args)
+			continue
+		case "match":
+			active = matchBlock(l.host, args)
+			continue
+		case "include":
+			if !active {
+				continue
+			}
+			for _, pattern := range args {
+				if err := l.include(pattern, depth); err != nil {
+					return fmt.Errorf("%s:%d: %w", file, lineNum, err)
+				}
+			}
+			continue
+		}
+		if !active || len(args) == 0 {
+			continue
+		}
+		if err := l.apply(keyword, args); err != nil {
+			return fmt.Errorf("%s:%d: %w", file, lineNum, err)
+		}
+	}
+	return scanner.Err()
+}
+
+// include reads every file a pattern names; relative patterns are taken
+// from ~/.ssh, as ssh does for the user configuration.
+func (l *lookup) include(pattern string, depth int) error {
+	pattern = ExpandTilde(pattern)
+	if !filepath.IsAbs(pattern) {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return err
+		}
+		pattern = filepath.Join(home, ".ssh", pattern)
+	}
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return fmt.Errorf("Include %s: %w", pattern, err)
+	}
+	for _, match := range matches {
+		if err := l.read(match, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *lookup) apply(keyword string, args []string) error {
+	if keyword == "identityfile" {
+		l.settings.IdentityFiles = append(l.settings.IdentityFiles, args[0])
+		return nil
+	}
+	if l.set[keyword] {
+		return nil
+	}
+
+	switch keyword {
+	case "hostname":
+		l.settings.HostName = args[0]
+	case "user":
+		l.settings.User = args[0]
+	case "port":
+		port, err := strconv.Atoi(args[0])
+		if err != nil || port < 1 || port > 65535 {
+			return fmt.Errorf("Port %q is not a valid port", args[0])
+		}
+		l.settings.Port = port
+	case "proxyjump":
+		l.proxyJump = args[0]
+	case "forwardagent":
+		l.settings.ForwardAgent = strings.EqualFold(args[0], "yes")
+	default:
+		return nil
+	}
+	l.set[keyword] = true
+	return nil
+}
+
+// splitLine returns a line's lower-cased keyword and its arguments.
+// Keywords are separated from arguments by spaces or a single "=", and
+// arguments may be double-quoted.
+func splitLine(line string) (string, []string, error) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return "", nil, nil
+	}
+	end := strings.IndexAny(line, " \t=")
+	if end < 0 {
+		return strings.ToLower(line), nil, nil
+	}
+	keyword := strings.ToLower(line[:end])
+	rest := strings.TrimLeft(line[end:], " \t")
+	rest = strings.TrimLeft(strings.TrimPrefix(rest, "="), " \t")
+
+	var args []string
+	for rest != "" {
+		if rest[0] == '"' {
+			closing := strings.IndexByte(rest[1:], '"')
+			if closing < 0 {
+				return "", nil, fmt.Errorf("unterminated quote")
+			}
+			args = append(args, rest[1:closing+1])
+			rest = strings.TrimLeft(rest[closing+2:], " \t")
+			continue
+		}
+		if rest[0] == '#' {
+			break
+		}
+		end := strings.IndexAny(rest, " \t")
+		if end < 0 {
+			args = append(args, rest)
+			break
+		}
+		args = append(args, rest[:end])
+		rest = strings.TrimLeft(rest[end:], " \t")
+	}
+	return keyword, args, nil
+}
+
+// matchHost applies a Host line: any pattern may match, and a negated
+// pattern that matches excludes the host outright.
+func matchHost(host string, patterns []string) bool {
+	matched := false
+	for _, pattern := range patterns {
+		for _, p := range strings.Split(pattern, ",") {
+			negated := strings.HasPrefix(p, "!")
+			if ok, _ := path.Match(strings.TrimPrefix(p, "!"), host); ok {
+				if negated {
+					return false
+				}
+				matched = true
+			}
+		}
+	}
+	return matched
+}
+
+// matchBlock applies a Match line. Only "all" and "host" are understood;
+// a block with any other criterion is skipped, since applying settings
+// meant for a condition DART cannot evaluate could point a node at the
+// wrong machine.
+func matchBlock(host string, args []string) bool {
+	if len(args) == 1 && strings.EqualFold(args[0], "all") {
+		return true
+	}
+	if len(args) == 0 || len(args)%2 != 0 {
+		return false
+	}
+	for i := 0; i < len(args); i += 2 {
+		if !strings.EqualFold(args[i], "host") || !matchHost(host, []string{args[i+1]}) {
+			return false
+		}
+	}
+	return true
+}
+
+// ExpandTilde resolves a leading ~/ against the current user's home.
+func ExpandTilde(p string) string {
+	if p != "~" && !strings.HasPrefix(p, "~/") {
+		return p
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return p
+	}
+	return filepath.Join(home, strings.TrimPrefix(p, "~"))
+}
+
+// ExpandTokens resolves the tokens ssh allows in IdentityFile: ~, %d (local
+// home), %u (local user), %h (remote host), %r (remote user), %p (port),
+// and %%.
+func ExpandTokens(p, host, user string, port int) string {
+	p = ExpandTilde(p)
+	if !strings.Contains(p, "%") {
+		return p
+	}
+	home, _ := os.UserHomeDir()
+	localUser := os.Getenv("USER")
+	replacer := strings.NewReplacer(
+		"%%", "%",
+		"%d", home,
+		"%u", localUser,
+		"%h", host,
+		"%r", user,
+		"%p", strconv.Itoa(port),
+	)
+	return replacer.Replace(p)
+}
+
+// ParseJump splits one ProxyJump hop, "[user@]host[:port]", into its
+// parts; a missing port is 0.
+func ParseJump(jump string) (user, host string, port int, err error) {
+	hop := strings.TrimPrefix(strings.TrimSpace(jump), "ssh://")
+	if at := strings.LastIndex(hop, "@"); at >= 0 {
+		user, hop = hop[:at], hop[at+1:]
+	}
+	host = hop
+	if strings.HasPrefix(hop, "[") {
+		// [v6addr]:port
+		end := strings.Index(hop, "]")
+		if end < 0 {
+			return "", "", 0, fmt.Errorf("ProxyJump hop %q: unterminated [", jump)
+		}
+		host = hop[1:end]
+		hop = hop[end+1:]
+		if !strings.HasPrefix(hop, ":") {
+			hop = ""
+		}
+	} else if colon := strings.LastIndex(hop, ":"); colon >= 0 && strings.Count(hop, ":") == 1 {
+		host = hop[:colon]
+		hop = hop[colon:]
+	} else {
+		hop = ""
+	}
+	if hop != "" {
+		port, err = strconv.Atoi(strings.TrimPrefix(hop, ":"))
+		if err != nil || port < 1 || port > 65535 {
+			return "", "", 0, fmt.Errorf("ProxyJump port %q is not a valid port", strings.TrimPrefix(hop, ":"))
+		}
+	}
+	if host == "" {
+		return "", "", 0, fmt.Errorf("ProxyJump hop %q has no host", jump)
+	}
+	return user, host, port, nil
+}
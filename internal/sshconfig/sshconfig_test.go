@@ -0,0 +1,118 @@
+package sshconfig
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeConfig(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+	return path
+}
+
+func TestLookupFirstValueWins(t *testing.T) {
+	dir := t.TempDir()
+	path := writeConfig(t, dir, "config", `
+# global defaults
+ForwardAgent no
+
+Host web-? !web-9
+    HostName %h.lab.example
+    User deploy
+    IdentityFile ~/.ssh/deploy
+
+Host web-*
+    User ignored
+    Port=2222
+    IdentityFile "/keys/with space"
+    ProxyJump ops@jump:2200
+
+Host *
+    User fallback
+    IdentityFile ~/.ssh/id_ed25519
+`)
+
+	s, err := Lookup(path, "web-1")
+	require.NoError(t, err)
+	assert.Equal(t, "%h.lab.example", s.HostName)
+	assert.Equal(t, "deploy", s.User)
+	assert.Equal(t, 2222, s.Port)
+	assert.Equal(t, []string{"~/.ssh/deploy", "/keys/with space", "~/.ssh/id_ed25519"}, s.IdentityFiles)
+	assert.Equal(t, "ops@jump:2200", s.ProxyJump)
+	assert.False(t, s.ForwardAgent)
+
+	// The negated pattern excludes web-9 from the first block only
+	s, err = Lookup(path, "web-9")
+	require.NoError(t, err)
+	assert.Equal(t, "", s.HostName)
+	assert.Equal(t, "ignored", s.User)
+}
+
+func TestLookupMatchAndInclude(t *testing.T) {
+	dir := t.TempDir()
+	writeConfig(t, dir, "lab.conf", "Host db\n    HostName 10.0.0.5\n    ProxyJump none\n")
+	path := writeConfig(t, dir, "config", `
+Include `+filepath.Join(dir, "*.conf")+`
+
+Match host db exec "true"
+    User never
+
+Match host db
+    User postgres
+
+Match all
+    ForwardAgent yes
+    ProxyJump jump
+`)
+
+	s, err := Lookup(path, "db")
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.5", s.HostName)
+	assert.Equal(t, "postgres", s.User, "Match criteria other than host are not applied")
+	assert.True(t, s.ForwardAgent)
+	assert.Equal(t, "", s.ProxyJump, "ProxyJump none wins and disables the jump")
+}
+
+func TestLookupRejectsBadPort(t *testing.T) {
+	path := writeConfig(t, t.TempDir(), "config", "Host *\n    Port ssh\n")
+	_, err := Lookup(path, "any")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "config:2")
+}
+
+func TestParseJump(t *testing.T) {
+	cases := []struct {
+		hop        string
+		user, host string
+		port       int
+	}{
+		{"jump", "", "jump", 0},
+		{"ops@jump:2200", "ops", "jump", 2200},
+		{"[2001:db8::1]:22", "", "2001:db8::1", 22},
+		{"ops@2001:db8::1", "ops", "2001:db8::1", 0},
+		{"ssh://ops@jump", "ops", "jump", 0},
+	}
+	for _, tc := range cases {
+		user, host, port, err := ParseJump(tc.hop)
+		require.NoError(t, err, tc.hop)
+		assert.Equal(t, tc.user, user, tc.hop)
+		assert.Equal(t, tc.host, host, tc.hop)
+		assert.Equal(t, tc.port, port, tc.hop)
+	}
+
+	_, _, _, err := ParseJump("jump:http")
+	assert.Error(t, err)
+}
+
+func TestExpandTokens(t *testing.T) {
+	home, err := os.UserHomeDir()
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(home, ".ssh", "id_web-1_deploy"), ExpandTokens("~/.ssh/id_%h_%r", "web-1", "deploy", 22))
+	assert.Equal(t, "/keys/100%/2222", ExpandTokens("/keys/100%%/%p", "h", "u", 2222))
+}
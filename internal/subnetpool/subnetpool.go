@@ -0,0 +1,97 @@
+// Package subnetpool hands out /24 subnets for networks a suite does not
+// pin, so concurrent runs on one host never ask for the same range.
+package subnetpool
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/netip"
+)
+
+// DefaultPool is used when a platform block sets no subnet_pool.
+const DefaultPool = "10.201.0.0/16"
+
+// blockBits is the size of every allocated subnet.
+const blockBits = 24
+
+// Pool is an IPv4 range carved into /24 blocks.
+type Pool struct {
+	prefix netip.Prefix
+}
+
+// Parse reads a pool such as 10.201.0.0/16. The range must be IPv4 and
+// hold at least one /24.
+func Parse(pool string) (Pool, error) {
+	prefix, err := netip.ParsePrefix(pool)
+	if err != nil {
+		return Pool{}, fmt.Errorf("subnet_pool %q is not valid CIDR notation", pool)
+	}
+	if !prefix.Addr().Is4() {
+		return Pool{}, fmt.Errorf("subnet_pool %q must be an IPv4 range", pool)
+	}
+	if prefix.Bits() > blockBits {
+		return Pool{}, fmt.Errorf("subnet_pool %q is smaller than the /%d each network takes", pool, blockBits)
+	}
+	return Pool{prefix: prefix.Masked()}, nil
+}
+
+// size is the number of /24 blocks in the pool.
+func (p Pool) size() int {
+	return 1 << (blockBits - p.prefix.Bits())
+}
+
+// block returns the pool's i-th /24.
+func (p Pool) block(i int) netip.Prefix {
+	base := p.prefix.Addr().As4()
+	start := binary.BigEndian.Uint32(base[:]) + uint32(i)<<(32-blockBits)
+	var addr [4]byte
+	binary.BigEndian.PutUint32(addr[:], start)
+	return netip.PrefixFrom(netip.AddrFrom4(addr), blockBits)
+}
+
+// Allocate returns the first block that overlaps nothing in inUse. The
+// search starts at an offset derived from seed, normally the run ID, so
+// two runs starting together begin their search in different places.
+func (p Pool) Allocate(seed string, inUse []netip.Prefix) (netip.Prefix, error) {
+	sum := sha256.Sum256([]byte(seed))
+	size := p.size()
+	offset := int(binary.BigEndian.Uint32(sum[:4]) % uint32(size))
+	for i := 0; i < size; i++ {
+		candidate := p.block((offset + i) % size)
+		free := true
+		for _, used := range inUse {
+			if candidate.Overlaps(used) {
+				free = false
+				break
+			}
+		}
+		if free {
+			return candidate, nil
+		}
+	}
+	return netip.Prefix{}, fmt.Errorf("subnet_pool %s has no free /%d left", p.prefix, blockBits)
+}
+
+// Gateway is the address a bridge takes in an allocated subnet: the first
+// host address.
+func Gateway(subnet netip.Prefix) netip.Addr {
+	return subnet.Masked().Addr().Next()
+}
+
+// HostPrefixes lists the subnets of this host's interface addresses, which
+// an allocated network must not shadow.
+func HostPrefixes() []netip.Prefix {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil
+	}
+	var prefixes []netip.Prefix
+	for _, addr := range addrs {
+		if prefix, err := netip.ParsePrefix(addr.String()); err == nil {
+			prefixes = append(prefixes, prefix.Masked())
+		}
+	}
+	return prefixes
+}
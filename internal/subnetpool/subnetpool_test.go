@@ -0,0 +1,49 @@
+package subnetpool
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	_, err := Parse("10.201.0.0/16")
+	assert.NoError(t, err)
+	_, err = Parse("10.201.0.0")
+	assert.ErrorContains(t, err, "not valid CIDR")
+	_, err = Parse("fd00::/48")
+	assert.ErrorContains(t, err, "must be an IPv4 range")
+	_, err = Parse("10.201.0.0/25")
+	assert.ErrorContains(t, err, "smaller than the /24")
+}
+
+// Two runs begin in different places, and a block anything else uses is
+// never handed out.
+func TestAllocate(t *testing.T) {
+	pool, err := Parse("10.201.0.0/22")
+	require.NoError(t, err)
+
+	first, err := pool.Allocate("run-a", nil)
+	require.NoError(t, err)
+	again, err := pool.Allocate("run-a", nil)
+	require.NoError(t, err)
+	assert.Equal(t, first, again, "the same seed picks the same block")
+	assert.Equal(t, 24, first.Bits())
+	assert.True(t, netip.MustParsePrefix("10.201.0.0/22").Overlaps(first))
+
+	var used []netip.Prefix
+	for i := 0; i < 3; i++ {
+		next, err := pool.Allocate("run-a", used)
+		require.NoError(t, err)
+		for _, prior := range used {
+			assert.False(t, next.Overlaps(prior))
+		}
+		used = append(used, next)
+	}
+	last, err := pool.Allocate("run-b", append(used, netip.MustParsePrefix("10.0.0.0/8")))
+	assert.ErrorContains(t, err, "no free /24", "a host route covering the pool leaves nothing (got %s)", last)
+
+	assert.Equal(t, "10.201.3.1", Gateway(netip.MustParsePrefix("10.201.3.0/24")).String())
+}
@@ -100,3 +100,48 @@ type Snapshotter interface {
 type Rebooter interface {
 	Reboot(force bool, readyCommand string, timeout time.Duration) error
 }
+
+// Migrator is implemented by node types whose targets can move to another
+// member of a cluster. mode is "live" (the target keeps running across the
+// move), "cold" (it is stopped, moved and started again) or "auto" (live
+// where the target supports it, cold otherwise). A running target is then
+// waited on as Reboot does; a stopped one is only moved.
+type Migrator interface {
+	Migrate(member string, mode string, readyCommand string, timeout time.Duration) error
+}
+
+// ShellLess is implemented by node types whose Execute drives a vendor
+// command line rather than a POSIX shell. Step and test types that build
+// shell commands — file operations, node-side probes — reject such nodes
+// at construction.
+type ShellLess interface {
+	// NoShell is a marker; it is never called.
+	NoShell()
+}
+
+// SetupTemplater is implemented by node types whose setup reads text that
+// may reference vars and facts, such as an LXD node's cloud-init user-data.
+// The controller hands the node a renderer before calling Setup; facts
+// resolve against the nodes set up before it.
+type SetupTemplater interface {
+	UseTemplateRenderer(render func(text string) (string, error))
+}
+
+// SetupCacher is implemented by node types that can keep their target, as
+// prepared by setup steps, for later runs to start from. The controller
+// hands the node a hash per setup step targeting it, each covering the
+// node's configuration and every step up to that one, before calling
+// Setup; Setup starts from a kept target when one matches a hash, and the
+// steps that hash covers are skipped.
+type SetupCacher interface {
+	// SetupCache names what the node keeps its target under, such as an
+	// image alias, or is empty when the node keeps nothing.
+	SetupCache() string
+	UseSetupHashes(hashes []string)
+	// CachedSetupSteps reports, after Setup, how many of the node's
+	// leading setup steps its target already reflects.
+	CachedSetupSteps() int
+	// PublishSetup keeps the target once the setup steps its hashes cover
+	// have run, and leaves it ready for the steps and tests after them.
+	PublishSetup() error
+}
@@ -3,7 +3,9 @@ package nodetypes
 import (
 	"encoding/json"
 	"fmt"
+	"net/netip"
 	"reflect"
+	"slices"
 	"sort"
 	"strings"
 
@@ -20,8 +22,8 @@ type BaseNode struct {
 // IsKnownNodeType lets validate-only paths (--check) reject unknown types
 // without constructing real nodes.
 var knownNodeTypes = map[string]bool{
-	"local": true, "docker": true, "docker-compose": true,
-	"ssh": true, "lxd": true, "lxd-vm": true,
+	"local": true, "docker": true, "docker-compose": true, "podman": true,
+	"ssh": true, "lxd": true, "lxd-vm": true, "netns": true, "rootfs": true, "cli": true,
 }
 
 // IsKnownNodeType reports whether the factory can construct this type.
@@ -37,6 +39,9 @@ func ValidateNodeOptions(cfg *config.NodeConfig) error {
 	if err := validateOptionNames(cfg); err != nil {
 		return err
 	}
+	if err := validateUnmanagedOptions(cfg); err != nil {
+		return err
+	}
 
 	switch cfg.Type {
 	case "ssh":
@@ -44,44 +49,38 @@ func ValidateNodeOptions(cfg *config.NodeConfig) error {
 		if err := decodeNodeOptions(cfg.Options, &opts); err != nil {
 			return err
 		}
-		// Without a host the dial goes to ":22" and fails mid-run with a
-		// connection error that says nothing about the real mistake
-		if opts.Host == "" {
-			return fmt.Errorf("host is required")
+		if err := validateSshNodeOpts(opts, cfg.SuiteDir); err != nil {
+			return err
 		}
-		if _, err := sshAuthMethods(opts.KeyFile, opts.Pass); err != nil {
+	case "cli":
+		var opts CliNodeOpts
+		if err := decodeNodeOptions(cfg.Options, &opts); err != nil {
 			return err
 		}
-		if _, err := hostKeyCallbackFor(opts.KnownHosts, opts.InsecureSkipHostKey); err != nil {
+		if err := validateSshNodeOpts(opts.SshNodeOpts, cfg.SuiteDir); err != nil {
 			return err
 		}
-		if opts.Bastion != nil {
-			if opts.Bastion.Host == "" {
-				return fmt.Errorf("bastion host is required")
-			}
-			if opts.Bastion.Bastion != nil {
-				return fmt.Errorf("chained bastions are not supported: remove the nested bastion block")
-			}
-			if _, err := sshAuthMethods(opts.Bastion.KeyFile, opts.Bastion.Pass); err != nil {
-				return fmt.Errorf("bastion: %w", err)
-			}
+		if _, err := opts.sessionOptions(); err != nil {
+			return err
 		}
 	case "docker":
 		var opts DockerNodeOpts
 		if err := decodeNodeOptions(cfg.Options, &opts); err != nil {
 			return err
 		}
-		if opts.Image == "" {
-			return fmt.Errorf("image is required")
+		if err := validateDockerNodeOpts(opts, cfg.SuiteDir); err != nil {
+			return err
 		}
-		if err := validateNetworkAttachments(opts.Networks); err != nil {
+	case "podman":
+		var opts PodmanNodeOpts
+		if err := decodeNodeOptions(cfg.Options, &opts); err != nil {
 			return err
 		}
-		if _, err := resolveVolumes(opts.Volumes, cfg.SuiteDir); err != nil {
+		if err := validateDockerNodeOpts(opts.DockerNodeOpts, cfg.SuiteDir); err != nil {
 			return err
 		}
-		if len(opts.Ports) > 0 {
-			if err := docker.ValidatePortSpecs(opts.Ports); err != nil {
+		if rootlessAtCheck(opts) {
+			if err := validateRootlessPorts(opts.Ports); err != nil {
 				return err
 			}
 		}
@@ -93,6 +92,12 @@ func ValidateNodeOptions(cfg *config.NodeConfig) error {
 		if composeOpts.ComposeFile == "" {
 			return fmt.Errorf("compose_file is required")
 		}
+		if composeOpts.waitsForReady() && composeOpts.Service == "" {
+			return fmt.Errorf("wait_for_healthy and ready_command need service: they apply to the service's container")
+		}
+		if composeOpts.ReadyTimeout < 0 {
+			return fmt.Errorf("ready_timeout must not be negative (got %d)", composeOpts.ReadyTimeout)
+		}
 
 		// A compose node also accepts the docker option shapes
 		var opts DockerNodeOpts
@@ -107,6 +112,22 @@ func ValidateNodeOptions(cfg *config.NodeConfig) error {
 				return err
 			}
 		}
+	case "netns":
+		var opts NetnsNodeOpts
+		if err := decodeNodeOptions(cfg.Options, &opts); err != nil {
+			return err
+		}
+		if err := opts.validate(); err != nil {
+			return err
+		}
+	case "rootfs":
+		var opts RootfsNodeOpts
+		if err := decodeNodeOptions(cfg.Options, &opts); err != nil {
+			return err
+		}
+		if err := opts.validate(cfg.SuiteDir); err != nil {
+			return err
+		}
 	case "lxd", "lxd-vm":
 		var opts LxdNodeOpts
 		if err := decodeNodeOptions(cfg.Options, &opts); err != nil {
@@ -115,6 +136,16 @@ func ValidateNodeOptions(cfg *config.NodeConfig) error {
 		if err := opts.validate(); err != nil {
 			return err
 		}
+		if opts.CloudInit != nil {
+			if err := opts.CloudInit.validate(cfg.Options["cloud_init"], cfg.SuiteDir); err != nil {
+				return err
+			}
+		}
+		if opts.CloneFrom != nil {
+			if err := opts.CloneFrom.validateKeys(cfg.Options["clone_from"]); err != nil {
+				return err
+			}
+		}
 		for _, network := range opts.Networks {
 			// A node attaches to an existing bridge; it does not define
 			// one. subnet here consumed nothing, so a suite that set it
@@ -131,6 +162,32 @@ func ValidateNodeOptions(cfg *config.NodeConfig) error {
 	return nil
 }
 
+// validateDockerNodeOpts holds the checks shared by every node created
+// through the Docker-compatible API.
+func validateDockerNodeOpts(opts DockerNodeOpts, suiteDir string) error {
+	if opts.Image == "" && opts.managed() {
+		return fmt.Errorf("image is required")
+	}
+	if err := validateNetworkAttachments(opts.Networks); err != nil {
+		return err
+	}
+	if _, err := resolveVolumes(opts.Volumes, suiteDir); err != nil {
+		return err
+	}
+	if len(opts.Ports) > 0 {
+		if err := docker.ValidatePortSpecs(opts.Ports); err != nil {
+			return err
+		}
+	}
+	if opts.ReadyTimeout < 0 {
+		return fmt.Errorf("ready_timeout must not be negative (got %d)", opts.ReadyTimeout)
+	}
+	if _, err := opts.runtimeOptions(); err != nil {
+		return err
+	}
+	return nil
+}
+
 // optionKeysOf collects the option names a set of typed option structs
 // accepts, read from their json tags — the same tags the decode uses, so
 // the two cannot drift.
@@ -166,8 +223,20 @@ func knownNodeOptions(nodeType string) map[string]bool {
 		return optionKeysOf(DockerNodeOpts{})
 	case "docker-compose":
 		return optionKeysOf(DockerComposeNodeOpts{}, DockerNodeOpts{})
+	case "podman":
+		// The embedded docker options carry no json tag of their own, so
+		// they are listed separately
+		return optionKeysOf(PodmanNodeOpts{}, DockerNodeOpts{})
 	case "lxd", "lxd-vm":
 		return optionKeysOf(LxdNodeOpts{})
+	case "netns":
+		return optionKeysOf(NetnsNodeOpts{})
+	case "rootfs":
+		return optionKeysOf(RootfsNodeOpts{})
+	case "cli":
+		// The embedded ssh options carry no json tag of their own, so they
+		// are listed separately
+		return optionKeysOf(CliNodeOpts{}, SshNodeOpts{})
 	}
 	return nil
 }
@@ -201,6 +270,89 @@ func validateOptionNames(cfg *config.NodeConfig) error {
 		unknown[0], cfg.Type, strings.Join(accepted, ", "))
 }
 
+// CreatesRunScopedObjects reports whether the suite creates anything named
+// after the run ID: a docker network, an LXD network, network ACL, profile,
+// project, storage pool or volume, a managed container or instance, a
+// compose stack without a project_name, or a rootfs node's work tree and
+// machine. A --teardown-only run of such a
+// suite must be given the ID of the run it tears down to find them.
+func CreatesRunScopedObjects(cfg *config.Configuration) bool {
+	if cfg.Docker != nil && len(cfg.Docker.Networks) > 0 {
+		return true
+	}
+	if cfg.Lxd != nil && (cfg.Lxd.Project != nil || len(cfg.Lxd.Networks) > 0 || len(cfg.Lxd.Profiles) > 0 ||
+		len(cfg.Lxd.StoragePools) > 0 || len(cfg.Lxd.Volumes) > 0 || len(cfg.Lxd.Acls) > 0) {
+		return true
+	}
+	for _, node := range cfg.Nodes {
+		switch node.Type {
+		case "docker", "podman", "lxd", "lxd-vm":
+			if managed, ok := node.Options["managed"].(bool); !ok || managed {
+				return true
+			}
+		case "docker-compose":
+			if name, _ := node.Options["project_name"].(string); name == "" {
+				return true
+			}
+		case "rootfs":
+			return true
+		}
+	}
+	return false
+}
+
+// unmanagedNodeOptions lists the options an unmanaged node still honours,
+// per node type: naming the target, reaching it, and checking it is
+// ready. Everything else describes how to create it.
+var unmanagedNodeOptions = map[string][]string{
+	"docker": {"managed", "container_name", "wait_for_healthy", "ready_command", "ready_timeout"},
+	"podman": {"managed", "container_name", "wait_for_healthy", "ready_command", "ready_timeout"},
+	"lxd": {"managed", "instance_name", "project", "exec_opts", "boot_wait",
+		"socket", "remote_addr", "client_cert", "client_key", "server_cert", "trust_token", "skip_verify"},
+}
+
+// validateUnmanagedOptions rejects creation options on a managed: false
+// node. DART never creates the target, so an image or a port mapping there
+// would read as configured while describing nothing.
+func validateUnmanagedOptions(cfg *config.NodeConfig) error {
+	raw, present := cfg.Options["managed"]
+	if !present {
+		return nil
+	}
+	nodeType := cfg.Type
+	if nodeType == "lxd-vm" {
+		nodeType = "lxd"
+	}
+	allowed, ok := unmanagedNodeOptions[nodeType]
+	if !ok {
+		return fmt.Errorf("managed applies to docker, podman, lxd, and lxd-vm nodes, not %s", cfg.Type)
+	}
+	managed, ok := raw.(bool)
+	if !ok {
+		return fmt.Errorf("managed must be true or false (got %T)", raw)
+	}
+	if managed {
+		return nil
+	}
+
+	var rejected []string
+	for key := range cfg.Options {
+		if !slices.Contains(allowed, key) {
+			rejected = append(rejected, key)
+		}
+	}
+	if len(rejected) == 0 {
+		return nil
+	}
+	sort.Strings(rejected)
+	target := "container"
+	if nodeType == "lxd" {
+		target = "instance"
+	}
+	return fmt.Errorf("option %q has no effect on an unmanaged node, which adopts an existing %s instead of creating one (accepted: %s)",
+		rejected[0], target, strings.Join(allowed, ", "))
+}
+
 // validateNetworkAttachments checks the docker node-level networks list. A
 // node joins a network the suite already declared; it does not define one,
 // so addressing keys belong on the platform block that creates it.
@@ -213,6 +365,16 @@ func validateNetworkAttachments(networks []DockerNetworkOpts) error {
 			return fmt.Errorf("network %q sets subnet, which a node cannot do: the subnet belongs on the suite's docker.networks entry that creates the network",
 				net.Name)
 		}
+		if net.Ip != "" {
+			if addr, err := netip.ParseAddr(net.Ip); err != nil || !addr.Is4() {
+				return fmt.Errorf("network %q: ip %q is not an IPv4 address (an IPv6 address goes in ipv6)", net.Name, net.Ip)
+			}
+		}
+		if net.IPv6 != "" {
+			if addr, err := netip.ParseAddr(net.IPv6); err != nil || !addr.Is6() || addr.Is4In6() {
+				return fmt.Errorf("network %q: ipv6 %q is not an IPv6 address", net.Name, net.IPv6)
+			}
+		}
 	}
 	return nil
 }
@@ -244,6 +406,7 @@ func ValidateNodeSet(configs []*config.NodeConfig, opts ...NodeSetOptions) error
 
 	seen := make(map[string]bool, len(configs))
 	localNode := ""
+	publishers := make(map[string]string)
 
 	for _, cfg := range configs {
 		if seen[cfg.Name] {
@@ -276,6 +439,57 @@ func ValidateNodeSet(configs []*config.NodeConfig, opts ...NodeSetOptions) error
 				return &config.ConfigError{Message: err.Error(), Location: cfg.Loc}
 			}
 		}
+
+		// Each node publishes its own image, which two nodes sharing an
+		// alias would replace with each other's on every run
+		if cfg.Type == "lxd" || cfg.Type == "lxd-vm" {
+			var lxdOpts LxdNodeOpts
+			if err := decodeNodeOptions(cfg.Options, &lxdOpts); err != nil {
+				return err
+			}
+			if other, taken := publishers[lxdOpts.PublishAs]; taken {
+				return &config.ConfigError{
+					Message:  fmt.Sprintf("node %q and node %q both publish_as %q; give each node its own alias", other, cfg.Name, lxdOpts.PublishAs),
+					Location: cfg.Loc,
+				}
+			}
+			if lxdOpts.PublishAs != "" {
+				publishers[lxdOpts.PublishAs] = cfg.Name
+			}
+			if err := lxdOpts.validatePublishAsProject(setOpts.LxdProject); err != nil {
+				return &config.ConfigError{Message: fmt.Sprintf("node %q: %s", cfg.Name, err), Location: cfg.Loc}
+			}
+		}
+
+		// A node's volumes are created by the suite, or already exist in a
+		// pool the node names; anything else fails only when the instance
+		// is created
+		if setOpts.LxdVolumes != nil && (cfg.Type == "lxd" || cfg.Type == "lxd-vm") {
+			var lxdOpts LxdNodeOpts
+			if err := decodeNodeOptions(cfg.Options, &lxdOpts); err != nil {
+				return err
+			}
+			if err := lxdOpts.validateVolumeReferences(setOpts.LxdVolumes); err != nil {
+				return &config.ConfigError{Message: fmt.Sprintf("node %q: %s", cfg.Name, err), Location: cfg.Loc}
+			}
+		}
+
+		// A netns node's links hang off bridges the suite creates; naming
+		// one it does not would fail mid-setup with "Cannot find device"
+		if setOpts.NetnsBridges != nil && cfg.Type == "netns" {
+			var nsOpts NetnsNodeOpts
+			if err := decodeNodeOptions(cfg.Options, &nsOpts); err != nil {
+				return err
+			}
+			for _, iface := range nsOpts.Interfaces {
+				if iface.Bridge != "" && !setOpts.NetnsBridges[iface.Bridge] {
+					return &config.ConfigError{
+						Message:  fmt.Sprintf("node %q attaches to bridge %q, which is not declared under netns.bridges", cfg.Name, iface.Bridge),
+						Location: cfg.Loc,
+					}
+				}
+			}
+		}
 	}
 	return nil
 }
@@ -285,6 +499,15 @@ type NodeSetOptions struct {
 	// HasLxdPlatform reports whether the suite declares a top-level lxd:
 	// block, which fixes the server every lxd node is created on.
 	HasLxdPlatform bool
+	// NetnsBridges holds the bridge names the suite's netns block
+	// declares. Nil skips the check that netns nodes only name those.
+	NetnsBridges map[string]bool
+	// LxdVolumes holds the volumes the suite's lxd block declares. Nil
+	// skips the check that lxd nodes attach only those, or name a pool.
+	LxdVolumes map[string]*config.LxdVolumeConfig
+	// LxdProject is the project the suite's lxd block creates for each
+	// run, or empty when it declares none.
+	LxdProject string
 }
 
 // CreateNodesWithWrappers creates nodes using both Docker and LXD wrappers
@@ -306,8 +529,16 @@ func CreateNodesWithWrappers(configs []*config.NodeConfig, dockerWrapper *docker
 			node, err = NewDockerNode(dockerWrapper, cfg.Name, &cfg.Options, cfg.SuiteDir)
 		case "docker-compose":
 			node, err = NewDockerComposeNode(dockerWrapper, cfg.Name, &cfg.Options, cfg.SuiteDir)
+		case "podman":
+			node, err = NewPodmanNode(dockerWrapper, cfg.Name, &cfg.Options, cfg.SuiteDir)
 		case "ssh":
 			node, err = NewSshNode(cfg.Name, &cfg.Options, cfg.SuiteDir)
+		case "netns":
+			node, err = NewNetnsNode(cfg.Name, &cfg.Options, cfg.SuiteDir)
+		case "rootfs":
+			node, err = NewRootfsNode(cfg.Name, &cfg.Options, cfg.SuiteDir)
+		case "cli":
+			node, err = NewCliNode(cfg.Name, &cfg.Options, cfg.SuiteDir)
 		case "lxd":
 			if lxdWrapper != nil {
 				node, err = NewLxdNodeWithWrapper(lxdWrapper, cfg.Name, &cfg.Options, cfg.SuiteDir)
@@ -17,7 +17,12 @@ type Capability string
 const (
 	CapabilityReboot           Capability = "reboot"
 	CapabilitySnapshot         Capability = "snapshot"
+	CapabilityMigrate          Capability = "migrate"
 	CapabilityNetworkInspector Capability = "network inspection"
+	// CapabilityShell is a POSIX shell behind Execute, which file
+	// operations and node-side probes build their commands for. Every
+	// type has one except those implementing ifaces.ShellLess.
+	CapabilityShell Capability = "shell"
 )
 
 // nodeCapabilities records which node types implement which capability.
@@ -30,10 +35,17 @@ var nodeCapabilities = map[Capability]map[string]bool{
 		"ssh": true, "lxd": true, "lxd-vm": true,
 	},
 	CapabilitySnapshot: {
+		"lxd": true, "lxd-vm": true, "rootfs": true,
+	},
+	CapabilityMigrate: {
 		"lxd": true, "lxd-vm": true,
 	},
 	CapabilityNetworkInspector: {
-		"docker": true, "lxd": true, "lxd-vm": true,
+		"docker": true, "podman": true, "lxd": true, "lxd-vm": true, "netns": true,
+	},
+	CapabilityShell: {
+		"local": true, "docker": true, "docker-compose": true, "podman": true, "ssh": true,
+		"lxd": true, "lxd-vm": true, "netns": true, "rootfs": true,
 	},
 }
 
@@ -42,6 +54,14 @@ func Supports(nodeType string, capability Capability) bool {
 	return nodeCapabilities[capability][nodeType]
 }
 
+// HasShell reports whether a node runs commands through a POSIX shell, so
+// step and test types can refuse to build shell commands for one that
+// does not.
+func HasShell(node ifaces.Node) bool {
+	_, shellLess := node.(ifaces.ShellLess)
+	return !shellLess
+}
+
 // SupportingTypes lists the node types implementing a capability, for the
 // "supported: ..." half of an error message.
 func SupportingTypes(capability Capability) string {
@@ -61,10 +81,16 @@ func NewCheckNode(nodeType string) ifaces.Node {
 	base := checkNode{MockNode: NewMockNode()}
 
 	switch {
+	case IsKnownNodeType(nodeType) && !Supports(nodeType, CapabilityShell):
+		return &checkNodeShellLess{checkNode: base}
+	case Supports(nodeType, CapabilityReboot) && Supports(nodeType, CapabilitySnapshot) && Supports(nodeType, CapabilityMigrate):
+		return &checkNodeRebootSnapshotMigrate{checkNodeRebootSnapshot: checkNodeRebootSnapshot{checkNodeReboot: checkNodeReboot{checkNode: base}}}
 	case Supports(nodeType, CapabilityReboot) && Supports(nodeType, CapabilitySnapshot):
 		return &checkNodeRebootSnapshot{checkNodeReboot: checkNodeReboot{checkNode: base}}
 	case Supports(nodeType, CapabilityReboot):
 		return &checkNodeReboot{checkNode: base}
+	case Supports(nodeType, CapabilitySnapshot):
+		return &checkNodeSnapshot{checkNode: base}
 	default:
 		return &base
 	}
@@ -103,3 +129,27 @@ func (c *checkNodeRebootSnapshot) Snapshot(name string, stateful bool) error { r
 func (c *checkNodeRebootSnapshot) RestoreSnapshot(name string, stateful bool) error { return nil }
 
 func (c *checkNodeRebootSnapshot) DeleteSnapshot(name string) error { return nil }
+
+type checkNodeRebootSnapshotMigrate struct {
+	checkNodeRebootSnapshot
+}
+
+func (c *checkNodeRebootSnapshotMigrate) Migrate(member string, mode string, readyCommand string, timeout time.Duration) error {
+	return nil
+}
+
+type checkNodeSnapshot struct {
+	checkNode
+}
+
+func (c *checkNodeSnapshot) Snapshot(name string, stateful bool) error { return nil }
+
+func (c *checkNodeSnapshot) RestoreSnapshot(name string, stateful bool) error { return nil }
+
+func (c *checkNodeSnapshot) DeleteSnapshot(name string) error { return nil }
+
+type checkNodeShellLess struct {
+	checkNode
+}
+
+func (c *checkNodeShellLess) NoShell() {}
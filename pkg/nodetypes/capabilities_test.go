@@ -17,9 +17,15 @@ func capabilitiesOf(node interface{}) map[Capability]bool {
 	if _, ok := node.(ifaces.Snapshotter); ok {
 		found[CapabilitySnapshot] = true
 	}
+	if _, ok := node.(ifaces.Migrator); ok {
+		found[CapabilityMigrate] = true
+	}
 	if _, ok := node.(ifaces.NetworkInspector); ok {
 		found[CapabilityNetworkInspector] = true
 	}
+	if _, ok := node.(ifaces.ShellLess); !ok {
+		found[CapabilityShell] = true
+	}
 	return found
 }
 
@@ -34,14 +40,18 @@ func TestCapabilityTableMatchesNodeTypes(t *testing.T) {
 		"local":          &LocalNode{},
 		"docker":         &DockerNode{},
 		"docker-compose": &DockerComposeNode{},
+		"podman":         &PodmanNode{},
 		"ssh":            &SshNode{},
 		"lxd":            &LxdNode{},
 		"lxd-vm":         &LxdNode{},
+		"netns":          &NetnsNode{},
+		"rootfs":         &RootfsNode{},
+		"cli":            &CliNode{},
 	}
 
 	for nodeType, node := range real {
 		actual := capabilitiesOf(node)
-		for _, capability := range []Capability{CapabilityReboot, CapabilitySnapshot, CapabilityNetworkInspector} {
+		for _, capability := range []Capability{CapabilityReboot, CapabilitySnapshot, CapabilityMigrate, CapabilityNetworkInspector, CapabilityShell} {
 			assert.Equal(t, actual[capability], Supports(nodeType, capability),
 				"table and implementation disagree: %s / %s", nodeType, capability)
 		}
@@ -63,7 +73,7 @@ func TestCheckNodeMirrorsRealCapabilities(t *testing.T) {
 		stand := NewCheckNode(nodeType)
 		actual := capabilitiesOf(stand)
 
-		for _, capability := range []Capability{CapabilityReboot, CapabilitySnapshot} {
+		for _, capability := range []Capability{CapabilityReboot, CapabilitySnapshot, CapabilityMigrate, CapabilityShell} {
 			assert.Equal(t, Supports(nodeType, capability), actual[capability],
 				"stand-in for %s: %s", nodeType, capability)
 		}
@@ -80,5 +90,13 @@ func TestCheckNodeAcceptsAnyCommand(t *testing.T) {
 
 func TestSupportingTypesIsSortedAndComplete(t *testing.T) {
 	assert.Equal(t, "lxd, lxd-vm, ssh", SupportingTypes(CapabilityReboot))
-	assert.Equal(t, "lxd, lxd-vm", SupportingTypes(CapabilitySnapshot))
+	assert.Equal(t, "lxd, lxd-vm, rootfs", SupportingTypes(CapabilitySnapshot))
+	assert.Equal(t, "lxd, lxd-vm", SupportingTypes(CapabilityMigrate))
+}
+
+// Stand-ins for types outside the table, which --check rejects elsewhere,
+// keep a shell, so an unknown type is not reported as shell-less too.
+func TestCheckNodeForUnknownTypeHasShell(t *testing.T) {
+	assert.True(t, HasShell(NewCheckNode("no-such-type")))
+	assert.False(t, HasShell(NewCheckNode("cli")))
 }
@@ -0,0 +1,260 @@
+package nodetypes
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/bgrewell/dart/internal/execution"
+	"github.com/bgrewell/dart/internal/helpers"
+	"github.com/bgrewell/dart/internal/prompt"
+	"github.com/bgrewell/dart/internal/stream"
+	"github.com/bgrewell/dart/pkg/ifaces"
+	"golang.org/x/crypto/ssh"
+)
+
+var _ ifaces.Node = &CliNode{}
+var _ ifaces.ShellLess = &CliNode{}
+
+type CliNodeOpts struct {
+	// The connection options are the ssh node's: host, port, user, key,
+	// pass, known_hosts, insecure_skip_host_key, and bastion
+	SshNodeOpts
+	// Prompt is a regular expression matched against the last line of
+	// output; a match means the device is ready for the next command
+	Prompt string `yaml:"prompt,omitempty" json:"prompt"`
+	// Pager matches a paging prompt such as --More--, answered with
+	// PagerResponse (a space by default)
+	Pager         string `yaml:"pager,omitempty" json:"pager"`
+	PagerResponse string `yaml:"pager_response,omitempty" json:"pager_response"`
+	// ErrorPatterns are matched against each line of a command's output;
+	// any match gives the command exit code 1
+	ErrorPatterns []string `yaml:"error_patterns,omitempty" json:"error_patterns"`
+	// Enable enters privileged mode after login
+	Enable *CliEnableOpts `yaml:"enable,omitempty" json:"enable"`
+	// InitCommands run once after login (and enable), e.g.
+	// "terminal length 0"
+	InitCommands []string `yaml:"init_commands,omitempty" json:"init_commands"`
+	// Timeout is the seconds to wait for the prompt after each command.
+	// Defaults to 30.
+	Timeout int `yaml:"timeout,omitempty" json:"timeout"`
+}
+
+// CliEnableOpts describes how a device enters privileged mode.
+type CliEnableOpts struct {
+	// Command defaults to "enable"
+	Command  string `yaml:"command,omitempty" json:"command"`
+	Password string `yaml:"password,omitempty" json:"password"`
+	// PasswordPrompt matches the device asking for the password
+	PasswordPrompt string `yaml:"password_prompt,omitempty" json:"password_prompt"`
+}
+
+// sessionOptions compiles the prompt-matching options, so a bad pattern
+// is reported by --check rather than on connect.
+func (o CliNodeOpts) sessionOptions() (prompt.Options, error) {
+	opts := prompt.Options{PagerResponse: o.PagerResponse}
+	var err error
+
+	if opts.Prompt, err = compileCliPattern("prompt", o.Prompt, prompt.DefaultPrompt); err != nil {
+		return opts, err
+	}
+	if opts.Pager, err = compileCliPattern("pager", o.Pager, prompt.DefaultPager); err != nil {
+		return opts, err
+	}
+	patterns := o.ErrorPatterns
+	if patterns == nil {
+		patterns = prompt.DefaultErrorPatterns
+	}
+	for _, pattern := range patterns {
+		compiled, err := compileCliPattern("error_patterns", pattern, "")
+		if err != nil {
+			return opts, err
+		}
+		opts.Errors = append(opts.Errors, compiled)
+	}
+	if o.Enable != nil {
+		if _, err := compileCliPattern("enable password_prompt", o.Enable.PasswordPrompt, prompt.DefaultPasswordPrompt); err != nil {
+			return opts, err
+		}
+	}
+
+	if o.Timeout < 0 {
+		return opts, fmt.Errorf("timeout must not be negative")
+	}
+	opts.Timeout = time.Duration(o.Timeout) * time.Second
+	return opts, nil
+}
+
+func compileCliPattern(option, pattern, fallback string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		pattern = fallback
+	}
+	compiled, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("%s %q is not a valid regular expression: %w", option, pattern, err)
+	}
+	return compiled, nil
+}
+
+func NewCliNode(name string, opts ifaces.NodeOptions, suiteDir string) (node ifaces.Node, err error) {
+
+	jsonData, err := json.Marshal(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var nodeopts CliNodeOpts
+	err = json.Unmarshal(jsonData, &nodeopts)
+	if err != nil {
+		return nil, err
+	}
+
+	sessionOpts, err := nodeopts.sessionOptions()
+	if err != nil {
+		return nil, err
+	}
+
+	// The connection, bastion, and host-key handling are the ssh node's;
+	// only what runs over the connection differs
+	conn, err := NewSshNode(name, opts, suiteDir)
+	if err != nil {
+		return nil, err
+	}
+	c := &CliNode{
+		name:    name,
+		options: nodeopts,
+		conn:    conn.(*SshNode),
+	}
+	if err := c.open(sessionOpts); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// CliNode is a network device reached over SSH whose command line is a
+// vendor CLI rather than a POSIX shell. It keeps one interactive session
+// open and treats the prompt reappearing as the end of each command's
+// output.
+type CliNode struct {
+	name    string
+	options CliNodeOpts
+	conn    *SshNode
+	session *ssh.Session
+	cli     *prompt.Session
+}
+
+// open starts the interactive session, waits out the login banner, and
+// runs the enable and init commands.
+func (c *CliNode) open(sessionOpts prompt.Options) error {
+	session, err := c.conn.client.NewSession()
+	if err != nil {
+		return fmt.Errorf("cli node %s: failed to open a session: %w", c.name, err)
+	}
+	c.session = session
+
+	// A wide terminal keeps long lines from wrapping, which would split
+	// output lines and the echoed command
+	modes := ssh.TerminalModes{ssh.ECHO: 1}
+	if err := session.RequestPty("vt100", 200, 511, modes); err != nil {
+		return fmt.Errorf("cli node %s: failed to request a terminal: %w", c.name, err)
+	}
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := session.Shell(); err != nil {
+		return fmt.Errorf("cli node %s: failed to start the CLI: %w", c.name, err)
+	}
+
+	c.cli = prompt.NewSession(stdout, stdin, sessionOpts)
+	if err := c.cli.WaitForPrompt(); err != nil {
+		return fmt.Errorf("cli node %s: no prompt after login: %w (set prompt to match this device)", c.name, err)
+	}
+	return c.initialise()
+}
+
+// initialise enters privileged mode and runs the init commands. A failing
+// init command is an error: the suite was written against the mode it
+// sets up.
+func (c *CliNode) initialise() error {
+	if enable := c.options.Enable; enable != nil {
+		command := enable.Command
+		if command == "" {
+			command = "enable"
+		}
+		passwordPrompt, _ := compileCliPattern("enable password_prompt", enable.PasswordPrompt, prompt.DefaultPasswordPrompt)
+		if err := c.cli.Enable(command, enable.Password, passwordPrompt); err != nil {
+			return fmt.Errorf("cli node %s: %w", c.name, err)
+		}
+	}
+	for _, command := range c.options.InitCommands {
+		output, failed, err := c.cli.Run(command)
+		if err != nil {
+			return fmt.Errorf("cli node %s: %w", c.name, err)
+		}
+		if failed {
+			return fmt.Errorf("cli node %s: init command %q failed: %s", c.name, command, strings.TrimSpace(output))
+		}
+	}
+	return nil
+}
+
+// NoShell marks the node as having no POSIX shell.
+func (c *CliNode) NoShell() {}
+
+func (c *CliNode) Setup() error {
+	return nil
+}
+
+func (c *CliNode) Teardown() error {
+	return nil
+}
+
+// Execute sends the command to the CLI and returns what it printed before
+// the prompt came back. The CLI has no exit status: the exit code is 1
+// when a line matches an error pattern and 0 otherwise. A terminal merges
+// the streams, so everything is on stdout.
+func (c *CliNode) Execute(command string, options ...execution.ExecutionOption) (result *execution.ExecutionResult, err error) {
+	if c.cli == nil {
+		return nil, fmt.Errorf("cli node %s has no open session", c.name)
+	}
+
+	output, failed, err := c.cli.Run(command)
+	if err != nil {
+		return nil, fmt.Errorf("cli node %s: %w", c.name, err)
+	}
+
+	debugEnabled := execution.IsDebugMode()
+	stdoutWriter := stream.NewTeeWriter(stream.StreamStdout, c.name, debugEnabled)
+	stderrWriter := stream.NewTeeWriter(stream.StreamStderr, c.name, debugEnabled)
+	stdoutWriter.Write([]byte(output))
+
+	exitCode := 0
+	if failed {
+		exitCode = 1
+	}
+	return &execution.ExecutionResult{
+		ExecutionId: helpers.GetRandomId(),
+		ExitCode:    exitCode,
+		Stdout:      stdoutWriter.Reader(),
+		Stderr:      stderrWriter.Reader(),
+	}, nil
+}
+
+// Close ends the session and the connection under it.
+func (c *CliNode) Close() error {
+	if c.session != nil {
+		c.session.Close()
+	}
+	if c.conn != nil {
+		return c.conn.Close()
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package nodetypes
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/bgrewell/dart/internal/prompt"
+	"github.com/bgrewell/dart/pkg/ifaces"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// scriptedCli answers each input line with canned output, the way a
+// switch echoes the command and prints its result.
+type scriptedCli struct {
+	out     *io.PipeWriter
+	replies map[string]string
+	inputs  []string
+}
+
+func (d *scriptedCli) Write(p []byte) (int, error) {
+	d.inputs = append(d.inputs, string(p))
+	if reply, ok := d.replies[string(p)]; ok {
+		go d.out.Write([]byte(reply))
+	}
+	return len(p), nil
+}
+
+func newTestCliNode(t *testing.T, options CliNodeOpts, replies map[string]string) (*CliNode, *scriptedCli) {
+	t.Helper()
+	sessionOpts, err := options.sessionOptions()
+	require.NoError(t, err)
+	sessionOpts.Timeout = time.Second
+
+	r, w := io.Pipe()
+	t.Cleanup(func() { w.Close() })
+	device := &scriptedCli{out: w, replies: replies}
+	node := &CliNode{name: "sw1", options: options, cli: prompt.NewSession(r, device, sessionOpts)}
+
+	go w.Write([]byte("sw1>"))
+	require.NoError(t, node.cli.WaitForPrompt())
+	return node, device
+}
+
+func TestCliNodeExecuteMapsErrorsToExitCode(t *testing.T) {
+	node, _ := newTestCliNode(t, CliNodeOpts{}, map[string]string{
+		"show version\n": "show version\r\nCisco IOS Software, Version 15.2\r\nsw1>",
+		"show bogus\n":   "show bogus\r\n% Invalid input detected at '^' marker.\r\nsw1>",
+	})
+
+	result, err := node.Execute("show version")
+	require.NoError(t, err)
+	assert.Equal(t, 0, result.ExitCode)
+	stdout, _ := io.ReadAll(result.Stdout)
+	assert.Equal(t, "Cisco IOS Software, Version 15.2\n", string(stdout))
+
+	result, err = node.Execute("show bogus")
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.ExitCode)
+}
+
+func TestCliNodeInitialiseEnablesThenRunsInitCommands(t *testing.T) {
+	node, device := newTestCliNode(t, CliNodeOpts{
+		Enable:       &CliEnableOpts{Password: "s3cret"},
+		InitCommands: []string{"terminal length 0"},
+	}, map[string]string{
+		"enable\n":            "enable\r\nPassword: ",
+		"s3cret\n":            "\r\nsw1#",
+		"terminal length 0\n": "terminal length 0\r\nsw1#",
+	})
+
+	require.NoError(t, node.initialise())
+	assert.Equal(t, []string{"enable\n", "s3cret\n", "terminal length 0\n"}, device.inputs)
+}
+
+func TestCliNodeInitCommandFailureIsAnError(t *testing.T) {
+	node, _ := newTestCliNode(t, CliNodeOpts{InitCommands: []string{"terminal pager 0"}}, map[string]string{
+		"terminal pager 0\n": "terminal pager 0\r\n% Invalid input detected\r\nsw1>",
+	})
+
+	err := node.initialise()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `init command "terminal pager 0" failed`)
+}
+
+func TestCliNodeOptsRejectBadPatterns(t *testing.T) {
+	_, err := CliNodeOpts{Prompt: "sw1(>"}.sessionOptions()
+	assert.ErrorContains(t, err, "prompt")
+	_, err = CliNodeOpts{ErrorPatterns: []string{"["}}.sessionOptions()
+	assert.ErrorContains(t, err, "error_patterns")
+	_, err = CliNodeOpts{Enable: &CliEnableOpts{PasswordPrompt: "("}}.sessionOptions()
+	assert.ErrorContains(t, err, "password_prompt")
+	_, err = CliNodeOpts{Timeout: -1}.sessionOptions()
+	assert.ErrorContains(t, err, "timeout")
+}
+
+func TestCliNodeHasNoShell(t *testing.T) {
+	var node ifaces.Node = &CliNode{}
+	assert.False(t, HasShell(node))
+	assert.True(t, HasShell(&LocalNode{}))
+}
@@ -5,12 +5,15 @@ import (
 	"fmt"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/bgrewell/dart/internal/config"
 	"github.com/bgrewell/dart/internal/docker"
 	"github.com/bgrewell/dart/internal/execution"
 	"github.com/bgrewell/dart/internal/helpers"
+	"github.com/bgrewell/dart/internal/runlabel"
 	"github.com/bgrewell/dart/pkg/ifaces"
+	"github.com/docker/docker/client"
 )
 
 var _ ifaces.Node = &DockerNode{}
@@ -19,10 +22,14 @@ type DockerNetworkOpts struct {
 	Name   string `yaml:"name,omitempty" json:"name"`
 	Subnet string `yaml:"subnet,omitempty" json:"subnet"`
 	Ip     string `yaml:"ip,omitempty" json:"ip"`
+	IPv6   string `yaml:"ipv6,omitempty" json:"ipv6"`
 }
 
 type DockerNodeOpts struct {
 	Image string `yaml:"image,omitempty" json:"image"`
+	// Managed false adopts an existing, running container instead of
+	// creating one, and leaves it in place at teardown. Defaults to true.
+	Managed *bool `yaml:"managed,omitempty" json:"managed"`
 	// ContainerName decouples the Docker object's name from the node name.
 	// Defaults to the node name, which is what makes a suite's containers
 	// findable by the name the YAML uses.
@@ -44,6 +51,153 @@ type DockerNodeOpts struct {
 	// Capabilities adds specific Linux capabilities without going
 	// privileged (e.g. NET_ADMIN for network tests).
 	Capabilities []string `yaml:"capabilities,omitempty" json:"capabilities"`
+	// WaitForHealthy holds setup until the image's HEALTHCHECK reports
+	// healthy, so tests never reach a container whose entrypoint is still
+	// initialising. An unhealthy container fails setup.
+	WaitForHealthy bool `yaml:"wait_for_healthy,omitempty" json:"wait_for_healthy"`
+	// ReadyCommand must exit zero before the container counts as ready,
+	// like an LXD node's boot_wait.ready_command.
+	ReadyCommand string `yaml:"ready_command,omitempty" json:"ready_command"`
+	// ReadyTimeout is the maximum seconds to wait for readiness (default 120)
+	ReadyTimeout int `yaml:"ready_timeout,omitempty" json:"ready_timeout"`
+	// Resource limits reproduce production constraints. Sizes use the
+	// docker CLI's notation ("256m", "1g").
+	Memory     string   `yaml:"memory,omitempty" json:"memory"`
+	MemorySwap string   `yaml:"memory_swap,omitempty" json:"memory_swap"` // memory plus swap; "-1" for unlimited swap
+	CPUs       float64  `yaml:"cpus,omitempty" json:"cpus"`
+	PidsLimit  int64    `yaml:"pids_limit,omitempty" json:"pids_limit"`
+	Ulimits    []string `yaml:"ulimits,omitempty" json:"ulimits"` // name=soft[:hard]
+	ShmSize    string   `yaml:"shm_size,omitempty" json:"shm_size"`
+	// Runtime options
+	Sysctls    map[string]interface{} `yaml:"sysctls,omitempty" json:"sysctls"`
+	Tmpfs      []string               `yaml:"tmpfs,omitempty" json:"tmpfs"` // path[:options]
+	User       string                 `yaml:"user,omitempty" json:"user"`
+	Workdir    string                 `yaml:"workdir,omitempty" json:"workdir"`
+	Hostname   string                 `yaml:"hostname,omitempty" json:"hostname"`
+	DNS        []string               `yaml:"dns,omitempty" json:"dns"`
+	ExtraHosts []string               `yaml:"extra_hosts,omitempty" json:"extra_hosts"` // host:ip
+	Init       bool                   `yaml:"init,omitempty" json:"init"`
+	Restart    string                 `yaml:"restart,omitempty" json:"restart"`
+}
+
+// runtimeOptions parses the resource limits and runtime options into
+// container options. Validation calls it too, so a malformed size or
+// ulimit is reported by --check rather than by the daemon.
+func (o DockerNodeOpts) runtimeOptions() ([]docker.ContainerOptions, error) {
+	var opts []docker.ContainerOptions
+	if o.Memory != "" {
+		limit, err := docker.ParseByteSize(o.Memory)
+		if err != nil {
+			return nil, fmt.Errorf("memory: %w", err)
+		}
+		opts = append(opts, docker.WithMemory(limit))
+	}
+	if o.MemorySwap != "" {
+		if o.Memory == "" {
+			return nil, fmt.Errorf("memory_swap requires memory: it limits memory plus swap")
+		}
+		limit, err := docker.ParseMemorySwap(o.MemorySwap)
+		if err != nil {
+			return nil, fmt.Errorf("memory_swap: %w", err)
+		}
+		opts = append(opts, docker.WithMemorySwap(limit))
+	}
+	if o.CPUs < 0 {
+		return nil, fmt.Errorf("cpus must be positive (got %v)", o.CPUs)
+	}
+	if o.CPUs > 0 {
+		opts = append(opts, docker.WithCPUs(o.CPUs))
+	}
+	if o.PidsLimit < 0 {
+		return nil, fmt.Errorf("pids_limit must be positive (got %d)", o.PidsLimit)
+	}
+	if o.PidsLimit > 0 {
+		opts = append(opts, docker.WithPidsLimit(o.PidsLimit))
+	}
+	if len(o.Ulimits) > 0 {
+		ulimits, err := docker.ParseUlimits(o.Ulimits)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, docker.WithUlimits(ulimits))
+	}
+	if o.ShmSize != "" {
+		size, err := docker.ParseByteSize(o.ShmSize)
+		if err != nil {
+			return nil, fmt.Errorf("shm_size: %w", err)
+		}
+		opts = append(opts, docker.WithShmSize(size))
+	}
+	if len(o.Sysctls) > 0 {
+		sysctls := make(map[string]string, len(o.Sysctls))
+		for key, value := range o.Sysctls {
+			switch value.(type) {
+			case string, float64, bool:
+				// YAML reads net.ipv4.ip_forward: 1 as a number; the
+				// kernel takes the text either way
+				sysctls[key] = fmt.Sprint(value)
+			default:
+				return nil, fmt.Errorf("sysctl %s must be a string or number (got %T)", key, value)
+			}
+		}
+		opts = append(opts, docker.WithSysctls(sysctls))
+	}
+	if len(o.Tmpfs) > 0 {
+		mounts, err := docker.ParseTmpfs(o.Tmpfs)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, docker.WithTmpfs(mounts))
+	}
+	if o.User != "" {
+		opts = append(opts, docker.WithUser(o.User))
+	}
+	if o.Workdir != "" {
+		if !strings.HasPrefix(o.Workdir, "/") {
+			return nil, fmt.Errorf("workdir must be an absolute path (got %q)", o.Workdir)
+		}
+		opts = append(opts, docker.WithWorkingDir(o.Workdir))
+	}
+	if len(o.DNS) > 0 {
+		if err := docker.ValidateDNSServers(o.DNS); err != nil {
+			return nil, err
+		}
+		opts = append(opts, docker.WithDNS(o.DNS))
+	}
+	if len(o.ExtraHosts) > 0 {
+		if err := docker.ValidateExtraHosts(o.ExtraHosts); err != nil {
+			return nil, err
+		}
+		opts = append(opts, docker.WithExtraHosts(o.ExtraHosts))
+	}
+	if o.Init {
+		opts = append(opts, docker.WithInit())
+	}
+	if o.Restart != "" {
+		policy, err := docker.ParseRestartPolicy(o.Restart)
+		if err != nil {
+			return nil, fmt.Errorf("restart: %w", err)
+		}
+		opts = append(opts, docker.WithRestartPolicy(policy))
+	}
+	return opts, nil
+}
+
+// managed reports whether DART owns the container's lifecycle.
+func (o DockerNodeOpts) managed() bool {
+	return o.Managed == nil || *o.Managed
+}
+
+// readinessConfig converts the readiness options into a readiness
+// configuration, substituting defaults for any value that was not provided.
+func (o DockerNodeOpts) readinessConfig() *docker.ContainerReadinessConfig {
+	config := docker.DefaultContainerReadinessConfig()
+	if o.ReadyTimeout > 0 {
+		config.Timeout = time.Duration(o.ReadyTimeout) * time.Second
+	}
+	config.WaitForHealthy = o.WaitForHealthy
+	config.ReadyCommand = o.ReadyCommand
+	return config
 }
 
 func NewDockerNode(wrapper *docker.Wrapper, name string, opts ifaces.NodeOptions, suiteDir string) (node ifaces.Node, err error) {
@@ -101,6 +255,10 @@ func resolveVolumes(volumes []string, suiteDir string) ([]string, error) {
 }
 
 func (d *DockerNode) Setup() error {
+	if !d.options.managed() {
+		return d.adopt()
+	}
+
 	// Fetch the image first: creating a container from an absent image fails
 	// with the daemon's "No such image", which describes the symptom rather
 	// than the cause
@@ -134,44 +292,74 @@ func (d *DockerNode) Setup() error {
 	if len(d.options.Entrypoint) > 0 {
 		opts = append(opts, docker.WithEntrypoint(d.options.Entrypoint))
 	}
+	runtime, err := d.options.runtimeOptions()
+	if err != nil {
+		return err
+	}
+	opts = append(opts, runtime...)
 	if len(d.options.Networks) > 0 {
 		attachments := make([]docker.NetworkAttachment, 0, len(d.options.Networks))
 		for _, net := range d.options.Networks {
-			attachments = append(attachments, docker.NetworkAttachment{Name: net.Name, IPv4: net.Ip})
+			attachments = append(attachments, docker.NetworkAttachment{
+				Name: net.Name, IPv4: net.Ip, IPv6: net.IPv6, Aliases: []string{d.name},
+			})
 		}
 		opts = append(opts, docker.WithNetworks(attachments))
 	}
 
 	// The hostname stays the node name even when the container is named
-	// something else, so node-side commands see the name the suite uses
-	if err := d.wrapper.CreateContainer(d.containerName(), d.name, d.options.Image, opts...); err != nil {
+	// something else, so node-side commands see the name the suite uses,
+	// unless the suite sets one
+	hostname := d.name
+	if d.options.Hostname != "" {
+		hostname = d.options.Hostname
+	}
+	if err := d.wrapper.CreateContainer(d.containerName(), hostname, d.options.Image, opts...); err != nil {
 		return err
 	}
 	if err := d.wrapper.StartContainer(d.containerName()); err != nil {
 		return err
 	}
-	// Wait for the container to be fully ready (running and responsive)
-	if err := d.wrapper.WaitForContainerReady(d.containerName()); err != nil {
+	// Wait for the container to be fully ready (running, healthy when
+	// asked, and responsive)
+	if err := d.wrapper.WaitForContainerReady(d.containerName(), d.options.readinessConfig()); err != nil {
 		return err
 	}
 	return nil
 }
 
-// containerName is the Docker object's name. It defaults to the node name,
-// so a suite's containers are findable by the name the YAML uses;
+// adopt attaches to a container someone else provides. Nothing is
+// created or started; the container must already be running, and is then
+// held to the same readiness check as one DART created.
+func (d *DockerNode) adopt() error {
+	if err := d.wrapper.AdoptContainer(d.containerName()); err != nil {
+		return err
+	}
+	return d.wrapper.WaitForContainerReady(d.containerName(), d.options.readinessConfig())
+}
+
+// containerName is the Docker object's name. It defaults to the node name
+// scoped by the run ID, so concurrent runs of one suite do not collide;
+// the container still answers to the node name on its networks.
 // container_name overrides it for suites that must match an externally
-// fixed name.
+// fixed name, and an adopted container is found by the node name as is.
 func (d *DockerNode) containerName() string {
 	if d.options.ContainerName != "" {
 		return d.options.ContainerName
 	}
-	return d.name
+	if !d.options.managed() {
+		return d.name
+	}
+	return runlabel.Current().Scoped(d.name)
 }
 
 // Teardown stops and removes the container. A container that no longer
 // exists (partial setup, previous cleanup, teardown-only run) counts as
-// already removed.
+// already removed. An adopted container is left running.
 func (d *DockerNode) Teardown() error {
+	if !d.options.managed() {
+		return nil
+	}
 	if err := d.wrapper.StopContainer(d.containerName()); err != nil {
 		if docker.IsNotFound(err) {
 			return nil
@@ -198,6 +386,13 @@ func (d *DockerNode) Execute(command string, options ...execution.ExecutionOptio
 	}, nil
 }
 
+// DockerContainer returns the Engine API client and the container's
+// reference, so file transfers can use the archive API rather than the
+// container's shell.
+func (d *DockerNode) DockerContainer() (client.APIClient, string, error) {
+	return d.wrapper.GetClient(), d.containerName(), nil
+}
+
 var _ ifaces.NetworkInspector = &DockerNode{}
 
 // NetworkFacts reports the container's addresses from Docker's own
@@ -1,13 +1,16 @@
 package nodetypes
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/bgrewell/dart/internal/config"
 	"github.com/bgrewell/dart/internal/docker"
 	"github.com/bgrewell/dart/internal/execution"
 	"github.com/bgrewell/dart/internal/helpers"
+	"github.com/bgrewell/dart/internal/runlabel"
 	"github.com/bgrewell/dart/pkg/ifaces"
+	"github.com/docker/docker/client"
 	"strings"
 )
 
@@ -19,6 +22,17 @@ type DockerComposeNodeOpts struct {
 	ProjectName string                 `yaml:"project_name,omitempty" json:"project_name"`
 	Service     string                 `yaml:"service,omitempty" json:"service"`
 	ExecOptions map[string]interface{} `yaml:"exec_opts,omitempty" json:"exec_opts"`
+	// The readiness options mean what they mean on a docker node, applied
+	// to the service container once the stack is up
+	WaitForHealthy bool   `yaml:"wait_for_healthy,omitempty" json:"wait_for_healthy"`
+	ReadyCommand   string `yaml:"ready_command,omitempty" json:"ready_command"`
+	ReadyTimeout   int    `yaml:"ready_timeout,omitempty" json:"ready_timeout"`
+}
+
+// waitsForReady reports whether the node asked for a readiness wait;
+// without one, setup returns as soon as the stack is up.
+func (o DockerComposeNodeOpts) waitsForReady() bool {
+	return o.WaitForHealthy || o.ReadyCommand != ""
 }
 
 // NewDockerComposeNode creates a new docker-compose node
@@ -61,9 +75,15 @@ type DockerComposeNode struct {
 // Setup starts the docker-compose stack
 func (d *DockerComposeNode) Setup() error {
 	// Generate a unique key for this compose stack
+	// The default project is scoped by the run ID, so concurrent runs of
+	// one suite bring up separate stacks, and labelled with it, so dart gc
+	// removes the stack of a run that died. A project_name the suite pins
+	// is reused by the next run instead, as it always was
 	projectName := d.options.ProjectName
+	var labels map[string]string
 	if projectName == "" {
-		projectName = d.name
+		projectName = runlabel.Current().Scoped(d.name)
+		labels = runlabel.Current().Labels()
 	}
 	d.stackKey = docker.GetStackKey(d.options.ComposeFile, projectName)
 
@@ -77,6 +97,7 @@ func (d *DockerComposeNode) Setup() error {
 			d.options.ComposeFile,
 			projectName,
 		)
+		stack.Labels = labels
 
 		if err := stack.Up(); err != nil {
 			return nil, fmt.Errorf("failed to start compose stack: %v", err)
@@ -90,6 +111,21 @@ func (d *DockerComposeNode) Setup() error {
 	}
 
 	d.stack = stack
+
+	if d.options.waitsForReady() {
+		cli, id, err := d.DockerContainer()
+		if err != nil {
+			return err
+		}
+		readiness := DockerNodeOpts{
+			WaitForHealthy: d.options.WaitForHealthy,
+			ReadyCommand:   d.options.ReadyCommand,
+			ReadyTimeout:   d.options.ReadyTimeout,
+		}.readinessConfig()
+		if err := docker.WaitForContainerReady(context.Background(), cli, id, readiness); err != nil {
+			return fmt.Errorf("service %s not ready: %v", d.options.Service, err)
+		}
+	}
 	return nil
 }
 
@@ -141,6 +177,22 @@ func (d *DockerComposeNode) Execute(command string, options ...execution.Executi
 	}, nil
 }
 
+// DockerContainer returns the Engine API client and the ID of the node's
+// service container. See DockerNode.DockerContainer.
+func (d *DockerComposeNode) DockerContainer() (client.APIClient, string, error) {
+	if d.stack == nil {
+		return nil, "", fmt.Errorf("compose stack not initialized")
+	}
+	if d.options.Service == "" {
+		return nil, "", fmt.Errorf("no service specified for execution (set 'service' in node options)")
+	}
+	id, err := d.stack.GetServiceContainerID(d.options.Service)
+	if err != nil {
+		return nil, "", err
+	}
+	return d.wrapper.GetClient(), id, nil
+}
+
 // Close cleans up any resources
 func (d *DockerComposeNode) Close() error {
 	// No specific cleanup needed beyond teardown
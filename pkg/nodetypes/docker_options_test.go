@@ -5,6 +5,7 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/bgrewell/dart/internal/config"
 	"github.com/stretchr/testify/assert"
@@ -102,3 +103,74 @@ func TestValidateNodeOptionsCatchesLocalProblems(t *testing.T) {
 	})
 	assert.NoError(t, err)
 }
+
+func TestDockerReadinessOptions(t *testing.T) {
+	readiness := DockerNodeOpts{WaitForHealthy: true, ReadyCommand: "pg_isready", ReadyTimeout: 300}.readinessConfig()
+	assert.True(t, readiness.WaitForHealthy)
+	assert.Equal(t, "pg_isready", readiness.ReadyCommand)
+	assert.Equal(t, 300*time.Second, readiness.Timeout)
+	assert.Equal(t, 2*time.Minute, DockerNodeOpts{}.readinessConfig().Timeout, "the default timeout is kept")
+
+	err := ValidateNodeOptions(&config.NodeConfig{
+		Name: "db", Type: "docker",
+		Options: map[string]interface{}{"image": "postgres", "ready_timeout": -1},
+	})
+	assert.ErrorContains(t, err, "ready_timeout must not be negative")
+
+	err = ValidateNodeOptions(&config.NodeConfig{
+		Name: "stack", Type: "docker-compose",
+		Options: map[string]interface{}{"compose_file": "compose.yml", "wait_for_healthy": true},
+	})
+	assert.ErrorContains(t, err, "need service")
+}
+
+// Limits are parsed at --check time, so a typo in a unit fails validation
+// instead of the container create.
+func TestDockerRuntimeOptions(t *testing.T) {
+	err := ValidateNodeOptions(&config.NodeConfig{
+		Name: "app", Type: "docker",
+		Options: map[string]interface{}{"image": "ubuntu", "memory": "512q"},
+	})
+	assert.ErrorContains(t, err, "memory")
+
+	err = ValidateNodeOptions(&config.NodeConfig{
+		Name: "app", Type: "docker",
+		Options: map[string]interface{}{"image": "ubuntu", "memory_swap": "1g"},
+	})
+	assert.ErrorContains(t, err, "memory_swap requires memory")
+
+	err = ValidateNodeOptions(&config.NodeConfig{
+		Name: "app", Type: "docker",
+		Options: map[string]interface{}{"image": "ubuntu", "workdir": "srv"},
+	})
+	assert.ErrorContains(t, err, "workdir must be an absolute path")
+
+	err = ValidateNodeOptions(&config.NodeConfig{
+		Name: "app", Type: "docker",
+		Options: map[string]interface{}{
+			"image": "ubuntu", "memory": "256m", "memory_swap": "256m", "cpus": 1.5,
+			"pids_limit": 100, "ulimits": []interface{}{"nofile=1024:2048"}, "shm_size": "64m",
+			"sysctls": map[string]interface{}{"net.ipv4.ip_forward": 1},
+			"tmpfs":   []interface{}{"/run:size=16m"}, "user": "1000:1000", "workdir": "/srv",
+			"hostname": "app.test", "dns": []interface{}{"10.0.0.2"},
+			"extra_hosts": []interface{}{"db:10.0.0.5"}, "init": true, "restart": "on-failure:3",
+		},
+	})
+	assert.NoError(t, err)
+
+	opts, err := DockerNodeOpts{Memory: "256m", CPUs: 2, Init: true}.runtimeOptions()
+	require.NoError(t, err)
+	assert.Len(t, opts, 3)
+}
+
+func TestDockerNetworkAddressFamilies(t *testing.T) {
+	attach := func(network map[string]interface{}) error {
+		return ValidateNodeOptions(&config.NodeConfig{
+			Name: "web", Type: "docker",
+			Options: map[string]interface{}{"image": "nginx", "networks": []interface{}{network}},
+		})
+	}
+	assert.NoError(t, attach(map[string]interface{}{"name": "dual", "ip": "172.30.0.10", "ipv6": "fd00:30::10"}))
+	assert.ErrorContains(t, attach(map[string]interface{}{"name": "dual", "ip": "fd00:30::10"}), "goes in ipv6")
+	assert.ErrorContains(t, attach(map[string]interface{}{"name": "dual", "ipv6": "172.30.0.10"}), "not an IPv6 address")
+}
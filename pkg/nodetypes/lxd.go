@@ -11,8 +11,10 @@ import (
 	"encoding/pem"
 	"errors"
 	"fmt"
+	"maps"
 	"math/big"
 	"net"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
@@ -25,6 +27,7 @@ import (
 	"github.com/bgrewell/dart/internal/lxc"
 	"github.com/bgrewell/dart/internal/lxd"
 	"github.com/bgrewell/dart/internal/platform"
+	"github.com/bgrewell/dart/internal/runlabel"
 	"github.com/bgrewell/dart/internal/stream"
 	"github.com/bgrewell/dart/pkg/ifaces"
 	lxdclient "github.com/canonical/lxd/client"
@@ -32,14 +35,16 @@ import (
 )
 
 var _ ifaces.Node = &LxdNode{}
+var _ ifaces.SetupTemplater = &LxdNode{}
 
 // LxdNetworkOpts attaches a node to an existing network. The bridge itself
 // is created by the suite's lxd.networks block, which is where addressing
 // like subnet and gateway belongs; a node only names the network to join
 // and, optionally, the address to take on it.
 type LxdNetworkOpts struct {
-	Name string `yaml:"name,omitempty" json:"name"`
-	Ip   string `yaml:"ip,omitempty" json:"ip"`
+	Name string   `yaml:"name,omitempty" json:"name"`
+	Ip   string   `yaml:"ip,omitempty" json:"ip"`
+	Acls []string `yaml:"acls,omitempty" json:"acls"` // Network ACLs applied to this NIC alone
 	// Subnet is accepted only so a suite that sets it gets a clear error
 	// instead of a silent no-op; see ValidateNodeOptions.
 	Subnet string `yaml:"subnet,omitempty" json:"subnet"`
@@ -65,6 +70,7 @@ type LxdBootWaitOpts struct {
 
 type LxdNodeOpts struct {
 	Image        string                            `yaml:"image,omitempty" json:"image"`
+	CloneFrom    *LxdCloneOpts                     `yaml:"clone_from,omitempty" json:"clone_from"`
 	Empty        bool                              `yaml:"empty,omitempty" json:"empty"` // Create an instance with no image (boot media is supplied via devices)
 	Server       string                            `yaml:"server,omitempty" json:"server"`
 	Protocol     string                            `yaml:"protocol,omitempty" json:"protocol"`
@@ -73,8 +79,10 @@ type LxdNodeOpts struct {
 	Config       map[string]interface{}            `yaml:"config,omitempty" json:"config"`   // Instance configuration keys (e.g. security.secureboot)
 	Devices      map[string]map[string]interface{} `yaml:"devices,omitempty" json:"devices"` // Arbitrary instance devices (ISO disks, extra disks, ...)
 	BootWait     *LxdBootWaitOpts                  `yaml:"boot_wait,omitempty" json:"boot_wait"`
+	CloudInit    *LxdCloudInitOpts                 `yaml:"cloud_init,omitempty" json:"cloud_init"`
 	ExecOptions  map[string]interface{}            `yaml:"exec_opts,omitempty" json:"exec_opts"`
 	Networks     []LxdNetworkOpts                  `yaml:"networks,omitempty" json:"networks"`
+	Volumes      []LxdVolumeMountOpts              `yaml:"volumes,omitempty" json:"volumes"`
 	// Socket path for local connections (supports both LXD and Incus)
 	Socket string `yaml:"socket,omitempty" json:"socket"`
 	// Remote connection options (for connecting to remote LXD servers)
@@ -86,10 +94,25 @@ type LxdNodeOpts struct {
 	SkipVerify bool   `yaml:"skip_verify,omitempty" json:"skip_verify"` // Skip TLS verification (not recommended for production)
 	// Project support
 	Project string `yaml:"project,omitempty" json:"project"` // LXD project to use (defaults to lxd.DefaultProject)
+	// Target is the cluster member the instance is created on, or a
+	// cluster group as "@group". Empty leaves placement to the cluster.
+	Target string `yaml:"target,omitempty" json:"target"`
 	// InstanceName decouples the LXD/Incus instance name from the node
 	// name. Defaults to the node name, which is what makes a suite's
 	// instances findable by the name the YAML uses.
 	InstanceName string `yaml:"instance_name,omitempty" json:"instance_name"`
+	// Managed false adopts an existing, running instance instead of
+	// creating one, and leaves it in place at teardown. Defaults to true.
+	Managed *bool `yaml:"managed,omitempty" json:"managed"`
+	// PublishAs keeps the instance, once its setup steps have run, as a
+	// local image under this alias; later runs start from it and skip
+	// the steps it already reflects.
+	PublishAs string `yaml:"publish_as,omitempty" json:"publish_as"`
+}
+
+// managed reports whether DART owns the instance's lifecycle.
+func (o LxdNodeOpts) managed() bool {
+	return o.Managed == nil || *o.Managed
 }
 
 // connectionOptions lists the node-level options that select which server the
@@ -118,9 +141,10 @@ func (o LxdNodeOpts) connectionOptions() []string {
 }
 
 // emptyInstance reports whether the instance should be created without an image.
-// An instance is empty when it is explicitly marked as such or when no image was given.
+// An instance is empty when it is explicitly marked as such or when neither an
+// image nor an instance to clone was given.
 func (o LxdNodeOpts) emptyInstance() bool {
-	return o.Empty || o.Image == ""
+	return o.Empty || (o.Image == "" && o.CloneFrom == nil)
 }
 
 // validate checks the option combinations that cannot be caught by the LXD server
@@ -129,6 +153,36 @@ func (o LxdNodeOpts) validate() error {
 	if o.Empty && o.Image != "" {
 		return helpers.WrapError("empty instances cannot specify an image; remove either 'empty' or 'image'")
 	}
+	if o.CloneFrom != nil {
+		if o.Image != "" || o.Empty {
+			return helpers.WrapError("clone_from creates the instance from a copy; remove 'image' and 'empty'")
+		}
+		if err := o.CloneFrom.validate(); err != nil {
+			return err
+		}
+	}
+	if err := o.validateVolumeMounts(); err != nil {
+		return err
+	}
+	if err := o.validatePublishAs(); err != nil {
+		return err
+	}
+	if !o.managed() && o.Target != "" {
+		return helpers.WrapError("target places the instance DART creates; an unmanaged instance is already placed, so remove 'target'")
+	}
+	if !o.managed() && o.BootWait != nil && len(o.BootWait.EjectOnPoweroff) > 0 {
+		return helpers.WrapError("boot_wait.eject_on_poweroff detaches devices, which an unmanaged instance does not allow")
+	}
+	if o.CloudInit != nil {
+		if o.emptyInstance() {
+			return helpers.WrapError("cloud_init needs an image that runs cloud-init; an empty instance has none")
+		}
+		for _, source := range o.CloudInit.sources() {
+			if _, set := o.Config[source.key]; set {
+				return helpers.WrapError(fmt.Sprintf("config sets %s, which cloud_init.%s also sets; keep only cloud_init", source.key, source.option))
+			}
+		}
+	}
 	return nil
 }
 
@@ -416,6 +470,12 @@ func NewLxdNodeWithWrapper(wrapper *lxd.Wrapper, name string, opts ifaces.NodeOp
 	if err = ErrConnectionOptionsWithPlatformBlock(name, nodeopts); err != nil {
 		return nil, err
 	}
+	// Only the suite's own project is renamed for the run
+	if wrapper.ProjectRef(nodeopts.Project) != nodeopts.Project {
+		if err = nodeopts.validatePublishAsProject(nodeopts.Project); err != nil {
+			return nil, err
+		}
+	}
 
 	// Set defaults
 	if nodeopts.Server == "" {
@@ -451,7 +511,7 @@ func NewLxdNodeWithWrapper(wrapper *lxd.Wrapper, name string, opts ifaces.NodeOp
 	// Get the server from wrapper and use the project if specified
 	client := wrapper.GetServer()
 	if nodeopts.Project != lxd.DefaultProject {
-		client = client.UseProject(nodeopts.Project)
+		client = client.UseProject(wrapper.ProjectRef(nodeopts.Project))
 	}
 
 	return &LxdNode{
@@ -464,14 +524,48 @@ func NewLxdNodeWithWrapper(wrapper *lxd.Wrapper, name string, opts ifaces.NodeOp
 }
 
 // instanceName is the LXD/Incus instance's name. It defaults to the node
-// name, so a suite's instances are findable by the name the YAML uses;
-// instance_name overrides it for suites that must match an externally
-// fixed name.
+// name scoped by the run ID, so concurrent runs of one suite do not
+// collide. instance_name overrides it for suites that must match an
+// externally fixed name, and an adopted instance is found by the node
+// name as is.
 func (d *LxdNode) instanceName() string {
 	if d.options.InstanceName != "" {
 		return d.options.InstanceName
 	}
-	return d.name
+	if !d.options.managed() {
+		return d.name
+	}
+	return runlabel.Current().Scoped(d.name)
+}
+
+// networkRef is the server-side name of a network the node joins: the
+// suite's own networks are run-scoped by the wrapper that creates them.
+func (d *LxdNode) networkRef(name string) string {
+	if d.wrapper == nil {
+		return name
+	}
+	return d.wrapper.NetworkRef(name)
+}
+
+// aclRefs renders the node's ACL names as a security.acls value, under
+// their server-side names.
+func (d *LxdNode) aclRefs(names []string) string {
+	if d.wrapper == nil {
+		return strings.Join(names, ",")
+	}
+	return d.wrapper.AclRefs(names)
+}
+
+// profileRefs lists the node's profiles by their server-side names.
+func (d *LxdNode) profileRefs() []string {
+	if d.wrapper == nil || d.options.Profiles == nil {
+		return d.options.Profiles
+	}
+	profiles := make([]string, len(d.options.Profiles))
+	for i, profile := range d.options.Profiles {
+		profiles[i] = d.wrapper.ProfileRef(profile)
+	}
+	return profiles
 }
 
 type LxdNode struct {
@@ -481,12 +575,25 @@ type LxdNode struct {
 	wrapper   *lxd.Wrapper
 	options   LxdNodeOpts
 	addresses []string
+	// snapshots the suite created and has not deleted, removed at
+	// teardown of an instance DART does not delete
+	snapshots []string
+	// render resolves var and fact references in cloud-init sources
+	render func(text string) (string, error)
+	// setupHashes holds a hash per setup step on the node, matched
+	// against the image kept under publish_as; cachedSteps counts the
+	// leading steps the instance was created with already applied
+	setupHashes []string
+	cachedSteps int
 }
 
 func (d *LxdNode) Setup() error {
 	if d.client == nil {
 		return helpers.WrapError("lxd client not initialized")
 	}
+	if !d.options.managed() {
+		return d.adopt()
+	}
 
 	// Determine the instance type
 	instanceType := api.InstanceType(d.options.InstanceType)
@@ -499,7 +606,7 @@ func (d *LxdNode) Setup() error {
 		deviceName := fmt.Sprintf("eth%d", i)
 		deviceConfig := map[string]string{
 			"type":    "nic",
-			"network": netOpts.Name,
+			"network": d.networkRef(netOpts.Name),
 		}
 		// Add static IP address if specified, detecting IPv4 vs IPv6
 		if netOpts.Ip != "" {
@@ -513,9 +620,18 @@ func (d *LxdNode) Setup() error {
 				deviceConfig["ipv6.address"] = netOpts.Ip
 			}
 		}
+		if len(netOpts.Acls) > 0 {
+			deviceConfig["security.acls"] = d.aclRefs(netOpts.Acls)
+		}
 		devices[deviceName] = deviceConfig
 	}
 
+	volumeDevices, err := d.volumeDevices()
+	if err != nil {
+		return err
+	}
+	maps.Copy(devices, volumeDevices)
+
 	// Merge in any explicitly configured devices, such as an ISO attached as boot media.
 	// These are applied last so a node can override a generated NIC if it needs to.
 	configuredDevices, err := buildDevices(d.options.Devices, d.options.RemoteAddr == "", d.suiteDir)
@@ -526,12 +642,33 @@ func (d *LxdNode) Setup() error {
 		devices[deviceName] = deviceConfig
 	}
 
-	// Build the instance configuration keys
-	instanceConfig := make(map[string]string, len(d.options.Config))
+	// Build the instance configuration keys. The run's keys let `dart gc`
+	// find the instance if this run never reaches teardown
+	instanceConfig := runlabel.Current().LxdConfig()
 	for key, value := range d.options.Config {
 		instanceConfig[key] = optionValueToString(value)
 	}
 
+	// An instance from the image kept under publish_as has been through
+	// cloud-init and the setup steps the image covers already
+	if d.cachedSteps, err = d.cachedSetup(); err != nil {
+		return err
+	}
+	if d.cachedSteps == 0 {
+		cloudInit, err := d.cloudInitConfig()
+		if err != nil {
+			return err
+		}
+		maps.Copy(instanceConfig, cloudInit)
+	}
+
+	if d.options.CloneFrom != nil && d.cachedSteps == 0 {
+		if err := d.createClone(instanceConfig, devices); err != nil {
+			return err
+		}
+		return d.start()
+	}
+
 	// Empty instances are created without a source so they boot from their devices
 	source := api.InstanceSource{
 		Type:     api.SourceTypeImage,
@@ -542,6 +679,9 @@ func (d *LxdNode) Setup() error {
 	if d.options.emptyInstance() {
 		source = api.InstanceSource{Type: api.SourceTypeNone}
 	}
+	if d.cachedSteps > 0 {
+		source = api.InstanceSource{Type: api.SourceTypeImage, Alias: d.options.PublishAs}
+	}
 
 	// Create a request for the instance
 	req := api.InstancesPost{
@@ -549,13 +689,17 @@ func (d *LxdNode) Setup() error {
 		Source: source,
 		Type:   instanceType,
 		InstancePut: api.InstancePut{
-			Profiles: d.options.Profiles,
+			Profiles: d.profileRefs(),
 			Config:   instanceConfig,
 			Devices:  devices,
 		},
 	}
 
-	op, err := d.client.CreateInstance(req)
+	placement, err := d.placement()
+	if err != nil {
+		return err
+	}
+	op, err := placement.CreateInstance(req)
 	if err != nil {
 		return helpers.WrapError(fmt.Sprintf("error creating instance: %v", err))
 	}
@@ -566,13 +710,29 @@ func (d *LxdNode) Setup() error {
 		return helpers.WrapError(fmt.Sprintf("error creating instance: %v", err))
 	}
 
-	// Start the instance
+	return d.start()
+}
+
+// placement returns the client instances are created through: pinned to
+// the node's target member when it has one.
+func (d *LxdNode) placement() (lxdclient.InstanceServer, error) {
+	if d.options.Target == "" {
+		return d.client, nil
+	}
+	if !d.client.IsClustered() {
+		return nil, helpers.WrapError(fmt.Sprintf("target %s is set, but the LXD server is not a cluster; remove 'target'", d.options.Target))
+	}
+	return d.client.UseTarget(d.options.Target), nil
+}
+
+// start boots the instance DART created and waits until it is ready.
+func (d *LxdNode) start() error {
 	reqState := api.InstanceStatePut{
 		Action:  "start",
 		Timeout: -1,
 	}
 
-	op, err = d.client.UpdateInstanceState(d.instanceName(), reqState, "")
+	op, err := d.client.UpdateInstanceState(d.instanceName(), reqState, "")
 	if err != nil {
 		return helpers.WrapError(fmt.Sprintf("error starting instance: %v", err))
 	}
@@ -584,13 +744,43 @@ func (d *LxdNode) Setup() error {
 	return d.waitForReady()
 }
 
+// adopt attaches to an instance someone else provides. Nothing is created
+// or started; the instance must already be running, and must then pass the
+// same readiness check as one DART created.
+func (d *LxdNode) adopt() error {
+	state, _, err := d.client.GetInstanceState(d.instanceName())
+	if err != nil {
+		if lxd.IsNotFound(err) {
+			return helpers.WrapError(fmt.Sprintf("instance %s does not exist: an unmanaged node adopts an instance that is already running", d.instanceName()))
+		}
+		return helpers.WrapError(fmt.Sprintf("error getting instance state: %v", err))
+	}
+	if state.Status != "Running" {
+		return helpers.WrapError(fmt.Sprintf("instance %s is %s: an unmanaged node is not started by DART, so start it first", d.instanceName(), strings.ToLower(state.Status)))
+	}
+
+	ctx := context.Background()
+	if d.options.BootWait != nil {
+		command := d.options.BootWait.readyCommand(d.shell())
+		if err := lxd.WaitForInstanceCommand(ctx, d.client, d.instanceName(), command, d.options.BootWait.readinessConfig()); err != nil {
+			return helpers.WrapError(fmt.Sprintf("error waiting for instance to be ready: %v", err))
+		}
+		return nil
+	}
+	if err := lxd.WaitForInstanceReady(ctx, d.client, d.instanceName(), nil); err != nil {
+		return helpers.WrapError(fmt.Sprintf("error waiting for instance to be ready: %v", err))
+	}
+	return nil
+}
+
 var _ ifaces.NetworkInspector = &LxdNode{}
 
 // NetworkFacts reports the instance's addresses from LXD's own state, so
 // suites can reference {{ fact "node" "ipv4" }} without a fact command.
 // Loopback is skipped; the first global address per family becomes the
 // bare "ipv4"/"ipv6" fact, and every address is also exposed per
-// interface ("ipv4.eth0").
+// interface ("ipv4.eth0"). On an OVN network the node joins, the address
+// its router takes on the uplink is exposed too ("router.ipv4.tenant").
 func (d *LxdNode) NetworkFacts() (map[string]string, error) {
 	if d.client == nil {
 		return nil, helpers.WrapError("lxd client not initialized")
@@ -628,6 +818,20 @@ func (d *LxdNode) NetworkFacts() (map[string]string, error) {
 			}
 		}
 	}
+
+	// With NAT on, traffic leaving an OVN network takes its router's
+	// address, so that is the source a test on the uplink side sees
+	for _, netOpts := range d.options.Networks {
+		network, _, err := d.client.GetNetwork(d.networkRef(netOpts.Name))
+		if err != nil || network.Type != "ovn" {
+			continue
+		}
+		for _, family := range []string{"ipv4", "ipv6"} {
+			if address := network.Config["volatile.network."+family+".address"]; address != "" {
+				facts[fmt.Sprintf("router.%s.%s", family, netOpts.Name)] = address
+			}
+		}
+	}
 	return facts, nil
 }
 
@@ -640,7 +844,11 @@ func (d *LxdNode) Snapshot(name string, stateful bool) error {
 	if d.client == nil {
 		return helpers.WrapError("lxd client not initialized")
 	}
-	return lxd.CreateInstanceSnapshot(context.Background(), d.client, d.instanceName(), name, stateful)
+	if err := lxd.CreateInstanceSnapshot(context.Background(), d.client, d.instanceName(), name, stateful); err != nil {
+		return err
+	}
+	d.snapshots = append(d.snapshots, name)
+	return nil
 }
 
 // RestoreSnapshot rolls the instance back to a snapshot. LXD stops and
@@ -682,6 +890,7 @@ func (d *LxdNode) DeleteSnapshot(name string) error {
 	if err := lxd.DeleteInstanceSnapshot(context.Background(), d.client, d.instanceName(), name); err != nil && !lxd.IsNotFound(err) {
 		return err
 	}
+	d.snapshots = slices.DeleteFunc(d.snapshots, func(taken string) bool { return taken == name })
 	return nil
 }
 
@@ -704,6 +913,71 @@ func (d *LxdNode) Reboot(force bool, readyCommand string, timeout time.Duration)
 		return helpers.WrapError(fmt.Sprintf("error restarting instance %s: %v", d.instanceName(), err))
 	}
 
+	if err := d.waitForCommand(readyCommand, timeout); err != nil {
+		return helpers.WrapError(fmt.Sprintf("instance %s did not become ready after reboot: %v", d.instanceName(), err))
+	}
+	return nil
+}
+
+var _ ifaces.Migrator = &LxdNode{}
+
+// Migrate moves the instance to another cluster member. In auto mode a
+// running VM with migration.stateful set moves live and anything else
+// cold; a stopped instance is moved and left stopped. The readiness wait
+// after the move is the one Reboot uses.
+func (d *LxdNode) Migrate(member string, mode string, readyCommand string, timeout time.Duration) error {
+	ctx := context.Background()
+	name := d.instanceName()
+	if !d.client.IsClustered() {
+		return helpers.WrapError(fmt.Sprintf("instance %s cannot migrate: the LXD server is not a cluster", name))
+	}
+	instance, _, err := d.client.GetInstance(name)
+	if err != nil {
+		return helpers.WrapError(fmt.Sprintf("error getting instance %s: %v", name, err))
+	}
+	if instance.Location == member {
+		return nil
+	}
+
+	running := instance.Status == "Running"
+	live := false
+	switch mode {
+	case "live":
+		if !running {
+			return helpers.WrapError(fmt.Sprintf("instance %s is %s: live migration moves a running instance", name, strings.ToLower(instance.Status)))
+		}
+		live = true
+	case "auto", "":
+		live = running && instance.Type == string(api.InstanceTypeVM) && instance.ExpandedConfig["migration.stateful"] == "true"
+	}
+
+	if running && !live {
+		if err := lxd.StopInstance(ctx, d.client, name, false); err != nil {
+			return helpers.WrapError(fmt.Sprintf("error stopping instance %s for migration: %v", name, err))
+		}
+	}
+	if err := lxd.MigrateInstance(ctx, d.client, name, member, live); err != nil {
+		return helpers.WrapError(err.Error())
+	}
+	if !running {
+		return nil
+	}
+	if !live {
+		if err := lxd.StartInstance(ctx, d.client, name); err != nil {
+			return helpers.WrapError(fmt.Sprintf("error starting instance %s on %s: %v", name, member, err))
+		}
+	}
+
+	if err := d.waitForCommand(readyCommand, timeout); err != nil {
+		return helpers.WrapError(fmt.Sprintf("instance %s did not become ready after migrating to %s: %v", name, member, err))
+	}
+	return nil
+}
+
+// waitForCommand polls the node's readiness command until it succeeds,
+// using the boot_wait configuration unless readyCommand or timeout
+// override it.
+func (d *LxdNode) waitForCommand(readyCommand string, timeout time.Duration) error {
 	cfg := d.options.BootWait.readinessConfig()
 	if timeout > 0 {
 		cfg.Timeout = timeout
@@ -712,16 +986,14 @@ func (d *LxdNode) Reboot(force bool, readyCommand string, timeout time.Duration)
 	if readyCommand != "" {
 		command = []string{d.shell(), "-c", readyCommand}
 	}
-	if err := lxd.WaitForInstanceCommand(context.Background(), d.client, d.instanceName(), command, cfg); err != nil {
-		return helpers.WrapError(fmt.Sprintf("instance %s did not become ready after reboot: %v", d.instanceName(), err))
-	}
-	return nil
+	return lxd.WaitForInstanceCommand(context.Background(), d.client, d.instanceName(), command, cfg)
 }
 
 // waitForReady blocks until the instance can run commands. When boot_wait is configured
 // the default readiness check is replaced by a poll of the configured command, which is
 // what an instance installing from an ISO needs: it is unreachable while the installer
-// runs and only answers once it has rebooted from disk.
+// runs and only answers once it has rebooted from disk. A node with cloud_init then
+// waits for cloud-init to finish.
 func (d *LxdNode) waitForReady() error {
 	ctx := context.Background()
 
@@ -740,7 +1012,7 @@ func (d *LxdNode) waitForReady() error {
 		if err := lxd.WaitForInstanceCommand(ctx, d.client, d.instanceName(), command, d.options.BootWait.readinessConfig()); err != nil {
 			return helpers.WrapError(fmt.Sprintf("error waiting for instance to be ready: %v", err))
 		}
-		return nil
+		return d.waitForCloudInit()
 	}
 
 	// An empty instance has no guest agent until something is installed into it, so
@@ -754,7 +1026,7 @@ func (d *LxdNode) waitForReady() error {
 		return helpers.WrapError(fmt.Sprintf("error waiting for instance to be ready: %v", err))
 	}
 
-	return nil
+	return d.waitForCloudInit()
 }
 
 // ejectAfterPoweroff waits for the instance to power itself off (the end of an
@@ -829,6 +1101,9 @@ func (d *LxdNode) Teardown() error {
 	if d.client == nil {
 		return helpers.WrapError("lxd client not initialized")
 	}
+	if !d.options.managed() {
+		return d.releaseSnapshots()
+	}
 
 	// An instance may already be stopped, for example a VM that powered itself off at
 	// the end of an unattended install, and stopping it again is an error
@@ -872,6 +1147,22 @@ func (d *LxdNode) Teardown() error {
 	return nil
 }
 
+// releaseSnapshots deletes the snapshots the suite took of an adopted
+// instance. A managed instance takes its snapshots with it when deleted;
+// an adopted one would otherwise collect one per run.
+func (d *LxdNode) releaseSnapshots() error {
+	var failed []string
+	for _, name := range append([]string(nil), d.snapshots...) {
+		if err := d.DeleteSnapshot(name); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", name, err))
+		}
+	}
+	if len(failed) > 0 {
+		return helpers.WrapError(fmt.Sprintf("error deleting snapshots of instance %s: %s", d.instanceName(), strings.Join(failed, "; ")))
+	}
+	return nil
+}
+
 func (d *LxdNode) Execute(command string, options ...execution.ExecutionOption) (result *execution.ExecutionResult, err error) {
 
 	if d.client == nil {
@@ -919,6 +1210,15 @@ func (d *LxdNode) Execute(command string, options ...execution.ExecutionOption)
 	}, nil
 }
 
+// LxdInstance returns the LXD client and the instance name, so file
+// transfers can use the instance file API rather than the shell.
+func (d *LxdNode) LxdInstance() (lxdclient.InstanceServer, string, error) {
+	if d.client == nil {
+		return nil, "", helpers.WrapError("lxd client not initialized")
+	}
+	return d.client, d.instanceName(), nil
+}
+
 func (d *LxdNode) Close() error {
 	// No cleanup needed for the LXD client
 	return nil
@@ -0,0 +1,275 @@
+package nodetypes
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/bgrewell/dart/internal/config"
+	"github.com/bgrewell/dart/internal/helpers"
+	"github.com/bgrewell/dart/internal/lxd"
+	"github.com/bgrewell/dart/internal/runlabel"
+	"github.com/canonical/lxd/shared/api"
+)
+
+// LxdCloneOpts creates an instance as a copy of an existing one, a
+// "golden" instance, instead of from an image. On a ZFS or btrfs pool the
+// copy shares the golden's blocks, so a clone is ready in the time it takes
+// to boot rather than to unpack and provision an image.
+type LxdCloneOpts struct {
+	Instance string `yaml:"instance" json:"instance"`           // Name of the golden instance
+	Snapshot string `yaml:"snapshot,omitempty" json:"snapshot"` // Snapshot of the golden to copy; the golden's current state when empty
+	Project  string `yaml:"project,omitempty" json:"project"`   // Project holding the golden; the node's own when empty
+}
+
+// validate checks clone_from on its own; how it combines with the node's
+// other options is checked by LxdNodeOpts.validate.
+func (c *LxdCloneOpts) validate() error {
+	if c.Instance == "" {
+		return helpers.WrapError("clone_from.instance is required")
+	}
+	if strings.Contains(c.Instance, "/") {
+		return helpers.WrapError(fmt.Sprintf("clone_from.instance %q names a snapshot; give the snapshot as clone_from.snapshot", c.Instance))
+	}
+	if strings.Contains(c.Snapshot, "/") {
+		return helpers.WrapError(fmt.Sprintf("clone_from.snapshot %q must be a snapshot name, not a path", c.Snapshot))
+	}
+	return nil
+}
+
+// validateKeys rejects clone_from keys that name no option; options are
+// otherwise only checked by name at the top level.
+func (c *LxdCloneOpts) validateKeys(raw interface{}) error {
+	fields, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	known := optionKeysOf(LxdCloneOpts{})
+	var unknown []string
+	for key := range fields {
+		if !known[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("unknown clone_from option %q (accepted: instance, project, snapshot)", unknown[0])
+	}
+	return nil
+}
+
+// String names the copy's source the way lxc does, instance/snapshot,
+// followed by the project when it is not the node's own.
+func (c *LxdCloneOpts) String() string {
+	source := c.source().Source
+	if c.Project != "" {
+		source += " (project " + c.Project + ")"
+	}
+	return source
+}
+
+// source is the copy request's source. The golden's own snapshots stay
+// behind; a clone starts with none.
+func (c *LxdCloneOpts) source() api.InstanceSource {
+	source := c.Instance
+	if c.Snapshot != "" {
+		source += "/" + c.Snapshot
+	}
+	return api.InstanceSource{
+		Type:         api.SourceTypeCopy,
+		Source:       source,
+		Project:      c.Project,
+		InstanceOnly: true,
+	}
+}
+
+// createClone creates the instance as a copy of clone_from. The copy
+// carries the golden's config, devices and profiles; the node's own are
+// laid over them afterwards, so a clone differs from its golden only where
+// the suite says so.
+func (d *LxdNode) createClone(instanceConfig map[string]string, devices map[string]map[string]string) error {
+	name := d.instanceName()
+	clone := d.options.CloneFrom
+
+	placement, err := d.placement()
+	if err != nil {
+		return err
+	}
+	op, err := placement.CreateInstance(api.InstancesPost{Name: name, Source: clone.source()})
+	if err != nil {
+		return helpers.WrapError(fmt.Sprintf("error cloning instance from %s: %v", clone, err))
+	}
+	if err = op.Wait(); err != nil {
+		return helpers.WrapError(fmt.Sprintf("error cloning instance from %s: %v", clone, err))
+	}
+
+	instance, etag, err := d.client.GetInstance(name)
+	if err != nil {
+		return helpers.WrapError(fmt.Sprintf("error getting cloned instance: %v", err))
+	}
+	// A copy keeps its golden's type, which the node type must agree with:
+	// a VM is reached and made ready differently from a container
+	if instance.Type != d.options.InstanceType {
+		return helpers.WrapError(fmt.Sprintf("clone_from %s is a %s, but the node creates a %s; use an lxd node for a container golden and lxd-vm for a VM",
+			clone, instance.Type, d.options.InstanceType))
+	}
+	put := instance.Writable()
+	if put.Config == nil {
+		put.Config = make(map[string]string)
+	}
+	maps.Copy(put.Config, instanceConfig)
+	if put.Devices == nil {
+		put.Devices = make(map[string]map[string]string)
+	}
+	maps.Copy(put.Devices, devices)
+	if d.options.Profiles != nil {
+		put.Profiles = d.profileRefs()
+	}
+
+	op, err = d.client.UpdateInstance(name, put, etag)
+	if err != nil {
+		return helpers.WrapError(fmt.Sprintf("error configuring cloned instance: %v", err))
+	}
+	if err = op.Wait(); err != nil {
+		return helpers.WrapError(fmt.Sprintf("error configuring cloned instance: %v", err))
+	}
+	return nil
+}
+
+// PublishGolden turns the node's instance into a golden that clone_from can
+// copy. The instance is stopped so its disk is consistent, copied to name
+// (replacing a previous golden of that name) and the copy snapshotted. The
+// copy loses what ties it to this run: the run labels, so `dart gc` leaves
+// it alone; the cloud-init sources, so clones do not replay the build's
+// user-data; and the NICs on the node's networks and the disks of its
+// volumes, which clones declare for themselves.
+func (d *LxdNode) PublishGolden(name, snapshot string) error {
+	if d.client == nil {
+		return helpers.WrapError("lxd client not initialized")
+	}
+	ctx := context.Background()
+
+	// A clean shutdown, so the golden's disk is not copied mid-write; a
+	// setup step may already have powered the instance off
+	state, _, err := d.client.GetInstanceState(d.instanceName())
+	if err != nil {
+		return helpers.WrapError(fmt.Sprintf("error getting instance state: %v", err))
+	}
+	if state.Status != "Stopped" {
+		if err := lxd.StopInstance(ctx, d.client, d.instanceName(), false); err != nil {
+			return helpers.WrapError(fmt.Sprintf("error stopping instance before publishing it: %v", err))
+		}
+	}
+
+	// Clones made from an earlier golden are copies of their own and
+	// survive its replacement
+	state, _, err = d.client.GetInstanceState(name)
+	switch {
+	case lxd.IsNotFound(err):
+	case err != nil:
+		return helpers.WrapError(fmt.Sprintf("error getting state of golden %s: %v", name, err))
+	default:
+		if state.Status != "Stopped" {
+			if err := lxd.StopInstance(ctx, d.client, name, true); err != nil {
+				return helpers.WrapError(fmt.Sprintf("error replacing golden %s: %v", name, err))
+			}
+		}
+		if err := lxd.DeleteInstance(ctx, d.client, name); err != nil {
+			return helpers.WrapError(fmt.Sprintf("error replacing golden %s: %v", name, err))
+		}
+	}
+
+	op, err := d.client.CreateInstance(api.InstancesPost{
+		Name: name,
+		Source: api.InstanceSource{
+			Type:         api.SourceTypeCopy,
+			Source:       d.instanceName(),
+			InstanceOnly: true,
+		},
+	})
+	if err != nil {
+		return helpers.WrapError(fmt.Sprintf("error copying instance to golden %s: %v", name, err))
+	}
+	if err = op.Wait(); err != nil {
+		return helpers.WrapError(fmt.Sprintf("error copying instance to golden %s: %v", name, err))
+	}
+
+	instance, etag, err := d.client.GetInstance(name)
+	if err != nil {
+		return helpers.WrapError(fmt.Sprintf("error getting golden %s: %v", name, err))
+	}
+	put := instance.Writable()
+	maps.DeleteFunc(put.Config, func(key, _ string) bool {
+		return strings.HasPrefix(key, runlabel.LxdPrefix+"dart.") ||
+			slices.Contains([]string{lxd.CloudInitUserData, lxd.CloudInitNetworkConfig, lxd.CloudInitVendorData}, key)
+	})
+	for i := range d.options.Networks {
+		device := fmt.Sprintf("eth%d", i)
+		if _, configured := d.options.Devices[device]; !configured {
+			delete(put.Devices, device)
+		}
+	}
+	for _, mount := range d.options.Volumes {
+		delete(put.Devices, mount.Name)
+	}
+	op, err = d.client.UpdateInstance(name, put, etag)
+	if err != nil {
+		return helpers.WrapError(fmt.Sprintf("error configuring golden %s: %v", name, err))
+	}
+	if err = op.Wait(); err != nil {
+		return helpers.WrapError(fmt.Sprintf("error configuring golden %s: %v", name, err))
+	}
+
+	return lxd.CreateInstanceSnapshot(ctx, d.client, name, snapshot, false)
+}
+
+// GoldenBuildNode picks the node `dart golden build` publishes: the named
+// node, or the suite's only LXD node when name is empty. The golden must
+// outlive the run that builds it, so the node may not live in the suite's
+// own project or use the suite's own profiles, which teardown removes.
+func GoldenBuildNode(cfg *config.Configuration, name string) (*config.NodeConfig, error) {
+	var candidates []*config.NodeConfig
+	for _, node := range cfg.Nodes {
+		if node.Type != "lxd" && node.Type != "lxd-vm" {
+			continue
+		}
+		if name == "" || node.Name == name {
+			candidates = append(candidates, node)
+		}
+	}
+	switch {
+	case len(candidates) == 0 && name != "":
+		return nil, fmt.Errorf("the suite has no lxd node named %q", name)
+	case len(candidates) == 0:
+		return nil, fmt.Errorf("the suite has no lxd node to build a golden from")
+	case len(candidates) > 1:
+		names := make([]string, len(candidates))
+		for i, node := range candidates {
+			names[i] = node.Name
+		}
+		return nil, fmt.Errorf("the suite has several lxd nodes (%s); pick one with --node", strings.Join(names, ", "))
+	}
+	node := candidates[0]
+
+	var opts LxdNodeOpts
+	if err := decodeNodeOptions(node.Options, &opts); err != nil {
+		return nil, err
+	}
+	if !opts.managed() {
+		return nil, fmt.Errorf("node %s is unmanaged; a golden is built from an instance DART creates", node.Name)
+	}
+	if cfg.Lxd != nil {
+		if cfg.Lxd.Project != nil && cfg.Lxd.Project.Name != lxd.DefaultProject && opts.Project == cfg.Lxd.Project.Name {
+			return nil, fmt.Errorf("node %s is in the suite's project %s, which teardown deletes; build the golden in a project that outlives the run", node.Name, opts.Project)
+		}
+		for _, profile := range cfg.Lxd.Profiles {
+			if profile.Name != "default" && slices.Contains(opts.Profiles, profile.Name) {
+				return nil, fmt.Errorf("node %s uses the suite's profile %s, which teardown deletes; a golden may only use profiles that outlive the run", node.Name, profile.Name)
+			}
+		}
+	}
+	return node, nil
+}
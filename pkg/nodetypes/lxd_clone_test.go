@@ -0,0 +1,198 @@
+package nodetypes
+
+import (
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/bgrewell/dart/internal/config"
+	"github.com/bgrewell/dart/internal/lxd"
+	"github.com/bgrewell/dart/internal/runlabel"
+	lxdclient "github.com/canonical/lxd/client"
+	"github.com/canonical/lxd/shared/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// cloneServer keeps instances in memory and records the copy requests, so
+// a test can check what a clone and a golden end up with.
+type cloneServer struct {
+	lxdclient.InstanceServer
+	instances map[string]*api.Instance
+	copies    []api.InstancesPost
+	snapshots []string
+}
+
+func (s *cloneServer) CreateInstance(req api.InstancesPost) (lxdclient.Operation, error) {
+	s.copies = append(s.copies, req)
+	from, _, _ := strings.Cut(req.Source.Source, "/")
+	source := s.instances[from]
+	instance := &api.Instance{Name: req.Name, Type: source.Type, Status: "Stopped"}
+	instance.Profiles = append([]string(nil), source.Profiles...)
+	instance.Config = maps.Clone(source.Config)
+	instance.Devices = maps.Clone(source.Devices)
+	s.instances[req.Name] = instance
+	return doneOperation{}, nil
+}
+
+func (s *cloneServer) GetInstance(name string) (*api.Instance, string, error) {
+	instance, ok := s.instances[name]
+	if !ok {
+		return nil, "", api.StatusErrorf(http.StatusNotFound, "Instance not found")
+	}
+	return instance, "etag", nil
+}
+
+func (s *cloneServer) GetInstanceState(name string) (*api.InstanceState, string, error) {
+	instance, ok := s.instances[name]
+	if !ok {
+		return nil, "", api.StatusErrorf(http.StatusNotFound, "Instance not found")
+	}
+	return &api.InstanceState{Status: instance.Status}, "", nil
+}
+
+func (s *cloneServer) UpdateInstance(name string, put api.InstancePut, etag string) (lxdclient.Operation, error) {
+	s.instances[name].InstancePut = put
+	return doneOperation{}, nil
+}
+
+func (s *cloneServer) UpdateInstanceState(name string, state api.InstanceStatePut, etag string) (lxdclient.Operation, error) {
+	s.instances[name].Status = map[string]string{"start": "Running", "stop": "Stopped"}[state.Action]
+	return doneOperation{}, nil
+}
+
+func (s *cloneServer) DeleteInstance(name string, force bool) (lxdclient.Operation, error) {
+	delete(s.instances, name)
+	return doneOperation{}, nil
+}
+
+func (s *cloneServer) CreateInstanceSnapshot(name string, req api.InstanceSnapshotsPost) (lxdclient.Operation, error) {
+	s.snapshots = append(s.snapshots, name+"/"+req.Name)
+	return doneOperation{}, nil
+}
+
+func TestCloneFromValidation(t *testing.T) {
+	validate := func(options map[string]interface{}) error {
+		return ValidateNodeOptions(&config.NodeConfig{Name: "web", Type: "lxd", Options: options})
+	}
+	golden := map[string]interface{}{"instance": "golden", "snapshot": "base"}
+
+	assert.NoError(t, validate(map[string]interface{}{"clone_from": golden}))
+	assert.ErrorContains(t, validate(map[string]interface{}{"clone_from": golden, "image": "ubuntu:24.04"}),
+		"remove 'image' and 'empty'")
+	assert.ErrorContains(t, validate(map[string]interface{}{"clone_from": map[string]interface{}{"snapshot": "base"}}),
+		"clone_from.instance is required")
+	assert.ErrorContains(t, validate(map[string]interface{}{"clone_from": map[string]interface{}{"instance": "golden/base"}}),
+		"give the snapshot as clone_from.snapshot")
+	assert.ErrorContains(t, validate(map[string]interface{}{"clone_from": map[string]interface{}{"instance": "golden", "snap": "base"}}),
+		`unknown clone_from option "snap"`)
+
+	// A clone has a source, so it is not an empty instance and gets the
+	// usual readiness wait
+	assert.False(t, LxdNodeOpts{CloneFrom: &LxdCloneOpts{Instance: "golden"}}.emptyInstance())
+}
+
+// A clone starts as an exact copy of its golden; the node's networks,
+// config and run labels are laid over it.
+func TestLxdCloneOverlaysNodeConfig(t *testing.T) {
+	_, err := runlabel.Start("suite", "t1")
+	require.NoError(t, err)
+	server := &cloneServer{instances: map[string]*api.Instance{
+		"golden": {Type: "container", InstancePut: api.InstancePut{
+			Profiles: []string{"default"},
+			Config:   map[string]string{"limits.cpu": "2", "limits.memory": "1GiB"},
+			Devices:  map[string]map[string]string{"data": {"type": "disk", "path": "/data", "source": "/srv"}},
+		}},
+	}}
+	node := &LxdNode{name: "web", client: server, options: LxdNodeOpts{
+		InstanceType: "container",
+		CloneFrom:    &LxdCloneOpts{Instance: "golden", Snapshot: "base"},
+		Config:       map[string]interface{}{"limits.memory": "2GiB"},
+		Networks:     []LxdNetworkOpts{{Name: "lxdbr0", Ip: "10.0.3.10"}},
+	}}
+
+	require.NoError(t, node.createClone(map[string]string{"limits.memory": "2GiB", "user.dart.run-id": "t1"},
+		map[string]map[string]string{"eth0": {"type": "nic", "network": "lxdbr0", "ipv4.address": "10.0.3.10"}}))
+
+	assert.Equal(t, api.InstanceSource{Type: api.SourceTypeCopy, Source: "golden/base", InstanceOnly: true}, server.copies[0].Source)
+	clone := server.instances["web-t1"]
+	require.NotNil(t, clone)
+	assert.Equal(t, map[string]string{"limits.cpu": "2", "limits.memory": "2GiB", "user.dart.run-id": "t1"}, clone.Config)
+	assert.Contains(t, clone.Devices, "data", "the golden's own devices are kept")
+	assert.Equal(t, "10.0.3.10", clone.Devices["eth0"]["ipv4.address"])
+	assert.Equal(t, []string{"default"}, clone.Profiles)
+
+	vm := &LxdNode{name: "vm", client: server, options: LxdNodeOpts{
+		InstanceType: "virtual-machine",
+		CloneFrom:    &LxdCloneOpts{Instance: "golden"},
+	}}
+	assert.ErrorContains(t, vm.createClone(nil, nil), "clone_from golden is a container, but the node creates a virtual-machine")
+}
+
+// A golden outlives the run that built it, so nothing in it may tie it to
+// that run.
+func TestPublishGoldenStripsRunState(t *testing.T) {
+	_, err := runlabel.Start("suite", "t1")
+	require.NoError(t, err)
+	server := &cloneServer{instances: map[string]*api.Instance{
+		"builder-t1": {Type: "container", Status: "Running", InstancePut: api.InstancePut{
+			Config: runlabel.Current().WithLxdConfig(map[string]string{
+				"limits.cpu":          "2",
+				lxd.CloudInitUserData: "#cloud-config\n",
+			}),
+			Devices: map[string]map[string]string{
+				"eth0":  {"type": "nic", "network": "build-t1"},
+				"data":  {"type": "disk", "path": "/data", "source": "/srv"},
+				"cache": {"type": "disk", "path": "/cache", "pool": "default", "source": "cache-t1"},
+			},
+		}},
+		"golden": {Type: "container", Status: "Stopped"},
+	}}
+	node := &LxdNode{name: "builder", client: server, options: LxdNodeOpts{
+		Networks: []LxdNetworkOpts{{Name: "build"}},
+		Volumes:  []LxdVolumeMountOpts{{Name: "cache", Path: "/cache"}},
+	}}
+
+	require.NoError(t, node.PublishGolden("golden", "base"))
+
+	assert.Equal(t, "Stopped", server.instances["builder-t1"].Status, "the build instance is shut down before it is copied")
+	assert.Equal(t, "builder-t1", server.copies[0].Source.Source)
+	golden := server.instances["golden"]
+	assert.Equal(t, map[string]string{"limits.cpu": "2"}, golden.Config)
+	assert.Equal(t, []string{"data"}, slices.Sorted(maps.Keys(golden.Devices)))
+	assert.Equal(t, []string{"golden/base"}, server.snapshots)
+}
+
+func TestGoldenBuildNode(t *testing.T) {
+	node := func(name, nodeType string, options map[string]interface{}) *config.NodeConfig {
+		return &config.NodeConfig{Name: name, Type: nodeType, Options: options}
+	}
+	cfg := &config.Configuration{Nodes: []*config.NodeConfig{
+		node("client", "docker", map[string]interface{}{"image": "alpine"}),
+		node("builder", "lxd", map[string]interface{}{"image": "ubuntu:24.04"}),
+	}}
+	picked, err := GoldenBuildNode(cfg, "")
+	require.NoError(t, err)
+	assert.Equal(t, "builder", picked.Name)
+
+	_, err = GoldenBuildNode(cfg, "client")
+	assert.ErrorContains(t, err, `no lxd node named "client"`)
+
+	cfg.Nodes = append(cfg.Nodes, node("builder-vm", "lxd-vm", map[string]interface{}{"image": "ubuntu:24.04"}))
+	_, err = GoldenBuildNode(cfg, "")
+	assert.ErrorContains(t, err, "several lxd nodes (builder, builder-vm); pick one with --node")
+
+	cfg.Lxd = &config.LxdConfig{
+		Project:  &config.LxdProjectConfig{Name: "perf"},
+		Profiles: []*config.LxdProfileConfig{{Name: "tuned"}},
+	}
+	cfg.Nodes = []*config.NodeConfig{node("builder", "lxd", map[string]interface{}{"image": "ubuntu:24.04", "project": "perf"})}
+	_, err = GoldenBuildNode(cfg, "builder")
+	assert.ErrorContains(t, err, "in the suite's project perf")
+
+	cfg.Nodes = []*config.NodeConfig{node("builder", "lxd", map[string]interface{}{"image": "ubuntu:24.04", "profiles": []interface{}{"default", "tuned"}})}
+	_, err = GoldenBuildNode(cfg, "builder")
+	assert.ErrorContains(t, err, "uses the suite's profile tuned")
+}
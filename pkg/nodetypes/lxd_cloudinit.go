@@ -0,0 +1,169 @@
+package nodetypes
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bgrewell/dart/internal/config"
+	"github.com/bgrewell/dart/internal/facts"
+	"github.com/bgrewell/dart/internal/helpers"
+	"github.com/bgrewell/dart/internal/lxd"
+)
+
+// LxdCloudInitOpts provisions an instance on first boot the way a cloud
+// does, so a suite can test the same user-data production uses. Each source
+// is either the content itself or the path of a file holding it, relative
+// to the suite file: a value spanning several lines is content, a single
+// line is a path.
+type LxdCloudInitOpts struct {
+	UserData      string `yaml:"user_data,omitempty" json:"user_data"`
+	NetworkConfig string `yaml:"network_config,omitempty" json:"network_config"`
+	VendorData    string `yaml:"vendor_data,omitempty" json:"vendor_data"`
+	Timeout       int    `yaml:"timeout,omitempty" json:"timeout"` // Seconds to wait for cloud-init to finish
+}
+
+// defaultCloudInitTimeout bounds the wait for cloud-init when no timeout is
+// set. Package installs make a first boot far longer than the instance's
+// own readiness check allows for.
+const defaultCloudInitTimeout = 10 * time.Minute
+
+// jinjaHeader opens user-data that cloud-init renders itself. Its {{ }}
+// references are cloud-init's, so DART passes such a source on untouched.
+const jinjaHeader = "## template: jinja"
+
+// cloudInitSource is one configured source and the config key it fills.
+type cloudInitSource struct {
+	option string
+	key    string
+	value  string
+}
+
+// sources lists the configured sources in a fixed order.
+func (c *LxdCloudInitOpts) sources() []cloudInitSource {
+	var sources []cloudInitSource
+	for _, source := range []cloudInitSource{
+		{"user_data", lxd.CloudInitUserData, c.UserData},
+		{"network_config", lxd.CloudInitNetworkConfig, c.NetworkConfig},
+		{"vendor_data", lxd.CloudInitVendorData, c.VendorData},
+	} {
+		if source.value != "" {
+			sources = append(sources, source)
+		}
+	}
+	return sources
+}
+
+// timeout is how long setup waits for cloud-init to finish.
+func (c *LxdCloudInitOpts) timeout() time.Duration {
+	if c.Timeout > 0 {
+		return time.Duration(c.Timeout) * time.Second
+	}
+	return defaultCloudInitTimeout
+}
+
+// inlineSource reports whether a source holds the content itself rather
+// than naming a file.
+func inlineSource(value string) bool {
+	return strings.Contains(value, "\n")
+}
+
+// validate checks what can be checked without the LXD server: every source
+// names a file that exists, and the timeout is usable. raw is the option as
+// written, whose keys the decode would otherwise drop unseen.
+func (c *LxdCloudInitOpts) validate(raw interface{}, suiteDir string) error {
+	if fields, ok := raw.(map[string]interface{}); ok {
+		known := optionKeysOf(LxdCloudInitOpts{})
+		var unknown []string
+		for key := range fields {
+			if !known[key] {
+				unknown = append(unknown, key)
+			}
+		}
+		if len(unknown) > 0 {
+			sort.Strings(unknown)
+			return fmt.Errorf("unknown cloud_init option %q (accepted: network_config, timeout, user_data, vendor_data)", unknown[0])
+		}
+	}
+	if len(c.sources()) == 0 {
+		return fmt.Errorf("cloud_init sets none of user_data, network_config, and vendor_data")
+	}
+	if c.Timeout < 0 {
+		return fmt.Errorf("cloud_init.timeout must not be negative (got %d)", c.Timeout)
+	}
+	for _, source := range c.sources() {
+		if inlineSource(source.value) {
+			continue
+		}
+		path, err := config.ResolveLocalPath(suiteDir, source.value)
+		if err != nil {
+			return err
+		}
+		if _, err := os.Stat(path); err != nil {
+			return fmt.Errorf("cloud_init.%s: %q is neither a readable file nor inline content (inline content spans several lines): %v", source.option, source.value, err)
+		}
+	}
+	return nil
+}
+
+// UseTemplateRenderer sets how cloud-init sources are rendered; see
+// ifaces.SetupTemplater.
+func (d *LxdNode) UseTemplateRenderer(render func(text string) (string, error)) {
+	d.render = render
+}
+
+// cloudInitConfig reads each cloud-init source, renders its var and fact
+// references, and returns the instance config keys that carry them.
+func (d *LxdNode) cloudInitConfig() (map[string]string, error) {
+	if d.options.CloudInit == nil {
+		return nil, nil
+	}
+	render := d.render
+	if render == nil {
+		// Outside a run there are no facts to resolve, and a reference
+		// must fail rather than reach the instance as literal text
+		render = func(text string) (string, error) {
+			return facts.RenderTemplate(text, facts.FactStore{}, d.name)
+		}
+	}
+
+	keys := make(map[string]string)
+	for _, source := range d.options.CloudInit.sources() {
+		content := source.value
+		if !inlineSource(content) {
+			path, err := config.ResolveLocalPath(d.suiteDir, content)
+			if err != nil {
+				return nil, helpers.WrapError(fmt.Sprintf("cloud_init.%s: %v", source.option, err))
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return nil, helpers.WrapError(fmt.Sprintf("cloud_init.%s: %v", source.option, err))
+			}
+			content = string(data)
+		}
+		if !strings.HasPrefix(content, jinjaHeader) {
+			rendered, err := render(content)
+			if err != nil {
+				return nil, helpers.WrapError(fmt.Sprintf("cloud_init.%s: %v", source.option, err))
+			}
+			content = rendered
+		}
+		keys[source.key] = content
+	}
+	return keys, nil
+}
+
+// waitForCloudInit is the last stage of readiness for a node provisioned
+// by cloud-init: the instance answering commands says nothing about
+// whether its first-boot provisioning has finished, or worked.
+func (d *LxdNode) waitForCloudInit() error {
+	if d.options.CloudInit == nil {
+		return nil
+	}
+	if err := lxd.WaitForCloudInit(d.client, d.instanceName(), d.options.CloudInit.timeout()); err != nil {
+		return helpers.WrapError(err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package nodetypes
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bgrewell/dart/internal/config"
+	"github.com/bgrewell/dart/internal/lxd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCloudInitValidation(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "user-data.yaml"), []byte("#cloud-config\n"), 0o644))
+	validate := func(options map[string]interface{}) error {
+		return ValidateNodeOptions(&config.NodeConfig{Name: "web", Type: "lxd-vm", SuiteDir: dir, Options: options})
+	}
+	withCloudInit := func(cloudInit map[string]interface{}) map[string]interface{} {
+		return map[string]interface{}{"image": "ubuntu:24.04", "cloud_init": cloudInit}
+	}
+
+	assert.NoError(t, validate(withCloudInit(map[string]interface{}{"user_data": "user-data.yaml"})))
+	assert.NoError(t, validate(withCloudInit(map[string]interface{}{
+		"user_data":      "#cloud-config\npackages: [nginx]\n",
+		"network_config": "version: 2\nethernets:\n  enp5s0:\n    dhcp4: true\n",
+		"timeout":        900,
+	})))
+
+	assert.ErrorContains(t, validate(withCloudInit(map[string]interface{}{"user_data": "missing.yaml"})),
+		`cloud_init.user_data: "missing.yaml" is neither a readable file nor inline content`)
+	assert.ErrorContains(t, validate(withCloudInit(map[string]interface{}{"userdata": "user-data.yaml"})),
+		`unknown cloud_init option "userdata"`)
+	assert.ErrorContains(t, validate(withCloudInit(map[string]interface{}{"timeout": 60})), "sets none of")
+	assert.ErrorContains(t, validate(withCloudInit(map[string]interface{}{"user_data": "user-data.yaml", "timeout": -1})),
+		"must not be negative")
+	assert.ErrorContains(t, validate(map[string]interface{}{
+		"empty": true, "cloud_init": map[string]interface{}{"user_data": "user-data.yaml"},
+	}), "an empty instance has none")
+	assert.ErrorContains(t, validate(map[string]interface{}{
+		"image":      "ubuntu:24.04",
+		"config":     map[string]interface{}{"cloud-init.user-data": "#cloud-config\n"},
+		"cloud_init": map[string]interface{}{"user_data": "user-data.yaml"},
+	}), "keep only cloud_init")
+	assert.ErrorContains(t, validate(map[string]interface{}{
+		"managed": false, "cloud_init": map[string]interface{}{"user_data": "user-data.yaml"},
+	}), `option "cloud_init" has no effect on an unmanaged node`)
+}
+
+// Sources are read from the suite directory and rendered before they reach
+// the instance's config, except user-data cloud-init renders itself.
+func TestCloudInitConfigRendering(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "user-data.yaml"),
+		[]byte("#cloud-config\nwrite_files:\n  - path: /etc/app.conf\n    content: db={{ fact \"db\" \"ipv4\" }}\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "vendor-data.yaml"),
+		[]byte("## template: jinja\n#cloud-config\nhostname: {{ v1.local_hostname }}\n"), 0o644))
+
+	node := &LxdNode{name: "web", suiteDir: dir, options: LxdNodeOpts{CloudInit: &LxdCloudInitOpts{
+		UserData:      "user-data.yaml",
+		NetworkConfig: "version: 2\nethernets:\n  eth0:\n    dhcp4: true\n",
+		VendorData:    "vendor-data.yaml",
+	}}}
+	node.UseTemplateRenderer(func(text string) (string, error) {
+		return strings.ReplaceAll(text, `{{ fact "db" "ipv4" }}`, "10.201.7.20"), nil
+	})
+
+	keys, err := node.cloudInitConfig()
+	require.NoError(t, err)
+	assert.Equal(t, "#cloud-config\nwrite_files:\n  - path: /etc/app.conf\n    content: db=10.201.7.20\n", keys[lxd.CloudInitUserData])
+	assert.Equal(t, "version: 2\nethernets:\n  eth0:\n    dhcp4: true\n", keys[lxd.CloudInitNetworkConfig])
+	assert.Equal(t, "## template: jinja\n#cloud-config\nhostname: {{ v1.local_hostname }}\n", keys[lxd.CloudInitVendorData])
+
+	// Without a run's renderer a fact reference fails instead of reaching
+	// the instance as literal text
+	node.UseTemplateRenderer(nil)
+	_, err = node.cloudInitConfig()
+	assert.ErrorContains(t, err, "cloud_init.user_data")
+}
@@ -0,0 +1,119 @@
+package nodetypes
+
+import (
+	"fmt"
+	"testing"
+
+	lxdclient "github.com/canonical/lxd/client"
+	"github.com/canonical/lxd/shared/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// clusterServer holds one instance on a cluster and records the state
+// changes and moves made to it. UseTarget returns a copy aimed at a member,
+// as the real client does.
+type clusterServer struct {
+	lxdclient.InstanceServer
+	clustered bool
+	target    string
+	instance  *api.Instance
+	calls     *[]string
+}
+
+func (s *clusterServer) IsClustered() bool { return s.clustered }
+
+func (s *clusterServer) UseTarget(name string) lxdclient.InstanceServer {
+	clone := *s
+	clone.target = name
+	return &clone
+}
+
+func (s *clusterServer) GetInstance(name string) (*api.Instance, string, error) {
+	return s.instance, "etag", nil
+}
+
+func (s *clusterServer) UpdateInstanceState(name string, state api.InstanceStatePut, etag string) (lxdclient.Operation, error) {
+	*s.calls = append(*s.calls, state.Action)
+	s.instance.Status = map[string]string{"start": "Running", "stop": "Stopped"}[state.Action]
+	return doneOperation{}, nil
+}
+
+func (s *clusterServer) MigrateInstance(name string, req api.InstancePost) (lxdclient.Operation, error) {
+	*s.calls = append(*s.calls, fmt.Sprintf("migrate to %s live=%t", s.target, req.Live))
+	s.instance.Location = s.target
+	return doneOperation{}, nil
+}
+
+func (s *clusterServer) ExecInstance(name string, exec api.InstanceExecPost, args *lxdclient.InstanceExecArgs) (lxdclient.Operation, error) {
+	*s.calls = append(*s.calls, "ready check")
+	return exitedOperation{}, nil
+}
+
+// exitedOperation is a command that exited zero.
+type exitedOperation struct{ lxdclient.Operation }
+
+func (exitedOperation) Wait() error { return nil }
+
+func (exitedOperation) Get() api.Operation {
+	return api.Operation{Metadata: map[string]any{"return": float64(0)}}
+}
+
+func TestLxdMigrate(t *testing.T) {
+	migrate := func(instanceType, status string, config map[string]string, mode string) ([]string, error) {
+		var calls []string
+		instance := &api.Instance{Name: "db", Type: instanceType, Status: status, Location: "member-1"}
+		instance.ExpandedConfig = config
+		node := &LxdNode{name: "db", client: &clusterServer{clustered: true, instance: instance, calls: &calls},
+			options: LxdNodeOpts{BootWait: &LxdBootWaitOpts{Interval: 1, Timeout: 10}}}
+		err := node.Migrate("member-2", mode, "", 0)
+		return calls, err
+	}
+
+	calls, err := migrate("virtual-machine", "Running", map[string]string{"migration.stateful": "true"}, "auto")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"migrate to member-2 live=true", "ready check"}, calls)
+
+	calls, err = migrate("container", "Running", nil, "auto")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"stop", "migrate to member-2 live=false", "start", "ready check"}, calls,
+		"a container moves cold")
+
+	calls, err = migrate("virtual-machine", "Stopped", nil, "auto")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"migrate to member-2 live=false"}, calls, "a stopped instance is moved and left stopped")
+
+	_, err = migrate("virtual-machine", "Stopped", nil, "live")
+	assert.ErrorContains(t, err, "is stopped: live migration moves a running instance")
+
+	var calls2 []string
+	here := &api.Instance{Name: "db", Status: "Running", Location: "member-2"}
+	node := &LxdNode{name: "db", client: &clusterServer{clustered: true, instance: here, calls: &calls2}}
+	require.NoError(t, node.Migrate("member-2", "auto", "", 0))
+	assert.Empty(t, calls2, "an instance already on the member stays put")
+
+	single := &LxdNode{name: "db", client: &clusterServer{instance: here, calls: &calls2}}
+	assert.ErrorContains(t, single.Migrate("member-2", "auto", "", 0), "the LXD server is not a cluster")
+}
+
+func TestLxdTargetPlacement(t *testing.T) {
+	var calls []string
+	node := &LxdNode{name: "db", client: &clusterServer{clustered: true, calls: &calls},
+		options: LxdNodeOpts{Target: "member-2"}}
+	placement, err := node.placement()
+	require.NoError(t, err)
+	assert.Equal(t, "member-2", placement.(*clusterServer).target)
+
+	node.options.Target = ""
+	placement, err = node.placement()
+	require.NoError(t, err)
+	assert.Empty(t, placement.(*clusterServer).target, "without a target the cluster places the instance")
+
+	single := &LxdNode{name: "db", client: &clusterServer{calls: &calls}, options: LxdNodeOpts{Target: "member-2"}}
+	_, err = single.placement()
+	assert.ErrorContains(t, err, "target member-2 is set, but the LXD server is not a cluster")
+
+	unmanaged := false
+	assert.ErrorContains(t, LxdNodeOpts{Target: "member-2", Managed: &unmanaged}.validate(),
+		"an unmanaged instance is already placed")
+}
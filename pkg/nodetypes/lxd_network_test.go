@@ -0,0 +1,60 @@
+package nodetypes
+
+import (
+	"net/http"
+	"testing"
+
+	lxdclient "github.com/canonical/lxd/client"
+	"github.com/canonical/lxd/shared/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// networkServer reports one instance's addresses and a fixed set of
+// networks.
+type networkServer struct {
+	lxdclient.InstanceServer
+	state    api.InstanceState
+	networks map[string]api.Network
+}
+
+func (s *networkServer) GetInstanceState(name string) (*api.InstanceState, string, error) {
+	return &s.state, "", nil
+}
+
+func (s *networkServer) GetNetwork(name string) (*api.Network, string, error) {
+	network, ok := s.networks[name]
+	if !ok {
+		return nil, "", api.StatusErrorf(http.StatusNotFound, "Network not found")
+	}
+	return &network, "", nil
+}
+
+// A node on an OVN network also reports the address its router takes on
+// the uplink, which is where the node's traffic appears to come from.
+func TestLxdNetworkFactsIncludeOvnRouter(t *testing.T) {
+	tenant := api.Network{Name: "tenant", Type: "ovn"}
+	tenant.Config = map[string]string{"volatile.network.ipv4.address": "10.60.0.100"}
+	bridge := api.Network{Name: "lxdbr0", Type: "bridge"}
+	bridge.Config = map[string]string{"ipv4.address": "10.0.3.1/24"}
+	server := &networkServer{
+		state: api.InstanceState{Network: map[string]api.InstanceStateNetwork{
+			"eth0": {Addresses: []api.InstanceStateNetworkAddress{{Family: "inet", Address: "10.50.0.10", Scope: "global"}}},
+			"eth1": {Addresses: []api.InstanceStateNetworkAddress{{Family: "inet", Address: "10.0.3.20", Scope: "global"}}},
+		}},
+		networks: map[string]api.Network{"tenant": tenant, "lxdbr0": bridge},
+	}
+	node := &LxdNode{name: "web", client: server, options: LxdNodeOpts{
+		InstanceName: "web",
+		Networks:     []LxdNetworkOpts{{Name: "tenant"}, {Name: "lxdbr0"}, {Name: "gone"}},
+	}}
+
+	facts, err := node.NetworkFacts()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"ipv4":               "10.50.0.10",
+		"ipv4.eth0":          "10.50.0.10",
+		"ipv4.eth1":          "10.0.3.20",
+		"router.ipv4.tenant": "10.60.0.100",
+	}, facts, "a bridge has no router, and a network that cannot be read is skipped")
+}
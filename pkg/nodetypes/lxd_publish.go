@@ -0,0 +1,201 @@
+package nodetypes
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/bgrewell/dart/internal/config"
+	"github.com/bgrewell/dart/internal/helpers"
+	"github.com/bgrewell/dart/internal/lxd"
+	"github.com/bgrewell/dart/pkg/ifaces"
+)
+
+// setupHashProperty is the image property recording which setup an image
+// published under publish_as reflects. An alias whose image lacks it was
+// not published by DART and is never replaced.
+const setupHashProperty = "dart.setup_hash"
+
+// validatePublishAs checks publish_as against the options it cannot be
+// combined with.
+func (o LxdNodeOpts) validatePublishAs() error {
+	if o.PublishAs == "" {
+		return nil
+	}
+	if strings.ContainsAny(o.PublishAs, ":/") {
+		return helpers.WrapError(fmt.Sprintf("publish_as %q must be a plain image alias; the image is published on the node's own server", o.PublishAs))
+	}
+	if !o.managed() {
+		return helpers.WrapError("publish_as keeps an instance DART creates; an unmanaged instance is not one")
+	}
+	if o.emptyInstance() {
+		return helpers.WrapError("publish_as caches setup steps run on an image; to keep an installed empty instance, use dart golden build and clone_from")
+	}
+	if o.BootWait != nil && len(o.BootWait.EjectOnPoweroff) > 0 {
+		return helpers.WrapError("boot_wait.eject_on_poweroff waits for an install to power off, which an instance from the publish_as image never does; remove one of them")
+	}
+	return nil
+}
+
+// validatePublishAsProject rejects publish_as on a node in the suite's own
+// lxd.project. That project is created for each run and deleted at
+// teardown, so a later run could never find the image, and the image left
+// in it would keep teardown from deleting the project.
+func (o LxdNodeOpts) validatePublishAsProject(suiteProject string) error {
+	if o.PublishAs == "" || suiteProject == "" || suiteProject == lxd.DefaultProject || o.Project != suiteProject {
+		return nil
+	}
+	return helpers.WrapError(fmt.Sprintf("publish_as keeps its image in the node's project, and %s is the suite's project, which teardown deletes; put the node in a project that outlives the run", suiteProject))
+}
+
+// SetupInputs returns what a node's own setup depends on beyond its
+// options as written: a digest of each cloud-init source read from a file,
+// by option. It reports false when a source, with vars expanded, still
+// holds a fact reference, which differs between runs, so no image can
+// stand for the node's setup.
+func SetupInputs(cfg *config.NodeConfig, vars map[string]string) (map[string]string, bool) {
+	if cfg.Type != "lxd" && cfg.Type != "lxd-vm" {
+		return nil, true
+	}
+	var opts LxdNodeOpts
+	if err := decodeNodeOptions(cfg.Options, &opts); err != nil {
+		return nil, false
+	}
+	if opts.CloudInit == nil {
+		return nil, true
+	}
+	inputs := make(map[string]string)
+	for _, source := range opts.CloudInit.sources() {
+		content := source.value
+		if !inlineSource(content) {
+			path, err := config.ResolveLocalPath(cfg.SuiteDir, content)
+			if err != nil {
+				return nil, false
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return nil, false
+			}
+			content = string(data)
+			sum := sha256.Sum256(data)
+			inputs[source.option] = hex.EncodeToString(sum[:])
+		}
+		if strings.HasPrefix(content, jinjaHeader) {
+			continue
+		}
+		expanded, err := config.ExpandVars(content, vars)
+		if err != nil || strings.Contains(expanded, "{{") {
+			return nil, false
+		}
+		if expanded != content {
+			sum := sha256.Sum256([]byte(expanded))
+			inputs[source.option] = hex.EncodeToString(sum[:])
+		}
+	}
+	return inputs, true
+}
+
+var _ ifaces.SetupCacher = &LxdNode{}
+
+// SetupCache returns the image alias the node publishes its instance
+// under, or "" when it publishes none.
+func (d *LxdNode) SetupCache() string {
+	return d.options.PublishAs
+}
+
+// UseSetupHashes gives the node a hash per setup step targeting it, the
+// last covering all of them.
+func (d *LxdNode) UseSetupHashes(hashes []string) {
+	d.setupHashes = hashes
+}
+
+// CachedSetupSteps reports how many of the node's leading setup steps the
+// instance was created with already applied.
+func (d *LxdNode) CachedSetupSteps() int {
+	return d.cachedSteps
+}
+
+// cachedSetup looks up the image kept under publish_as and returns how
+// many of the node's setup steps it covers: the most whose hash the image
+// records, or none when there is no image or its hash matches no prefix
+// of the steps, after a step in it changed.
+func (d *LxdNode) cachedSetup() (int, error) {
+	if d.options.PublishAs == "" || len(d.setupHashes) == 0 {
+		return 0, nil
+	}
+	image, _, err := lxd.GetImageByAlias(context.Background(), d.client, d.options.PublishAs)
+	if lxd.IsNotFound(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, helpers.WrapError(fmt.Sprintf("error looking up publish_as image %s: %v", d.options.PublishAs, err))
+	}
+	hash, published := image.Properties[setupHashProperty]
+	if !published {
+		return 0, helpers.WrapError(fmt.Sprintf("image alias %s names an image DART did not publish; choose another publish_as", d.options.PublishAs))
+	}
+	for covered := len(d.setupHashes); covered > 0; covered-- {
+		if d.setupHashes[covered-1] == hash {
+			return covered, nil
+		}
+	}
+	return 0, nil
+}
+
+// PublishSetup keeps the instance for later runs once its setup steps have
+// run. The instance is stopped so its disk is consistent, published as a
+// local image recording the hash of its setup, and started again for the
+// steps and tests after them; publish_as then names the new image and the
+// one it replaces is deleted. An instance whose every hashed step came
+// from the image is left alone.
+func (d *LxdNode) PublishSetup() error {
+	if d.options.PublishAs == "" || d.cachedSteps == len(d.setupHashes) {
+		return nil
+	}
+	ctx := context.Background()
+	name := d.instanceName()
+
+	state, _, err := d.client.GetInstanceState(name)
+	if err != nil {
+		return helpers.WrapError(fmt.Sprintf("error getting instance state: %v", err))
+	}
+	if state.Status != "Stopped" {
+		if err := lxd.StopInstance(ctx, d.client, name, false); err != nil {
+			return helpers.WrapError(fmt.Sprintf("error stopping instance before publishing it: %v", err))
+		}
+	}
+
+	fingerprint, err := lxd.PublishInstance(ctx, d.client, name, map[string]string{
+		setupHashProperty: d.setupHashes[len(d.setupHashes)-1],
+		"description":     fmt.Sprintf("Node %s after DART setup", d.name),
+	})
+	if err != nil {
+		return helpers.WrapError(err.Error())
+	}
+
+	previous, err := lxd.GetImageFingerprint(ctx, d.client, d.options.PublishAs)
+	switch {
+	case lxd.IsNotFound(err):
+		previous = ""
+	case err != nil:
+		return helpers.WrapError(err.Error())
+	default:
+		if err := lxd.DeleteImageAlias(ctx, d.client, d.options.PublishAs); err != nil {
+			return helpers.WrapError(err.Error())
+		}
+	}
+	if err := lxd.CreateImageAlias(ctx, d.client, d.options.PublishAs, fingerprint, fmt.Sprintf("Node %s after DART setup", d.name)); err != nil {
+		return helpers.WrapError(err.Error())
+	}
+	if previous != "" && previous != fingerprint {
+		if err := lxd.DeleteImage(ctx, d.client, previous); err != nil {
+			return helpers.WrapError(fmt.Sprintf("error deleting the image publish_as %s replaced: %v", d.options.PublishAs, err))
+		}
+	}
+
+	d.cachedSteps = len(d.setupHashes)
+	return d.start()
+}
@@ -0,0 +1,176 @@
+package nodetypes
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/bgrewell/dart/internal/config"
+	lxdclient "github.com/canonical/lxd/client"
+	"github.com/canonical/lxd/shared/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// imageServer keeps images and aliases in memory, and records what
+// publishing does to them and to the instance.
+type imageServer struct {
+	lxdclient.InstanceServer
+	status  string
+	aliases map[string]string
+	images  map[string]*api.Image
+	calls   []string
+}
+
+func (s *imageServer) GetImageAlias(name string) (*api.ImageAliasesEntry, string, error) {
+	target, ok := s.aliases[name]
+	if !ok {
+		return nil, "", api.StatusErrorf(http.StatusNotFound, "Image alias not found")
+	}
+	return &api.ImageAliasesEntry{Name: name, Target: target}, "", nil
+}
+
+func (s *imageServer) GetImage(fingerprint string) (*api.Image, string, error) {
+	image, ok := s.images[fingerprint]
+	if !ok {
+		return nil, "", api.StatusErrorf(http.StatusNotFound, "Image not found")
+	}
+	return image, "", nil
+}
+
+func (s *imageServer) CreateImage(req api.ImagesPost, args *lxdclient.ImageCreateArgs) (lxdclient.Operation, error) {
+	s.calls = append(s.calls, "publish "+req.Source.Name)
+	s.images["fp-new"] = &api.Image{Fingerprint: "fp-new", ImagePut: req.ImagePut}
+	return publishedOperation{fingerprint: "fp-new"}, nil
+}
+
+func (s *imageServer) CreateImageAlias(alias api.ImageAliasesPost) error {
+	s.calls = append(s.calls, "alias "+alias.Name+" "+alias.Target)
+	s.aliases[alias.Name] = alias.Target
+	return nil
+}
+
+func (s *imageServer) DeleteImageAlias(name string) error {
+	s.calls = append(s.calls, "unalias "+name)
+	delete(s.aliases, name)
+	return nil
+}
+
+func (s *imageServer) DeleteImage(fingerprint string) (lxdclient.Operation, error) {
+	s.calls = append(s.calls, "delete image "+fingerprint)
+	delete(s.images, fingerprint)
+	return doneOperation{}, nil
+}
+
+func (s *imageServer) GetInstanceState(name string) (*api.InstanceState, string, error) {
+	return &api.InstanceState{Status: s.status}, "", nil
+}
+
+func (s *imageServer) UpdateInstanceState(name string, state api.InstanceStatePut, etag string) (lxdclient.Operation, error) {
+	s.calls = append(s.calls, state.Action)
+	s.status = map[string]string{"start": "Running", "stop": "Stopped"}[state.Action]
+	return doneOperation{}, nil
+}
+
+func (s *imageServer) ExecInstance(name string, exec api.InstanceExecPost, args *lxdclient.InstanceExecArgs) (lxdclient.Operation, error) {
+	return exitedOperation{}, nil
+}
+
+// publishedOperation is a publish that produced an image.
+type publishedOperation struct {
+	lxdclient.Operation
+	fingerprint string
+}
+
+func (publishedOperation) Wait() error { return nil }
+
+func (o publishedOperation) Get() api.Operation {
+	return api.Operation{Metadata: map[string]any{"fingerprint": o.fingerprint}}
+}
+
+func TestPublishAsValidation(t *testing.T) {
+	unmanaged := false
+	assert.NoError(t, LxdNodeOpts{Image: "ubuntu:24.04", PublishAs: "web-base"}.validate())
+	assert.ErrorContains(t, LxdNodeOpts{Image: "ubuntu:24.04", PublishAs: "local:web-base"}.validate(),
+		"must be a plain image alias")
+	assert.ErrorContains(t, LxdNodeOpts{Image: "ubuntu:24.04", PublishAs: "web-base", Managed: &unmanaged}.validate(),
+		"an unmanaged instance is not one")
+	assert.ErrorContains(t, LxdNodeOpts{Empty: true, PublishAs: "web-base"}.validate(),
+		"use dart golden build and clone_from")
+	assert.ErrorContains(t, LxdNodeOpts{Image: "ubuntu:24.04", PublishAs: "web-base",
+		BootWait: &LxdBootWaitOpts{EjectOnPoweroff: []string{"iso"}}}.validate(), "remove one of them")
+
+	node := func(name, alias string) *config.NodeConfig {
+		return &config.NodeConfig{Name: name, Type: "lxd", Options: map[string]interface{}{"image": "ubuntu:24.04", "publish_as": alias}}
+	}
+	assert.NoError(t, ValidateNodeSet([]*config.NodeConfig{node("web", "web-base"), node("db", "db-base")}))
+	assert.ErrorContains(t, ValidateNodeSet([]*config.NodeConfig{node("web", "base"), node("db", "base")}),
+		`node "web" and node "db" both publish_as "base"`)
+
+	// The suite's own project is deleted at teardown, image and all
+	inSuiteProject := node("web", "web-base")
+	inSuiteProject.Options["project"] = "ci"
+	assert.ErrorContains(t, ValidateNodeSet([]*config.NodeConfig{inSuiteProject}, NodeSetOptions{LxdProject: "ci"}),
+		"ci is the suite's project, which teardown deletes")
+	assert.NoError(t, ValidateNodeSet([]*config.NodeConfig{node("web", "web-base")}, NodeSetOptions{LxdProject: "ci"}),
+		"a node in another project keeps its image")
+}
+
+func TestLxdCachedSetup(t *testing.T) {
+	server := &imageServer{
+		aliases: map[string]string{"web-base": "fp-old", "ubuntu-custom": "fp-other"},
+		images: map[string]*api.Image{
+			"fp-old":   {Fingerprint: "fp-old", ImagePut: api.ImagePut{Properties: map[string]string{setupHashProperty: "h2"}}},
+			"fp-other": {Fingerprint: "fp-other"},
+		},
+	}
+	node := &LxdNode{name: "web", client: server, options: LxdNodeOpts{PublishAs: "web-base"}}
+
+	node.UseSetupHashes([]string{"h1", "h2", "h3"})
+	covered, err := node.cachedSetup()
+	require.NoError(t, err)
+	assert.Equal(t, 2, covered, "the image covers the steps up to the hash it records")
+
+	node.UseSetupHashes([]string{"h1'", "h2'"})
+	covered, err = node.cachedSetup()
+	require.NoError(t, err)
+	assert.Zero(t, covered, "an image from before a step changed covers nothing")
+
+	node.options.PublishAs = "web-next"
+	covered, err = node.cachedSetup()
+	require.NoError(t, err)
+	assert.Zero(t, covered, "no image yet")
+
+	node.options.PublishAs = "ubuntu-custom"
+	_, err = node.cachedSetup()
+	assert.ErrorContains(t, err, "names an image DART did not publish")
+}
+
+func TestLxdPublishSetup(t *testing.T) {
+	server := &imageServer{
+		status:  "Running",
+		aliases: map[string]string{"web-base": "fp-old"},
+		images: map[string]*api.Image{
+			"fp-old": {Fingerprint: "fp-old", ImagePut: api.ImagePut{Properties: map[string]string{setupHashProperty: "h1"}}},
+		},
+	}
+	node := &LxdNode{name: "web", client: server, options: LxdNodeOpts{PublishAs: "web-base",
+		InstanceName: "web-ci", BootWait: &LxdBootWaitOpts{Interval: 1, Timeout: 10}}}
+	node.UseSetupHashes([]string{"h1", "h2"})
+	node.cachedSteps = 1
+
+	require.NoError(t, node.PublishSetup())
+	assert.Equal(t, []string{
+		"stop",
+		"publish web-ci",
+		"unalias web-base",
+		"alias web-base fp-new",
+		"delete image fp-old",
+		"start",
+	}, server.calls, "the instance is published stopped, and runs again for the tests")
+	assert.Equal(t, "h2", server.images["fp-new"].Properties[setupHashProperty])
+	assert.Equal(t, 2, node.CachedSetupSteps())
+
+	server.calls = nil
+	require.NoError(t, node.PublishSetup())
+	assert.Empty(t, server.calls, "an image that covers every step is not published again")
+}
@@ -0,0 +1,100 @@
+package nodetypes
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/bgrewell/dart/internal/config"
+	"github.com/bgrewell/dart/internal/helpers"
+)
+
+// LxdVolumeMountOpts attaches a custom storage volume to the instance, as a
+// disk device named after the volume. A volume the suite declares under
+// lxd.volumes is found by name; any other volume already on the server is
+// attached by naming its pool as well.
+type LxdVolumeMountOpts struct {
+	Name     string `yaml:"name" json:"name"`
+	Path     string `yaml:"path,omitempty" json:"path"`         // Mount point; a block volume has none
+	Pool     string `yaml:"pool,omitempty" json:"pool"`         // Pool of a volume the suite does not declare
+	ReadOnly bool   `yaml:"readonly,omitempty" json:"readonly"` // Mount the volume read-only
+}
+
+// validateVolumeMounts checks the node's volume entries on their own; which
+// volumes exist is checked against the suite by validateVolumeReferences.
+func (o LxdNodeOpts) validateVolumeMounts() error {
+	seen := make(map[string]bool, len(o.Volumes))
+	for _, mount := range o.Volumes {
+		if mount.Name == "" {
+			return helpers.WrapError("a volumes entry is missing name")
+		}
+		if seen[mount.Name] {
+			return helpers.WrapError(fmt.Sprintf("volume %s is attached twice", mount.Name))
+		}
+		seen[mount.Name] = true
+		if mount.Path != "" && !path.IsAbs(mount.Path) {
+			return helpers.WrapError(fmt.Sprintf("volume %s: path %q must be absolute", mount.Name, mount.Path))
+		}
+		// The device is named after the volume, so it must not replace one
+		// the node already has
+		if _, taken := o.Devices[mount.Name]; taken || mount.Name == "root" {
+			return helpers.WrapError(fmt.Sprintf("volume %s: its device would replace the node's %s device; rename the volume", mount.Name, mount.Name))
+		}
+		for i := range o.Networks {
+			if mount.Name == fmt.Sprintf("eth%d", i) {
+				return helpers.WrapError(fmt.Sprintf("volume %s: its device would replace the node's %s NIC; rename the volume", mount.Name, mount.Name))
+			}
+		}
+	}
+	return nil
+}
+
+// validateVolumeReferences checks the node's volumes against the ones the
+// suite declares: a volume without a pool must be one of them, and its
+// content type decides whether it takes a path.
+func (o LxdNodeOpts) validateVolumeReferences(declared map[string]*config.LxdVolumeConfig) error {
+	for _, mount := range o.Volumes {
+		volume, ok := declared[mount.Name]
+		if !ok {
+			if mount.Pool == "" {
+				return fmt.Errorf("volume %s is not declared under lxd.volumes; set pool to attach an existing volume", mount.Name)
+			}
+			continue
+		}
+		if mount.Pool != "" {
+			return fmt.Errorf("volume %s is declared under lxd.volumes, which gives its pool; remove pool here", mount.Name)
+		}
+		switch {
+		case volume.ContentType == "block" && mount.Path != "":
+			return fmt.Errorf("volume %s is a block volume, which attaches as a disk without a path", mount.Name)
+		case volume.ContentType != "block" && mount.Path == "":
+			return fmt.Errorf("volume %s needs a path to mount at", mount.Name)
+		}
+	}
+	return nil
+}
+
+// volumeDevices builds the disk devices that attach the node's volumes,
+// under the server-side names of the suite's pools and volumes.
+func (d *LxdNode) volumeDevices() (map[string]map[string]string, error) {
+	devices := make(map[string]map[string]string, len(d.options.Volumes))
+	for _, mount := range d.options.Volumes {
+		pool, source := mount.Pool, mount.Name
+		if d.wrapper != nil && mount.Pool == "" {
+			if volume := d.wrapper.Volume(mount.Name); volume != nil {
+				pool, source = d.wrapper.PoolRef(volume.Pool), d.wrapper.VolumeRef(mount.Name)
+			}
+		}
+		if pool == "" {
+			return nil, helpers.WrapError(fmt.Sprintf("volume %s is not declared under lxd.volumes; set pool to attach an existing volume", mount.Name))
+		}
+		device := map[string]string{"type": "disk", "pool": pool, "source": source}
+		if mount.Path != "" {
+			device["path"] = mount.Path
+		}
+		if mount.ReadOnly {
+			device["readonly"] = "true"
+		}
+		devices[mount.Name] = device
+	}
+	return devices, nil
+}
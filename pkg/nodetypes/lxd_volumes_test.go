@@ -0,0 +1,83 @@
+package nodetypes
+
+import (
+	"testing"
+
+	"github.com/bgrewell/dart/internal/config"
+	"github.com/bgrewell/dart/internal/lxd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLxdVolumeValidation(t *testing.T) {
+	validate := func(options map[string]interface{}) error {
+		return ValidateNodeOptions(&config.NodeConfig{Name: "db", Type: "lxd", Options: options})
+	}
+	mount := func(entry map[string]interface{}) map[string]interface{} {
+		return map[string]interface{}{"image": "ubuntu:24.04", "volumes": []interface{}{entry}}
+	}
+
+	assert.NoError(t, validate(mount(map[string]interface{}{"name": "scratch", "path": "/data", "readonly": true})))
+	assert.ErrorContains(t, validate(mount(map[string]interface{}{"path": "/data"})), "missing name")
+	assert.ErrorContains(t, validate(mount(map[string]interface{}{"name": "scratch", "path": "data"})),
+		`path "data" must be absolute`)
+	assert.ErrorContains(t, validate(mount(map[string]interface{}{"name": "root", "path": "/data"})),
+		"would replace the node's root device")
+	assert.ErrorContains(t, validate(map[string]interface{}{
+		"image":    "ubuntu:24.04",
+		"networks": []interface{}{map[string]interface{}{"name": "lxdbr0"}},
+		"volumes":  []interface{}{map[string]interface{}{"name": "eth0", "path": "/data"}},
+	}), "would replace the node's eth0 NIC")
+}
+
+func TestLxdVolumeReferences(t *testing.T) {
+	node := func(entries ...map[string]interface{}) []*config.NodeConfig {
+		volumes := make([]interface{}, len(entries))
+		for i, entry := range entries {
+			volumes[i] = entry
+		}
+		return []*config.NodeConfig{{Name: "db", Type: "lxd", Options: map[string]interface{}{"image": "ubuntu:24.04", "volumes": volumes}}}
+	}
+	declared := lxd.DeclaredVolumes(&config.LxdConfig{Volumes: []*config.LxdVolumeConfig{
+		{Name: "scratch", Pool: "fast"},
+		{Name: "disk", Pool: "fast", ContentType: "block"},
+	}})
+	check := func(nodes []*config.NodeConfig) error {
+		return ValidateNodeSet(nodes, NodeSetOptions{LxdVolumes: declared})
+	}
+
+	assert.NoError(t, check(node(
+		map[string]interface{}{"name": "scratch", "path": "/data"},
+		map[string]interface{}{"name": "disk"},
+		map[string]interface{}{"name": "fixtures", "pool": "default", "path": "/fixtures"},
+	)))
+	assert.ErrorContains(t, check(node(map[string]interface{}{"name": "fixtures", "path": "/fixtures"})),
+		"not declared under lxd.volumes; set pool")
+	assert.ErrorContains(t, check(node(map[string]interface{}{"name": "scratch", "pool": "fast", "path": "/data"})),
+		"remove pool here")
+	assert.ErrorContains(t, check(node(map[string]interface{}{"name": "scratch"})), "needs a path")
+	assert.ErrorContains(t, check(node(map[string]interface{}{"name": "disk", "path": "/dev/data"})),
+		"block volume")
+	assert.NoError(t, ValidateNodeSet(node(map[string]interface{}{"name": "fixtures"})),
+		"without the suite's volumes the check is skipped")
+}
+
+// A volume in a named pool is attached as named; the scoped names of the
+// suite's own volumes are covered by the lxd package.
+func TestLxdVolumeDevices(t *testing.T) {
+	node := &LxdNode{name: "db", options: LxdNodeOpts{Volumes: []LxdVolumeMountOpts{
+		{Name: "fixtures", Pool: "default", Path: "/fixtures", ReadOnly: true},
+		{Name: "disk", Pool: "default"},
+	}}}
+
+	devices, err := node.volumeDevices()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]map[string]string{
+		"fixtures": {"type": "disk", "pool": "default", "source": "fixtures", "path": "/fixtures", "readonly": "true"},
+		"disk":     {"type": "disk", "pool": "default", "source": "disk"},
+	}, devices)
+
+	node.options.Volumes = []LxdVolumeMountOpts{{Name: "scratch", Path: "/data"}}
+	_, err = node.volumeDevices()
+	assert.ErrorContains(t, err, "volume scratch is not declared under lxd.volumes")
+}
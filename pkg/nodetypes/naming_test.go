@@ -4,18 +4,52 @@ import (
 	"testing"
 
 	"github.com/bgrewell/dart/internal/config"
+	"github.com/bgrewell/dart/internal/runlabel"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
-// The platform object's name defaults to the node name, so a suite's
-// containers and instances are findable by the name the YAML uses.
-func TestPlatformNamesDefaultToNodeName(t *testing.T) {
+// The platform object's name defaults to the node name scoped by the run
+// ID, so two runs of one suite on one host never ask for the same name.
+func TestPlatformNamesDefaultToRunScopedNodeName(t *testing.T) {
+	_, err := runlabel.Start("naming", "ci-1234")
+	require.NoError(t, err)
+
 	docker := &DockerNode{name: "web"}
-	assert.Equal(t, "web", docker.containerName())
+	assert.Equal(t, "web-ci-1234", docker.containerName())
 
 	lxd := &LxdNode{name: "db"}
-	assert.Equal(t, "db", lxd.instanceName())
+	assert.Equal(t, "db-ci-1234", lxd.instanceName())
+
+	tree := &RootfsNode{name: "pkg", options: RootfsNodeOpts{Workdir: "/w"}}
+	assert.Equal(t, "/w/dart-pkg-ci-1234", tree.dir())
+
+	// An adopted object already has its name
+	managed := false
+	adopted := &DockerNode{name: "staging", options: DockerNodeOpts{Managed: &managed}}
+	assert.Equal(t, "staging", adopted.containerName())
+}
+
+// A --teardown-only run without --run-id would look for objects named
+// after a fresh ID, so a suite that creates any must be given the old one.
+func TestCreatesRunScopedObjects(t *testing.T) {
+	suite := func(nodes ...*config.NodeConfig) *config.Configuration {
+		return &config.Configuration{Nodes: nodes}
+	}
+	assert.False(t, CreatesRunScopedObjects(suite(&config.NodeConfig{Name: "host", Type: "local"})))
+	assert.True(t, CreatesRunScopedObjects(suite(&config.NodeConfig{Name: "web", Type: "docker"})))
+	assert.False(t, CreatesRunScopedObjects(suite(&config.NodeConfig{
+		Name: "staging", Type: "docker", Options: map[string]interface{}{"managed": false},
+	})), "an adopted container keeps its own name")
+	assert.True(t, CreatesRunScopedObjects(suite(&config.NodeConfig{
+		Name: "app", Type: "docker-compose", Options: map[string]interface{}{"compose_file": "compose.yml", "service": "web"},
+	})))
+	assert.False(t, CreatesRunScopedObjects(suite(&config.NodeConfig{
+		Name: "app", Type: "docker-compose", Options: map[string]interface{}{"compose_file": "compose.yml", "service": "web", "project_name": "shop"},
+	})), "a pinned compose project keeps its name")
+	assert.True(t, CreatesRunScopedObjects(suite(&config.NodeConfig{
+		Name: "pkg", Type: "rootfs", Options: map[string]interface{}{"source": "/srv/rootfs"},
+	})), "a rootfs work tree and its machine are named after the run")
 }
 
 // An explicit name decouples the platform identifier from node identity,
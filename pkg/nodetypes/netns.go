@@ -0,0 +1,212 @@
+package nodetypes
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/bgrewell/dart/internal/execution"
+	"github.com/bgrewell/dart/internal/helpers"
+	"github.com/bgrewell/dart/internal/netns"
+	"github.com/bgrewell/dart/pkg/ifaces"
+)
+
+var _ ifaces.Node = &NetnsNode{}
+var _ ifaces.NetworkInspector = &NetnsNode{}
+
+type NetnsInterfaceOpts struct {
+	// Name inside the namespace; defaults to eth0, eth1, ... by position
+	Name string `yaml:"name,omitempty" json:"name"`
+	// Bridge names an entry in the suite's netns.bridges block
+	Bridge  string `yaml:"bridge,omitempty" json:"bridge"`
+	Address string `yaml:"address,omitempty" json:"address"` // CIDR
+}
+
+type NetnsNodeOpts struct {
+	// Namespace is the name given to `ip netns add`. It defaults to
+	// dart-<node>, so a suite's namespaces are recognisable and do not
+	// collide with ones the host already uses.
+	Namespace  string               `yaml:"namespace,omitempty" json:"namespace"`
+	Interfaces []NetnsInterfaceOpts `yaml:"interfaces,omitempty" json:"interfaces"`
+	Routes     []string             `yaml:"routes,omitempty" json:"routes"`
+	// Sysctls are applied inside the namespace, e.g. net.ipv4.ip_forward
+	// for a router. Values may be written as numbers.
+	Sysctls map[string]interface{} `yaml:"sysctls,omitempty" json:"sysctls"`
+	// Nameservers replace the host's resolvers inside the namespace
+	Nameservers []string `yaml:"nameservers,omitempty" json:"nameservers"`
+	// Sudo runs ip through `sudo -n` when DART is not itself root
+	Sudo bool `yaml:"sudo,omitempty" json:"sudo"`
+}
+
+func NewNetnsNode(name string, opts ifaces.NodeOptions, suiteDir string) (node ifaces.Node, err error) {
+
+	jsonData, err := json.Marshal(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var nodeopts NetnsNodeOpts
+	err = json.Unmarshal(jsonData, &nodeopts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &NetnsNode{
+		name:    name,
+		options: nodeopts,
+		run:     helpers.NewHostRunner(nodeopts.Sudo),
+		// Commands go through the local executor so output streaming,
+		// exit codes, and the suite working directory behave exactly as
+		// on a local node
+		host: NewLocalNode(name, nil, suiteDir),
+	}, nil
+}
+
+// NetnsNode is a network namespace on the machine running DART. It shares
+// the host's filesystem and processes and has its own interfaces, routes,
+// and firewall state — enough to stand in for a host in a network test.
+type NetnsNode struct {
+	name    string
+	options NetnsNodeOpts
+	run     helpers.HostRunner
+	host    ifaces.Node
+}
+
+// namespace is the kernel object's name; see NetnsNodeOpts.Namespace.
+func (n *NetnsNode) namespace() string {
+	if n.options.Namespace != "" {
+		return n.options.Namespace
+	}
+	return "dart-" + n.name
+}
+
+// interfaces resolves names and host-side peers for the configured links.
+func (n *NetnsNode) interfaces() []netns.Interface {
+	links := make([]netns.Interface, 0, len(n.options.Interfaces))
+	for i, opts := range n.options.Interfaces {
+		name := opts.Name
+		if name == "" {
+			name = fmt.Sprintf("eth%d", i)
+		}
+		links = append(links, netns.Interface{
+			Name:     name,
+			HostName: netns.HostVethName(n.namespace(), i),
+			Bridge:   opts.Bridge,
+			Address:  opts.Address,
+		})
+	}
+	return links
+}
+
+func (n *NetnsNode) Setup() error {
+	ns := n.namespace()
+	if err := netns.CreateNamespace(n.run, ns); err != nil {
+		return err
+	}
+	for _, iface := range n.interfaces() {
+		if err := netns.AddInterface(n.run, ns, iface); err != nil {
+			return err
+		}
+	}
+	// Routes come after the interfaces: a gateway is only reachable once
+	// the link to it is up and addressed
+	for _, route := range n.options.Routes {
+		if err := netns.AddRoute(n.run, ns, route); err != nil {
+			return err
+		}
+	}
+
+	keys := make([]string, 0, len(n.options.Sysctls))
+	for key := range n.options.Sysctls {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := netns.SetSysctl(n.run, ns, key, fmt.Sprint(n.options.Sysctls[key])); err != nil {
+			return err
+		}
+	}
+
+	if len(n.options.Nameservers) > 0 {
+		if err := netns.WriteResolvConf(n.run, ns, n.options.Nameservers); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Teardown deletes the namespace, which takes its veth pairs with it. A
+// namespace that no longer exists counts as already removed.
+func (n *NetnsNode) Teardown() error {
+	ns := n.namespace()
+	if len(n.options.Nameservers) > 0 {
+		if err := netns.RemoveNamespaceFiles(n.run, ns); err != nil {
+			return err
+		}
+	}
+	if err := netns.DeleteNamespace(n.run, ns); err != nil && !netns.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// Execute runs the command inside the namespace. Network probes run on
+// the node therefore see the namespace's routes, resolvers, and firewall
+// rather than the host's, which is the point of probing from a node.
+func (n *NetnsNode) Execute(command string, options ...execution.ExecutionOption) (result *execution.ExecutionResult, err error) {
+	return n.host.Execute(netns.ExecCommand(n.namespace(), command, n.options.Sudo), options...)
+}
+
+// NetworkFacts reports the namespace's addresses, so suites can reference
+// {{ fact "node" "ipv4" }} without a fact command.
+func (n *NetnsNode) NetworkFacts() (map[string]string, error) {
+	return netns.AddressFacts(n.run, n.namespace())
+}
+
+// Close has nothing to release: the namespace lifecycle is handled by
+// Setup/Teardown.
+func (n *NetnsNode) Close() error {
+	return nil
+}
+
+// validate checks the options without touching the host.
+func (o NetnsNodeOpts) validate() error {
+	if strings.ContainsAny(o.Namespace, "/ \t") {
+		return fmt.Errorf("namespace %q contains a character a namespace name cannot hold", o.Namespace)
+	}
+	seen := map[string]bool{}
+	for i, iface := range o.Interfaces {
+		name := iface.Name
+		if name == "" {
+			name = fmt.Sprintf("eth%d", i)
+		}
+		if err := netns.ValidateInterfaceName(name); err != nil {
+			return err
+		}
+		if seen[name] {
+			return fmt.Errorf("interface %q is declared twice", name)
+		}
+		seen[name] = true
+		if iface.Bridge == "" {
+			return fmt.Errorf("interface %q is missing bridge", name)
+		}
+		if iface.Address != "" {
+			if err := netns.ValidateAddress(iface.Address); err != nil {
+				return fmt.Errorf("interface %q: %w", name, err)
+			}
+		}
+	}
+	for _, route := range o.Routes {
+		if strings.TrimSpace(route) == "" {
+			return fmt.Errorf("a routes entry is empty")
+		}
+	}
+	for _, server := range o.Nameservers {
+		if net.ParseIP(server) == nil {
+			return fmt.Errorf("nameserver %q is not an IP address", server)
+		}
+	}
+	return nil
+}
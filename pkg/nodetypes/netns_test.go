@@ -0,0 +1,109 @@
+package nodetypes
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/bgrewell/dart/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestNetnsNode(t *testing.T, options map[string]interface{}) (*NetnsNode, *[]string) {
+	t.Helper()
+	node, err := NewNetnsNode("r1", &options, "")
+	require.NoError(t, err)
+	commands := &[]string{}
+	n := node.(*NetnsNode)
+	n.run = func(command string) (string, error) {
+		*commands = append(*commands, command)
+		return "", nil
+	}
+	return n, commands
+}
+
+func TestNetnsNodeSetupOrder(t *testing.T) {
+	n, commands := newTestNetnsNode(t, map[string]interface{}{
+		"interfaces": []interface{}{
+			map[string]interface{}{"bridge": "br-lab", "address": "10.10.0.2/24"},
+		},
+		"routes":  []interface{}{"default via 10.10.0.1"},
+		"sysctls": map[string]interface{}{"net.ipv4.ip_forward": 1},
+	})
+
+	require.NoError(t, n.Setup())
+	require.Len(t, *commands, 9)
+	assert.Equal(t, "ip netns add 'dart-r1'", (*commands)[0])
+	assert.Contains(t, (*commands)[2], "peer name 'eth0' netns 'dart-r1'")
+	// The route needs the link it goes through, so it follows the links
+	assert.Equal(t, "ip -n 'dart-r1' route add 'default' 'via' '10.10.0.1'", (*commands)[7])
+	assert.Equal(t, "ip netns exec 'dart-r1' sysctl -w 'net.ipv4.ip_forward=1'", (*commands)[8])
+}
+
+// Commands run inside the namespace, so a probe from the node sees the
+// namespace's routes and resolvers rather than the host's.
+func TestNetnsNodeExecuteRunsInsideNamespace(t *testing.T) {
+	n, _ := newTestNetnsNode(t, map[string]interface{}{"namespace": "lab-r1"})
+	host := NewMockNode()
+	host.SetResponse("ip netns exec 'lab-r1' sh -c 'ip route'", 0, "default via 10.10.0.1\n", "")
+	n.host = host
+
+	result, err := n.Execute("ip route")
+	require.NoError(t, err)
+	assert.Equal(t, 0, result.ExitCode)
+}
+
+func TestNetnsNodeTeardownToleratesMissingNamespace(t *testing.T) {
+	n, _ := newTestNetnsNode(t, nil)
+	n.run = func(command string) (string, error) {
+		return "", errors.New(`Cannot remove namespace file "/run/netns/dart-r1": No such file or directory`)
+	}
+	assert.NoError(t, n.Teardown())
+}
+
+func TestValidateNetnsOptions(t *testing.T) {
+	valid := &config.NodeConfig{Name: "r1", Type: "netns", Options: map[string]interface{}{
+		"interfaces":  []interface{}{map[string]interface{}{"bridge": "br-lab", "address": "10.10.0.2/24"}},
+		"nameservers": []interface{}{"10.10.0.53"},
+	}}
+	assert.NoError(t, ValidateNodeOptions(valid))
+
+	tests := []struct {
+		name    string
+		options map[string]interface{}
+		message string
+	}{
+		{"missing bridge", map[string]interface{}{
+			"interfaces": []interface{}{map[string]interface{}{"address": "10.10.0.2/24"}},
+		}, "missing bridge"},
+		{"address without prefix", map[string]interface{}{
+			"interfaces": []interface{}{map[string]interface{}{"bridge": "br-lab", "address": "10.10.0.2"}},
+		}, "CIDR"},
+		{"duplicate interface", map[string]interface{}{
+			"interfaces": []interface{}{
+				map[string]interface{}{"bridge": "br-lab", "name": "eth1"},
+				map[string]interface{}{"bridge": "br-wan"},
+			},
+		}, "declared twice"},
+		{"bad nameserver", map[string]interface{}{"nameservers": []interface{}{"dns.example.com"}}, "not an IP address"},
+		{"unknown option", map[string]interface{}{"route": []interface{}{"default via 10.0.0.1"}}, `unknown option "route"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateNodeOptions(&config.NodeConfig{Name: "r1", Type: "netns", Options: tt.options})
+			assert.ErrorContains(t, err, tt.message)
+		})
+	}
+}
+
+func TestValidateNodeSetChecksNetnsBridges(t *testing.T) {
+	nodes := []*config.NodeConfig{{Name: "r1", Type: "netns", Options: map[string]interface{}{
+		"interfaces": []interface{}{map[string]interface{}{"bridge": "br-wan"}},
+	}}}
+
+	err := ValidateNodeSet(nodes, NodeSetOptions{NetnsBridges: map[string]bool{"br-lab": true}})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `bridge "br-wan"`)
+
+	assert.NoError(t, ValidateNodeSet(nodes, NodeSetOptions{NetnsBridges: map[string]bool{"br-wan": true}}))
+}
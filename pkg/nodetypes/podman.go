@@ -0,0 +1,104 @@
+package nodetypes
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/bgrewell/dart/internal/docker"
+	"github.com/bgrewell/dart/internal/platform"
+	"github.com/bgrewell/dart/pkg/ifaces"
+)
+
+var _ ifaces.Node = &PodmanNode{}
+var _ ifaces.NetworkInspector = &PodmanNode{}
+
+// PodmanNodeOpts accepts every docker node option plus the Podman-only
+// ones. The container is created through Podman's Docker-compatible API,
+// so the shared options mean exactly what they mean for a docker node.
+type PodmanNodeOpts struct {
+	DockerNodeOpts
+	// Rootless states whether the Podman service runs unprivileged. Unset,
+	// it follows the socket DART connected to, or at --check the user
+	// running DART.
+	Rootless *bool `yaml:"rootless,omitempty" json:"rootless"`
+}
+
+func NewPodmanNode(wrapper *docker.Wrapper, name string, opts ifaces.NodeOptions, suiteDir string) (node ifaces.Node, err error) {
+
+	jsonData, err := json.Marshal(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var nodeopts PodmanNodeOpts
+	err = json.Unmarshal(jsonData, &nodeopts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PodmanNode{
+		DockerNode: &DockerNode{
+			name:     name,
+			wrapper:  wrapper,
+			options:  nodeopts.DockerNodeOpts,
+			suiteDir: suiteDir,
+		},
+		rootless: nodeopts.Rootless,
+	}, nil
+}
+
+// PodmanNode is a docker node pinned to Podman. Setup refuses to run
+// against a Docker daemon, so a suite written for Podman's behavior never
+// silently passes or fails on the other engine.
+type PodmanNode struct {
+	*DockerNode
+	rootless *bool
+}
+
+func (p *PodmanNode) Setup() error {
+	if p.wrapper.Runtime() != platform.RuntimePodman {
+		return fmt.Errorf("podman node %s: the container API in use is served by %s, not Podman; point docker.socket or DOCKER_HOST at the Podman socket",
+			p.name, p.wrapper.Runtime())
+	}
+	if p.isRootless() {
+		if err := validateRootlessPorts(p.options.Ports); err != nil {
+			return fmt.Errorf("podman node %s: %w", p.name, err)
+		}
+	}
+	return p.DockerNode.Setup()
+}
+
+// isRootless prefers the suite's explicit setting over what the wrapper
+// inferred from the socket path.
+func (p *PodmanNode) isRootless() bool {
+	if p.rootless != nil {
+		return *p.rootless
+	}
+	return p.wrapper.Rootless()
+}
+
+// validateRootlessPorts rejects host ports a rootless runtime cannot bind.
+// Podman only reports it when the container starts, as a bind error that
+// does not mention rootless mode at all.
+func validateRootlessPorts(ports []string) error {
+	privileged, err := docker.PrivilegedHostPorts(ports)
+	if err != nil {
+		return err
+	}
+	if len(privileged) > 0 {
+		return fmt.Errorf("ports %s bind host ports below 1024, which rootless Podman cannot do: use a host port of 1024 or above, or set rootless: false for a rootful Podman service",
+			strings.Join(privileged, ", "))
+	}
+	return nil
+}
+
+// rootlessAtCheck is the --check default when the suite does not say:
+// nothing is contacted, so the best evidence is who is running DART.
+func rootlessAtCheck(opts PodmanNodeOpts) bool {
+	if opts.Rootless != nil {
+		return *opts.Rootless
+	}
+	return os.Geteuid() != 0
+}
@@ -0,0 +1,73 @@
+package nodetypes
+
+import (
+	"testing"
+
+	"github.com/bgrewell/dart/internal/config"
+	"github.com/bgrewell/dart/internal/docker"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Rootless Podman cannot bind host ports below 1024 and only says so when
+// the container starts, as a bind error that never mentions rootless mode.
+func TestValidatePodmanRejectsPrivilegedPortsWhenRootless(t *testing.T) {
+	err := ValidateNodeOptions(&config.NodeConfig{
+		Name: "web", Type: "podman",
+		Options: map[string]interface{}{
+			"image":    "nginx:alpine",
+			"ports":    []interface{}{"8080:80", "443:443/tcp"},
+			"rootless": true,
+		},
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "443:443/tcp")
+	assert.Contains(t, err.Error(), "rootless Podman")
+	assert.NotContains(t, err.Error(), "8080:80", "an unprivileged port is not the problem")
+}
+
+func TestValidatePodmanAllowsPrivilegedPortsWhenRootful(t *testing.T) {
+	err := ValidateNodeOptions(&config.NodeConfig{
+		Name: "web", Type: "podman",
+		Options: map[string]interface{}{
+			"image":    "nginx:alpine",
+			"ports":    []interface{}{"80:80", "127.0.0.1::53/udp"},
+			"rootless": false,
+		},
+	})
+	assert.NoError(t, err)
+}
+
+// A podman node takes the docker options; anything else is still a typo.
+func TestValidatePodmanAcceptsDockerOptions(t *testing.T) {
+	err := ValidateNodeOptions(&config.NodeConfig{
+		Name: "web", Type: "podman",
+		Options: map[string]interface{}{
+			"image": "alpine:3.20", "command": []interface{}{"sleep", "infinity"},
+			"capabilities": []interface{}{"NET_ADMIN"}, "rootless": true,
+		},
+	})
+	require.NoError(t, err)
+
+	err = ValidateNodeOptions(&config.NodeConfig{
+		Name: "web", Type: "podman",
+		Options: map[string]interface{}{"image": "alpine:3.20", "rootles": true},
+	})
+	assert.ErrorContains(t, err, `unknown option "rootles"`)
+
+	err = ValidateNodeOptions(&config.NodeConfig{
+		Name: "web", Type: "podman", Options: map[string]interface{}{},
+	})
+	assert.ErrorContains(t, err, "image is required")
+}
+
+// A suite pinned to Podman must not quietly run its containers on a
+// Docker daemon that happens to answer the API.
+func TestPodmanNodeRefusesDockerRuntime(t *testing.T) {
+	node, err := NewPodmanNode(&docker.Wrapper{}, "web", &map[string]interface{}{"image": "alpine:3.20"}, "")
+	require.NoError(t, err)
+
+	err = node.Setup()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "not Podman")
+}
@@ -0,0 +1,291 @@
+package nodetypes
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bgrewell/dart/internal/config"
+	"github.com/bgrewell/dart/internal/execution"
+	"github.com/bgrewell/dart/internal/helpers"
+	"github.com/bgrewell/dart/internal/rootfs"
+	"github.com/bgrewell/dart/internal/runlabel"
+	"github.com/bgrewell/dart/pkg/ifaces"
+)
+
+var _ ifaces.Node = &RootfsNode{}
+var _ ifaces.Snapshotter = &RootfsNode{}
+
+// defaultRootfsWorkdir holds the per-run copies. /var/tmp rather than /tmp:
+// a root filesystem is large, and /tmp is often memory-backed.
+const defaultRootfsWorkdir = "/var/tmp/dart-rootfs"
+
+type RootfsNodeOpts struct {
+	// Rootfs is the source tree: a directory or a tar archive, resolved
+	// against the suite directory. It is never modified.
+	Rootfs string `yaml:"rootfs,omitempty" json:"rootfs"`
+	// Engine is auto (systemd-nspawn when installed, chroot otherwise),
+	// nspawn, or chroot.
+	Engine string `yaml:"engine,omitempty" json:"engine"`
+	// Boot runs the tree's init under systemd-nspawn and enters the running
+	// machine for each command, for tests that need services. nspawn only.
+	Boot bool `yaml:"boot,omitempty" json:"boot"`
+	// BootTimeout is the seconds to wait for a booted machine to accept
+	// commands. Defaults to 60.
+	BootTimeout int `yaml:"boot_timeout,omitempty" json:"boot_timeout"`
+	// Workdir holds the per-run copy and its snapshots
+	Workdir string `yaml:"workdir,omitempty" json:"workdir"`
+	// Sudo runs the host-side commands through `sudo -n` when DART is not
+	// itself root
+	Sudo bool `yaml:"sudo,omitempty" json:"sudo"`
+}
+
+func NewRootfsNode(name string, opts ifaces.NodeOptions, suiteDir string) (node ifaces.Node, err error) {
+
+	jsonData, err := json.Marshal(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var nodeopts RootfsNodeOpts
+	err = json.Unmarshal(jsonData, &nodeopts)
+	if err != nil {
+		return nil, err
+	}
+
+	source, err := config.ResolveLocalPath(suiteDir, nodeopts.Rootfs)
+	if err != nil {
+		return nil, fmt.Errorf("rootfs: %w", err)
+	}
+	engine, _ := rootfs.ParseEngine(nodeopts.Engine)
+
+	return &RootfsNode{
+		name:    name,
+		options: nodeopts,
+		source:  source,
+		engine:  engine,
+		run:     helpers.NewHostRunner(nodeopts.Sudo),
+		host:    NewLocalNode(name, nil, suiteDir),
+	}, nil
+}
+
+// RootfsNode is a root filesystem entered with systemd-nspawn or chroot.
+// Setup copies the source into a per-run directory, so the source stays
+// pristine and every run starts from the same tree.
+type RootfsNode struct {
+	name    string
+	options RootfsNodeOpts
+	source  string
+	engine  rootfs.Engine
+	run     helpers.HostRunner
+	host    ifaces.Node
+}
+
+// machine is the systemd machine name, also naming the per-run directory.
+// It is scoped by the run ID, so concurrent runs of one suite never share
+// a tree.
+func (r *RootfsNode) machine() string {
+	return rootfs.MachineName(runlabel.Current().Scoped(r.name))
+}
+
+// dir holds the copy and its snapshots. The path is derived from the node
+// name and run ID, so a teardown-only run given --run-id finds it.
+func (r *RootfsNode) dir() string {
+	workdir := r.options.Workdir
+	if workdir == "" {
+		workdir = defaultRootfsWorkdir
+	}
+	return filepath.Join(workdir, r.machine())
+}
+
+func (r *RootfsNode) root() string {
+	return filepath.Join(r.dir(), "rootfs")
+}
+
+func (r *RootfsNode) snapshotPath(name string) string {
+	return filepath.Join(r.dir(), "snapshots", name)
+}
+
+// resolvedEngine settles auto on first use, so a teardown-only run that
+// never ran Setup still enters the tree the same way.
+func (r *RootfsNode) resolvedEngine() rootfs.Engine {
+	if r.engine == rootfs.EngineAuto || r.engine == "" {
+		r.engine = rootfs.DetectEngine(r.run)
+	}
+	return r.engine
+}
+
+func (r *RootfsNode) bootTimeout() time.Duration {
+	if r.options.BootTimeout > 0 {
+		return time.Duration(r.options.BootTimeout) * time.Second
+	}
+	return 60 * time.Second
+}
+
+func (r *RootfsNode) Setup() error {
+	engine := r.resolvedEngine()
+	if r.options.Boot && engine != rootfs.EngineNspawn {
+		return fmt.Errorf("rootfs node %s: boot requires systemd-nspawn, which is not installed on this host", r.name)
+	}
+
+	// A previous run with this run ID that died before teardown leaves its
+	// copy behind; starting from it would not be starting from the source.
+	// A booted machine on it means that run is still alive.
+	if rootfs.Exists(r.run, r.dir()) {
+		if r.options.Boot && rootfs.MachineRunning(r.run, r.machine()) {
+			return fmt.Errorf("rootfs node %s: machine %s is still running on %s; another run is using this run ID", r.name, r.machine(), r.dir())
+		}
+		if err := r.release(); err != nil {
+			return err
+		}
+	}
+
+	if err := rootfs.Prepare(r.run, r.source, r.root()); err != nil {
+		return err
+	}
+	return r.start()
+}
+
+// start makes the prepared tree usable: API filesystems for a chroot, a
+// running init for a booted machine. Plain nspawn needs neither.
+func (r *RootfsNode) start() error {
+	if r.options.Boot {
+		if err := rootfs.Boot(r.run, r.root(), r.machine()); err != nil {
+			return err
+		}
+		return rootfs.WaitForBoot(r.run, r.machine(), r.bootTimeout(), time.Second)
+	}
+	if r.resolvedEngine() == rootfs.EngineChroot {
+		return rootfs.MountAPI(r.run, r.root())
+	}
+	return nil
+}
+
+// stop undoes start. Both halves tolerate nothing running or mounted.
+func (r *RootfsNode) stop() error {
+	if r.options.Boot {
+		if err := rootfs.Terminate(r.run, r.machine(), r.bootTimeout()); err != nil {
+			return err
+		}
+	}
+	return rootfs.UnmountAPI(r.run, r.root())
+}
+
+// release stops whatever uses the tree and deletes the run's directory.
+func (r *RootfsNode) release() error {
+	if err := r.stop(); err != nil {
+		return err
+	}
+	return rootfs.Remove(r.run, r.dir())
+}
+
+// Teardown stops the machine, unmounts, and deletes the per-run copy and
+// its snapshots. A directory that no longer exists counts as removed.
+func (r *RootfsNode) Teardown() error {
+	return r.release()
+}
+
+// Execute runs the command inside the tree.
+func (r *RootfsNode) Execute(command string, options ...execution.ExecutionOption) (result *execution.ExecutionResult, err error) {
+	wrapped := rootfs.ExecCommand(r.resolvedEngine(), r.root(), r.machine(), r.options.Boot, command, r.options.Sudo)
+	return r.host.Execute(wrapped, options...)
+}
+
+// Snapshot copies the tree. A booted machine is copied live, like a
+// stateless LXD snapshot of a running instance.
+func (r *RootfsNode) Snapshot(name string, stateful bool) error {
+	if err := validateRootfsSnapshot(name, stateful); err != nil {
+		return err
+	}
+	if rootfs.Exists(r.run, r.snapshotPath(name)) {
+		return fmt.Errorf("snapshot %s already exists on node %s", name, r.name)
+	}
+	return rootfs.Copy(r.run, r.root(), r.snapshotPath(name))
+}
+
+// RestoreSnapshot replaces the tree with the snapshot's copy, stopping and
+// restarting whatever uses it, and blocks until a booted machine accepts
+// commands again.
+func (r *RootfsNode) RestoreSnapshot(name string, stateful bool) error {
+	if err := validateRootfsSnapshot(name, stateful); err != nil {
+		return err
+	}
+	if !rootfs.Exists(r.run, r.snapshotPath(name)) {
+		return fmt.Errorf("snapshot %s does not exist on node %s", name, r.name)
+	}
+	if err := r.stop(); err != nil {
+		return err
+	}
+	if err := rootfs.Remove(r.run, r.root()); err != nil {
+		return err
+	}
+	if err := rootfs.Copy(r.run, r.snapshotPath(name), r.root()); err != nil {
+		return err
+	}
+	return r.start()
+}
+
+// DeleteSnapshot removes a snapshot's copy; one that no longer exists
+// counts as deleted.
+func (r *RootfsNode) DeleteSnapshot(name string) error {
+	if err := validateRootfsSnapshot(name, false); err != nil {
+		return err
+	}
+	return rootfs.Remove(r.run, r.snapshotPath(name))
+}
+
+// validateRootfsSnapshot rejects what a directory copy cannot honour. The
+// name becomes a path component, so it must not walk out of the snapshot
+// directory.
+func validateRootfsSnapshot(name string, stateful bool) error {
+	if stateful {
+		return fmt.Errorf("rootfs nodes support only stateless snapshots: a directory copy cannot hold running memory")
+	}
+	if name == "" || name == "." || name == ".." || strings.ContainsRune(name, '/') {
+		return fmt.Errorf("snapshot name %q cannot be used as a directory name", name)
+	}
+	return nil
+}
+
+// Close has nothing to release: the tree's lifecycle is handled by
+// Setup/Teardown.
+func (r *RootfsNode) Close() error {
+	return nil
+}
+
+// validate checks the options and that the source exists, without
+// touching anything.
+func (o RootfsNodeOpts) validate(suiteDir string) error {
+	if o.Rootfs == "" {
+		return fmt.Errorf("rootfs is required")
+	}
+	source, err := config.ResolveLocalPath(suiteDir, o.Rootfs)
+	if err != nil {
+		return fmt.Errorf("rootfs: %w", err)
+	}
+	info, err := os.Stat(source)
+	if err != nil {
+		return fmt.Errorf("rootfs %s: %w", o.Rootfs, err)
+	}
+	if !info.IsDir() && !rootfs.IsTarball(source) {
+		return fmt.Errorf("rootfs %s must be a directory or a tar archive (.tar, .tar.gz, .tgz, .tar.xz, .tar.bz2, .tar.zst)", o.Rootfs)
+	}
+
+	engine, ok := rootfs.ParseEngine(o.Engine)
+	if !ok {
+		return fmt.Errorf("engine must be auto, nspawn, or chroot (got %q)", o.Engine)
+	}
+	if o.Boot && engine == rootfs.EngineChroot {
+		return fmt.Errorf("boot requires engine nspawn: a chroot has no init to boot")
+	}
+	if o.BootTimeout < 0 {
+		return fmt.Errorf("boot_timeout must not be negative")
+	}
+	if o.Workdir != "" && !filepath.IsAbs(o.Workdir) {
+		return fmt.Errorf("workdir must be an absolute path (got %q)", o.Workdir)
+	}
+	return nil
+}
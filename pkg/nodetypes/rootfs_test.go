@@ -0,0 +1,125 @@
+package nodetypes
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bgrewell/dart/internal/runlabel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestRootfsNode builds a node whose host commands are recorded rather
+// than run. Commands listed in fail return an error.
+func newTestRootfsNode(t *testing.T, options map[string]interface{}, fail map[string]bool) (*RootfsNode, *[]string) {
+	t.Helper()
+	_, err := runlabel.Start("rootfs", "t1")
+	require.NoError(t, err)
+	node, err := NewRootfsNode("pkg", &options, "/suite")
+	require.NoError(t, err)
+	commands := &[]string{}
+	r := node.(*RootfsNode)
+	r.run = func(command string) (string, error) {
+		*commands = append(*commands, command)
+		if fail[command] {
+			return "", errors.New("exit status 1")
+		}
+		return "", nil
+	}
+	return r, commands
+}
+
+func TestRootfsNodeChrootSetupMountsAPI(t *testing.T) {
+	r, commands := newTestRootfsNode(t, map[string]interface{}{
+		"rootfs": "images/debian.tar", "engine": "chroot", "workdir": "/w",
+	}, map[string]bool{"test -e '/w/dart-pkg-t1'": true})
+
+	require.NoError(t, r.Setup())
+	require.Len(t, *commands, 5)
+	assert.Equal(t, "mkdir -p '/w/dart-pkg-t1/rootfs' && tar --numeric-owner -xpf '/suite/images/debian.tar' -C '/w/dart-pkg-t1/rootfs'", (*commands)[1])
+	assert.Equal(t, "mkdir -p '/w/dart-pkg-t1/rootfs/proc' && mount -t proc proc '/w/dart-pkg-t1/rootfs/proc'", (*commands)[2])
+}
+
+// A copy left by a run that died before teardown is discarded, so every
+// run starts from the source.
+func TestRootfsNodeSetupDiscardsStaleCopy(t *testing.T) {
+	r, commands := newTestRootfsNode(t, map[string]interface{}{
+		"rootfs": "/images/debian", "engine": "nspawn", "workdir": "/w",
+	}, nil)
+
+	require.NoError(t, r.Setup())
+	assert.Contains(t, *commands, "rm -rf --one-file-system '/w/dart-pkg-t1'")
+	assert.Equal(t, "mkdir -p '/w/dart-pkg-t1' && cp -a --reflink=auto '/images/debian/.' '/w/dart-pkg-t1/rootfs'", (*commands)[len(*commands)-1])
+}
+
+// A booted machine on the existing tree belongs to a live run; its tree is
+// refused rather than deleted.
+func TestRootfsNodeSetupRefusesRunningMachine(t *testing.T) {
+	r, commands := newTestRootfsNode(t, map[string]interface{}{
+		"rootfs": "/images/debian", "engine": "nspawn", "boot": true, "workdir": "/w",
+	}, nil)
+
+	assert.ErrorContains(t, r.Setup(), "machine dart-pkg-t1 is still running")
+	for _, command := range *commands {
+		assert.NotContains(t, command, "rm -rf")
+		assert.NotContains(t, command, "machinectl terminate")
+	}
+}
+
+func TestRootfsNodeExecuteEntersTree(t *testing.T) {
+	r, _ := newTestRootfsNode(t, map[string]interface{}{
+		"rootfs": "/images/debian", "engine": "nspawn", "workdir": "/w",
+	}, nil)
+	host := NewMockNode()
+	host.SetResponse("systemd-nspawn --quiet --register=no --console=pipe -D '/w/dart-pkg-t1/rootfs' /bin/sh -c 'dpkg -l'", 0, "", "")
+	r.host = host
+
+	result, err := r.Execute("dpkg -l")
+	require.NoError(t, err)
+	assert.Equal(t, 0, result.ExitCode)
+}
+
+func TestRootfsNodeRestoreReplacesTree(t *testing.T) {
+	r, commands := newTestRootfsNode(t, map[string]interface{}{
+		"rootfs": "/images/debian", "engine": "chroot", "workdir": "/w",
+	}, nil)
+
+	require.NoError(t, r.RestoreSnapshot("clean", false))
+	assert.Contains(t, *commands, "rm -rf --one-file-system '/w/dart-pkg-t1/rootfs'")
+	assert.Contains(t, *commands, "mkdir -p '/w/dart-pkg-t1' && cp -a -x --reflink=auto '/w/dart-pkg-t1/snapshots/clean' '/w/dart-pkg-t1/rootfs'")
+	// The chroot gets its API filesystems back
+	assert.Equal(t, "mkdir -p '/w/dart-pkg-t1/rootfs/dev' && mount --bind /dev '/w/dart-pkg-t1/rootfs/dev'", (*commands)[len(*commands)-1])
+}
+
+func TestRootfsNodeRejectsStatefulAndUnsafeSnapshots(t *testing.T) {
+	r, commands := newTestRootfsNode(t, map[string]interface{}{"rootfs": "/images/debian"}, nil)
+
+	assert.Error(t, r.Snapshot("clean", true))
+	assert.Error(t, r.Snapshot("../escape", false))
+	assert.Error(t, r.DeleteSnapshot(".."))
+	assert.Empty(t, *commands)
+}
+
+func TestRootfsNodeOptsValidate(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "tree"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "debian.tar.xz"), nil, 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "notes.txt"), nil, 0o644))
+
+	assert.NoError(t, RootfsNodeOpts{Rootfs: "tree"}.validate(dir))
+	assert.NoError(t, RootfsNodeOpts{Rootfs: "debian.tar.xz", Engine: "nspawn", Boot: true}.validate(dir))
+
+	for name, opts := range map[string]RootfsNodeOpts{
+		"missing rootfs":   {},
+		"absent source":    {Rootfs: "gone"},
+		"not an archive":   {Rootfs: "notes.txt"},
+		"unknown engine":   {Rootfs: "tree", Engine: "docker"},
+		"boot in a chroot": {Rootfs: "tree", Engine: "chroot", Boot: true},
+		"negative timeout": {Rootfs: "tree", BootTimeout: -1},
+		"relative workdir": {Rootfs: "tree", Workdir: "tmp"},
+	} {
+		assert.Error(t, opts.validate(dir), name)
+	}
+}
@@ -3,17 +3,20 @@ package nodetypes
 import (
 	"encoding/json"
 	"fmt"
+	"net"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 
-	dartconfig "github.com/bgrewell/dart/internal/config"
 	"github.com/bgrewell/dart/internal/execution"
 	"github.com/bgrewell/dart/internal/helpers"
 	"github.com/bgrewell/dart/internal/stream"
 	"github.com/bgrewell/dart/pkg/ifaces"
+	"github.com/pkg/sftp"
 	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
 	"golang.org/x/crypto/ssh/knownhosts"
 )
 
@@ -33,8 +36,32 @@ type SshNodeOpts struct {
 	KnownHosts          string `yaml:"known_hosts,omitempty" json:"known_hosts"`
 	InsecureSkipHostKey bool   `yaml:"insecure_skip_host_key,omitempty" json:"insecure_skip_host_key"`
 	// Bastion routes the connection through a jump host, for lab networks
-	// where targets are not directly reachable.
+	// where targets are not directly reachable. A bastion may have its own
+	// bastion, to any depth.
 	Bastion *SshBastionOpts `yaml:"bastion,omitempty" json:"bastion"`
+	// KeyPassphrase decrypts a passphrase-protected key
+	KeyPassphrase *SshSecretOpts `yaml:"key_passphrase,omitempty" json:"key_passphrase"`
+	// Agent authenticates with the keys held by the agent at SSH_AUTH_SOCK;
+	// ForwardAgent also makes that agent available to commands on the node
+	Agent        bool `yaml:"agent,omitempty" json:"agent"`
+	ForwardAgent bool `yaml:"forward_agent,omitempty" json:"forward_agent"`
+	// SshConfig is the OpenSSH client configuration consulted for the
+	// host. Empty means ~/.ssh/config when it exists; "none" disables it.
+	SshConfig string `yaml:"ssh_config,omitempty" json:"ssh_config"`
+
+	// Resolved by prepareSshNodeOpts
+	identityFiles []string
+	passphrase    string
+}
+
+func (o SshNodeOpts) credentials() sshCredentials {
+	return sshCredentials{
+		keyFile:       o.KeyFile,
+		identityFiles: o.identityFiles,
+		passphrase:    o.passphrase,
+		password:      o.Pass,
+		agent:         o.Agent,
+	}
 }
 
 // SshBastionOpts describes the jump host used to reach a node.
@@ -50,10 +77,27 @@ type SshBastionOpts struct {
 	// relax it for the bastion.
 	KnownHosts          string `yaml:"known_hosts,omitempty" json:"known_hosts"`
 	InsecureSkipHostKey *bool  `yaml:"insecure_skip_host_key,omitempty" json:"insecure_skip_host_key"`
-	// Bastion is rejected rather than ignored: chained jump hosts are not
-	// supported, and silently dropping the inner hop would connect
-	// somewhere the suite did not intend.
-	Bastion *SshBastionOpts `yaml:"bastion,omitempty" json:"bastion"`
+	// Bastion is the jump host this bastion is itself reached through,
+	// for targets behind more than one jump host. The innermost bastion
+	// is dialled first.
+	Bastion       *SshBastionOpts `yaml:"bastion,omitempty" json:"bastion"`
+	KeyPassphrase *SshSecretOpts  `yaml:"key_passphrase,omitempty" json:"key_passphrase"`
+	// Agent is inherited from the target when unset
+	Agent *bool `yaml:"agent,omitempty" json:"agent"`
+
+	// Resolved by prepareSshNodeOpts
+	identityFiles []string
+	passphrase    string
+}
+
+func (o SshBastionOpts) credentials() sshCredentials {
+	return sshCredentials{
+		keyFile:       o.KeyFile,
+		identityFiles: o.identityFiles,
+		passphrase:    o.passphrase,
+		password:      o.Pass,
+		agent:         o.Agent != nil && *o.Agent,
+	}
 }
 
 func NewSshNode(name string, opts ifaces.NodeOptions, suiteDir string) (node ifaces.Node, err error) {
@@ -69,36 +113,37 @@ func NewSshNode(name string, opts ifaces.NodeOptions, suiteDir string) (node ifa
 		return nil, err
 	}
 
-	if nodeopts.Port == 0 {
-		nodeopts.Port = 22
+	nodeopts, err = prepareSshNodeOpts(nodeopts, suiteDir)
+	if err != nil {
+		return nil, err
 	}
-
 	addr := fmt.Sprintf("%s:%d", nodeopts.Host, nodeopts.Port)
 
-	// Credential paths belong to the machine running DART, so they follow
-	// the suite-relative rule like every other local path
-	if nodeopts.KeyFile, err = dartconfig.ResolveLocalPath(suiteDir, nodeopts.KeyFile); err != nil {
-		return nil, err
-	}
-	if nodeopts.KnownHosts, err = dartconfig.ResolveLocalPath(suiteDir, nodeopts.KnownHosts); err != nil {
-		return nil, err
-	}
-	if nodeopts.Bastion != nil {
-		if nodeopts.Bastion.KeyFile, err = dartconfig.ResolveLocalPath(suiteDir, nodeopts.Bastion.KeyFile); err != nil {
-			return nil, err
+	// One agent connection serves authentication, the bastions, and
+	// forwarding for the node's lifetime
+	var agentClient agent.ExtendedAgent
+	var agentConn net.Conn
+	if nodeopts.Agent || nodeopts.ForwardAgent || chainUsesAgent(nodeopts.Bastion) {
+		agentClient, agentConn, err = dialAgent()
+		if err != nil {
+			return nil, fmt.Errorf("node %q: %w", name, err)
 		}
-		if nodeopts.Bastion.KnownHosts, err = dartconfig.ResolveLocalPath(suiteDir, nodeopts.Bastion.KnownHosts); err != nil {
-			return nil, err
+	}
+	closeAgent := func() {
+		if agentConn != nil {
+			agentConn.Close()
 		}
 	}
 
-	authMethods, err := sshAuthMethods(nodeopts.KeyFile, nodeopts.Pass)
+	authMethods, err := sshAuthMethods(nodeopts.credentials(), agentClient)
 	if err != nil {
+		closeAgent()
 		return nil, err
 	}
 
 	hostKeyCallback, err := hostKeyCallbackFor(nodeopts.KnownHosts, nodeopts.InsecureSkipHostKey)
 	if err != nil {
+		closeAgent()
 		return nil, err
 	}
 
@@ -110,80 +155,77 @@ func NewSshNode(name string, opts ifaces.NodeOptions, suiteDir string) (node ifa
 		HostKeyCallback: hostKeyCallback,
 	}
 
-	// Dial the target, optionally through a bastion
-	var client *ssh.Client
-	var bastionClient *ssh.Client
-	if nodeopts.Bastion != nil {
-		bastionClient, err = dialBastion(nodeopts.Bastion, nodeopts.KnownHosts, nodeopts.InsecureSkipHostKey)
-		if err != nil {
-			return nil, err
-		}
-		conn, err := bastionClient.Dial("tcp", addr)
-		if err != nil {
-			bastionClient.Close()
-			return nil, fmt.Errorf("bastion could not reach %s: %w", addr, err)
+	s := &SshNode{
+		name:         name,
+		config:       config,
+		address:      addr,
+		bastionChain: resolveBastionChain(nodeopts.Bastion, nodeopts.KnownHosts, nodeopts.InsecureSkipHostKey),
+		agent:        agentClient,
+		agentConn:    agentConn,
+		forwardAgent: nodeopts.ForwardAgent,
+	}
+
+	// Dial the target, through every bastion in the chain
+	s.client, err = s.redial()
+	if err != nil {
+		closeAgent()
+		return nil, err
+	}
+	return s, nil
+}
+
+// validateSshNodeOpts checks the connection options without dialling,
+// for --check.
+func validateSshNodeOpts(opts SshNodeOpts, suiteDir string) error {
+	// Without a host the dial goes to ":22" and fails mid-run with a
+	// connection error that says nothing about the real mistake
+	if opts.Host == "" {
+		return fmt.Errorf("host is required")
+	}
+	opts, err := prepareSshNodeOpts(opts, suiteDir)
+	if err != nil {
+		return err
+	}
+	if _, err := sshAuthMethods(opts.credentials(), nil); err != nil {
+		return err
+	}
+	if opts.ForwardAgent && os.Getenv("SSH_AUTH_SOCK") == "" {
+		return fmt.Errorf("forward_agent is set but SSH_AUTH_SOCK is not set")
+	}
+	if _, err := hostKeyCallbackFor(opts.KnownHosts, opts.InsecureSkipHostKey); err != nil {
+		return err
+	}
+	hops := resolveBastionChain(opts.Bastion, opts.KnownHosts, opts.InsecureSkipHostKey)
+	for _, hop := range hops {
+		if err := hop.requireHost(); err != nil {
+			return err
 		}
-		ncc, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
-		if err != nil {
-			bastionClient.Close()
-			return nil, fmt.Errorf("ssh handshake with %s via bastion failed: %w", addr, err)
+		if _, err := sshAuthMethods(hop.opts.credentials(), nil); err != nil {
+			return fmt.Errorf("%s: %w", hop.label, err)
 		}
-		client = ssh.NewClient(ncc, chans, reqs)
-	} else {
-		client, err = ssh.Dial("tcp", addr, config)
-		if err != nil {
-			return nil, describeSSHDialError(name, addr, err)
+		if _, err := hostKeyCallbackFor(hop.knownHosts, hop.insecure); err != nil {
+			return fmt.Errorf("%s: %w", hop.label, err)
 		}
 	}
-
-	// Return the new ssh node
-	return &SshNode{
-		name:                name,
-		config:              config,
-		client:              client,
-		address:             addr,
-		bastion:             bastionClient,
-		bastions:            nodeopts.Bastion,
-		knownHosts:          nodeopts.KnownHosts,
-		insecureSkipHostKey: nodeopts.InsecureSkipHostKey,
-	}, nil
+	return nil
 }
 
-// describeSSHDialError names the node and address, and points at the
-// host-key options when verification is what failed — the bare library
-// error ("knownhosts: key mismatch") says neither which node nor what to
-// do about it.
-func describeSSHDialError(nodeName, addr string, err error) error {
+// describeSSHDialError names the node or bastion hop and the address, and
+// points at the host-key options when verification is what failed — the
+// bare library error ("knownhosts: key mismatch") says neither which hop
+// nor what to do about it.
+func describeSSHDialError(who, addr string, err error) error {
 	message := err.Error()
 	switch {
 	case strings.Contains(message, "knownhosts: key is unknown"):
-		return fmt.Errorf("node %q: host key for %s is not in known_hosts: %w (add it, set known_hosts: <path>, or set insecure_skip_host_key: true)", nodeName, addr, err)
+		return fmt.Errorf("%s: host key for %s is not in known_hosts: %w (add it, set known_hosts: <path>, or set insecure_skip_host_key: true)", who, addr, err)
 	case strings.Contains(message, "knownhosts: key mismatch"):
-		return fmt.Errorf("node %q: host key for %s does not match known_hosts: %w (the host was rebuilt or the connection is being intercepted; update known_hosts deliberately)", nodeName, addr, err)
+		return fmt.Errorf("%s: host key for %s does not match known_hosts: %w (the host was rebuilt or the connection is being intercepted; update known_hosts deliberately)", who, addr, err)
 	default:
-		return fmt.Errorf("node %q: cannot connect to %s: %w", nodeName, addr, err)
+		return fmt.Errorf("%s: cannot connect to %s: %w", who, addr, err)
 	}
 }
 
-// sshAuthMethods builds the auth chain from a key file and/or password.
-func sshAuthMethods(keyFile, password string) ([]ssh.AuthMethod, error) {
-	methods := []ssh.AuthMethod{}
-	if keyFile != "" {
-		signer, err := readPrivateKey(expandUser(keyFile))
-		if err != nil {
-			return nil, err
-		}
-		methods = append(methods, ssh.PublicKeys(signer))
-	}
-	if password != "" {
-		methods = append(methods, ssh.Password(password))
-	}
-	if len(methods) == 0 {
-		return nil, fmt.Errorf("no ssh credentials configured: set key or pass")
-	}
-	return methods, nil
-}
-
 // hostKeyCallbackFor resolves host-key verification. Verification is the
 // default: an unverifiable host is an error unless the suite explicitly
 // opts out, so a tool holding credentials cannot silently trust any key.
@@ -211,50 +253,142 @@ func hostKeyCallbackFor(knownHosts string, insecure bool) (ssh.HostKeyCallback,
 	return callback, nil
 }
 
-// dialBastion connects to the jump host, reusing the node's host-key
-// policy so the bastion is verified on the same terms as the target.
-func dialBastion(opts *SshBastionOpts, knownHosts string, insecure bool) (*ssh.Client, error) {
-	if opts.Host == "" {
-		return nil, fmt.Errorf("bastion host is required")
+// bastionHop is one jump host with the host-key policy it is verified
+// under and how errors name it.
+type bastionHop struct {
+	opts       *SshBastionOpts
+	address    string
+	knownHosts string
+	insecure   bool
+	label      string
+}
+
+// resolveBastionChain flattens nested bastions into dial order, innermost
+// first. Each hop's own host-key policy wins when set; otherwise it
+// inherits the policy of the hop it leads to, and the hop next to the
+// target inherits the target's — so relaxing verification for an
+// ephemeral target does not relax it for the long-lived jump hosts.
+func resolveBastionChain(first *SshBastionOpts, knownHosts string, insecure bool) []bastionHop {
+	var hops []bastionHop
+	for b := first; b != nil; b = b.Bastion {
+		if b.KnownHosts != "" {
+			knownHosts = b.KnownHosts
+		}
+		if b.InsecureSkipHostKey != nil {
+			insecure = *b.InsecureSkipHostKey
+		}
+		port := b.Port
+		if port == 0 {
+			port = 22
+		}
+		hops = append(hops, bastionHop{
+			opts:       b,
+			address:    fmt.Sprintf("%s:%d", b.Host, port),
+			knownHosts: knownHosts,
+			insecure:   insecure,
+		})
+	}
+	slices.Reverse(hops)
+	for i := range hops {
+		host := hops[i].opts.Host
+		switch {
+		case len(hops) == 1 && host == "":
+			hops[i].label = "bastion"
+		case len(hops) == 1:
+			hops[i].label = "bastion " + host
+		case host == "":
+			hops[i].label = fmt.Sprintf("bastion hop %d of %d", i+1, len(hops))
+		default:
+			hops[i].label = fmt.Sprintf("bastion hop %d of %d (%s)", i+1, len(hops), host)
+		}
 	}
-	if opts.Bastion != nil {
-		return nil, fmt.Errorf("chained bastions are not supported: remove the nested bastion block")
+	return hops
+}
+
+// requireHost reports a hop without a host, which would otherwise dial
+// ":22" and fail with an error that says nothing about the mistake.
+func (h bastionHop) requireHost() error {
+	if h.opts.Host != "" {
+		return nil
 	}
-	port := opts.Port
-	if port == 0 {
-		port = 22
+	if h.label == "bastion" {
+		return fmt.Errorf("bastion host is required")
 	}
+	return fmt.Errorf("%s: host is required", h.label)
+}
 
-	// The bastion's own policy wins when set; otherwise it inherits the
-	// target's
-	bastionKnownHosts := knownHosts
-	if opts.KnownHosts != "" {
-		bastionKnownHosts = opts.KnownHosts
+func chainUsesAgent(first *SshBastionOpts) bool {
+	for b := first; b != nil; b = b.Bastion {
+		if b.Agent != nil && *b.Agent {
+			return true
+		}
 	}
-	bastionInsecure := insecure
-	if opts.InsecureSkipHostKey != nil {
-		bastionInsecure = *opts.InsecureSkipHostKey
+	return false
+}
+
+// dialBastionChain connects to each jump host in turn, through the one
+// before it, and returns the clients in dial order. On failure every
+// client already opened is closed, so a broken chain leaves no
+// authenticated session behind on the hosts that did answer.
+func dialBastionChain(hops []bastionHop, agentClient agent.Agent) ([]*ssh.Client, error) {
+	clients := make([]*ssh.Client, 0, len(hops))
+	fail := func(err error) ([]*ssh.Client, error) {
+		closeClients(clients)
+		return nil, err
 	}
 
-	authMethods, err := sshAuthMethods(opts.KeyFile, opts.Pass)
+	for i, hop := range hops {
+		if err := hop.requireHost(); err != nil {
+			return fail(err)
+		}
+		authMethods, err := sshAuthMethods(hop.opts.credentials(), agentClient)
+		if err != nil {
+			return fail(fmt.Errorf("%s: %w", hop.label, err))
+		}
+		callback, err := hostKeyCallbackFor(hop.knownHosts, hop.insecure)
+		if err != nil {
+			return fail(fmt.Errorf("%s: %w", hop.label, err))
+		}
+		config := &ssh.ClientConfig{
+			User:            hop.opts.User,
+			Auth:            authMethods,
+			HostKeyCallback: callback,
+		}
+
+		var client *ssh.Client
+		if i == 0 {
+			client, err = ssh.Dial("tcp", hop.address, config)
+		} else {
+			client, err = dialThrough(clients[i-1], hops[i-1].label, hop.address, config)
+		}
+		if err != nil {
+			return fail(describeSSHDialError(hop.label, hop.address, err))
+		}
+		clients = append(clients, client)
+	}
+	return clients, nil
+}
+
+// dialThrough opens an SSH connection to addr tunnelled through client.
+func dialThrough(client *ssh.Client, via, addr string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	conn, err := client.Dial("tcp", addr)
 	if err != nil {
-		return nil, fmt.Errorf("bastion: %w", err)
+		return nil, fmt.Errorf("%s could not reach %s: %w", via, addr, err)
 	}
-	callback, err := hostKeyCallbackFor(bastionKnownHosts, bastionInsecure)
+	ncc, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
 	if err != nil {
-		return nil, fmt.Errorf("bastion: %w", err)
+		conn.Close()
+		return nil, err
 	}
+	return ssh.NewClient(ncc, chans, reqs), nil
+}
 
-	addr := fmt.Sprintf("%s:%d", opts.Host, port)
-	client, err := ssh.Dial("tcp", addr, &ssh.ClientConfig{
-		User:            opts.User,
-		Auth:            authMethods,
-		HostKeyCallback: callback,
-	})
-	if err != nil {
-		return nil, describeSSHDialError("bastion "+opts.Host, addr, err)
+// closeClients closes a chain from the far end inward, so each tunnel
+// closes before the connection carrying it.
+func closeClients(clients []*ssh.Client) {
+	for i := len(clients) - 1; i >= 0; i-- {
+		clients[i].Close()
 	}
-	return client, nil
 }
 
 // expandUser resolves a leading ~ in a path.
@@ -292,6 +426,7 @@ func (s *SshNode) Reboot(force bool, readyCommand string, timeout time.Duration)
 	}
 	_, _ = s.Execute(command)
 	if s.client != nil {
+		s.closeSFTP()
 		s.client.Close()
 		s.client = nil
 	}
@@ -323,6 +458,7 @@ func (s *SshNode) Reboot(force bool, readyCommand string, timeout time.Duration)
 		}
 		if err != nil {
 			// Connection died again (host still shutting down); redial
+			s.closeSFTP()
 			s.client.Close()
 			s.client = nil
 		}
@@ -332,14 +468,19 @@ func (s *SshNode) Reboot(force bool, readyCommand string, timeout time.Duration)
 }
 
 type SshNode struct {
-	name                string
-	config              *ssh.ClientConfig
-	client              *ssh.Client
-	address             string
-	bastion             *ssh.Client
-	bastions            *SshBastionOpts
-	knownHosts          string
-	insecureSkipHostKey bool
+	name    string
+	config  *ssh.ClientConfig
+	client  *ssh.Client
+	address string
+	// bastions are the open jump-host connections, in dial order
+	bastions     []*ssh.Client
+	bastionChain []bastionHop
+	agent        agent.ExtendedAgent
+	agentConn    net.Conn
+	forwardAgent bool
+	// sftp is opened on first use and bound to client, so it is dropped
+	// whenever the connection is
+	sftp *sftp.Client
 }
 
 func (s *SshNode) Setup() error {
@@ -351,17 +492,44 @@ func (s *SshNode) Teardown() error {
 }
 
 func (s *SshNode) Close() error {
+	s.closeSFTP()
 	if s.client != nil {
 		s.client.Close()
 	}
-	// The bastion tunnel outlives the target connection and must be
-	// released too, or the jump host accumulates sessions across runs
-	if s.bastion != nil {
-		s.bastion.Close()
+	// The bastion tunnels outlive the target connection and must be
+	// released too, or the jump hosts accumulate sessions across runs
+	closeClients(s.bastions)
+	s.bastions = nil
+	if s.agentConn != nil {
+		s.agentConn.Close()
 	}
 	return nil
 }
 
+// SFTP returns an SFTP session on the node's connection, opening it on
+// first use. It fails when the server does not offer the sftp subsystem.
+func (s *SshNode) SFTP() (*sftp.Client, error) {
+	if s.sftp != nil {
+		return s.sftp, nil
+	}
+	if s.client == nil {
+		return nil, fmt.Errorf("ssh connection to %s is closed", s.address)
+	}
+	client, err := sftp.NewClient(s.client)
+	if err != nil {
+		return nil, fmt.Errorf("sftp is not available on %s: %w", s.address, err)
+	}
+	s.sftp = client
+	return client, nil
+}
+
+func (s *SshNode) closeSFTP() {
+	if s.sftp != nil {
+		s.sftp.Close()
+		s.sftp = nil
+	}
+}
+
 // Execute runs a command on the remote SSH host. Output is captured into
 // tee writers assigned as the session's Stdout/Stderr — session pipes are
 // unusable here because Run drains and closes them before returning, which
@@ -379,6 +547,12 @@ func (s *SshNode) Execute(command string, options ...execution.ExecutionOption)
 	}
 	defer session.Close()
 
+	if s.forwardAgent {
+		if err := agent.RequestAgentForwarding(session); err != nil {
+			return nil, fmt.Errorf("ssh node %s: agent forwarding refused: %w", s.name, err)
+		}
+	}
+
 	debugEnabled := execution.IsDebugMode()
 	stdoutWriter := stream.NewTeeWriter(stream.StreamStdout, s.name, debugEnabled)
 	stderrWriter := stream.NewTeeWriter(stream.StreamStderr, s.name, debugEnabled)
@@ -404,50 +578,48 @@ func (s *SshNode) Execute(command string, options ...execution.ExecutionOption)
 	}, nil
 }
 
-// redial reconnects to the target, routing through the bastion when one
-// is configured — a rebooted host behind a jump host must be reached the
-// same way it was originally.
+// redial (re)connects to the target, rebuilding the whole bastion chain
+// when one is configured — a rebooted host behind jump hosts must be
+// reached the same way it was originally.
 func (s *SshNode) redial() (*ssh.Client, error) {
-	if s.bastions == nil {
-		return ssh.Dial("tcp", s.address, s.config)
+	who := fmt.Sprintf("node %q", s.name)
+	if len(s.bastionChain) == 0 {
+		client, err := ssh.Dial("tcp", s.address, s.config)
+		if err != nil {
+			return nil, describeSSHDialError(who, s.address, err)
+		}
+		return s.forward(client, nil)
 	}
 
-	if s.bastion != nil {
-		s.bastion.Close()
-	}
-	bastionClient, err := dialBastion(s.bastions, s.knownHosts, s.insecureSkipHostKey)
+	closeClients(s.bastions)
+	s.bastions = nil
+	bastions, err := dialBastionChain(s.bastionChain, s.agent)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("node %q: %w", s.name, err)
 	}
 
-	// Only adopt the bastion once the target is reachable through it;
-	// otherwise a failed hop would leave an authenticated session open on
-	// the jump host for the rest of the run
-	conn, err := bastionClient.Dial("tcp", s.address)
+	// Only adopt the chain once the target is reachable through it;
+	// otherwise a failed hop would leave authenticated sessions open on
+	// the jump hosts for the rest of the run
+	last := len(bastions) - 1
+	client, err := dialThrough(bastions[last], s.bastionChain[last].label, s.address, s.config)
 	if err != nil {
-		bastionClient.Close()
-		return nil, err
+		closeClients(bastions)
+		return nil, describeSSHDialError(who, s.address, err)
 	}
-	ncc, chans, reqs, err := ssh.NewClientConn(conn, s.address, s.config)
-	if err != nil {
-		bastionClient.Close()
-		return nil, err
-	}
-	s.bastion = bastionClient
-	return ssh.NewClient(ncc, chans, reqs), nil
+	return s.forward(client, bastions)
 }
 
-// readPrivateKey reads an SSH private key from a file
-func readPrivateKey(file string) (ssh.Signer, error) {
-	buffer, err := os.ReadFile(file)
-	if err != nil {
-		return nil, fmt.Errorf("unable to read private key: %v", err)
-	}
-
-	key, err := ssh.ParsePrivateKey(buffer)
-	if err != nil {
-		return nil, fmt.Errorf("unable to parse private key: %v", err)
+// forward registers agent forwarding on a new connection, which is per
+// connection, and adopts the bastions that carry it.
+func (s *SshNode) forward(client *ssh.Client, bastions []*ssh.Client) (*ssh.Client, error) {
+	if s.forwardAgent {
+		if err := agent.ForwardToAgent(client, s.agent); err != nil {
+			client.Close()
+			closeClients(bastions)
+			return nil, fmt.Errorf("node %q: cannot forward the ssh agent: %w", s.name, err)
+		}
 	}
-
-	return key, nil
+	s.bastions = bastions
+	return client, nil
 }
@@ -0,0 +1,355 @@
+package nodetypes
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	dartconfig "github.com/bgrewell/dart/internal/config"
+	"github.com/bgrewell/dart/internal/execution"
+	"github.com/bgrewell/dart/internal/sshconfig"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// SshSecretOpts names where a secret such as a key passphrase comes from.
+// Exactly one source is set: an environment variable or a file keeps the
+// secret out of the suite, value writes it inline.
+type SshSecretOpts struct {
+	EnvVar string `yaml:"env_var,omitempty" json:"env_var"`
+	File   string `yaml:"file,omitempty" json:"file"`
+	Value  string `yaml:"value,omitempty" json:"value"`
+}
+
+// resolve reads the secret. An empty secret is an error: a passphrase
+// that was meant to be set but is not should say so, not fail as a bad
+// passphrase.
+func (s *SshSecretOpts) resolve(option, suiteDir string) (string, error) {
+	sources := 0
+	for _, set := range []bool{s.EnvVar != "", s.File != "", s.Value != ""} {
+		if set {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return "", fmt.Errorf("%s: set exactly one of env_var, file, or value", option)
+	}
+
+	switch {
+	case s.EnvVar != "":
+		secret := os.Getenv(s.EnvVar)
+		if secret == "" {
+			return "", fmt.Errorf("%s: environment variable %s is empty or unset", option, s.EnvVar)
+		}
+		return secret, nil
+	case s.File != "":
+		path, err := dartconfig.ResolveLocalPath(suiteDir, expandUser(s.File))
+		if err != nil {
+			return "", err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", option, err)
+		}
+		// A trailing newline is an artifact of how the file was written
+		secret := strings.TrimRight(string(data), "\r\n")
+		if secret == "" {
+			return "", fmt.Errorf("%s: file %s is empty", option, path)
+		}
+		return secret, nil
+	default:
+		return s.Value, nil
+	}
+}
+
+// sshCredentials is everything one hop can authenticate with.
+type sshCredentials struct {
+	keyFile string
+	// identityFiles come from ~/.ssh/config; unlike key, a listed file
+	// that does not exist is skipped, as ssh does
+	identityFiles []string
+	passphrase    string
+	password      string
+	agent         bool
+}
+
+// sshAuthMethods builds the auth chain: agent keys first, then key files,
+// then the password. A nil agentClient checks that an agent is available
+// without connecting to it, for --check.
+func sshAuthMethods(creds sshCredentials, agentClient agent.Agent) ([]ssh.AuthMethod, error) {
+	methods := []ssh.AuthMethod{}
+	if creds.agent {
+		if agentClient != nil {
+			methods = append(methods, ssh.PublicKeysCallback(agentClient.Signers))
+		} else if os.Getenv("SSH_AUTH_SOCK") == "" {
+			return nil, fmt.Errorf("agent is enabled but SSH_AUTH_SOCK is not set")
+		}
+	}
+
+	var signers []ssh.Signer
+	if creds.keyFile != "" {
+		signer, err := readPrivateKey(expandUser(creds.keyFile), creds.passphrase)
+		if err != nil {
+			return nil, err
+		}
+		signers = append(signers, signer)
+	}
+	// An IdentityFile DART cannot use is skipped, as ssh skips one it
+	// cannot decrypt: the config is shared with every other host, and the
+	// suite may well authenticate some other way
+	var skipped error
+	for _, file := range creds.identityFiles {
+		if _, err := os.Stat(file); err != nil {
+			continue
+		}
+		signer, err := readPrivateKey(file, creds.passphrase)
+		if err != nil {
+			skipped = fmt.Errorf("IdentityFile from ssh config: %w", err)
+			if execution.IsDebugMode() {
+				fmt.Fprintf(os.Stderr, "Debug: skipping %v\n", skipped)
+			}
+			continue
+		}
+		signers = append(signers, signer)
+	}
+	if len(signers) > 0 {
+		methods = append(methods, ssh.PublicKeys(signers...))
+	}
+
+	if creds.password != "" {
+		methods = append(methods, ssh.Password(creds.password))
+	}
+	if len(methods) == 0 && !creds.agent {
+		if skipped != nil {
+			return nil, fmt.Errorf("no usable ssh credentials: %w", skipped)
+		}
+		return nil, fmt.Errorf("no ssh credentials configured: set key, pass, or agent")
+	}
+	return methods, nil
+}
+
+// readPrivateKey reads an SSH private key from a file, decrypting it with
+// the passphrase when it is protected.
+func readPrivateKey(file, passphrase string) (ssh.Signer, error) {
+	buffer, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read private key: %v", err)
+	}
+
+	key, err := ssh.ParsePrivateKey(buffer)
+	var missing *ssh.PassphraseMissingError
+	if errors.As(err, &missing) {
+		if passphrase == "" {
+			return nil, fmt.Errorf("private key %s is passphrase protected: set key_passphrase or use agent: true: %w", file, err)
+		}
+		key, err = ssh.ParsePrivateKeyWithPassphrase(buffer, []byte(passphrase))
+		if err != nil {
+			return nil, fmt.Errorf("unable to decrypt private key %s: %v", file, err)
+		}
+		return key, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse private key: %v", err)
+	}
+
+	return key, nil
+}
+
+// dialAgent connects to the agent at SSH_AUTH_SOCK.
+func dialAgent() (agent.ExtendedAgent, net.Conn, error) {
+	socket := os.Getenv("SSH_AUTH_SOCK")
+	if socket == "" {
+		return nil, nil, fmt.Errorf("ssh agent requested but SSH_AUTH_SOCK is not set")
+	}
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot reach the ssh agent at %s: %w", socket, err)
+	}
+	return agent.NewClient(conn), conn, nil
+}
+
+// sshConfigPath resolves the ssh_config option: empty means ~/.ssh/config
+// when it exists, "none" turns the lookup off, and anything else is a
+// file that must exist. An empty result means no lookup.
+func sshConfigPath(option, suiteDir string) (string, error) {
+	switch option {
+	case "none":
+		return "", nil
+	case "":
+		path, err := sshconfig.DefaultPath()
+		if err != nil {
+			return "", nil
+		}
+		if _, err := os.Stat(path); err != nil {
+			return "", nil
+		}
+		return path, nil
+	}
+	path, err := dartconfig.ResolveLocalPath(suiteDir, expandUser(option))
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(path); err != nil {
+		return "", fmt.Errorf("ssh_config: %w", err)
+	}
+	return path, nil
+}
+
+// prepareSshNodeOpts resolves everything about the connection that needs
+// no network: ~/.ssh/config, suite-relative paths, the default port, and
+// the key passphrases. Construction and --check share it, so a suite that
+// passes --check connects with exactly the settings --check saw.
+func prepareSshNodeOpts(opts SshNodeOpts, suiteDir string) (SshNodeOpts, error) {
+	// The bastions are filled in below; the caller's copy stays as written
+	for b := &opts.Bastion; *b != nil; b = &(*b).Bastion {
+		bastion := **b
+		*b = &bastion
+	}
+	configPath, err := sshConfigPath(opts.SshConfig, suiteDir)
+	if err != nil {
+		return opts, err
+	}
+	if configPath != "" {
+		if err := applySshConfig(&opts, configPath); err != nil {
+			return opts, err
+		}
+	}
+	if opts.Port == 0 {
+		opts.Port = 22
+	}
+
+	// Credential paths belong to the machine running DART, so they follow
+	// the suite-relative rule like every other local path
+	if opts.KeyFile, err = dartconfig.ResolveLocalPath(suiteDir, opts.KeyFile); err != nil {
+		return opts, err
+	}
+	if opts.KnownHosts, err = dartconfig.ResolveLocalPath(suiteDir, opts.KnownHosts); err != nil {
+		return opts, err
+	}
+	if opts.KeyPassphrase != nil {
+		if opts.passphrase, err = opts.KeyPassphrase.resolve("key_passphrase", suiteDir); err != nil {
+			return opts, err
+		}
+	}
+
+	// Like the host-key policy, agent use is inherited along the chain
+	// unless a bastion sets its own
+	agentInherited := opts.Agent
+	for b := opts.Bastion; b != nil; b = b.Bastion {
+		if b.KeyFile, err = dartconfig.ResolveLocalPath(suiteDir, b.KeyFile); err != nil {
+			return opts, err
+		}
+		if b.KnownHosts, err = dartconfig.ResolveLocalPath(suiteDir, b.KnownHosts); err != nil {
+			return opts, err
+		}
+		if b.KeyPassphrase != nil {
+			if b.passphrase, err = b.KeyPassphrase.resolve("bastion "+b.Host+" key_passphrase", suiteDir); err != nil {
+				return opts, err
+			}
+		}
+		if b.Agent == nil {
+			inherited := agentInherited
+			b.Agent = &inherited
+		}
+		agentInherited = *b.Agent
+	}
+	return opts, nil
+}
+
+// applySshConfig fills what the suite leaves unset from ~/.ssh/config,
+// looking the host up by the name written in the suite, so an inventory
+// of Host aliases works unchanged. Options in the suite always win.
+func applySshConfig(opts *SshNodeOpts, configPath string) error {
+	settings, err := sshconfig.Lookup(configPath, opts.Host)
+	if err != nil {
+		return fmt.Errorf("ssh_config: %w", err)
+	}
+	alias := opts.Host
+	if settings.HostName != "" {
+		opts.Host = strings.ReplaceAll(settings.HostName, "%h", alias)
+	}
+	if opts.User == "" {
+		opts.User = settings.User
+	}
+	if opts.Port == 0 {
+		opts.Port = settings.Port
+	}
+	if opts.KeyFile == "" {
+		opts.identityFiles = expandIdentityFiles(settings, opts.Host, opts.User, opts.Port)
+	}
+	if settings.ForwardAgent {
+		opts.ForwardAgent = true
+	}
+
+	if opts.Bastion == nil && settings.ProxyJump != "" {
+		if opts.Bastion, err = parseProxyJump(settings.ProxyJump); err != nil {
+			return err
+		}
+	}
+
+	// Each jump host is looked up in turn, and its own ProxyJump extends
+	// the chain, as ssh does
+	depth := 0
+	for b := opts.Bastion; b != nil; b = b.Bastion {
+		if depth++; depth > maxProxyJumpDepth {
+			return fmt.Errorf("ssh_config: ProxyJump for %s is more than %d hops deep; is there a loop?", alias, maxProxyJumpDepth)
+		}
+		if b.Host == "" {
+			continue
+		}
+		jump, err := sshconfig.Lookup(configPath, b.Host)
+		if err != nil {
+			return fmt.Errorf("ssh_config: %w", err)
+		}
+		if jump.HostName != "" {
+			b.Host = strings.ReplaceAll(jump.HostName, "%h", b.Host)
+		}
+		if b.User == "" {
+			b.User = jump.User
+		}
+		if b.Port == 0 {
+			b.Port = jump.Port
+		}
+		if b.KeyFile == "" {
+			b.identityFiles = expandIdentityFiles(jump, b.Host, b.User, b.Port)
+		}
+		if b.Bastion == nil && jump.ProxyJump != "" {
+			if b.Bastion, err = parseProxyJump(jump.ProxyJump); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// maxProxyJumpDepth bounds chains built from ssh_config, where two hosts
+// that name each other as ProxyJump would otherwise never end.
+const maxProxyJumpDepth = 16
+
+// parseProxyJump turns "j1,j2" — dial j1, then j2 — into nested bastions:
+// the last hop is the one next to the host, and each hop's bastion is
+// the hop before it.
+func parseProxyJump(jumps string) (*SshBastionOpts, error) {
+	var chain *SshBastionOpts
+	for _, hop := range strings.Split(jumps, ",") {
+		user, host, port, err := sshconfig.ParseJump(hop)
+		if err != nil {
+			return nil, fmt.Errorf("ssh_config: %w", err)
+		}
+		chain = &SshBastionOpts{Host: host, Port: port, User: user, Bastion: chain}
+	}
+	return chain, nil
+}
+
+func expandIdentityFiles(settings *sshconfig.Settings, host, user string, port int) []string {
+	if port == 0 {
+		port = 22
+	}
+	files := make([]string, 0, len(settings.IdentityFiles))
+	for _, file := range settings.IdentityFiles {
+		files = append(files, sshconfig.ExpandTokens(file, host, user, port))
+	}
+	return files
+}
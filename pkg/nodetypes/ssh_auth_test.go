@@ -0,0 +1,292 @@
+package nodetypes
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bgrewell/dart/pkg/ifaces"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+func newTestClientKey(t *testing.T) (ed25519.PrivateKey, ssh.PublicKey) {
+	t.Helper()
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(private)
+	require.NoError(t, err)
+	return private, signer.PublicKey()
+}
+
+// writeTestClientKey writes the key in OpenSSH format, encrypted when a
+// passphrase is given.
+func writeTestClientKey(t *testing.T, key ed25519.PrivateKey, passphrase string) string {
+	t.Helper()
+	var block *pem.Block
+	var err error
+	if passphrase == "" {
+		block, err = ssh.MarshalPrivateKey(key, "")
+	} else {
+		block, err = ssh.MarshalPrivateKeyWithPassphrase(key, "", []byte(passphrase))
+	}
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "id_ed25519")
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(block), 0600))
+	return path
+}
+
+// startTestAgent serves an in-memory agent holding the keys and points
+// SSH_AUTH_SOCK at it.
+func startTestAgent(t *testing.T, keys ...ed25519.PrivateKey) {
+	t.Helper()
+	keyring := agent.NewKeyring()
+	for _, key := range keys {
+		require.NoError(t, keyring.Add(agent.AddedKey{PrivateKey: key}))
+	}
+	socket := filepath.Join(t.TempDir(), "agent.sock")
+	listener, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go agent.ServeAgent(keyring, conn)
+		}
+	}()
+	t.Setenv("SSH_AUTH_SOCK", socket)
+}
+
+func connectTestSSHNode(t *testing.T, opts map[string]interface{}) *SshNode {
+	t.Helper()
+	node, err := NewSshNode("ssh-test", ifaces.NodeOptions(&opts), "")
+	require.NoError(t, err)
+	t.Cleanup(func() { node.Close() })
+	return node.(*SshNode)
+}
+
+func assertTestSSHNodeRuns(t *testing.T, node ifaces.Node) {
+	t.Helper()
+	result, err := node.Execute("echo hello")
+	require.NoError(t, err)
+	stdout, _ := result.StdoutBytes()
+	assert.Equal(t, "hello\n", string(stdout))
+}
+
+func TestSSHAgentAuthentication(t *testing.T) {
+	key, public := newTestClientKey(t)
+	host, port, _ := startTestSSHServerAuthorizing(t, public)
+	startTestAgent(t, key)
+
+	node := connectTestSSHNode(t, map[string]interface{}{
+		"host": host, "port": port, "user": "testuser",
+		"agent": true, "insecure_skip_host_key": true,
+	})
+	assertTestSSHNodeRuns(t, node)
+}
+
+// A forwarded agent is visible to commands on the node.
+func TestSSHAgentForwarding(t *testing.T) {
+	host, port := startTestSSHServer(t)
+	key, _ := newTestClientKey(t)
+	startTestAgent(t, key)
+
+	node := connectTestSSHNode(t, map[string]interface{}{
+		"host": host, "port": port, "user": "testuser", "pass": "testpass",
+		"forward_agent": true, "insecure_skip_host_key": true,
+	})
+	result, err := node.Execute("agent-keys")
+	require.NoError(t, err)
+	require.Equal(t, 0, result.ExitCode)
+	stdout, _ := result.StdoutBytes()
+	assert.Equal(t, "1\n", string(stdout))
+}
+
+func TestSSHAgentWithoutSocketExplains(t *testing.T) {
+	t.Setenv("SSH_AUTH_SOCK", "")
+	err := validateSshNodeOpts(SshNodeOpts{Host: "h", Agent: true, InsecureSkipHostKey: true, SshConfig: "none"}, "")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "SSH_AUTH_SOCK")
+}
+
+func TestSSHEncryptedKeyWithPassphraseFromEnv(t *testing.T) {
+	key, public := newTestClientKey(t)
+	host, port, _ := startTestSSHServerAuthorizing(t, public)
+	keyFile := writeTestClientKey(t, key, "correct horse")
+	t.Setenv("DART_TEST_KEY_PASSPHRASE", "correct horse")
+
+	node := connectTestSSHNode(t, map[string]interface{}{
+		"host": host, "port": port, "user": "testuser", "key": keyFile,
+		"key_passphrase":         map[string]interface{}{"env_var": "DART_TEST_KEY_PASSPHRASE"},
+		"insecure_skip_host_key": true,
+	})
+	assertTestSSHNodeRuns(t, node)
+}
+
+func TestSSHEncryptedKeyErrors(t *testing.T) {
+	key, _ := newTestClientKey(t)
+	keyFile := writeTestClientKey(t, key, "correct horse")
+	base := SshNodeOpts{Host: "h", KeyFile: keyFile, InsecureSkipHostKey: true, SshConfig: "none"}
+
+	err := validateSshNodeOpts(base, "")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "passphrase protected: set key_passphrase")
+
+	wrong := base
+	wrong.KeyPassphrase = &SshSecretOpts{Value: "battery staple"}
+	err = validateSshNodeOpts(wrong, "")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unable to decrypt private key")
+}
+
+func TestSSHSecretSources(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "pass"), []byte("s3cret\n"), 0600))
+
+	secret, err := (&SshSecretOpts{File: "pass"}).resolve("key_passphrase", dir)
+	require.NoError(t, err)
+	assert.Equal(t, "s3cret", secret, "the trailing newline is not part of the secret")
+
+	_, err = (&SshSecretOpts{File: "pass", Value: "x"}).resolve("key_passphrase", dir)
+	assert.ErrorContains(t, err, "exactly one of")
+
+	t.Setenv("DART_TEST_EMPTY", "")
+	_, err = (&SshSecretOpts{EnvVar: "DART_TEST_EMPTY"}).resolve("key_passphrase", dir)
+	assert.ErrorContains(t, err, "DART_TEST_EMPTY is empty or unset")
+}
+
+func writeTestSSHConfig(t *testing.T, format string, args ...interface{}) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config")
+	require.NoError(t, os.WriteFile(path, []byte(fmt.Sprintf(format, args...)), 0600))
+	return path
+}
+
+// A Host alias from ssh_config supplies the address, user, port, and key,
+// so the suite names the host the way the inventory does.
+func TestSSHConfigResolvesHostAlias(t *testing.T) {
+	key, public := newTestClientKey(t)
+	host, port, _ := startTestSSHServerAuthorizing(t, public)
+	keyFile := writeTestClientKey(t, key, "")
+	config := writeTestSSHConfig(t, `
+Host lab-*
+    User testuser
+    IdentityFile %s
+
+Host lab-target
+    HostName %s
+    Port %d
+`, keyFile, host, port)
+
+	node := connectTestSSHNode(t, map[string]interface{}{
+		"host": "lab-target", "ssh_config": config, "insecure_skip_host_key": true,
+	})
+	assert.Equal(t, fmt.Sprintf("%s:%d", host, port), node.address)
+	assertTestSSHNodeRuns(t, node)
+}
+
+func TestSSHConfigProxyJumpBecomesBastion(t *testing.T) {
+	key, public := newTestClientKey(t)
+	targetHost, targetPort, _ := startTestSSHServerAuthorizing(t, public)
+	bastionHost, bastionPort, _ := startTestSSHServerAuthorizing(t, public)
+	keyFile := writeTestClientKey(t, key, "")
+	config := writeTestSSHConfig(t, `
+Host *
+    User testuser
+    IdentityFile %s
+
+Host jump
+    HostName %s
+    Port %d
+
+Host target
+    HostName %s
+    Port %d
+    ProxyJump jump
+`, keyFile, bastionHost, bastionPort, targetHost, targetPort)
+
+	node := connectTestSSHNode(t, map[string]interface{}{
+		"host": "target", "ssh_config": config, "insecure_skip_host_key": true,
+	})
+	require.Len(t, node.bastions, 1, "the ProxyJump host must be used as the bastion")
+	assertTestSSHNodeRuns(t, node)
+}
+
+// An encrypted IdentityFile from ssh_config that DART cannot decrypt is
+// skipped, as ssh skips it, so a suite authenticating with pass still
+// connects. The same key named by the suite is still an error.
+func TestSSHConfigSkipsUndecryptableIdentityFile(t *testing.T) {
+	key, _ := newTestClientKey(t)
+	encrypted := writeTestClientKey(t, key, "hunter2")
+	t.Setenv("SSH_AUTH_SOCK", "")
+
+	methods, err := sshAuthMethods(sshCredentials{identityFiles: []string{encrypted}, password: "p"}, nil)
+	require.NoError(t, err)
+	assert.Len(t, methods, 1, "only the password is offered")
+
+	_, err = sshAuthMethods(sshCredentials{identityFiles: []string{encrypted}}, nil)
+	assert.ErrorContains(t, err, "no usable ssh credentials: IdentityFile from ssh config")
+
+	_, err = sshAuthMethods(sshCredentials{keyFile: encrypted, password: "p"}, nil)
+	assert.ErrorContains(t, err, "passphrase protected")
+}
+
+// Options written in the suite win over ssh_config.
+func TestSSHConfigSuiteOptionsWin(t *testing.T) {
+	config := writeTestSSHConfig(t, "Host db\n    HostName 10.0.0.5\n    User admin\n    Port 2222\n")
+	opts, err := prepareSshNodeOpts(SshNodeOpts{Host: "db", User: "dart", SshConfig: config}, "")
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.5", opts.Host)
+	assert.Equal(t, "dart", opts.User)
+	assert.Equal(t, 2222, opts.Port)
+
+	opts, err = prepareSshNodeOpts(SshNodeOpts{Host: "db", SshConfig: "none"}, "")
+	require.NoError(t, err)
+	assert.Equal(t, "db", opts.Host)
+	assert.Equal(t, 22, opts.Port)
+}
+
+// A multi-hop ProxyJump, and a jump host's own ProxyJump, become a chain
+// of bastions in dial order.
+func TestSSHConfigProxyJumpChain(t *testing.T) {
+	config := writeTestSSHConfig(t, `
+Host target
+    ProxyJump ops@corp:2200,lab
+
+Host lab
+    HostName 10.0.0.1
+
+Host edge
+    ProxyJump target
+`)
+	opts, err := prepareSshNodeOpts(SshNodeOpts{Host: "target", SshConfig: config}, "")
+	require.NoError(t, err)
+	hops := resolveBastionChain(opts.Bastion, "", true)
+	require.Len(t, hops, 2)
+	assert.Equal(t, "corp:2200", hops[0].address)
+	assert.Equal(t, "ops", hops[0].opts.User)
+	assert.Equal(t, "10.0.0.1:22", hops[1].address)
+
+	opts, err = prepareSshNodeOpts(SshNodeOpts{Host: "edge", SshConfig: config}, "")
+	require.NoError(t, err)
+	hops = resolveBastionChain(opts.Bastion, "", true)
+	require.Len(t, hops, 3)
+	assert.Equal(t, "target:22", hops[2].address)
+}
+
+func TestSSHConfigProxyJumpLoopRejected(t *testing.T) {
+	config := writeTestSSHConfig(t, "Host a\n    ProxyJump b\nHost b\n    ProxyJump a\n")
+	_, err := prepareSshNodeOpts(SshNodeOpts{Host: "a", SshConfig: config}, "")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "is there a loop")
+}
@@ -1,6 +1,7 @@
 package nodetypes
 
 import (
+	"bytes"
 	"crypto/rand"
 	"crypto/rsa"
 	"fmt"
@@ -13,9 +14,11 @@ import (
 	"testing"
 
 	"github.com/bgrewell/dart/pkg/ifaces"
+	"github.com/pkg/sftp"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
 	"golang.org/x/crypto/ssh/knownhosts"
 )
 
@@ -24,12 +27,20 @@ import (
 //   - "echo hello"  -> stdout "hello\n", exit 0
 //   - "fail"        -> stderr "boom\n", exit 3
 //   - anything else -> stdout echoes the command, exit 0
+//
+// It also serves the sftp subsystem over the local filesystem.
 func startTestSSHServer(t *testing.T) (host string, port int) {
 	h, p, _ := startTestSSHServerWithKey(t)
 	return h, p
 }
 
 func startTestSSHServerWithKey(t *testing.T) (host string, port int, publicKey ssh.PublicKey) {
+	return startTestSSHServerAuthorizing(t)
+}
+
+// startTestSSHServerAuthorizing also accepts public-key auth as testuser
+// with any of the authorized keys.
+func startTestSSHServerAuthorizing(t *testing.T, authorized ...ssh.PublicKey) (host string, port int, publicKey ssh.PublicKey) {
 	t.Helper()
 
 	hostKey, err := rsa.GenerateKey(rand.Reader, 2048)
@@ -44,6 +55,14 @@ func startTestSSHServerWithKey(t *testing.T) (host string, port int, publicKey s
 			}
 			return nil, io.EOF
 		},
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			for _, allowed := range authorized {
+				if conn.User() == "testuser" && bytes.Equal(key.Marshal(), allowed.Marshal()) {
+					return nil, nil
+				}
+			}
+			return nil, io.EOF
+		},
 	}
 	serverConfig.AddHostKey(signer)
 
@@ -117,7 +136,27 @@ func handleTestSSHConn(conn net.Conn, config *ssh.ServerConfig) {
 		}
 		go func(channel ssh.Channel, requests <-chan *ssh.Request) {
 			defer channel.Close()
+			forwarded := false
 			for req := range requests {
+				if req.Type == "auth-agent-req@openssh.com" {
+					forwarded = true
+					req.Reply(true, nil)
+					continue
+				}
+				if req.Type == "subsystem" {
+					var subsystem struct{ Name string }
+					ssh.Unmarshal(req.Payload, &subsystem)
+					if subsystem.Name != "sftp" {
+						req.Reply(false, nil)
+						continue
+					}
+					req.Reply(true, nil)
+					go ssh.DiscardRequests(requests)
+					if server, err := sftp.NewServer(channel); err == nil {
+						server.Serve()
+					}
+					return
+				}
 				if req.Type != "exec" {
 					req.Reply(false, nil)
 					continue
@@ -133,6 +172,16 @@ func handleTestSSHConn(conn net.Conn, config *ssh.ServerConfig) {
 				case "fail":
 					io.WriteString(channel.Stderr(), "boom\n")
 					status = 3
+				case "agent-keys":
+					// Counts the keys in the forwarded agent, as ssh-add -l
+					// would on the remote side
+					status = 2
+					if forwarded {
+						if keys, err := listForwardedAgentKeys(serverConn); err == nil {
+							fmt.Fprintf(channel, "%d\n", len(keys))
+							status = 0
+						}
+					}
 				default:
 					io.WriteString(channel, payload.Command+"\n")
 				}
@@ -145,6 +194,16 @@ func handleTestSSHConn(conn net.Conn, config *ssh.ServerConfig) {
 	}
 }
 
+func listForwardedAgentKeys(conn *ssh.ServerConn) ([]*agent.Key, error) {
+	channel, requests, err := conn.OpenChannel("auth-agent@openssh.com", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer channel.Close()
+	go ssh.DiscardRequests(requests)
+	return agent.NewClient(channel).List()
+}
+
 func testSSHNode(t *testing.T) ifaces.Node {
 	t.Helper()
 	host, port := startTestSSHServer(t)
@@ -376,19 +435,82 @@ func TestSSHHostKeyMismatchExplains(t *testing.T) {
 	assert.Contains(t, err.Error(), "intercepted")
 }
 
-func TestSSHChainedBastionRejected(t *testing.T) {
-	host, port := startTestSSHServer(t)
+// A target behind two jump hosts is reached through both, innermost
+// bastion first, and a reconnect rebuilds the whole chain.
+func TestSSHThroughBastionChain(t *testing.T) {
+	targetHost, targetPort := startTestSSHServer(t)
+	labHost, labPort := startTestSSHServer(t)
+	corpHost, corpPort := startTestSSHServer(t)
+
 	opts := map[string]interface{}{
-		"host": host, "port": port, "user": "testuser", "pass": "testpass",
+		"host": targetHost, "port": targetPort, "user": "testuser", "pass": "testpass",
 		"insecure_skip_host_key": true,
 		"bastion": map[string]interface{}{
-			"host": "jump1", "user": "u", "pass": "p",
-			"bastion": map[string]interface{}{"host": "jump2", "user": "u", "pass": "p"},
+			"host": labHost, "port": labPort, "user": "testuser", "pass": "testpass",
+			"bastion": map[string]interface{}{
+				"host": corpHost, "port": corpPort, "user": "testuser", "pass": "testpass",
+			},
+		},
+	}
+	node, err := NewSshNode("ssh-test", ifaces.NodeOptions(&opts), "")
+	require.NoError(t, err)
+	defer node.Close()
+
+	sshNode := node.(*SshNode)
+	require.Len(t, sshNode.bastions, 2)
+	assert.Equal(t, fmt.Sprintf("%s:%d", corpHost, corpPort), sshNode.bastionChain[0].address, "the innermost bastion is dialled first")
+
+	result, err := node.Execute("echo hello")
+	require.NoError(t, err)
+	stdout, _ := result.StdoutBytes()
+	assert.Equal(t, "hello\n", string(stdout))
+
+	first := sshNode.bastions[0]
+	sshNode.client.Close()
+	sshNode.client, err = sshNode.redial()
+	require.NoError(t, err)
+	require.Len(t, sshNode.bastions, 2)
+	assert.NotSame(t, first, sshNode.bastions[0], "redial must rebuild the chain from the first hop")
+	_, err = node.Execute("echo hello")
+	require.NoError(t, err)
+}
+
+// A failure deep in the chain names the hop, not just the node.
+func TestSSHBastionChainErrorNamesHop(t *testing.T) {
+	targetHost, targetPort := startTestSSHServer(t)
+	labHost, labPort := startTestSSHServer(t)
+	corpHost, corpPort := startTestSSHServer(t)
+
+	opts := map[string]interface{}{
+		"host": targetHost, "port": targetPort, "user": "testuser", "pass": "testpass",
+		"insecure_skip_host_key": true,
+		"bastion": map[string]interface{}{
+			"host": labHost, "port": labPort, "user": "testuser", "pass": "wrong",
+			"bastion": map[string]interface{}{
+				"host": corpHost, "port": corpPort, "user": "testuser", "pass": "testpass",
+			},
 		},
 	}
 	_, err := NewSshNode("ssh-test", ifaces.NodeOptions(&opts), "")
 	require.Error(t, err)
-	assert.Contains(t, err.Error(), "chained bastions are not supported")
+	assert.Contains(t, err.Error(), fmt.Sprintf("bastion hop 2 of 2 (%s)", labHost))
+	assert.Contains(t, err.Error(), fmt.Sprintf("%s:%d", labHost, labPort))
+}
+
+func TestSSHBastionChainValidation(t *testing.T) {
+	err := validateSshNodeOpts(SshNodeOpts{
+		Host: "target", Pass: "x", InsecureSkipHostKey: true, SshConfig: "none",
+		Bastion: &SshBastionOpts{Host: "lab", Pass: "x", Bastion: &SshBastionOpts{User: "u", Pass: "x"}},
+	}, "")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "bastion hop 1 of 2: host is required")
+
+	err = validateSshNodeOpts(SshNodeOpts{
+		Host: "target", Pass: "x", InsecureSkipHostKey: true, SshConfig: "none",
+		Bastion: &SshBastionOpts{Host: "lab", Pass: "x", Bastion: &SshBastionOpts{Host: "corp"}},
+	}, "")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "bastion hop 1 of 2 (corp): no ssh credentials")
 }
 
 // The bastion can keep verification on while the ephemeral target opts out.
@@ -411,3 +533,38 @@ func TestSSHBastionKeepsOwnHostKeyPolicy(t *testing.T) {
 	require.Error(t, err, "the bastion must still verify even though the target does not")
 	assert.Contains(t, err.Error(), "bastion")
 }
+
+// The SFTP session is opened once, shares the node's connection (and so
+// its bastions), and is dropped with it.
+func TestSSHSFTPSession(t *testing.T) {
+	node := testSSHNode(t).(*SshNode)
+
+	client, err := node.SFTP()
+	require.NoError(t, err)
+	again, err := node.SFTP()
+	require.NoError(t, err)
+	assert.Same(t, client, again, "the session is reused")
+
+	path := filepath.Join(t.TempDir(), "over-sftp.txt")
+	file, err := client.Create(path)
+	require.NoError(t, err)
+	_, err = file.Write([]byte("payload"))
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+	got, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "payload", string(got))
+
+	require.NoError(t, node.Close())
+	assert.Nil(t, node.sftp)
+}
+
+func TestSSHSFTPWithoutConnection(t *testing.T) {
+	node := testSSHNode(t).(*SshNode)
+	node.client.Close()
+	node.client = nil
+
+	_, err := node.SFTP()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "is closed")
+}
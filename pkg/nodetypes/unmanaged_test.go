@@ -0,0 +1,131 @@
+package nodetypes
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/bgrewell/dart/internal/config"
+	"github.com/bgrewell/dart/internal/docker"
+	lxdclient "github.com/canonical/lxd/client"
+	"github.com/canonical/lxd/shared/api"
+	"github.com/docker/docker/api/types/container"
+	dockerclient "github.com/docker/docker/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// An unmanaged node names something that already exists, so creation
+// options there describe nothing and are rejected.
+func TestUnmanagedNodeOptions(t *testing.T) {
+	validate := func(nodeType string, options map[string]interface{}) error {
+		return ValidateNodeOptions(&config.NodeConfig{Name: "staging", Type: nodeType, Options: options})
+	}
+
+	assert.NoError(t, validate("docker", map[string]interface{}{
+		"managed": false, "container_name": "staging-api", "ready_command": "curl -fs localhost:8080/health",
+	}), "an adopted container needs no image")
+	assert.ErrorContains(t, validate("docker", map[string]interface{}{"managed": true}), "image is required")
+	assert.ErrorContains(t, validate("docker", map[string]interface{}{
+		"managed": false, "image": "nginx", "ports": []interface{}{"8080:80"},
+	}), `option "image" has no effect on an unmanaged node`)
+	assert.ErrorContains(t, validate("docker", map[string]interface{}{"managed": "no"}), "managed must be true or false")
+
+	assert.NoError(t, validate("lxd-vm", map[string]interface{}{
+		"managed": false, "instance_name": "staging-vm", "project": "qa",
+		"boot_wait": map[string]interface{}{"ready_command": "systemctl is-system-running"},
+	}))
+	assert.ErrorContains(t, validate("lxd", map[string]interface{}{
+		"managed": false, "image": "ubuntu:24.04",
+	}), "adopts an existing instance")
+	assert.ErrorContains(t, validate("lxd", map[string]interface{}{
+		"managed": false, "boot_wait": map[string]interface{}{"eject_on_poweroff": []interface{}{"iso"}},
+	}), "eject_on_poweroff")
+
+	assert.ErrorContains(t, validate("docker-compose", map[string]interface{}{
+		"compose_file": "compose.yml", "managed": false,
+	}), "managed applies to")
+}
+
+// Teardown of an adopted container must not reach the daemon at all; a
+// nil wrapper proves nothing was called.
+func TestUnmanagedDockerTeardownLeavesContainer(t *testing.T) {
+	managed := false
+	node := &DockerNode{name: "staging", options: DockerNodeOpts{Managed: &managed}}
+	assert.NoError(t, node.Teardown())
+}
+
+// distrolessDaemon serves one running container with no shell in it.
+// Anything else, such as running a command, hits the nil embedded
+// interface and fails the test.
+type distrolessDaemon struct {
+	dockerclient.APIClient
+}
+
+func (distrolessDaemon) ContainerInspect(ctx context.Context, id string) (container.InspectResponse, error) {
+	return container.InspectResponse{ContainerJSONBase: &container.ContainerJSONBase{
+		ID: id, State: &container.State{Status: container.StateRunning, Running: true},
+	}}, nil
+}
+
+func (distrolessDaemon) ContainerStatPath(ctx context.Context, id, path string) (container.PathStat, error) {
+	return container.PathStat{}, fmt.Errorf("Error: No such container:path: %s:%s", id, path)
+}
+
+// A distroless container can run no command, so adopting one is set up
+// once it is running rather than after the readiness timeout.
+func TestUnmanagedDockerSetupWithoutShell(t *testing.T) {
+	node, err := NewDockerNode(docker.NewWrapperWithClient(distrolessDaemon{}), "api", &map[string]interface{}{
+		"managed": false, "ready_timeout": 5,
+	}, "")
+	require.NoError(t, err)
+	require.NoError(t, node.Setup())
+}
+
+// lxdInstanceRecorder serves instance state and records snapshot calls.
+// Anything else, such as deleting the instance, hits the nil embedded
+// interface and fails the test.
+type lxdInstanceRecorder struct {
+	lxdclient.InstanceServer
+	status  string
+	deleted []string
+}
+
+type doneOperation struct{ lxdclient.Operation }
+
+func (doneOperation) Wait() error { return nil }
+
+func (r *lxdInstanceRecorder) GetInstanceState(name string) (*api.InstanceState, string, error) {
+	return &api.InstanceState{Status: r.status}, "", nil
+}
+
+func (r *lxdInstanceRecorder) CreateInstanceSnapshot(instanceName string, req api.InstanceSnapshotsPost) (lxdclient.Operation, error) {
+	return doneOperation{}, nil
+}
+
+func (r *lxdInstanceRecorder) DeleteInstanceSnapshot(instanceName, name string, mode string) (lxdclient.Operation, error) {
+	r.deleted = append(r.deleted, name)
+	return doneOperation{}, nil
+}
+
+// An adopted instance outlives the run, so the snapshots the suite took of
+// it are removed at teardown instead of piling up run after run.
+func TestUnmanagedLxdTeardownReleasesSnapshots(t *testing.T) {
+	managed := false
+	rec := &lxdInstanceRecorder{status: "Running"}
+	node := &LxdNode{name: "staging", client: rec, options: LxdNodeOpts{Managed: &managed}}
+
+	require.NoError(t, node.Snapshot("before-upgrade", false))
+	require.NoError(t, node.Snapshot("after-upgrade", false))
+	require.NoError(t, node.DeleteSnapshot("before-upgrade"))
+	require.NoError(t, node.Teardown())
+
+	assert.Equal(t, []string{"before-upgrade", "after-upgrade"}, rec.deleted,
+		"the suite's own delete, then the snapshot it left behind")
+}
+
+func TestUnmanagedLxdSetupRequiresRunningInstance(t *testing.T) {
+	managed := false
+	node := &LxdNode{name: "staging", client: &lxdInstanceRecorder{status: "Stopped"}, options: LxdNodeOpts{Managed: &managed}}
+	assert.ErrorContains(t, node.Setup(), "instance staging is stopped")
+}
@@ -21,6 +21,9 @@ type AptStep struct {
 }
 
 func newAptStep(c *config.StepConfig, node ifaces.Node) (ifaces.Step, error) {
+	if err := requireShell(c, node); err != nil {
+		return nil, err
+	}
 	packages, present, err := optStringList(c, "packages")
 	if err != nil {
 		return nil, err
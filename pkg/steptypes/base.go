@@ -9,6 +9,7 @@ import (
 
 	"github.com/bgrewell/dart/internal/config"
 	"github.com/bgrewell/dart/pkg/ifaces"
+	"github.com/bgrewell/dart/pkg/nodetypes"
 )
 
 const (
@@ -29,7 +30,11 @@ const (
 	TypeFilePush     = "file_push"
 	TypeFileFetch    = "file_fetch"
 	TypeFileTemplate = "file_template"
+	TypeDirPush      = "dir_push"
+	TypeDirFetch     = "dir_fetch"
+	TypeFileCopy     = "file_copy"
 	TypeSnapshot     = "snapshot"
+	TypeMigrate      = "migrate"
 )
 
 // BaseStep provides a common structure for all step types.
@@ -81,7 +86,19 @@ var stepFactories = map[string]stepFactory{
 	TypeFilePush:     newFilePushStep,
 	TypeFileFetch:    newFileFetchStep,
 	TypeFileTemplate: newFileTemplateStep,
+	TypeDirPush:      newDirPushStep,
+	TypeDirFetch:     newDirFetchStep,
 	TypeSnapshot:     newSnapshotStep,
+	TypeMigrate:      newMigrateStep,
+}
+
+// peerStepFactory constructs a step that also reaches nodes other than the
+// one it targets, named in its options and resolved from the suite's nodes.
+type peerStepFactory func(c *config.StepConfig, node ifaces.Node, nodes map[string]ifaces.Node) (ifaces.Step, error)
+
+// peerStepFactories holds the step types built by a peerStepFactory.
+var peerStepFactories = map[string]peerStepFactory{
+	TypeFileCopy: newFileCopyStep,
 }
 
 // CreateSteps constructs a slice of executable Steps based on provided configuration.
@@ -104,6 +121,12 @@ func CreateSteps(configs []*config.StepConfig, nodes map[string]ifaces.Node) ([]
 		}
 
 		factory, ok := stepFactories[c.Step.Type]
+		if peer, isPeer := peerStepFactories[c.Step.Type]; isPeer {
+			factory = func(c *config.StepConfig, node ifaces.Node) (ifaces.Step, error) {
+				return peer(c, node, nodes)
+			}
+			ok = true
+		}
 		if !ok {
 			return nil, &config.ConfigError{
 				Message:  fmt.Sprintf("unknown step type %q", c.Step.Type),
@@ -163,6 +186,17 @@ func optionError(c *config.StepConfig, format string, args ...interface{}) error
 	return &config.ConfigError{Message: message, Location: location, Key: key}
 }
 
+// requireShell rejects a node without a POSIX shell for the step types
+// that build shell commands — file operations, package and service checks,
+// node-side probes — at construction, so --check reports it.
+func requireShell(c *config.StepConfig, node ifaces.Node) error {
+	if nodetypes.HasShell(node) {
+		return nil
+	}
+	return optionError(c, "node %q has no POSIX shell, which a %s step needs (node types with one: %s) in step %q",
+		c.Node[0], c.Step.Type, nodetypes.SupportingTypes(nodetypes.CapabilityShell), c.Name)
+}
+
 // The opt* helpers validate raw option values. A present-but-wrong-typed
 // option is a config error, never a silent zero value.
 
@@ -0,0 +1,511 @@
+package steptypes
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/bgrewell/dart/internal/config"
+	"github.com/bgrewell/dart/internal/formatters"
+	"github.com/bgrewell/dart/pkg/ifaces"
+)
+
+// pathFilter selects the entries of a tree by include and exclude globs.
+// A pattern without a slash matches an entry's name at any depth, as in
+// .gitignore; one with a slash matches the path from the tree's root, and
+// a ** segment in it spans any number of directories. Excluding a
+// directory excludes everything below it. With include patterns, only the
+// files matching one are selected, and directories are created only to
+// hold them.
+type pathFilter struct {
+	include []string
+	exclude []string
+}
+
+func newPathFilter(c *config.StepConfig) (pathFilter, error) {
+	var filter pathFilter
+	var err error
+	if filter.include, err = globOption(c, "include"); err != nil {
+		return filter, err
+	}
+	if filter.exclude, err = globOption(c, "exclude"); err != nil {
+		return filter, err
+	}
+	return filter, nil
+}
+
+func globOption(c *config.StepConfig, key string) ([]string, error) {
+	patterns, _, err := optStringList(c, key)
+	if err != nil {
+		return nil, err
+	}
+	for i, pattern := range patterns {
+		// A trailing slash reads naturally for a directory but adds nothing
+		pattern = strings.TrimSuffix(pattern, "/")
+		if pattern == "" {
+			return nil, optionError(c, "%s has an empty pattern in step %q", key, c.Name)
+		}
+		for _, segment := range strings.Split(strings.TrimPrefix(pattern, "/"), "/") {
+			if _, err := path.Match(segment, ""); err != nil {
+				return nil, optionError(c, "%s pattern %q in step %q is invalid: %v", key, patterns[i], c.Name, err)
+			}
+		}
+		patterns[i] = pattern
+	}
+	return patterns, nil
+}
+
+func (f pathFilter) excluded(rel string) bool {
+	for p := rel; p != "."; p = path.Dir(p) {
+		for _, pattern := range f.exclude {
+			if matchGlob(pattern, p) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (f pathFilter) included(rel string) bool {
+	if len(f.include) == 0 {
+		return true
+	}
+	for _, pattern := range f.include {
+		if matchGlob(pattern, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchGlob(pattern, rel string) bool {
+	if !strings.Contains(pattern, "/") {
+		matched, _ := path.Match(pattern, path.Base(rel))
+		return matched
+	}
+	return matchSegments(strings.Split(strings.TrimPrefix(pattern, "/"), "/"), strings.Split(rel, "/"))
+}
+
+func matchSegments(pattern, parts []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(parts); i++ {
+				if matchSegments(pattern[1:], parts[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(parts) == 0 {
+			return false
+		}
+		if matched, _ := path.Match(pattern[0], parts[0]); !matched {
+			return false
+		}
+		pattern, parts = pattern[1:], parts[1:]
+	}
+	return len(parts) == 0
+}
+
+// treePlan is what one directory transfer copies, by path relative to the
+// tree's root, parents before their children.
+type treePlan struct {
+	dirs  []fileEntry
+	files []fileEntry
+}
+
+// planTree selects the directories and regular files of a listed tree.
+// Symlinks and special files are skipped.
+func planTree(entries []fileEntry, filter pathFilter) treePlan {
+	var plan treePlan
+	for _, entry := range entries {
+		if entry.Mode.IsRegular() && !filter.excluded(entry.Path) && filter.included(entry.Path) {
+			plan.files = append(plan.files, entry)
+		}
+	}
+
+	needed := map[string]bool{}
+	for _, file := range plan.files {
+		for dir := path.Dir(file.Path); dir != "."; dir = path.Dir(dir) {
+			needed[dir] = true
+		}
+	}
+	for _, entry := range entries {
+		if !entry.Mode.IsDir() || filter.excluded(entry.Path) {
+			continue
+		}
+		if len(filter.include) == 0 || needed[entry.Path] {
+			plan.dirs = append(plan.dirs, entry)
+		}
+	}
+	return plan
+}
+
+// pruneTree removes what sync makes extraneous: entries under root that
+// the filter selects but the transfer did not copy. As with rsync's
+// --delete, filtered-out entries are protected — excluded paths, and with
+// include patterns the files matching none. A directory is removed only
+// once nothing is left in it.
+func pruneTree(ops fileOps, root string, plan treePlan, filter pathFilter) error {
+	entries, err := ops.List(root)
+	if err != nil {
+		return fmt.Errorf("failed to list %s: %w", root, err)
+	}
+	copied := map[string]bool{}
+	for _, entry := range plan.dirs {
+		copied[entry.Path] = true
+	}
+	for _, entry := range plan.files {
+		copied[entry.Path] = true
+	}
+
+	// Children sort after their parents, so walking backwards empties a
+	// directory before deciding on it
+	occupied := map[string]bool{}
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		remove := !copied[entry.Path] && !filter.excluded(entry.Path)
+		if entry.Mode.IsDir() {
+			remove = remove && !occupied[entry.Path]
+		} else {
+			remove = remove && filter.included(entry.Path)
+		}
+		if !remove {
+			occupied[path.Dir(entry.Path)] = true
+			continue
+		}
+
+		target := path.Join(root, entry.Path)
+		if entry.Mode.IsDir() {
+			err = ops.DeleteDir(target)
+		} else {
+			err = ops.DeleteFile(target)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to remove extraneous %s: %w", target, err)
+		}
+	}
+	return nil
+}
+
+var _ ifaces.Step = &DirPushStep{}
+
+// DirPushStep copies a directory tree from the machine running DART onto
+// the step's target node — deploying a whole config directory in one step.
+// With template set, every file is rendered as file_template renders one.
+type DirPushStep struct {
+	BaseStep
+	node      ifaces.Node
+	source    string
+	dest      string
+	filter    pathFilter
+	template  bool
+	values    map[string]interface{}
+	overwrite bool
+	sync      bool
+}
+
+func newDirPushStep(c *config.StepConfig, node ifaces.Node) (ifaces.Step, error) {
+	if err := requireShell(c, node); err != nil {
+		return nil, err
+	}
+	source, err := requiredString(c, "source", "source is required")
+	if err != nil {
+		return nil, err
+	}
+	if source, err = localPath(c, source); err != nil {
+		return nil, err
+	}
+	dest, err := requiredString(c, "dest", "dest is required")
+	if err != nil {
+		return nil, err
+	}
+	filter, err := newPathFilter(c)
+	if err != nil {
+		return nil, err
+	}
+	overwrite, err := optBool(c, "overwrite")
+	if err != nil {
+		return nil, err
+	}
+	sync, err := optBool(c, "sync")
+	if err != nil {
+		return nil, err
+	}
+	if sync {
+		if err := requireDeletion(c, node, "sync: true"); err != nil {
+			return nil, err
+		}
+	}
+	isTemplate, err := optBool(c, "template")
+	if err != nil {
+		return nil, err
+	}
+	values, err := templateValues(c)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := c.Step.Options["values"]; ok && !isTemplate {
+		return nil, optionError(c, "values requires template: true in step %q", c.Name)
+	}
+
+	if isTemplate {
+		// Parse at config time, as file_template does, so a broken template
+		// fails before anything runs
+		entries, err := localFileOps{}.List(source)
+		if err != nil {
+			return nil, optionError(c, "cannot read template directory %s in step %q: %v", source, c.Name, err)
+		}
+		for _, file := range planTree(entries, filter).files {
+			name := filepath.Join(source, filepath.FromSlash(file.Path))
+			body, err := os.ReadFile(name)
+			if err != nil {
+				return nil, optionError(c, "cannot read template %s in step %q: %v", name, c.Name, err)
+			}
+			if _, err := parseTemplate(name, body); err != nil {
+				return nil, optionError(c, "template %s in step %q is invalid: %v", name, c.Name, err)
+			}
+		}
+	}
+
+	return &DirPushStep{
+		BaseStep:  baseFor(c),
+		node:      node,
+		source:    source,
+		dest:      dest,
+		filter:    filter,
+		template:  isTemplate,
+		values:    values,
+		overwrite: overwrite,
+		sync:      sync,
+	}, nil
+}
+
+// Run copies the selected tree to the node, then removes extraneous
+// entries when syncing.
+func (s *DirPushStep) Run(updater formatters.TaskCompleter) error {
+	if err := s.push(); err != nil {
+		updater.Error()
+		return err
+	}
+	updater.Complete()
+	return nil
+}
+
+func (s *DirPushStep) push() error {
+	info, err := os.Stat(s.source)
+	if err != nil {
+		return fmt.Errorf("failed to read source %s: %w", s.source, err)
+	}
+	entries, err := localFileOps{}.List(s.source)
+	if err != nil {
+		return fmt.Errorf("failed to read source %s: %w", s.source, err)
+	}
+	plan := planTree(entries, s.filter)
+
+	ops := fileOpsFor(s.node)
+	if err := ops.MkdirAll(s.dest, info.Mode().Perm()); err != nil {
+		return fmt.Errorf("failed to create %s: %w", s.dest, err)
+	}
+	for _, dir := range plan.dirs {
+		target := path.Join(s.dest, dir.Path)
+		if err := ops.MkdirAll(target, dir.Mode.Perm()); err != nil {
+			return fmt.Errorf("failed to create %s: %w", target, err)
+		}
+	}
+
+	// Syncing makes the destination match the source, existing files and all
+	overwrite := s.overwrite || s.sync
+	for _, file := range plan.files {
+		local := filepath.Join(s.source, filepath.FromSlash(file.Path))
+		target := path.Join(s.dest, file.Path)
+		if err := s.pushFile(ops, local, target, file.Mode.Perm(), overwrite); err != nil {
+			return err
+		}
+	}
+
+	if s.sync {
+		if err := pruneTree(ops, s.dest, plan, s.filter); err != nil {
+			return err
+		}
+	}
+	return setDirModes(ops, s.dest, plan.dirs)
+}
+
+func (s *DirPushStep) pushFile(ops fileOps, local, target string, mode os.FileMode, overwrite bool) error {
+	if s.template {
+		body, err := os.ReadFile(local)
+		if err != nil {
+			return fmt.Errorf("failed to read template %s: %w", local, err)
+		}
+		rendered, err := renderTemplate(local, body, s.values)
+		if err != nil {
+			return err
+		}
+		if err := ops.WriteFile(target, rendered, mode, overwrite, false); err != nil {
+			return fmt.Errorf("failed to write rendered %s to %s: %w", local, target, err)
+		}
+		return nil
+	}
+
+	source, err := os.Open(local)
+	if err != nil {
+		return fmt.Errorf("failed to read source %s: %w", local, err)
+	}
+	defer source.Close()
+	if err := ops.WriteStream(target, source, mode, overwrite, false); err != nil {
+		return fmt.Errorf("failed to push %s to %s: %w", local, target, err)
+	}
+	return nil
+}
+
+var _ ifaces.Step = &DirFetchStep{}
+
+// DirFetchStep copies a directory tree from the step's target node to the
+// machine running DART — collecting a log directory in one step.
+type DirFetchStep struct {
+	BaseStep
+	node      ifaces.Node
+	source    string
+	dest      string
+	filter    pathFilter
+	overwrite bool
+	sync      bool
+}
+
+func newDirFetchStep(c *config.StepConfig, node ifaces.Node) (ifaces.Step, error) {
+	if err := requireShell(c, node); err != nil {
+		return nil, err
+	}
+	source, err := requiredString(c, "source", "source is required")
+	if err != nil {
+		return nil, err
+	}
+	dest, err := requiredString(c, "dest", "dest is required")
+	if err != nil {
+		return nil, err
+	}
+	if dest, err = localPath(c, dest); err != nil {
+		return nil, err
+	}
+	filter, err := newPathFilter(c)
+	if err != nil {
+		return nil, err
+	}
+	overwrite, err := optBool(c, "overwrite")
+	if err != nil {
+		return nil, err
+	}
+	sync, err := optBool(c, "sync")
+	if err != nil {
+		return nil, err
+	}
+
+	return &DirFetchStep{
+		BaseStep:  baseFor(c),
+		node:      node,
+		source:    source,
+		dest:      dest,
+		filter:    filter,
+		overwrite: overwrite,
+		sync:      sync,
+	}, nil
+}
+
+// Run copies the selected tree from the node, then removes extraneous
+// local entries when syncing.
+func (s *DirFetchStep) Run(updater formatters.TaskCompleter) error {
+	if err := s.fetch(); err != nil {
+		updater.Error()
+		return err
+	}
+	updater.Complete()
+	return nil
+}
+
+func (s *DirFetchStep) fetch() error {
+	ops := fileOpsFor(s.node)
+	entries, err := ops.List(s.source)
+	if err != nil {
+		return fmt.Errorf("failed to fetch %s: %w", s.source, err)
+	}
+	plan := planTree(entries, s.filter)
+
+	if err := os.MkdirAll(s.dest, 0755); err != nil {
+		return fmt.Errorf("failed to create local directories: %w", err)
+	}
+	for _, dir := range plan.dirs {
+		target := filepath.Join(s.dest, filepath.FromSlash(dir.Path))
+		if err := os.MkdirAll(target, dir.Mode.Perm()); err != nil {
+			return fmt.Errorf("failed to create local directories: %w", err)
+		}
+	}
+
+	overwrite := s.overwrite || s.sync
+	for _, file := range plan.files {
+		remote := path.Join(s.source, file.Path)
+		target := filepath.Join(s.dest, filepath.FromSlash(file.Path))
+		if err := fetchFile(ops, remote, target, file.Mode.Perm(), overwrite); err != nil {
+			return err
+		}
+	}
+
+	if s.sync {
+		if err := pruneTree(localFileOps{}, filepath.ToSlash(s.dest), plan, s.filter); err != nil {
+			return err
+		}
+	}
+	return setDirModes(localFileOps{}, filepath.ToSlash(s.dest), plan.dirs)
+}
+
+// setDirModes gives each directory of a copied tree its source's
+// permission bits, as fetchFile and the writes do for files: MkdirAll
+// leaves an existing directory's mode alone and the umask narrows a new
+// one's. It runs once the tree is filled, deepest first, so a directory
+// without write or search permission is only restricted after the copy
+// no longer needs it.
+func setDirModes(ops fileOps, root string, dirs []fileEntry) error {
+	for i := len(dirs) - 1; i >= 0; i-- {
+		target := path.Join(root, dirs[i].Path)
+		if err := ops.SetDirMode(target, dirs[i].Mode.Perm()); err != nil {
+			return fmt.Errorf("failed to set the mode of %s: %w", target, err)
+		}
+	}
+	return nil
+}
+
+// fetchFile copies one file from the node, giving the local copy the
+// node's permission bits.
+func fetchFile(ops fileOps, remote, target string, mode os.FileMode, overwrite bool) error {
+	source, err := ops.Open(remote)
+	if err != nil {
+		return fmt.Errorf("failed to fetch %s: %w", remote, err)
+	}
+	defer source.Close()
+
+	flags := os.O_WRONLY | os.O_CREATE
+	if overwrite {
+		flags |= os.O_TRUNC
+	} else {
+		flags |= os.O_EXCL
+	}
+	file, err := os.OpenFile(target, flags, mode)
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", target, err)
+	}
+	if _, err := io.Copy(file, source); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to fetch %s to %s: %w", remote, target, err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", target, err)
+	}
+	// The umask applied at creation, and an existing file kept its mode
+	if err := os.Chmod(target, mode); err != nil {
+		return fmt.Errorf("failed to set mode on %s: %w", target, err)
+	}
+	return nil
+}
@@ -0,0 +1,268 @@
+package steptypes
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bgrewell/dart/internal/formatters"
+	"github.com/bgrewell/dart/pkg/ifaces"
+	"github.com/bgrewell/dart/pkg/nodetypes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTree creates files (and their directories) under root.
+func writeTree(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, contents := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0755))
+		require.NoError(t, os.WriteFile(p, []byte(contents), 0644))
+	}
+}
+
+// treeFiles returns the regular files under root with their contents.
+func treeFiles(t *testing.T, root string) map[string]string {
+	t.Helper()
+	entries, err := localFileOps{}.List(root)
+	require.NoError(t, err)
+	files := map[string]string{}
+	for _, entry := range entries {
+		if entry.Mode.IsRegular() {
+			data, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(entry.Path)))
+			require.NoError(t, err)
+			files[entry.Path] = string(data)
+		}
+	}
+	return files
+}
+
+func TestMatchGlob(t *testing.T) {
+	cases := []struct {
+		pattern, rel string
+		want         bool
+	}{
+		{"*.log", "app.log", true},
+		{"*.log", "var/old/app.log", true},
+		{"cache", "a/cache", true},
+		{"conf/*.yaml", "conf/app.yaml", true},
+		{"conf/*.yaml", "x/conf/app.yaml", false},
+		{"/conf/*.yaml", "conf/app.yaml", true},
+		{"**/*.yaml", "app.yaml", true},
+		{"conf/**/*.yaml", "conf/a/b/app.yaml", true},
+		{"conf/**", "conf/a/b", true},
+		{"conf/**", "other/a", false},
+	}
+	for _, tc := range cases {
+		assert.Equal(t, tc.want, matchGlob(tc.pattern, tc.rel), "%s ~ %s", tc.pattern, tc.rel)
+	}
+}
+
+func TestDirPushCopiesTreeAndModes(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "src")
+	writeTree(t, source, map[string]string{
+		"app.conf":         "port=80\n",
+		"bin/start.sh":     "#!/bin/sh\n",
+		"cache/blob":       "x",
+		"conf.d/extra.log": "noise",
+	})
+	require.NoError(t, os.Chmod(filepath.Join(source, "bin", "start.sh"), 0750))
+	require.NoError(t, os.Mkdir(filepath.Join(source, "empty"), 0700))
+	dest := filepath.Join(dir, "out", "app")
+
+	step, err := makeStepOn(t, localNode(t), TypeDirPush, map[string]interface{}{
+		"source": source, "dest": dest,
+		"exclude": []interface{}{"cache/", "*.log"},
+	})
+	require.NoError(t, err)
+	require.NoError(t, step.Run(formatters.NewMockTaskCompleter()))
+
+	assert.Equal(t, map[string]string{"app.conf": "port=80\n", "bin/start.sh": "#!/bin/sh\n"}, treeFiles(t, dest))
+	info, err := os.Stat(filepath.Join(dest, "bin", "start.sh"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0750), info.Mode().Perm())
+	info, err = os.Stat(filepath.Join(dest, "empty"))
+	require.NoError(t, err, "without include patterns empty directories are copied")
+	assert.True(t, info.IsDir())
+	_, err = os.Stat(filepath.Join(dest, "cache"))
+	assert.True(t, os.IsNotExist(err), "an excluded directory is not created")
+
+	// A second push finds the files in place
+	step, err = makeStepOn(t, localNode(t), TypeDirPush, map[string]interface{}{"source": source, "dest": dest})
+	require.NoError(t, err)
+	err = step.Run(formatters.NewMockTaskCompleter())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "app.conf")
+}
+
+func TestDirPushIncludeOnlyCreatesNeededDirs(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "src")
+	writeTree(t, source, map[string]string{
+		"a/b/app.yaml": "a", "a/readme.txt": "r", "other/x.txt": "x",
+	})
+	dest := filepath.Join(dir, "out")
+
+	step, err := makeStepOn(t, localNode(t), TypeDirPush, map[string]interface{}{
+		"source": source, "dest": dest, "include": []interface{}{"*.yaml"},
+	})
+	require.NoError(t, err)
+	require.NoError(t, step.Run(formatters.NewMockTaskCompleter()))
+
+	assert.Equal(t, map[string]string{"a/b/app.yaml": "a"}, treeFiles(t, dest))
+	_, err = os.Stat(filepath.Join(dest, "other"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestDirPushTemplate(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "src")
+	writeTree(t, source, map[string]string{
+		"app.conf":    "port={{ .port }}\n",
+		"db/pool.ini": "size={{ .pool }}\n",
+	})
+	dest := filepath.Join(dir, "out")
+
+	step, err := makeStepOn(t, localNode(t), TypeDirPush, map[string]interface{}{
+		"source": source, "dest": dest, "template": true,
+		"values": map[string]interface{}{"port": 8080, "pool": 4},
+	})
+	require.NoError(t, err)
+	require.NoError(t, step.Run(formatters.NewMockTaskCompleter()))
+	assert.Equal(t, map[string]string{"app.conf": "port=8080\n", "db/pool.ini": "size=4\n"}, treeFiles(t, dest))
+
+	writeTree(t, source, map[string]string{"broken.conf": "{{ .port"})
+	_, err = makeStepOn(t, localNode(t), TypeDirPush, map[string]interface{}{
+		"source": source, "dest": dest, "template": true,
+	})
+	require.Error(t, err, "every template is parsed at config time")
+	assert.Contains(t, err.Error(), "broken.conf")
+}
+
+// sync removes what the source no longer has, but leaves excluded paths
+// and the files an include pattern does not select.
+func TestDirPushSyncRemovesExtraneous(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "src")
+	writeTree(t, source, map[string]string{"keep.conf": "new"})
+	dest := filepath.Join(dir, "out")
+	writeTree(t, dest, map[string]string{
+		"keep.conf":      "old",
+		"stale.conf":     "s",
+		"gone/deep.conf": "d",
+		"state/db.conf":  "protected by exclude",
+		"notes.txt":      "not selected by include",
+	})
+
+	step, err := makeStepOn(t, localNode(t), TypeDirPush, map[string]interface{}{
+		"source": source, "dest": dest, "sync": true,
+		"include": []interface{}{"*.conf"}, "exclude": []interface{}{"state"},
+	})
+	require.NoError(t, err)
+	require.NoError(t, step.Run(formatters.NewMockTaskCompleter()))
+
+	assert.Equal(t, map[string]string{
+		"keep.conf":     "new",
+		"state/db.conf": "protected by exclude",
+		"notes.txt":     "not selected by include",
+	}, treeFiles(t, dest))
+	_, err = os.Stat(filepath.Join(dest, "gone"))
+	assert.True(t, os.IsNotExist(err), "an emptied directory is removed")
+}
+
+func TestDirFetchCopiesBackWithSync(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "logs")
+	writeTree(t, source, map[string]string{"app.log": "line\n", "old/app.1.log": "older\n", "app.pid": "42"})
+	require.NoError(t, os.Chmod(filepath.Join(source, "app.log"), 0600))
+	dest := filepath.Join(dir, "artifacts", "logs")
+	writeTree(t, dest, map[string]string{"previous.log": "from an earlier run"})
+
+	step, err := makeStepOn(t, localNode(t), TypeDirFetch, map[string]interface{}{
+		"source": source, "dest": dest, "exclude": []interface{}{"*.pid"}, "sync": true,
+	})
+	require.NoError(t, err)
+	require.NoError(t, step.Run(formatters.NewMockTaskCompleter()))
+
+	assert.Equal(t, map[string]string{"app.log": "line\n", "old/app.1.log": "older\n"}, treeFiles(t, dest))
+	info, err := os.Stat(filepath.Join(dest, "app.log"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm(), "the node's permission bits carry over")
+}
+
+// Directories keep their modes too, even where the umask would narrow a
+// new one or the directory already exists, on every transport.
+func TestDirTransferKeepsDirectoryModes(t *testing.T) {
+	nodes := map[string]ifaces.Node{
+		"local":  localNode(t),
+		"docker": &dockerMockNode{MockNode: nodetypes.NewMockNode(), cli: &fakeDockerFiles{}},
+		"lxd":    &lxdMockNode{MockNode: nodetypes.NewMockNode(), server: &fakeLxdFiles{}},
+	}
+	for name, node := range nodes {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			source := filepath.Join(dir, "src")
+			writeTree(t, source, map[string]string{"shared/upload.txt": "x", "private/key": "k"})
+			require.NoError(t, os.Chmod(filepath.Join(source, "shared"), 0775))
+			require.NoError(t, os.Chmod(filepath.Join(source, "private"), 0700))
+			dest := filepath.Join(dir, "out")
+			require.NoError(t, os.MkdirAll(filepath.Join(dest, "shared"), 0755))
+
+			push, err := makeStepOn(t, node, TypeDirPush, map[string]interface{}{"source": source, "dest": dest})
+			require.NoError(t, err)
+			require.NoError(t, push.Run(formatters.NewMockTaskCompleter()))
+			assertDirMode(t, filepath.Join(dest, "shared"), 0775, "an existing directory takes the source's mode")
+			assertDirMode(t, filepath.Join(dest, "private"), 0700, "")
+
+			fetched := filepath.Join(dir, "fetched")
+			fetch, err := makeStepOn(t, node, TypeDirFetch, map[string]interface{}{"source": source, "dest": fetched})
+			require.NoError(t, err)
+			require.NoError(t, fetch.Run(formatters.NewMockTaskCompleter()))
+			assertDirMode(t, filepath.Join(fetched, "shared"), 0775, "the umask does not narrow a fetched directory")
+			assertDirMode(t, filepath.Join(fetched, "private"), 0700, "")
+		})
+	}
+}
+
+func assertDirMode(t *testing.T, p string, mode os.FileMode, msg string) {
+	t.Helper()
+	info, err := os.Stat(p)
+	require.NoError(t, err)
+	assert.Equal(t, mode, info.Mode().Perm(), msg)
+}
+
+func TestDirFetchRefusesToClobber(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "logs")
+	writeTree(t, source, map[string]string{"app.log": "new"})
+	dest := filepath.Join(dir, "out")
+	writeTree(t, dest, map[string]string{"app.log": "old"})
+
+	step, err := makeStepOn(t, localNode(t), TypeDirFetch, map[string]interface{}{"source": source, "dest": dest})
+	require.NoError(t, err)
+	require.Error(t, step.Run(formatters.NewMockTaskCompleter()))
+	assert.Equal(t, map[string]string{"app.log": "old"}, treeFiles(t, dest))
+}
+
+func TestDirTransferValidation(t *testing.T) {
+	node := localNode(t)
+	_, err := makeStepOn(t, node, TypeDirPush, map[string]interface{}{
+		"source": t.TempDir(), "dest": "/tmp/x", "values": map[string]interface{}{"a": 1},
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "values requires template: true")
+
+	_, err = makeStepOn(t, node, TypeDirFetch, map[string]interface{}{
+		"source": "/var/log", "dest": t.TempDir(), "include": []interface{}{"[bad"},
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `include pattern "[bad"`)
+
+	_, err = makeStepOn(t, node, TypeDirFetch, map[string]interface{}{
+		"source": "/var/log", "dest": t.TempDir(), "exclude": "*.log",
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "exclude must be an array")
+}
@@ -52,6 +52,11 @@ func newDNSRequestStep(c *config.StepConfig, node ifaces.Node) (ifaces.Step, err
 	if err != nil {
 		return nil, err
 	}
+	if from == VantageNode {
+		if err := requireShell(c, node); err != nil {
+			return nil, err
+		}
+	}
 
 	return &DNSRequestStep{
 		BaseStep:    baseFor(c),
@@ -0,0 +1,182 @@
+package steptypes
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/bgrewell/dart/internal/config"
+	"github.com/bgrewell/dart/internal/formatters"
+	"github.com/bgrewell/dart/pkg/ifaces"
+	"github.com/bgrewell/dart/pkg/nodetypes"
+)
+
+var _ ifaces.Step = &FileCopyStep{}
+
+// copyEndpoint is one side of a node-to-node copy.
+type copyEndpoint struct {
+	nodeName string
+	node     ifaces.Node
+	path     string
+}
+
+func (e copyEndpoint) String() string {
+	return e.nodeName + ":" + e.path
+}
+
+// FileCopyStep copies a file from one node to another — a join token or a
+// CA certificate generated on one node and needed on the next. Contents
+// stream through the machine running DART, and the copy is read back and
+// compared by checksum before the step succeeds.
+type FileCopyStep struct {
+	BaseStep
+	from      copyEndpoint
+	to        copyEndpoint
+	mode      os.FileMode
+	overwrite bool
+	createDir bool
+}
+
+func newFileCopyStep(c *config.StepConfig, node ifaces.Node, nodes map[string]ifaces.Node) (ifaces.Step, error) {
+	from, err := copyEndpointOption(c, "from", node, nodes)
+	if err != nil {
+		return nil, err
+	}
+	to, err := copyEndpointOption(c, "to", node, nodes)
+	if err != nil {
+		return nil, err
+	}
+	if from.nodeName == to.nodeName && from.path == to.path {
+		return nil, optionError(c, "to names the same file as from (%s) in step %q", from, c.Name)
+	}
+	mode, err := optFileMode(c, "mode")
+	if err != nil {
+		return nil, err
+	}
+	overwrite, err := optBool(c, "overwrite")
+	if err != nil {
+		return nil, err
+	}
+	createDir, err := optBool(c, "create_dir")
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileCopyStep{
+		BaseStep:  baseFor(c),
+		from:      from,
+		to:        to,
+		mode:      mode,
+		overwrite: overwrite,
+		createDir: createDir,
+	}, nil
+}
+
+// copyEndpointOption reads a {node, path} option. node defaults to the
+// step's own node, so `node: b` with `from: {node: a, path: ...}` copies
+// from a onto each node the step targets.
+func copyEndpointOption(c *config.StepConfig, key string, node ifaces.Node, nodes map[string]ifaces.Node) (copyEndpoint, error) {
+	noteOption(key)
+	raw, ok := c.Step.Options[key]
+	if !ok {
+		return copyEndpoint{}, optionError(c, "%s is required in step %q", key, c.Name)
+	}
+	spec, ok := raw.(map[string]interface{})
+	if !ok {
+		return copyEndpoint{}, optionError(c, "%s must be a map with node and path in step %q (got %T)", key, c.Name, raw)
+	}
+	var unknown []string
+	for field := range spec {
+		if field != "node" && field != "path" {
+			unknown = append(unknown, field)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return copyEndpoint{}, optionError(c, "%s has unknown key %q in step %q (accepted: node, path)", key, unknown[0], c.Name)
+	}
+
+	endpoint := copyEndpoint{nodeName: c.Node[0], node: node}
+	if rawPath, ok := spec["path"].(string); ok && rawPath != "" {
+		endpoint.path = rawPath
+	} else {
+		return copyEndpoint{}, optionError(c, "%s.path is required and must be a string in step %q", key, c.Name)
+	}
+	if rawNode, present := spec["node"]; present {
+		name, ok := rawNode.(string)
+		if !ok || name == "" {
+			return copyEndpoint{}, optionError(c, "%s.node must be a node name in step %q (got %T)", key, c.Name, rawNode)
+		}
+		peer, ok := nodes[name]
+		if !ok {
+			return copyEndpoint{}, optionError(c, "%s.node %q not found in step %q", key, name, c.Name)
+		}
+		endpoint.nodeName, endpoint.node = name, peer
+	}
+	if !nodetypes.HasShell(endpoint.node) {
+		return copyEndpoint{}, optionError(c, "%s.node %q has no POSIX shell, which a %s step needs (node types with one: %s) in step %q",
+			key, endpoint.nodeName, c.Step.Type, nodetypes.SupportingTypes(nodetypes.CapabilityShell), c.Name)
+	}
+	return endpoint, nil
+}
+
+// Run streams the file between the nodes and verifies the copy.
+func (s *FileCopyStep) Run(updater formatters.TaskCompleter) error {
+	if err := s.copy(); err != nil {
+		updater.Error()
+		return err
+	}
+	updater.Complete()
+	return nil
+}
+
+func (s *FileCopyStep) copy() error {
+	fromOps := fileOpsFor(s.from.node)
+	toOps := fileOpsFor(s.to.node)
+
+	mode := s.mode
+	if mode == 0 {
+		// Carry the source's permissions, as file_push does
+		sourceMode, err := fromOps.FileMode(s.from.path)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", s.from, err)
+		}
+		mode = sourceMode
+	}
+
+	source, err := fromOps.Open(s.from.path)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", s.from, err)
+	}
+	defer source.Close()
+
+	sent := sha256.New()
+	if err := toOps.WriteStream(s.to.path, io.TeeReader(source, sent), mode, s.overwrite, s.createDir); err != nil {
+		return fmt.Errorf("failed to copy %s to %s: %w", s.from, s.to, err)
+	}
+
+	// Read the copy back: a short or corrupted write on the way in must
+	// fail here, not in whatever uses the file next
+	written, err := toOps.Open(s.to.path)
+	if err != nil {
+		return fmt.Errorf("failed to verify %s: %w", s.to, err)
+	}
+	defer written.Close()
+	received := sha256.New()
+	if _, err := io.Copy(received, written); err != nil {
+		return fmt.Errorf("failed to verify %s: %w", s.to, err)
+	}
+	if sum(sent) != sum(received) {
+		return fmt.Errorf("checksum mismatch copying %s to %s: sent sha256 %s, destination has %s",
+			s.from, s.to, sum(sent), sum(received))
+	}
+	return nil
+}
+
+func sum(h hash.Hash) string {
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,122 @@
+package steptypes
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bgrewell/dart/internal/config"
+	"github.com/bgrewell/dart/internal/formatters"
+	"github.com/bgrewell/dart/pkg/ifaces"
+	"github.com/bgrewell/dart/pkg/nodetypes"
+	lxdclient "github.com/canonical/lxd/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// makeCopyStep builds a file_copy step targeting node "b", with node "a"
+// available as a peer.
+func makeCopyStep(t *testing.T, a, b ifaces.Node, options map[string]interface{}) (ifaces.Step, error) {
+	t.Helper()
+	nodes := map[string]ifaces.Node{"a": a, "b": b}
+	configs := []*config.StepConfig{{
+		Name: "copy test",
+		Node: config.NodeReference{"b"},
+		Step: config.StepDetails{Type: TypeFileCopy, Options: options},
+	}}
+	steps, err := CreateSteps(configs, nodes)
+	if err != nil {
+		return nil, err
+	}
+	require.Len(t, steps, 1)
+	return steps[0], nil
+}
+
+// corruptingLxdFiles flips the contents of every write, as a broken
+// transport would.
+type corruptingLxdFiles struct {
+	fakeLxdFiles
+}
+
+func (f *corruptingLxdFiles) CreateInstanceFile(instance, p string, args lxdclient.InstanceFileArgs) error {
+	data, err := io.ReadAll(args.Content)
+	if err != nil {
+		return err
+	}
+	args.Content = strings.NewReader(strings.ToUpper(string(data)))
+	return f.fakeLxdFiles.CreateInstanceFile(instance, p, args)
+}
+
+func TestFileCopyBetweenNodes(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "ca.pem")
+	require.NoError(t, os.WriteFile(source, []byte("-----BEGIN CERTIFICATE-----\n"), 0640))
+	dest := filepath.Join(dir, "b", "ca.pem")
+	target := &lxdMockNode{MockNode: nodetypes.NewMockNode(), server: &fakeLxdFiles{}}
+
+	step, err := makeCopyStep(t, localNode(t), target, map[string]interface{}{
+		"from":       map[string]interface{}{"node": "a", "path": source},
+		"to":         map[string]interface{}{"path": dest},
+		"create_dir": true,
+	})
+	require.NoError(t, err)
+	require.NoError(t, step.Run(formatters.NewMockTaskCompleter()))
+
+	contents, err := os.ReadFile(dest)
+	require.NoError(t, err)
+	assert.Equal(t, "-----BEGIN CERTIFICATE-----\n", string(contents))
+	info, err := os.Stat(dest)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0640), info.Mode().Perm(), "the source's mode carries over")
+
+	// Consistent with the other file steps, an existing copy is kept
+	err = step.Run(formatters.NewMockTaskCompleter())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "b:"+dest)
+}
+
+func TestFileCopyDetectsCorruption(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "token")
+	require.NoError(t, os.WriteFile(source, []byte("join-token"), 0600))
+	target := &lxdMockNode{MockNode: nodetypes.NewMockNode(), server: &corruptingLxdFiles{}}
+
+	step, err := makeCopyStep(t, localNode(t), target, map[string]interface{}{
+		"from": map[string]interface{}{"node": "a", "path": source},
+		"to":   map[string]interface{}{"path": filepath.Join(dir, "token.copy")},
+	})
+	require.NoError(t, err)
+	err = step.Run(formatters.NewMockTaskCompleter())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "checksum mismatch")
+}
+
+func TestFileCopyValidation(t *testing.T) {
+	a, b := localNode(t), localNode(t)
+	cases := []struct {
+		options map[string]interface{}
+		want    string
+	}{
+		{map[string]interface{}{"to": map[string]interface{}{"path": "/x"}}, "from is required"},
+		{map[string]interface{}{"from": "a:/x", "to": map[string]interface{}{"path": "/x"}}, "from must be a map"},
+		{map[string]interface{}{
+			"from": map[string]interface{}{"node": "c", "path": "/x"}, "to": map[string]interface{}{"path": "/y"},
+		}, `from.node "c" not found`},
+		{map[string]interface{}{
+			"from": map[string]interface{}{"node": "a"}, "to": map[string]interface{}{"path": "/y"},
+		}, "from.path is required"},
+		{map[string]interface{}{
+			"from": map[string]interface{}{"node": "a", "path": "/x", "mode": "0600"}, "to": map[string]interface{}{"path": "/y"},
+		}, `from has unknown key "mode"`},
+		{map[string]interface{}{
+			"from": map[string]interface{}{"node": "b", "path": "/x"}, "to": map[string]interface{}{"path": "/x"},
+		}, "to names the same file"},
+	}
+	for _, tc := range cases {
+		_, err := makeCopyStep(t, a, b, tc.options)
+		require.Error(t, err, tc.want)
+		assert.Contains(t, err.Error(), tc.want)
+	}
+}
@@ -19,10 +19,16 @@ type FileDeleteStep struct {
 }
 
 func newFileDeleteStep(c *config.StepConfig, node ifaces.Node) (ifaces.Step, error) {
+	if err := requireShell(c, node); err != nil {
+		return nil, err
+	}
 	filePath, err := requiredString(c, "path", "file path is required")
 	if err != nil {
 		return nil, err
 	}
+	if err := requireDeletion(c, node, "file_delete"); err != nil {
+		return nil, err
+	}
 	ignoreErrors, err := optBool(c, "ignore_errors")
 	if err != nil {
 		return nil, err
@@ -60,6 +60,9 @@ type FileEditStep struct {
 
 // newFileEditStep parses and validates the edit configuration.
 func newFileEditStep(c *config.StepConfig, node ifaces.Node) (ifaces.Step, error) {
+	if err := requireShell(c, node); err != nil {
+		return nil, err
+	}
 	filePath, err := requiredString(c, "path", "file path is required")
 	if err != nil {
 		return nil, err
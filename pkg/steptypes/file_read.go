@@ -21,6 +21,9 @@ type FileReadStep struct {
 }
 
 func newFileReadStep(c *config.StepConfig, node ifaces.Node) (ifaces.Step, error) {
+	if err := requireShell(c, node); err != nil {
+		return nil, err
+	}
 	filePath, err := requiredString(c, "path", "file path is required")
 	if err != nil {
 		return nil, err
@@ -2,6 +2,7 @@ package steptypes
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
@@ -39,6 +40,9 @@ func localPath(c *config.StepConfig, raw string) (string, error) {
 }
 
 func newFilePushStep(c *config.StepConfig, node ifaces.Node) (ifaces.Step, error) {
+	if err := requireShell(c, node); err != nil {
+		return nil, err
+	}
 	source, err := requiredString(c, "source", "source is required")
 	if err != nil {
 		return nil, err
@@ -74,25 +78,26 @@ func newFilePushStep(c *config.StepConfig, node ifaces.Node) (ifaces.Step, error
 	}, nil
 }
 
-// Run reads the local source and writes it to the node.
+// Run streams the local source to the node.
 func (s *FilePushStep) Run(updater formatters.TaskCompleter) error {
-	contents, err := os.ReadFile(s.source)
+	source, err := os.Open(s.source)
 	if err != nil {
 		updater.Error()
 		return fmt.Errorf("failed to read source %s: %w", s.source, err)
 	}
+	defer source.Close()
 
 	mode := s.mode
 	if mode == 0 {
 		// Carry the source's permissions when none were requested, so
 		// pushed scripts stay executable
-		if info, statErr := os.Stat(s.source); statErr == nil {
+		if info, statErr := source.Stat(); statErr == nil {
 			mode = info.Mode().Perm()
 		}
 	}
 
 	ops := fileOpsFor(s.node)
-	if err := ops.WriteFile(s.dest, string(contents), mode, s.overwrite, s.createDir); err != nil {
+	if err := ops.WriteStream(s.dest, source, mode, s.overwrite, s.createDir); err != nil {
 		updater.Error()
 		return fmt.Errorf("failed to push %s to %s: %w", s.source, s.dest, err)
 	}
@@ -115,6 +120,9 @@ type FileFetchStep struct {
 }
 
 func newFileFetchStep(c *config.StepConfig, node ifaces.Node) (ifaces.Step, error) {
+	if err := requireShell(c, node); err != nil {
+		return nil, err
+	}
 	source, err := requiredString(c, "source", "source is required")
 	if err != nil {
 		return nil, err
@@ -145,14 +153,15 @@ func newFileFetchStep(c *config.StepConfig, node ifaces.Node) (ifaces.Step, erro
 	}, nil
 }
 
-// Run reads the file from the node and writes it locally.
+// Run streams the file from the node to the local destination.
 func (s *FileFetchStep) Run(updater formatters.TaskCompleter) error {
 	ops := fileOpsFor(s.node)
-	contents, err := ops.ReadFile(s.source)
+	source, err := ops.Open(s.source)
 	if err != nil {
 		updater.Error()
 		return fmt.Errorf("failed to fetch %s: %w", s.source, err)
 	}
+	defer source.Close()
 
 	if s.createDir {
 		if err := os.MkdirAll(filepath.Dir(s.dest), 0755); err != nil {
@@ -175,8 +184,12 @@ func (s *FileFetchStep) Run(updater formatters.TaskCompleter) error {
 		updater.Error()
 		return fmt.Errorf("failed to write %s: %w", s.dest, err)
 	}
-	defer file.Close()
-	if _, err := file.WriteString(contents); err != nil {
+	if _, err := io.Copy(file, source); err != nil {
+		file.Close()
+		updater.Error()
+		return fmt.Errorf("failed to fetch %s to %s: %w", s.source, s.dest, err)
+	}
+	if err := file.Close(); err != nil {
 		updater.Error()
 		return fmt.Errorf("failed to write %s: %w", s.dest, err)
 	}
@@ -204,6 +217,9 @@ type FileTemplateStep struct {
 }
 
 func newFileTemplateStep(c *config.StepConfig, node ifaces.Node) (ifaces.Step, error) {
+	if err := requireShell(c, node); err != nil {
+		return nil, err
+	}
 	source, err := requiredString(c, "source", "source is required")
 	if err != nil {
 		return nil, err
@@ -228,22 +244,9 @@ func newFileTemplateStep(c *config.StepConfig, node ifaces.Node) (ifaces.Step, e
 		return nil, err
 	}
 
-	values := map[string]interface{}{}
-	noteOption("values")
-	if raw, ok := c.Step.Options["values"]; ok {
-		valueMap, ok := raw.(map[string]interface{})
-		if !ok {
-			return nil, optionError(c, "values must be a map in step %q (got %T)", c.Name, raw)
-		}
-		// missingkey=error only catches absent keys; a key present with a
-		// null value renders the literal "<no value>" into a live config
-		// with no error at all
-		for key, value := range valueMap {
-			if value == nil {
-				return nil, optionError(c, "template value %q is null in step %q; give it a value or remove it", key, c.Name)
-			}
-		}
-		values = valueMap
+	values, err := templateValues(c)
+	if err != nil {
+		return nil, err
 	}
 
 	// Parse at config time so a broken template fails before anything runs
@@ -251,7 +254,7 @@ func newFileTemplateStep(c *config.StepConfig, node ifaces.Node) (ifaces.Step, e
 	if err != nil {
 		return nil, optionError(c, "cannot read template %s in step %q: %v", source, c.Name, err)
 	}
-	if _, err := template.New(filepath.Base(source)).Option("missingkey=error").Parse(string(body)); err != nil {
+	if _, err := parseTemplate(source, body); err != nil {
 		return nil, optionError(c, "template %s in step %q is invalid: %v", source, c.Name, err)
 	}
 
@@ -275,26 +278,14 @@ func (s *FileTemplateStep) Run(updater formatters.TaskCompleter) error {
 		return fmt.Errorf("failed to read template %s: %w", s.source, err)
 	}
 
-	tmpl, err := template.New(filepath.Base(s.source)).Option("missingkey=error").Parse(string(body))
+	rendered, err := renderTemplate(s.source, body, s.values)
 	if err != nil {
 		updater.Error()
-		return fmt.Errorf("template %s is invalid: %w", s.source, err)
-	}
-
-	var rendered strings.Builder
-	if err := tmpl.Execute(&rendered, s.values); err != nil {
-		updater.Error()
-		return fmt.Errorf("failed to render %s: %w", s.source, err)
-	}
-
-	// Belt and braces for the nil paths text/template renders silently
-	if strings.Contains(rendered.String(), "<no value>") {
-		updater.Error()
-		return fmt.Errorf("rendering %s produced \"<no value>\": a referenced value is null or missing", s.source)
+		return err
 	}
 
 	ops := fileOpsFor(s.node)
-	if err := ops.WriteFile(s.dest, rendered.String(), s.mode, s.overwrite, s.createDir); err != nil {
+	if err := ops.WriteFile(s.dest, rendered, s.mode, s.overwrite, s.createDir); err != nil {
 		updater.Error()
 		return fmt.Errorf("failed to write rendered %s to %s: %w", s.source, s.dest, err)
 	}
@@ -302,3 +293,49 @@ func (s *FileTemplateStep) Run(updater formatters.TaskCompleter) error {
 	updater.Complete()
 	return nil
 }
+
+// templateValues reads the `values` option shared by the templating steps.
+func templateValues(c *config.StepConfig) (map[string]interface{}, error) {
+	values := map[string]interface{}{}
+	noteOption("values")
+	raw, ok := c.Step.Options["values"]
+	if !ok {
+		return values, nil
+	}
+	valueMap, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, optionError(c, "values must be a map in step %q (got %T)", c.Name, raw)
+	}
+	// missingkey=error only catches absent keys; a key present with a
+	// null value renders the literal "<no value>" into a live config
+	// with no error at all
+	for key, value := range valueMap {
+		if value == nil {
+			return nil, optionError(c, "template value %q is null in step %q; give it a value or remove it", key, c.Name)
+		}
+	}
+	return valueMap, nil
+}
+
+func parseTemplate(source string, body []byte) (*template.Template, error) {
+	return template.New(filepath.Base(source)).Option("missingkey=error").Parse(string(body))
+}
+
+// renderTemplate renders a template body read from source.
+func renderTemplate(source string, body []byte, values map[string]interface{}) (string, error) {
+	tmpl, err := parseTemplate(source, body)
+	if err != nil {
+		return "", fmt.Errorf("template %s is invalid: %w", source, err)
+	}
+
+	var rendered strings.Builder
+	if err := tmpl.Execute(&rendered, values); err != nil {
+		return "", fmt.Errorf("failed to render %s: %w", source, err)
+	}
+
+	// Belt and braces for the nil paths text/template renders silently
+	if strings.Contains(rendered.String(), "<no value>") {
+		return "", fmt.Errorf("rendering %s produced \"<no value>\": a referenced value is null or missing", source)
+	}
+	return rendered.String(), nil
+}
@@ -2,10 +2,14 @@ package steptypes
 
 import (
 	"encoding/base64"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
 	"path"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -13,28 +17,68 @@ import (
 	"github.com/bgrewell/dart/internal/helpers"
 	"github.com/bgrewell/dart/pkg/ifaces"
 	"github.com/bgrewell/dart/pkg/nodetypes"
+	"github.com/pkg/sftp"
 )
 
 // fileOps abstracts the file operations used by the file_* steps so they act
-// on the step's target node: local nodes use the native filesystem, remote
-// nodes (docker, LXD, SSH, ...) go through shell commands over node.Execute.
+// on the step's target node: local nodes use the native filesystem, SSH
+// nodes use SFTP, docker nodes the Engine's archive API, LXD nodes the
+// instance file API, and other remote nodes go through shell commands over
+// node.Execute.
 // Note: the shell-based implementation requires a POSIX shell with cat,
-// test, rm, mkdir, stat, chmod, printf, and base64 available on the node.
+// test, rm, rmdir, mkdir, stat, chmod, printf, and base64 available on the node.
 type fileOps interface {
 	ReadFile(path string) (string, error)
+	// Open reads a file as a stream. Only the shell-based implementation
+	// holds the whole file in memory.
+	Open(path string) (io.ReadCloser, error)
 	// WriteFile creates or overwrites a file. With overwrite false the write
 	// fails if the file already exists. A zero mode leaves new files at the
 	// default 0644 and existing files untouched.
 	WriteFile(path, contents string, mode os.FileMode, overwrite, createDir bool) error
+	// WriteStream is WriteFile for contents read from r, so a large file
+	// is never held in memory.
+	WriteStream(path string, r io.Reader, mode os.FileMode, overwrite, createDir bool) error
 	DeleteFile(path string) error
+	// DeleteDir removes an empty directory.
+	DeleteDir(path string) error
 	Exists(path string) (bool, error)
 	// FileMode returns the permission bits of an existing file.
 	FileMode(path string) (os.FileMode, error)
+	// MkdirAll creates a directory and any missing parents with mode;
+	// existing directories are left as they are.
+	MkdirAll(path string, mode os.FileMode) error
+	// SetDirMode sets the permission bits of an existing directory, which
+	// MkdirAll leaves alone and the umask narrows on creation.
+	SetDirMode(path string, mode os.FileMode) error
+	// List returns every entry below root, recursively, parents before
+	// their children. Symlinks are listed, not followed.
+	List(root string) ([]fileEntry, error)
+}
+
+// fileEntry is one entry of a listed tree.
+type fileEntry struct {
+	// Path is relative to the listed root, with forward slashes
+	Path string
+	// Mode carries the permission bits and the directory or symlink type
+	Mode os.FileMode
+}
+
+func sortEntries(entries []fileEntry) []fileEntry {
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+	return entries
+}
+
+// sftpNode is implemented by nodes that can serve file operations over
+// SFTP (ssh nodes).
+type sftpNode interface {
+	SFTP() (*sftp.Client, error)
 }
 
 // fileOpsFor selects the implementation for a node. A nil node (steps
 // constructed directly, e.g. in tests) and local nodes use the native
-// filesystem; everything else operates through the node's shell.
+// filesystem; SSH, docker, and LXD nodes use their native file transfer;
+// everything else operates through the node's shell.
 func fileOpsFor(node ifaces.Node) fileOps {
 	if node == nil {
 		return localFileOps{}
@@ -42,6 +86,23 @@ func fileOpsFor(node ifaces.Node) fileOps {
 	if _, ok := node.(*nodetypes.LocalNode); ok {
 		return localFileOps{}
 	}
+	if n, ok := node.(sftpNode); ok {
+		// A server without the sftp subsystem (some appliances, minimal
+		// images) still has a shell
+		if client, err := n.SFTP(); err == nil {
+			return sftpFileOps{client: client}
+		}
+	}
+	if n, ok := node.(dockerNode); ok {
+		if cli, container, err := n.DockerContainer(); err == nil {
+			return dockerFileOps{execFileOps: execFileOps{node: node}, cli: cli, container: container}
+		}
+	}
+	if n, ok := node.(lxdNode); ok {
+		if server, instance, err := n.LxdInstance(); err == nil {
+			return lxdFileOps{server: server, instance: instance}
+		}
+	}
 	return execFileOps{node: node}
 }
 
@@ -53,7 +114,15 @@ func (localFileOps) ReadFile(p string) (string, error) {
 	return string(data), err
 }
 
-func (localFileOps) WriteFile(p, contents string, mode os.FileMode, overwrite, createDir bool) error {
+func (localFileOps) Open(p string) (io.ReadCloser, error) {
+	return os.Open(p)
+}
+
+func (o localFileOps) WriteFile(p, contents string, mode os.FileMode, overwrite, createDir bool) error {
+	return o.WriteStream(p, strings.NewReader(contents), mode, overwrite, createDir)
+}
+
+func (localFileOps) WriteStream(p string, r io.Reader, mode os.FileMode, overwrite, createDir bool) error {
 	if createDir {
 		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
 			return fmt.Errorf("failed to create directories: %w", err)
@@ -78,7 +147,7 @@ func (localFileOps) WriteFile(p, contents string, mode os.FileMode, overwrite, c
 	}
 	defer file.Close()
 
-	if _, err = file.WriteString(contents); err != nil {
+	if _, err = io.Copy(file, r); err != nil {
 		return err
 	}
 
@@ -96,6 +165,10 @@ func (localFileOps) DeleteFile(p string) error {
 	return os.Remove(p)
 }
 
+func (localFileOps) DeleteDir(p string) error {
+	return os.Remove(p)
+}
+
 func (localFileOps) Exists(p string) (bool, error) {
 	_, err := os.Stat(p)
 	if err == nil {
@@ -115,6 +188,43 @@ func (localFileOps) FileMode(p string) (os.FileMode, error) {
 	return info.Mode().Perm(), nil
 }
 
+func (localFileOps) MkdirAll(p string, mode os.FileMode) error {
+	return os.MkdirAll(p, mode)
+}
+
+func (localFileOps) SetDirMode(p string, mode os.FileMode) error {
+	return os.Chmod(p, mode.Perm())
+}
+
+func (localFileOps) List(root string) ([]fileEntry, error) {
+	var entries []fileEntry
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == root {
+			if !d.IsDir() {
+				return fmt.Errorf("%s is not a directory", root)
+			}
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, fileEntry{Path: filepath.ToSlash(rel), Mode: info.Mode().Type() | info.Mode().Perm()})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sortEntries(entries), nil
+}
+
 // execFileOps implements fileOps through shell commands on a node.
 type execFileOps struct {
 	node ifaces.Node
@@ -153,7 +263,19 @@ func (o execFileOps) ReadFile(p string) (string, error) {
 	return string(data), nil
 }
 
+func (o execFileOps) Open(p string) (io.ReadCloser, error) {
+	contents, err := o.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(strings.NewReader(contents)), nil
+}
+
 func (o execFileOps) WriteFile(p, contents string, mode os.FileMode, overwrite, createDir bool) error {
+	return o.WriteStream(p, strings.NewReader(contents), mode, overwrite, createDir)
+}
+
+func (o execFileOps) WriteStream(p string, r io.Reader, mode os.FileMode, overwrite, createDir bool) error {
 	if !overwrite {
 		exists, err := o.Exists(p)
 		if err != nil {
@@ -176,8 +298,7 @@ func (o execFileOps) WriteFile(p, contents string, mode os.FileMode, overwrite,
 	// MAX_ARG_STRLEN (128 KiB), so a one-shot write fails on files of
 	// roughly 95 KB with an opaque "argument list too long" from the
 	// container runtime.
-	encoded := base64.StdEncoding.EncodeToString([]byte(contents))
-	if err := o.writeEncoded(p, encoded); err != nil {
+	if err := o.writeEncoded(p, r); err != nil {
 		return fmt.Errorf("failed to write %s: %w", p, err)
 	}
 
@@ -194,31 +315,42 @@ func (o execFileOps) WriteFile(p, contents string, mode os.FileMode, overwrite,
 // 128 KiB per-argument kernel limit.
 const maxEncodedChunk = 32 * 1024
 
-// writeEncoded streams a base64 payload to a remote path in chunks,
-// truncating on the first chunk and appending after. A failure mid-stream
-// leaves a partial file, which is reported rather than silently accepted.
-func (o execFileOps) writeEncoded(path, encoded string) error {
+// writeEncoded streams r to a remote path in base64 chunks, truncating on
+// the first chunk and appending after, so only one chunk is in memory at a
+// time. A failure mid-stream leaves a partial file, which is reported
+// rather than silently accepted.
+func (o execFileOps) writeEncoded(path string, r io.Reader) error {
 	quoted := shellQuote(path)
-
-	// An empty payload still has to create (or truncate) the file
-	if encoded == "" {
-		_, err := execChecked(o.node, fmt.Sprintf(": > %s", quoted))
-		return err
-	}
+	raw := make([]byte, base64.StdEncoding.DecodedLen(maxEncodedChunk))
 
 	redirect := ">"
-	for start := 0; start < len(encoded); start += maxEncodedChunk {
-		end := start + maxEncodedChunk
-		if end > len(encoded) {
-			end = len(encoded)
+	offset := 0
+	for {
+		n, readErr := io.ReadFull(r, raw)
+		if readErr != nil && readErr != io.EOF && readErr != io.ErrUnexpectedEOF {
+			return fmt.Errorf("reading contents at offset %d: %w", offset, readErr)
+		}
+		if n == 0 && redirect == ">>" {
+			return nil
+		}
+
+		var cmd string
+		if n == 0 {
+			// An empty payload still has to create (or truncate) the file
+			cmd = fmt.Sprintf(": > %s", quoted)
+		} else {
+			encoded := base64.StdEncoding.EncodeToString(raw[:n])
+			cmd = fmt.Sprintf("printf '%%s' %s | base64 -d %s %s", encoded, redirect, quoted)
 		}
-		cmd := fmt.Sprintf("printf '%%s' %s | base64 -d %s %s", encoded[start:end], redirect, quoted)
 		if _, err := execChecked(o.node, cmd); err != nil {
-			return fmt.Errorf("chunk at offset %d of %d: %w", start, len(encoded), err)
+			return fmt.Errorf("chunk at offset %d: %w", offset, err)
+		}
+		if n < len(raw) {
+			return nil
 		}
+		offset += n
 		redirect = ">>"
 	}
-	return nil
 }
 
 func (o execFileOps) DeleteFile(p string) error {
@@ -226,6 +358,11 @@ func (o execFileOps) DeleteFile(p string) error {
 	return err
 }
 
+func (o execFileOps) DeleteDir(p string) error {
+	_, err := execChecked(o.node, "rmdir -- "+shellQuote(p))
+	return err
+}
+
 func (o execFileOps) Exists(p string) (bool, error) {
 	result, err := o.node.Execute("test -e " + shellQuote(p))
 	if err != nil {
@@ -235,7 +372,8 @@ func (o execFileOps) Exists(p string) (bool, error) {
 }
 
 func (o execFileOps) FileMode(p string) (os.FileMode, error) {
-	result, err := execChecked(o.node, "stat -c %a "+shellQuote(p))
+	// -L reports the target of a symlink, as os.Stat does
+	result, err := execChecked(o.node, "stat -L -c %a "+shellQuote(p))
 	if err != nil {
 		return 0, err
 	}
@@ -249,3 +387,217 @@ func (o execFileOps) FileMode(p string) (os.FileMode, error) {
 	}
 	return os.FileMode(bits), nil
 }
+
+// MkdirAll names every ancestor: mkdir -m applies only to the directories
+// named, not to parents -p creates along the way.
+func (o execFileOps) MkdirAll(p string, mode os.FileMode) error {
+	var dirs []string
+	for dir := path.Clean(p); ; dir = path.Dir(dir) {
+		dirs = append([]string{shellQuote(dir)}, dirs...)
+		if parent := path.Dir(dir); parent == dir {
+			break
+		}
+	}
+	_, err := execChecked(o.node, fmt.Sprintf("mkdir -p -m %o -- %s", mode.Perm(), strings.Join(dirs, " ")))
+	return err
+}
+
+func (o execFileOps) SetDirMode(p string, mode os.FileMode) error {
+	_, err := execChecked(o.node, fmt.Sprintf("chmod %o -- %s", mode.Perm(), shellQuote(p)))
+	return err
+}
+
+// List runs find from inside root, so every path comes back relative as
+// "./<path>", with stat's raw mode in hex ahead of it.
+func (o execFileOps) List(root string) ([]fileEntry, error) {
+	result, err := execChecked(o.node, fmt.Sprintf("cd %s && find . -exec stat -c '%%f %%n' {} +", shellQuote(root)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", root, err)
+	}
+	out, err := result.StdoutBytes()
+	if err != nil {
+		return nil, err
+	}
+	var entries []fileEntry
+	for _, line := range strings.Split(strings.TrimRight(string(out), "\n"), "\n") {
+		raw, name, ok := strings.Cut(line, " ")
+		if !ok || name == "." {
+			continue
+		}
+		bits, err := strconv.ParseUint(raw, 16, 32)
+		if err != nil {
+			return nil, fmt.Errorf("unexpected stat output for %s: %q", root, line)
+		}
+		entries = append(entries, fileEntry{Path: strings.TrimPrefix(name, "./"), Mode: unixFileMode(uint32(bits))})
+	}
+	return sortEntries(entries), nil
+}
+
+// unixFileMode converts a raw st_mode into an os.FileMode.
+func unixFileMode(raw uint32) os.FileMode {
+	mode := os.FileMode(raw & 0777)
+	switch raw & 0170000 {
+	case 0040000:
+		mode |= os.ModeDir
+	case 0120000:
+		mode |= os.ModeSymlink
+	case 0100000:
+	default:
+		mode |= os.ModeIrregular
+	}
+	return mode
+}
+
+// sftpFileOps implements fileOps over an SSH node's SFTP session: no shell
+// tools are needed on the target, and contents stream in both directions.
+type sftpFileOps struct {
+	client *sftp.Client
+}
+
+func (o sftpFileOps) ReadFile(p string) (string, error) {
+	file, err := o.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", p, err)
+	}
+	return string(data), nil
+}
+
+func (o sftpFileOps) Open(p string) (io.ReadCloser, error) {
+	file, err := o.client.Open(p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", p, err)
+	}
+	return file, nil
+}
+
+func (o sftpFileOps) WriteFile(p, contents string, mode os.FileMode, overwrite, createDir bool) error {
+	return o.WriteStream(p, strings.NewReader(contents), mode, overwrite, createDir)
+}
+
+// WriteStream truncates an existing file in place rather than replacing
+// it, so its owner, group, and (unless mode is set) permissions survive
+// the write — as they do with the shell's > redirection.
+func (o sftpFileOps) WriteStream(p string, r io.Reader, mode os.FileMode, overwrite, createDir bool) error {
+	if createDir {
+		if err := o.client.MkdirAll(path.Dir(p)); err != nil {
+			return fmt.Errorf("failed to create directories: %w", err)
+		}
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE
+	if overwrite {
+		flags |= os.O_TRUNC
+	} else {
+		// O_EXCL alone would fail with a bare "file exists" status from
+		// the server
+		exists, err := o.Exists(p)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return fmt.Errorf("file already exists: %s", p)
+		}
+		flags |= os.O_EXCL
+	}
+
+	file, err := o.client.OpenFile(p, flags)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", p, err)
+	}
+	if _, err := io.Copy(file, r); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write %s: %w", p, err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", p, err)
+	}
+
+	if mode != 0 {
+		if err := o.client.Chmod(p, mode); err != nil {
+			return fmt.Errorf("failed to set mode on %s: %w", p, err)
+		}
+	}
+	return nil
+}
+
+func (o sftpFileOps) DeleteFile(p string) error {
+	return o.client.Remove(p)
+}
+
+func (o sftpFileOps) DeleteDir(p string) error {
+	return o.client.RemoveDirectory(p)
+}
+
+func (o sftpFileOps) Exists(p string) (bool, error) {
+	_, err := o.client.Stat(p)
+	if err == nil {
+		return true, nil
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	return false, err
+}
+
+func (o sftpFileOps) FileMode(p string) (os.FileMode, error) {
+	info, err := o.client.Stat(p)
+	if err != nil {
+		return 0, err
+	}
+	return info.Mode().Perm(), nil
+}
+
+func (o sftpFileOps) MkdirAll(p string, mode os.FileMode) error {
+	info, err := o.client.Stat(p)
+	if err == nil {
+		if !info.IsDir() {
+			return fmt.Errorf("%s is not a directory", p)
+		}
+		return nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if parent := path.Dir(p); parent != p {
+		if err := o.MkdirAll(parent, mode); err != nil {
+			return err
+		}
+	}
+	if err := o.client.Mkdir(p); err != nil {
+		return fmt.Errorf("failed to create %s: %w", p, err)
+	}
+	return o.client.Chmod(p, mode)
+}
+
+func (o sftpFileOps) SetDirMode(p string, mode os.FileMode) error {
+	return o.client.Chmod(p, mode.Perm())
+}
+
+func (o sftpFileOps) List(root string) ([]fileEntry, error) {
+	info, err := o.client.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", root)
+	}
+	var entries []fileEntry
+	walker := o.client.Walk(root)
+	for walker.Step() {
+		if err := walker.Err(); err != nil {
+			return nil, err
+		}
+		if walker.Path() == root {
+			continue
+		}
+		rel := strings.TrimPrefix(walker.Path(), strings.TrimSuffix(root, "/")+"/")
+		mode := walker.Stat().Mode()
+		entries = append(entries, fileEntry{Path: rel, Mode: mode.Type() | mode.Perm()})
+	}
+	return sortEntries(entries), nil
+}
@@ -0,0 +1,632 @@
+package steptypes
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/bgrewell/dart/internal/config"
+	"github.com/bgrewell/dart/internal/docker"
+	"github.com/bgrewell/dart/internal/lxd"
+	"github.com/bgrewell/dart/pkg/ifaces"
+	lxdclient "github.com/canonical/lxd/client"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+)
+
+// dockerNode is implemented by nodes backed by a Docker (or Podman)
+// container.
+type dockerNode interface {
+	DockerContainer() (client.APIClient, string, error)
+}
+
+// lxdNode is implemented by nodes backed by an LXD instance.
+type lxdNode interface {
+	LxdInstance() (lxdclient.InstanceServer, string, error)
+}
+
+// seekable returns r as a seekable stream of known length, spooling it to a
+// temporary file when it is not one already: tar headers and the LXD file
+// API both need the length before the contents. Pushed files arrive as
+// *os.File and inline contents as *strings.Reader, so spooling is rare.
+func seekable(r io.Reader) (io.ReadSeeker, int64, func(), error) {
+	if rs, ok := r.(io.ReadSeeker); ok {
+		start, err := rs.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, 0, nil, err
+		}
+		end, err := rs.Seek(0, io.SeekEnd)
+		if err != nil {
+			return nil, 0, nil, err
+		}
+		if _, err := rs.Seek(start, io.SeekStart); err != nil {
+			return nil, 0, nil, err
+		}
+		return rs, end - start, func() {}, nil
+	}
+
+	spool, err := os.CreateTemp("", "dart-transfer-*")
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	cleanup := func() {
+		spool.Close()
+		os.Remove(spool.Name())
+	}
+	size, err := io.Copy(spool, r)
+	if err == nil {
+		_, err = spool.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		cleanup()
+		return nil, 0, nil, err
+	}
+	return spool, size, cleanup, nil
+}
+
+// archiveEntry reads one tar entry and closes the archive stream under it.
+type archiveEntry struct {
+	io.Reader
+	io.Closer
+}
+
+// dockerFileOps implements fileOps with the Engine's archive API, so file
+// steps work on images without a shell or coreutils (distroless, scratch).
+// The API has no way to remove a path, so DeleteFile and DeleteDir still
+// go through the container's shell; requireDeletion rejects the steps
+// that delete on a container without one.
+type dockerFileOps struct {
+	execFileOps
+	cli       client.APIClient
+	container string
+}
+
+// containerShell is what DeleteFile and DeleteDir run rm and rmdir
+// through on a docker node.
+const containerShell = "/bin/sh"
+
+// requireDeletion rejects, at construction, a step that deletes paths on
+// a docker node whose container has no shell, such as a distroless
+// image: every other file operation works there, and deletion would
+// otherwise fail only once the step runs. The container exists by then,
+// since steps are built after node setup.
+func requireDeletion(c *config.StepConfig, node ifaces.Node, reason string) error {
+	n, ok := node.(dockerNode)
+	if !ok {
+		return nil
+	}
+	cli, name, err := n.DockerContainer()
+	if err != nil {
+		return nil
+	}
+	if _, err := cli.ContainerStatPath(context.Background(), name, containerShell); !docker.IsNotFound(err) {
+		return nil
+	}
+	return optionError(c, "node %q has no %s in its container, which %s needs: the Docker API copies files in and out but cannot delete them, in step %q",
+		c.Node[0], containerShell, reason, c.Name)
+}
+
+// resolve stats a path, following a symlink to its target as the shell's
+// redirections would: writing through the archive API would otherwise
+// replace the link with a regular file.
+func (o dockerFileOps) resolve(p string) (string, container.PathStat, bool, error) {
+	stat, err := o.cli.ContainerStatPath(context.Background(), o.container, p)
+	if err != nil {
+		if docker.IsNotFound(err) {
+			return p, stat, false, nil
+		}
+		return p, stat, false, err
+	}
+	if stat.Mode&os.ModeSymlink != 0 && stat.LinkTarget != "" {
+		// The daemon resolves the whole chain inside the container, so
+		// one more stat reaches the final target
+		p = stat.LinkTarget
+		if stat, err = o.cli.ContainerStatPath(context.Background(), o.container, p); err != nil {
+			if docker.IsNotFound(err) {
+				return p, stat, false, nil
+			}
+			return p, stat, false, err
+		}
+	}
+	return p, stat, true, nil
+}
+
+func (o dockerFileOps) ReadFile(p string) (string, error) {
+	file, err := o.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", p, err)
+	}
+	return string(data), nil
+}
+
+func (o dockerFileOps) Open(p string) (io.ReadCloser, error) {
+	target, _, _, err := o.resolve(p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", p, err)
+	}
+	archive, stat, err := o.cli.CopyFromContainer(context.Background(), o.container, target)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", p, err)
+	}
+	if stat.Mode.IsDir() {
+		archive.Close()
+		return nil, fmt.Errorf("failed to read %s: is a directory", p)
+	}
+	tr := tar.NewReader(archive)
+	if _, err := tr.Next(); err != nil {
+		archive.Close()
+		return nil, fmt.Errorf("failed to read %s: %w", p, err)
+	}
+	return archiveEntry{Reader: tr, Closer: archive}, nil
+}
+
+// header returns an existing file's tar header, for its ownership.
+func (o dockerFileOps) header(p string) (*tar.Header, error) {
+	archive, _, err := o.cli.CopyFromContainer(context.Background(), o.container, p)
+	if err != nil {
+		return nil, err
+	}
+	defer archive.Close()
+	return tar.NewReader(archive).Next()
+}
+
+func (o dockerFileOps) WriteFile(p, contents string, mode os.FileMode, overwrite, createDir bool) error {
+	return o.WriteStream(p, strings.NewReader(contents), mode, overwrite, createDir)
+}
+
+// WriteStream extracts a one-file archive into the parent directory. An
+// existing file keeps its owner and group, and its mode unless one is
+// given; the archive would otherwise reset them to root and 0644.
+func (o dockerFileOps) WriteStream(p string, r io.Reader, mode os.FileMode, overwrite, createDir bool) error {
+	target, stat, exists, err := o.resolve(p)
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", p, err)
+	}
+	if exists && !overwrite {
+		return fmt.Errorf("file already exists: %s", p)
+	}
+	if exists && stat.Mode.IsDir() {
+		return fmt.Errorf("failed to write %s: is a directory", p)
+	}
+
+	file := &tar.Header{Typeflag: tar.TypeReg, Mode: 0644, ModTime: time.Now()}
+	if exists {
+		existing, err := o.header(target)
+		if err != nil {
+			return fmt.Errorf("failed to write %s: %w", p, err)
+		}
+		file.Uid, file.Gid = existing.Uid, existing.Gid
+		file.Uname, file.Gname = existing.Uname, existing.Gname
+		file.Mode = existing.Mode & 07777
+	}
+	if mode != 0 {
+		file.Mode = int64(mode)
+	}
+
+	base, dirs := path.Dir(target), []string(nil)
+	if createDir {
+		if base, dirs, err = o.missingDirs(base); err != nil {
+			return fmt.Errorf("failed to create directories: %w", err)
+		}
+	}
+
+	body, size, cleanup, err := seekable(r)
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", p, err)
+	}
+	defer cleanup()
+	file.Name = path.Base(target)
+	if len(dirs) > 0 {
+		file.Name = path.Join(dirs[len(dirs)-1], file.Name)
+	}
+	file.Size = size
+
+	if err := o.extract(base, dirHeaders(dirs, 0755), file, body); err != nil {
+		return fmt.Errorf("failed to write %s: %w", p, err)
+	}
+	return nil
+}
+
+// missingDirs finds the deepest existing ancestor of dir and the
+// directories below it that must be created, relative to it, shallowest
+// first. Existing directories are never part of an archive, so extracting
+// one cannot change their mode or owner.
+func (o dockerFileOps) missingDirs(dir string) (string, []string, error) {
+	var missing []string
+	for {
+		_, stat, exists, err := o.resolve(dir)
+		if err != nil {
+			return "", nil, err
+		}
+		if exists {
+			if !stat.Mode.IsDir() {
+				return "", nil, fmt.Errorf("%s is not a directory", dir)
+			}
+			break
+		}
+		missing = append([]string{path.Base(dir)}, missing...)
+		parent := path.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+	for i := 1; i < len(missing); i++ {
+		missing[i] = path.Join(missing[i-1], missing[i])
+	}
+	return dir, missing, nil
+}
+
+func dirHeaders(dirs []string, mode os.FileMode) []*tar.Header {
+	headers := make([]*tar.Header, 0, len(dirs))
+	for _, dir := range dirs {
+		headers = append(headers, &tar.Header{Typeflag: tar.TypeDir, Name: dir + "/", Mode: int64(mode.Perm()), ModTime: time.Now()})
+	}
+	return headers
+}
+
+// extract streams an archive of the headers, and then of file with the
+// contents of body when file is set, into base.
+func (o dockerFileOps) extract(base string, headers []*tar.Header, file *tar.Header, body io.Reader) error {
+	reader, writer := io.Pipe()
+	written := make(chan error, 1)
+	go func() {
+		tw := tar.NewWriter(writer)
+		err := func() error {
+			for _, header := range headers {
+				if err := tw.WriteHeader(header); err != nil {
+					return err
+				}
+			}
+			if file != nil {
+				if err := tw.WriteHeader(file); err != nil {
+					return err
+				}
+				if _, err := io.Copy(tw, body); err != nil {
+					return err
+				}
+			}
+			return tw.Close()
+		}()
+		writer.CloseWithError(err)
+		written <- err
+	}()
+
+	err := o.cli.CopyToContainer(context.Background(), o.container, base, reader, container.CopyToContainerOptions{})
+	// Unblocks the writer when the daemon stopped reading early
+	reader.Close()
+	if writeErr := <-written; err == nil && writeErr != nil {
+		err = writeErr
+	}
+	return err
+}
+
+func (o dockerFileOps) Exists(p string) (bool, error) {
+	_, _, exists, err := o.resolve(p)
+	return exists, err
+}
+
+func (o dockerFileOps) FileMode(p string) (os.FileMode, error) {
+	_, stat, exists, err := o.resolve(p)
+	if err != nil {
+		return 0, err
+	}
+	if !exists {
+		return 0, fmt.Errorf("stat %s: no such file or directory", p)
+	}
+	return stat.Mode.Perm(), nil
+}
+
+func (o dockerFileOps) MkdirAll(p string, mode os.FileMode) error {
+	base, dirs, err := o.missingDirs(path.Clean(p))
+	if err != nil {
+		return err
+	}
+	if len(dirs) == 0 {
+		return nil
+	}
+	if err := o.extract(base, dirHeaders(dirs, mode), nil, nil); err != nil {
+		return fmt.Errorf("failed to create %s: %w", p, err)
+	}
+	return nil
+}
+
+// SetDirMode extracts the directory's own header again with the new mode,
+// keeping its owner and group, which the archive would otherwise reset to
+// root.
+func (o dockerFileOps) SetDirMode(p string, mode os.FileMode) error {
+	target, stat, exists, err := o.resolve(path.Clean(p))
+	if err != nil {
+		return err
+	}
+	if !exists || !stat.Mode.IsDir() {
+		return fmt.Errorf("%s is not a directory", p)
+	}
+	existing, err := o.header(target)
+	if err != nil {
+		return fmt.Errorf("failed to set the mode of %s: %w", p, err)
+	}
+	dir := dirHeaders([]string{path.Base(target)}, mode)[0]
+	dir.Uid, dir.Gid = existing.Uid, existing.Gid
+	dir.Uname, dir.Gname = existing.Uname, existing.Gname
+	if err := o.extract(path.Dir(target), []*tar.Header{dir}, nil, nil); err != nil {
+		return fmt.Errorf("failed to set the mode of %s: %w", p, err)
+	}
+	return nil
+}
+
+// List reads the headers of the tree's archive. The daemon sends the
+// contents too, so listing a large tree costs as much as fetching it.
+func (o dockerFileOps) List(root string) ([]fileEntry, error) {
+	target, _, _, err := o.resolve(root)
+	if err != nil {
+		return nil, err
+	}
+	archive, stat, err := o.cli.CopyFromContainer(context.Background(), o.container, target)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", root, err)
+	}
+	defer archive.Close()
+	if !stat.Mode.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", root)
+	}
+
+	var entries []fileEntry
+	tr := tar.NewReader(archive)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s: %w", root, err)
+		}
+		// Entries are named under the root's own base name
+		rel := strings.TrimPrefix(strings.TrimSuffix(header.Name, "/"), stat.Name)
+		rel = strings.TrimPrefix(rel, "/")
+		if rel == "" {
+			continue
+		}
+		mode := header.FileInfo().Mode()
+		entries = append(entries, fileEntry{Path: rel, Mode: mode.Type() | mode.Perm()})
+	}
+	return sortEntries(entries), nil
+}
+
+// lxdFileOps implements fileOps with the LXD instance file API, so file
+// steps work without a shell in the instance.
+type lxdFileOps struct {
+	server   lxdclient.InstanceServer
+	instance string
+}
+
+// maxSymlinkHops bounds symlink resolution, as the kernel's ELOOP does.
+const maxSymlinkHops = 40
+
+// get fetches a path, following symlinks: the API reports a link as its
+// target path rather than resolving it. The returned reader is nil for
+// directories.
+func (o lxdFileOps) get(p string) (string, io.ReadCloser, *lxdclient.InstanceFileResponse, error) {
+	for i := 0; i < maxSymlinkHops; i++ {
+		content, resp, err := o.server.GetInstanceFile(o.instance, p)
+		if err != nil {
+			return p, nil, nil, err
+		}
+		if resp.Type != "symlink" {
+			return p, content, resp, nil
+		}
+		target, err := io.ReadAll(content)
+		content.Close()
+		if err != nil {
+			return p, nil, nil, err
+		}
+		link := strings.TrimSpace(string(target))
+		if !path.IsAbs(link) {
+			link = path.Join(path.Dir(p), link)
+		}
+		p = link
+	}
+	return p, nil, nil, fmt.Errorf("%s: too many levels of symbolic links", p)
+}
+
+// stat is get without the contents.
+func (o lxdFileOps) stat(p string) (string, *lxdclient.InstanceFileResponse, bool, error) {
+	target, content, resp, err := o.get(p)
+	if err != nil {
+		if lxd.IsNotFound(err) {
+			return target, nil, false, nil
+		}
+		return target, nil, false, err
+	}
+	if content != nil {
+		content.Close()
+	}
+	return target, resp, true, nil
+}
+
+func (o lxdFileOps) ReadFile(p string) (string, error) {
+	file, err := o.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", p, err)
+	}
+	return string(data), nil
+}
+
+func (o lxdFileOps) Open(p string) (io.ReadCloser, error) {
+	_, content, resp, err := o.get(p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", p, err)
+	}
+	if resp.Type == "directory" || content == nil {
+		if content != nil {
+			content.Close()
+		}
+		return nil, fmt.Errorf("failed to read %s: is a directory", p)
+	}
+	return content, nil
+}
+
+func (o lxdFileOps) WriteFile(p, contents string, mode os.FileMode, overwrite, createDir bool) error {
+	return o.WriteStream(p, strings.NewReader(contents), mode, overwrite, createDir)
+}
+
+// WriteStream keeps an existing file's owner, group, and (unless mode is
+// given) mode by passing them back with the new contents.
+func (o lxdFileOps) WriteStream(p string, r io.Reader, mode os.FileMode, overwrite, createDir bool) error {
+	target, resp, exists, err := o.stat(p)
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", p, err)
+	}
+	if exists && !overwrite {
+		return fmt.Errorf("file already exists: %s", p)
+	}
+	if exists && resp.Type == "directory" {
+		return fmt.Errorf("failed to write %s: is a directory", p)
+	}
+	if createDir {
+		if err := o.MkdirAll(path.Dir(target), 0755); err != nil {
+			return fmt.Errorf("failed to create directories: %w", err)
+		}
+	}
+
+	body, _, cleanup, err := seekable(r)
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", p, err)
+	}
+	defer cleanup()
+
+	// -1 leaves the owner to the server's default (root)
+	args := lxdclient.InstanceFileArgs{Content: body, Type: "file", WriteMode: "overwrite", UID: -1, GID: -1, Mode: 0644}
+	if exists {
+		args.UID, args.GID, args.Mode = resp.UID, resp.GID, resp.Mode
+	}
+	if mode != 0 {
+		args.Mode = int(mode)
+	}
+	if err := o.server.CreateInstanceFile(o.instance, target, args); err != nil {
+		return fmt.Errorf("failed to write %s: %w", p, err)
+	}
+	return nil
+}
+
+func (o lxdFileOps) DeleteFile(p string) error {
+	return o.server.DeleteInstanceFile(o.instance, p)
+}
+
+func (o lxdFileOps) DeleteDir(p string) error {
+	return o.server.DeleteInstanceFile(o.instance, p)
+}
+
+func (o lxdFileOps) Exists(p string) (bool, error) {
+	_, _, exists, err := o.stat(p)
+	return exists, err
+}
+
+func (o lxdFileOps) FileMode(p string) (os.FileMode, error) {
+	_, resp, exists, err := o.stat(p)
+	if err != nil {
+		return 0, err
+	}
+	if !exists {
+		return 0, fmt.Errorf("stat %s: no such file or directory", p)
+	}
+	return os.FileMode(resp.Mode).Perm(), nil
+}
+
+func (o lxdFileOps) MkdirAll(p string, mode os.FileMode) error {
+	p = path.Clean(p)
+	_, resp, exists, err := o.stat(p)
+	if err != nil {
+		return err
+	}
+	if exists {
+		if resp.Type != "directory" {
+			return fmt.Errorf("%s is not a directory", p)
+		}
+		return nil
+	}
+	if parent := path.Dir(p); parent != p {
+		if err := o.MkdirAll(parent, mode); err != nil {
+			return err
+		}
+	}
+	args := lxdclient.InstanceFileArgs{Type: "directory", UID: -1, GID: -1, Mode: int(mode.Perm())}
+	if err := o.server.CreateInstanceFile(o.instance, p, args); err != nil {
+		return fmt.Errorf("failed to create %s: %w", p, err)
+	}
+	return nil
+}
+
+// SetDirMode creates the directory again, which the server applies to
+// an existing one, passing back its owner and group.
+func (o lxdFileOps) SetDirMode(p string, mode os.FileMode) error {
+	target, resp, exists, err := o.stat(p)
+	if err != nil {
+		return err
+	}
+	if !exists || resp.Type != "directory" {
+		return fmt.Errorf("%s is not a directory", p)
+	}
+	args := lxdclient.InstanceFileArgs{Type: "directory", UID: resp.UID, GID: resp.GID, Mode: int(mode.Perm())}
+	if err := o.server.CreateInstanceFile(o.instance, target, args); err != nil {
+		return fmt.Errorf("failed to set the mode of %s: %w", p, err)
+	}
+	return nil
+}
+
+func (o lxdFileOps) List(root string) ([]fileEntry, error) {
+	target, resp, exists, err := o.stat(root)
+	if err != nil {
+		return nil, err
+	}
+	if !exists || resp.Type != "directory" {
+		return nil, fmt.Errorf("%s is not a directory", root)
+	}
+	var entries []fileEntry
+	if err := o.walk(target, "", resp.Entries, &entries); err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", root, err)
+	}
+	return sortEntries(entries), nil
+}
+
+// walk lists a directory's children without following symlinks.
+func (o lxdFileOps) walk(dir, rel string, names []string, entries *[]fileEntry) error {
+	for _, name := range names {
+		child, childRel := path.Join(dir, name), path.Join(rel, name)
+		content, resp, err := o.server.GetInstanceFile(o.instance, child)
+		if err != nil {
+			return err
+		}
+		if content != nil {
+			content.Close()
+		}
+		mode := os.FileMode(resp.Mode).Perm()
+		switch resp.Type {
+		case "directory":
+			*entries = append(*entries, fileEntry{Path: childRel, Mode: mode | os.ModeDir})
+			if err := o.walk(child, childRel, resp.Entries, entries); err != nil {
+				return err
+			}
+		case "symlink":
+			*entries = append(*entries, fileEntry{Path: childRel, Mode: mode | os.ModeSymlink})
+		default:
+			*entries = append(*entries, fileEntry{Path: childRel, Mode: mode})
+		}
+	}
+	return nil
+}
@@ -0,0 +1,319 @@
+package steptypes
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bgrewell/dart/internal/formatters"
+	"github.com/bgrewell/dart/pkg/nodetypes"
+	lxdclient "github.com/canonical/lxd/client"
+	"github.com/canonical/lxd/shared/api"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeDockerFiles serves the Engine's archive endpoints over the local
+// filesystem, with container paths mapped one-to-one onto host paths. Like
+// the daemon, it extracts headers with their mode, and records them so
+// tests can check what ownership was sent.
+type fakeDockerFiles struct {
+	client.APIClient
+	extracted []*tar.Header
+}
+
+func (f *fakeDockerFiles) ContainerStatPath(_ context.Context, id, p string) (container.PathStat, error) {
+	info, err := os.Lstat(p)
+	if err != nil {
+		return container.PathStat{}, fmt.Errorf("Error: No such container:path: %s:%s", id, p)
+	}
+	stat := container.PathStat{Name: info.Name(), Size: info.Size(), Mode: info.Mode(), Mtime: info.ModTime()}
+	if info.Mode()&os.ModeSymlink != 0 {
+		stat.LinkTarget, _ = filepath.EvalSymlinks(p)
+	}
+	return stat, nil
+}
+
+func (f *fakeDockerFiles) CopyFromContainer(ctx context.Context, id, p string) (io.ReadCloser, container.PathStat, error) {
+	stat, err := f.ContainerStatPath(ctx, id, p)
+	if err != nil {
+		return nil, stat, err
+	}
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	err = filepath.Walk(p, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		link := ""
+		if info.Mode()&os.ModeSymlink != 0 {
+			link, _ = os.Readlink(file)
+		}
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(filepath.Dir(p), file)
+		header.Name = filepath.ToSlash(rel)
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return err
+			}
+			_, err = tw.Write(data)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, stat, err
+	}
+	tw.Close()
+	return io.NopCloser(&buf), stat, nil
+}
+
+func (f *fakeDockerFiles) CopyToContainer(_ context.Context, id, dst string, content io.Reader, _ container.CopyToContainerOptions) error {
+	if info, err := os.Stat(dst); err != nil || !info.IsDir() {
+		return fmt.Errorf("Error: No such container:path: %s:%s", id, dst)
+	}
+	tr := tar.NewReader(content)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		f.extracted = append(f.extracted, header)
+		target := filepath.Join(dst, header.Name)
+		mode := os.FileMode(header.Mode).Perm()
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.Mkdir(target, mode); err != nil && !os.IsExist(err) {
+				return err
+			}
+		case tar.TypeReg:
+			file, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(file, tr); err != nil {
+				file.Close()
+				return err
+			}
+			file.Close()
+		}
+		if err := os.Chmod(target, mode); err != nil {
+			return err
+		}
+	}
+}
+
+// fakeLxdFiles serves the LXD instance file endpoints over the local
+// filesystem, and records the arguments of each write.
+type fakeLxdFiles struct {
+	lxdclient.InstanceServer
+	created []lxdclient.InstanceFileArgs
+}
+
+func (f *fakeLxdFiles) GetInstanceFile(_ string, p string) (io.ReadCloser, *lxdclient.InstanceFileResponse, error) {
+	info, err := os.Lstat(p)
+	if err != nil {
+		return nil, nil, api.StatusErrorf(http.StatusNotFound, "Not Found")
+	}
+	resp := &lxdclient.InstanceFileResponse{Mode: int(info.Mode().Perm())}
+	switch {
+	case info.IsDir():
+		resp.Type = "directory"
+		entries, err := os.ReadDir(p)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, entry := range entries {
+			resp.Entries = append(resp.Entries, entry.Name())
+		}
+		return nil, resp, nil
+	case info.Mode()&os.ModeSymlink != 0:
+		resp.Type = "symlink"
+		target, err := os.Readlink(p)
+		if err != nil {
+			return nil, nil, err
+		}
+		return io.NopCloser(strings.NewReader(target)), resp, nil
+	default:
+		resp.Type = "file"
+		file, err := os.Open(p)
+		if err != nil {
+			return nil, nil, err
+		}
+		return file, resp, nil
+	}
+}
+
+func (f *fakeLxdFiles) CreateInstanceFile(_ string, p string, args lxdclient.InstanceFileArgs) error {
+	f.created = append(f.created, args)
+	mode := os.FileMode(0644)
+	if args.Mode >= 0 {
+		mode = os.FileMode(args.Mode)
+	}
+	if args.Type == "directory" {
+		// The server applies the mode to a directory that already exists
+		if info, err := os.Stat(p); err == nil && info.IsDir() {
+			return os.Chmod(p, mode)
+		}
+		if err := os.Mkdir(p, mode); err != nil {
+			return api.StatusErrorf(http.StatusNotFound, "Not Found")
+		}
+		return nil
+	}
+	file, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return api.StatusErrorf(http.StatusNotFound, "Not Found")
+	}
+	defer file.Close()
+	if _, err := io.Copy(file, args.Content); err != nil {
+		return err
+	}
+	return os.Chmod(p, mode)
+}
+
+func (f *fakeLxdFiles) DeleteInstanceFile(_ string, p string) error {
+	if err := os.Remove(p); err != nil {
+		return api.StatusErrorf(http.StatusNotFound, "Not Found")
+	}
+	return nil
+}
+
+type dockerMockNode struct {
+	*nodetypes.MockNode
+	cli client.APIClient
+}
+
+func (n *dockerMockNode) DockerContainer() (client.APIClient, string, error) {
+	return n.cli, "c1", nil
+}
+
+type lxdMockNode struct {
+	*nodetypes.MockNode
+	server lxdclient.InstanceServer
+}
+
+func (n *lxdMockNode) LxdInstance() (lxdclient.InstanceServer, string, error) {
+	return n.server, "i1", nil
+}
+
+func TestFileOpsForContainers(t *testing.T) {
+	assert.IsType(t, dockerFileOps{}, fileOpsFor(&dockerMockNode{MockNode: nodetypes.NewMockNode(), cli: &fakeDockerFiles{}}))
+	assert.IsType(t, lxdFileOps{}, fileOpsFor(&lxdMockNode{MockNode: nodetypes.NewMockNode(), server: &fakeLxdFiles{}}))
+}
+
+// An overwrite sends the existing owner back; a new file leaves it to the
+// server.
+func TestContainerFileOpsKeepOwnership(t *testing.T) {
+	dir := t.TempDir()
+	p := filepath.Join(dir, "owned.txt")
+	require.NoError(t, os.WriteFile(p, []byte("x"), 0640))
+
+	fakeDocker := &fakeDockerFiles{}
+	dockerOps := dockerFileOps{cli: fakeDocker, container: "c1"}
+	require.NoError(t, dockerOps.WriteFile(p, "y", 0, true, false))
+	require.Len(t, fakeDocker.extracted, 1)
+	assert.Equal(t, os.Getuid(), fakeDocker.extracted[0].Uid)
+	assert.Equal(t, int64(0640), fakeDocker.extracted[0].Mode)
+
+	fakeLxd := &fakeLxdFiles{}
+	lxdOps := lxdFileOps{server: fakeLxd, instance: "i1"}
+	require.NoError(t, lxdOps.WriteFile(p, "z", 0, true, false))
+	require.NoError(t, lxdOps.WriteFile(filepath.Join(dir, "new.txt"), "z", 0, false, false))
+	require.Len(t, fakeLxd.created, 2)
+	assert.Equal(t, 0640, fakeLxd.created[0].Mode)
+	assert.Equal(t, int64(-1), fakeLxd.created[1].UID)
+	assert.Equal(t, 0644, fakeLxd.created[1].Mode)
+}
+
+// create_dir over the archive API sends only the missing directories, so
+// extracting it cannot reset an existing parent's mode.
+func TestDockerFileOpsCreateOnlyMissingDirs(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.Chmod(dir, 0700))
+	fake := &fakeDockerFiles{}
+	ops := dockerFileOps{cli: fake, container: "c1"}
+
+	require.NoError(t, ops.WriteFile(path.Join(dir, "a", "b", "f.txt"), "x", 0, false, true))
+
+	var names []string
+	for _, header := range fake.extracted {
+		names = append(names, header.Name)
+	}
+	assert.Equal(t, []string{"a/", "a/b/", "a/b/f.txt"}, names)
+	info, err := os.Stat(dir)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0700), info.Mode().Perm())
+}
+
+// shellLessDockerFiles is a container with no shell, such as a distroless
+// image.
+type shellLessDockerFiles struct {
+	*fakeDockerFiles
+}
+
+func (f shellLessDockerFiles) ContainerStatPath(ctx context.Context, id, p string) (container.PathStat, error) {
+	if p == containerShell {
+		return container.PathStat{}, fmt.Errorf("Error: No such container:path: %s:%s", id, p)
+	}
+	return f.fakeDockerFiles.ContainerStatPath(ctx, id, p)
+}
+
+// The archive API cannot delete, so a step that deletes on a shell-less
+// container is rejected when it is built rather than when it runs. A
+// fetch prunes locally, so it still syncs.
+func TestShellLessContainerRejectsDeletion(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "src")
+	writeTree(t, source, map[string]string{"app.conf": "x"})
+	node := &dockerMockNode{MockNode: nodetypes.NewMockNode(), cli: shellLessDockerFiles{&fakeDockerFiles{}}}
+
+	_, err := makeStepOn(t, node, TypeFileDelete, map[string]interface{}{"path": filepath.Join(dir, "src", "app.conf")})
+	assert.ErrorContains(t, err, "which file_delete needs")
+	_, err = makeStepOn(t, node, TypeDirPush, map[string]interface{}{"source": source, "dest": filepath.Join(dir, "out"), "sync": true})
+	assert.ErrorContains(t, err, "which sync: true needs")
+
+	push, err := makeStepOn(t, node, TypeDirPush, map[string]interface{}{"source": source, "dest": filepath.Join(dir, "out")})
+	require.NoError(t, err)
+	require.NoError(t, push.Run(formatters.NewMockTaskCompleter()))
+
+	fetched := filepath.Join(dir, "fetched")
+	writeTree(t, fetched, map[string]string{"stale.conf": "s"})
+	fetch, err := makeStepOn(t, node, TypeDirFetch, map[string]interface{}{"source": filepath.Join(dir, "out"), "dest": fetched, "sync": true})
+	require.NoError(t, err)
+	require.NoError(t, fetch.Run(formatters.NewMockTaskCompleter()))
+	assert.Equal(t, map[string]string{"app.conf": "x"}, treeFiles(t, fetched))
+
+	withShell := &dockerMockNode{MockNode: nodetypes.NewMockNode(), cli: &fakeDockerFiles{}}
+	_, err = makeStepOn(t, withShell, TypeFileDelete, map[string]interface{}{"path": filepath.Join(dir, "out", "app.conf")})
+	assert.NoError(t, err)
+}
+
+func TestSeekableSpoolsPlainReaders(t *testing.T) {
+	body, size, cleanup, err := seekable(io.MultiReader(strings.NewReader("ab"), strings.NewReader("cd")))
+	require.NoError(t, err)
+	defer cleanup()
+	assert.Equal(t, int64(4), size)
+	data, err := io.ReadAll(body)
+	require.NoError(t, err)
+	assert.Equal(t, "abcd", string(data))
+}
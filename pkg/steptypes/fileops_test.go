@@ -1,6 +1,10 @@
 package steptypes
 
 import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -8,26 +12,63 @@ import (
 
 	"github.com/bgrewell/dart/pkg/ifaces"
 	"github.com/bgrewell/dart/pkg/nodetypes"
+	"github.com/pkg/sftp"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
-// allFileOps exercises the same behaviors against both implementations so
-// local and shell-based file operations stay in sync. The exec variant runs
-// against a shell-backed local node, mirroring how remote nodes (docker
-// `sh -c`, LXD `bash -c`, SSH) interpret commands.
+// allFileOps exercises the same behaviors against every implementation so
+// local, shell-based, SFTP, docker, and LXD file operations stay in sync.
+// The exec variant runs against a shell-backed local node, mirroring how
+// remote nodes (docker `sh -c`, LXD `bash -c`) interpret commands; the
+// sftp, docker, and lxd variants talk to in-process stand-ins for their
+// servers over the local filesystem.
 func allFileOps(t *testing.T) map[string]fileOps {
 	t.Helper()
 	ops := map[string]fileOps{
 		"local": localFileOps{},
+		"sftp":  sftpFileOps{client: newTestSFTPClient(t)},
+		"lxd":   lxdFileOps{server: &fakeLxdFiles{}, instance: "i1"},
 	}
 	if runtime.GOOS != "windows" {
 		nodeOpts := map[string]interface{}{"shell": "/bin/sh"}
-		ops["exec"] = execFileOps{node: nodetypes.NewLocalNode("fileops-test", ifaces.NodeOptions(&nodeOpts), "")}
+		shell := execFileOps{node: nodetypes.NewLocalNode("fileops-test", ifaces.NodeOptions(&nodeOpts), "")}
+		ops["exec"] = shell
+		// Deletes go through the shell on docker nodes
+		ops["docker"] = dockerFileOps{execFileOps: shell, cli: &fakeDockerFiles{}, container: "c1"}
 	}
 	return ops
 }
 
+// newTestSFTPClient connects a client to an SFTP server over an in-memory
+// pipe, the same protocol an ssh node speaks on its sftp subsystem.
+func newTestSFTPClient(t *testing.T) *sftp.Client {
+	t.Helper()
+	serverConn, clientConn := net.Pipe()
+	server, err := sftp.NewServer(serverConn)
+	require.NoError(t, err)
+	go server.Serve()
+
+	client, err := sftp.NewClientPipe(clientConn, clientConn)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+	return client
+}
+
+// sftpMockNode is a non-local node that offers SFTP, as an ssh node does.
+type sftpMockNode struct {
+	*nodetypes.MockNode
+	client *sftp.Client
+	err    error
+}
+
+func (n *sftpMockNode) SFTP() (*sftp.Client, error) {
+	return n.client, n.err
+}
+
 func TestFileOpsWriteReadRoundtrip(t *testing.T) {
 	for name, ops := range allFileOps(t) {
 		t.Run(name, func(t *testing.T) {
@@ -116,6 +157,108 @@ func TestFileOpsForSelection(t *testing.T) {
 	assert.IsType(t, localFileOps{}, fileOpsFor(nil))
 	assert.IsType(t, localFileOps{}, fileOpsFor(nodetypes.NewLocalNode("local", nil, "")))
 	assert.IsType(t, execFileOps{}, fileOpsFor(nodetypes.NewMockNode()))
+	assert.IsType(t, sftpFileOps{}, fileOpsFor(&sftpMockNode{MockNode: nodetypes.NewMockNode(), client: newTestSFTPClient(t)}))
+	assert.IsType(t, execFileOps{}, fileOpsFor(&sftpMockNode{MockNode: nodetypes.NewMockNode(), err: errors.New("subsystem request failed")}),
+		"a server without the sftp subsystem falls back to the shell")
+}
+
+func TestFileOpsStreamRoundtrip(t *testing.T) {
+	for name, ops := range allFileOps(t) {
+		t.Run(name, func(t *testing.T) {
+			p := filepath.Join(t.TempDir(), "stream.bin")
+			payload := bytes.Repeat([]byte{0x00, 0xff, 'x', '\n'}, 64*1024)
+
+			require.NoError(t, ops.WriteStream(p, bytes.NewReader(payload), 0, false, false))
+
+			reader, err := ops.Open(p)
+			require.NoError(t, err)
+			defer reader.Close()
+			got, err := io.ReadAll(reader)
+			require.NoError(t, err)
+			assert.Equal(t, payload, got)
+		})
+	}
+}
+
+// Overwriting without a mode keeps the file's existing permissions; a
+// new file without a mode is 0644.
+func TestFileOpsOverwriteKeepsMode(t *testing.T) {
+	for name, ops := range allFileOps(t) {
+		t.Run(name, func(t *testing.T) {
+			p := filepath.Join(t.TempDir(), "script.sh")
+			require.NoError(t, ops.WriteFile(p, "old", 0, false, false))
+			mode, err := ops.FileMode(p)
+			require.NoError(t, err)
+			assert.Equal(t, os.FileMode(0644), mode)
+
+			require.NoError(t, os.Chmod(p, 0750))
+			require.NoError(t, ops.WriteFile(p, "new", 0, true, false))
+			mode, err = ops.FileMode(p)
+			require.NoError(t, err)
+			assert.Equal(t, os.FileMode(0750), mode)
+			got, err := ops.ReadFile(p)
+			require.NoError(t, err)
+			assert.Equal(t, "new", got)
+		})
+	}
+}
+
+// Writing through a symlink replaces the target's contents, not the link,
+// as the shell's redirection does.
+func TestFileOpsWriteThroughSymlink(t *testing.T) {
+	for name, ops := range allFileOps(t) {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			target := filepath.Join(dir, "real.conf")
+			link := filepath.Join(dir, "link.conf")
+			require.NoError(t, os.WriteFile(target, []byte("old"), 0600))
+			require.NoError(t, os.Symlink("real.conf", link))
+
+			require.NoError(t, ops.WriteFile(link, "new", 0, true, false))
+
+			info, err := os.Lstat(link)
+			require.NoError(t, err)
+			assert.NotZero(t, info.Mode()&os.ModeSymlink, "the link survives")
+			got, err := ops.ReadFile(link)
+			require.NoError(t, err)
+			assert.Equal(t, "new", got)
+			mode, err := ops.FileMode(link)
+			require.NoError(t, err)
+			assert.Equal(t, os.FileMode(0600), mode)
+		})
+	}
+}
+
+func TestFileOpsMkdirAllAndList(t *testing.T) {
+	for name, ops := range allFileOps(t) {
+		t.Run(name, func(t *testing.T) {
+			root := filepath.Join(t.TempDir(), "tree")
+			require.NoError(t, ops.MkdirAll(filepath.Join(root, "etc", "conf.d"), 0750))
+			require.NoError(t, ops.MkdirAll(filepath.Join(root, "etc"), 0700), "existing directories are fine")
+			require.NoError(t, ops.WriteFile(filepath.Join(root, "etc", "conf.d", "a.conf"), "a", 0600, false, false))
+			require.NoError(t, ops.WriteFile(filepath.Join(root, "run.sh"), "#!/bin/sh", 0755, false, false))
+			require.NoError(t, os.Symlink("run.sh", filepath.Join(root, "start")))
+
+			entries, err := ops.List(root)
+			require.NoError(t, err)
+			assert.Equal(t, []fileEntry{
+				{Path: "etc", Mode: os.ModeDir | 0750},
+				{Path: "etc/conf.d", Mode: os.ModeDir | 0750},
+				{Path: "etc/conf.d/a.conf", Mode: 0600},
+				{Path: "run.sh", Mode: 0755},
+				{Path: "start", Mode: os.ModeSymlink | 0777},
+			}, entries)
+
+			_, err = ops.List(filepath.Join(root, "run.sh"))
+			assert.Error(t, err, "listing a file must fail")
+
+			assert.Error(t, ops.DeleteDir(filepath.Join(root, "etc")), "a directory with contents must stay")
+			require.NoError(t, ops.DeleteFile(filepath.Join(root, "etc", "conf.d", "a.conf")))
+			require.NoError(t, ops.DeleteDir(filepath.Join(root, "etc", "conf.d")))
+			_, err = os.Stat(filepath.Join(root, "etc", "conf.d"))
+			assert.True(t, os.IsNotExist(err))
+		})
+	}
 }
 
 func TestShellQuote(t *testing.T) {
@@ -67,6 +67,11 @@ func newHTTPRequestStep(c *config.StepConfig, node ifaces.Node) (ifaces.Step, er
 	if err != nil {
 		return nil, err
 	}
+	if from == VantageNode {
+		if err := requireShell(c, node); err != nil {
+			return nil, err
+		}
+	}
 
 	headers := map[string]string{}
 	noteOption("headers")
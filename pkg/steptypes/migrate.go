@@ -0,0 +1,90 @@
+package steptypes
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bgrewell/dart/internal/config"
+	"github.com/bgrewell/dart/internal/formatters"
+	"github.com/bgrewell/dart/pkg/ifaces"
+	"github.com/bgrewell/dart/pkg/nodetypes"
+)
+
+var _ ifaces.Step = &MigrateStep{}
+
+// MigrateStep moves the target node to another cluster member and blocks
+// until it accepts commands again. Supported on node types implementing
+// ifaces.Migrator (lxd, lxd-vm).
+type MigrateStep struct {
+	BaseStep
+	node         ifaces.Node
+	target       string
+	mode         string
+	readyCommand string
+	timeout      time.Duration
+}
+
+// newMigrateStep parses target (the member to move to), mode
+// (auto|live|cold, default auto), ready_command (optional override of the
+// node's readiness check), and timeout seconds (0 uses the node's default).
+func newMigrateStep(c *config.StepConfig, node ifaces.Node) (ifaces.Step, error) {
+	target, err := requiredString(c, "target", "migrate target member is required")
+	if err != nil {
+		return nil, err
+	}
+
+	mode, present, err := optString(c, "mode")
+	if err != nil {
+		return nil, err
+	}
+	if !present || mode == "" {
+		mode = "auto"
+	}
+	if mode != "auto" && mode != "live" && mode != "cold" {
+		return nil, optionError(c, "mode must be \"auto\", \"live\" or \"cold\" in step %q (got %q)", c.Name, mode)
+	}
+
+	readyCommand, _, err := optString(c, "ready_command")
+	if err != nil {
+		return nil, err
+	}
+	timeoutSeconds, err := optFloat(c, "timeout", 0)
+	if err != nil {
+		return nil, err
+	}
+	if timeoutSeconds < 0 {
+		return nil, optionError(c, "timeout must be non-negative in step %q", c.Name)
+	}
+
+	if _, ok := node.(ifaces.Migrator); !ok {
+		return nil, optionError(c, "node %q does not support migrate (supported: %s) in step %q",
+			c.Node[0], nodetypes.SupportingTypes(nodetypes.CapabilityMigrate), c.Name)
+	}
+
+	return &MigrateStep{
+		BaseStep:     baseFor(c),
+		node:         node,
+		target:       target,
+		mode:         mode,
+		readyCommand: readyCommand,
+		timeout:      time.Duration(timeoutSeconds * float64(time.Second)),
+	}, nil
+}
+
+// Run moves the node and waits for readiness.
+func (s *MigrateStep) Run(updater formatters.TaskCompleter) error {
+	migrator, ok := s.node.(ifaces.Migrator)
+	if !ok {
+		updater.Error()
+		return fmt.Errorf("node does not support migrate")
+	}
+
+	updater.Update("migrating to " + s.target)
+	if err := migrator.Migrate(s.target, s.mode, s.readyCommand, s.timeout); err != nil {
+		updater.Error()
+		return err
+	}
+
+	updater.Complete()
+	return nil
+}
@@ -0,0 +1,64 @@
+package steptypes
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bgrewell/dart/internal/formatters"
+	"github.com/bgrewell/dart/pkg/nodetypes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// migrateMock records the last migrate call.
+type migrateMock struct {
+	*nodetypes.MockNode
+	member       string
+	mode         string
+	readyCommand string
+	timeout      time.Duration
+	failWith     error
+}
+
+func (m *migrateMock) Migrate(member string, mode string, readyCommand string, timeout time.Duration) error {
+	m.member, m.mode, m.readyCommand, m.timeout = member, mode, readyCommand, timeout
+	return m.failWith
+}
+
+func TestMigrateStep(t *testing.T) {
+	node := &migrateMock{MockNode: nodetypes.NewMockNode()}
+	step, err := makeStepOn(t, node, TypeMigrate, map[string]interface{}{"target": "member-2"})
+	require.NoError(t, err)
+	require.NoError(t, step.Run(formatters.NewMockTaskCompleter()))
+	assert.Equal(t, "member-2", node.member)
+	assert.Equal(t, "auto", node.mode, "auto by default")
+
+	step, err = makeStepOn(t, node, TypeMigrate, map[string]interface{}{
+		"target": "member-3", "mode": "cold", "ready_command": "systemctl is-active postgresql", "timeout": 90})
+	require.NoError(t, err)
+	require.NoError(t, step.Run(formatters.NewMockTaskCompleter()))
+	assert.Equal(t, "cold", node.mode)
+	assert.Equal(t, "systemctl is-active postgresql", node.readyCommand)
+	assert.Equal(t, 90*time.Second, node.timeout)
+}
+
+func TestMigrateStepValidation(t *testing.T) {
+	node := &migrateMock{MockNode: nodetypes.NewMockNode()}
+
+	_, err := makeStepOn(t, node, TypeMigrate, map[string]interface{}{})
+	assert.ErrorContains(t, err, "migrate target member is required")
+
+	_, err = makeStepOn(t, node, TypeMigrate, map[string]interface{}{"target": "member-2", "mode": "hot"})
+	assert.ErrorContains(t, err, `mode must be "auto", "live" or "cold"`)
+
+	_, err = makeStepOn(t, nodetypes.NewMockNode(), TypeMigrate, map[string]interface{}{"target": "member-2"})
+	assert.ErrorContains(t, err, "does not support migrate (supported: lxd, lxd-vm)")
+}
+
+func TestMigrateFailureSurfaces(t *testing.T) {
+	node := &migrateMock{MockNode: nodetypes.NewMockNode(), failWith: errors.New("member-2 is offline")}
+	step, err := makeStepOn(t, node, TypeMigrate, map[string]interface{}{"target": "member-2"})
+	require.NoError(t, err)
+	assert.ErrorContains(t, step.Run(formatters.NewMockTaskCompleter()), "member-2 is offline")
+}
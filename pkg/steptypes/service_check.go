@@ -20,6 +20,9 @@ type ServiceCheckStep struct {
 }
 
 func newServiceCheckStep(c *config.StepConfig, node ifaces.Node) (ifaces.Step, error) {
+	if err := requireShell(c, node); err != nil {
+		return nil, err
+	}
 	service, err := requiredString(c, "service", "service is required")
 	if err != nil {
 		return nil, err
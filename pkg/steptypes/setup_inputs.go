@@ -0,0 +1,125 @@
+package steptypes
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bgrewell/dart/internal/config"
+)
+
+// localSources are the step types that read a file or tree from the
+// machine running DART, named by their source option.
+var localSources = map[string]bool{
+	TypeFilePush:     true,
+	TypeFileTemplate: true,
+	TypeDirPush:      true,
+}
+
+// SetupInputs returns what a step's effect depends on beyond its options
+// as written: a digest of each local file it reads, by path relative to
+// its source. It reports false when the step cannot be known before the
+// run: its options hold a fact or capture reference, resolved only once
+// nodes are up; it copies a file to or from another node, which may
+// generate it anew each run, as with a CA certificate or a join token; or
+// its source does not exist yet, as when an earlier step fetches it.
+func SetupInputs(c *config.StepConfig) (map[string]string, bool) {
+	if hasTemplate(c.Step.Options) {
+		return nil, false
+	}
+	if c.Step.Type == TypeFileCopy && copiesAcrossNodes(c) {
+		return nil, false
+	}
+	if !localSources[c.Step.Type] {
+		return nil, true
+	}
+	raw, ok := c.Step.Options["source"].(string)
+	if !ok || raw == "" {
+		return nil, true
+	}
+	source, err := config.ResolveLocalPath(c.SuiteDir, raw)
+	if err != nil {
+		return nil, false
+	}
+
+	inputs := make(map[string]string)
+	if c.Step.Type != TypeDirPush {
+		digest, err := fileDigest(source, 0)
+		if err != nil {
+			return nil, false
+		}
+		inputs["."] = digest
+		return inputs, true
+	}
+	entries, err := localFileOps{}.List(source)
+	if err != nil {
+		return nil, false
+	}
+	for _, entry := range entries {
+		digest, err := fileDigest(filepath.Join(source, filepath.FromSlash(entry.Path)), entry.Mode)
+		if err != nil {
+			return nil, false
+		}
+		inputs[entry.Path] = digest
+	}
+	return inputs, true
+}
+
+// copiesAcrossNodes reports whether a file_copy step's from or to names a
+// node other than the step's own.
+func copiesAcrossNodes(c *config.StepConfig) bool {
+	for _, key := range []string{"from", "to"} {
+		spec, _ := c.Step.Options[key].(map[string]interface{})
+		if name, _ := spec["node"].(string); name != "" && name != c.Node[0] {
+			return true
+		}
+	}
+	return false
+}
+
+// fileDigest identifies what a tree entry holds: a file's mode and
+// contents, a symlink's target, or a directory's mode.
+func fileDigest(path string, mode os.FileMode) (string, error) {
+	switch {
+	case mode.IsDir():
+		return mode.String(), nil
+	case mode&os.ModeSymlink != 0:
+		target, err := os.Readlink(path)
+		if err != nil {
+			return "", err
+		}
+		return "link " + target, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return fmt.Sprintf("%s %s", mode.Perm(), hex.EncodeToString(sum[:])), nil
+}
+
+// hasTemplate reports whether an option value holds a {{ }} reference.
+// Vars are substituted when the suite loads, so what remains is a fact or
+// capture reference.
+func hasTemplate(value interface{}) bool {
+	switch v := value.(type) {
+	case string:
+		return strings.Contains(v, "{{")
+	case map[string]interface{}:
+		for _, item := range v {
+			if hasTemplate(item) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			if hasTemplate(item) {
+				return true
+			}
+		}
+	}
+	return false
+}
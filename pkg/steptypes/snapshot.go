@@ -14,7 +14,7 @@ var _ ifaces.Step = &SnapshotStep{}
 // SnapshotStep captures, restores, or deletes a snapshot of the target
 // node, giving destructive tests cheap isolation: snapshot in setup,
 // break things, restore in teardown — far faster than recreating a node.
-// Supported on node types implementing ifaces.Snapshotter (lxd).
+// Supported on node types implementing ifaces.Snapshotter (lxd, rootfs).
 type SnapshotStep struct {
 	BaseStep
 	node     ifaces.Node
@@ -4,6 +4,7 @@ import (
 	"os/exec"
 	"testing"
 
+	"github.com/bgrewell/dart/pkg/nodetypes"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -39,3 +40,26 @@ func TestStepVantageValidation(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, VantageHost, step.(*DNSRequestStep).from)
 }
+
+// Steps that build shell commands refuse a node without a POSIX shell at
+// construction, so --check reports them; from: host needs no node shell.
+func TestShellStepsRejectShellLessNode(t *testing.T) {
+	node := nodetypes.NewCheckNode("cli")
+
+	for stepType, options := range map[string]map[string]interface{}{
+		TypeFileCreate:   {"path": "/tmp/x", "contents": "x"},
+		TypeFileRead:     {"path": "/tmp/x"},
+		TypeApt:          {"packages": []interface{}{"curl"}},
+		TypeHTTPRequest:  {"url": "http://localhost/"},
+		TypeDNSRequest:   {"hostname": "example.com"},
+		TypeServiceCheck: {"service": "sshd"},
+	} {
+		_, err := makeStepOn(t, node, stepType, options)
+		assert.ErrorContains(t, err, "has no POSIX shell", stepType)
+	}
+
+	_, err := makeStepOn(t, node, TypeHTTPRequest, map[string]interface{}{"url": "http://localhost/", "from": "host"})
+	assert.NoError(t, err)
+	_, err = makeStepOn(t, node, TypeExecute, map[string]interface{}{"command": "show version"})
+	assert.NoError(t, err)
+}
@@ -12,6 +12,9 @@ import (
 // Options: path (alias filename); evaluate.exists (bool, default true).
 // Other evaluate keys fall through to the standard evaluators.
 func newExistsTest(base BaseTest, opts map[string]interface{}) (ifaces.Test, error) {
+	if err := requireShell(base); err != nil {
+		return nil, err
+	}
 	path, err := requiredString(base.name, opts, "path", "filename")
 	if err != nil {
 		return nil, err
@@ -11,6 +11,9 @@ import (
 // Options: filename (alias path). With no evaluate block, the test asserts
 // the file is readable.
 func newFileContentTest(base BaseTest, opts map[string]interface{}) (ifaces.Test, error) {
+	if err := requireShell(base); err != nil {
+		return nil, err
+	}
 	path, err := requiredString(base.name, opts, "filename", "path")
 	if err != nil {
 		return nil, err
@@ -25,6 +25,9 @@ var hashAlgos = []struct {
 // (alias path); evaluate: md5 / sha1 / sha256 with expected hex digests
 // (at least one required). Only the requested checksum tools run.
 func newFileHashTest(base BaseTest, opts map[string]interface{}) (ifaces.Test, error) {
+	if err := requireShell(base); err != nil {
+		return nil, err
+	}
 	path, err := requiredString(base.name, opts, "filename", "path")
 	if err != nil {
 		return nil, err
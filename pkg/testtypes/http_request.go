@@ -102,6 +102,11 @@ func newHTTPRequestTest(base BaseTest, opts map[string]interface{}) (ifaces.Test
 	if err != nil {
 		return nil, err
 	}
+	if from == VantageNode {
+		if err := requireShell(base); err != nil {
+			return nil, err
+		}
+	}
 
 	base.evaluations = evaluations
 	if from == VantageNode {
@@ -15,6 +15,9 @@ import (
 // through to the standard evaluators. Requires `ping` on the node; works
 // with iputils and busybox output formats.
 func newPingTest(base BaseTest, opts map[string]interface{}) (ifaces.Test, error) {
+	if err := requireShell(base); err != nil {
+		return nil, err
+	}
 	target, err := requiredString(base.name, opts, "target", "host")
 	if err != nil {
 		return nil, err
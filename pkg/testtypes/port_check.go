@@ -44,6 +44,11 @@ func newPortCheckTest(base BaseTest, opts map[string]interface{}) (ifaces.Test,
 	if err != nil {
 		return nil, err
 	}
+	if from == VantageNode {
+		if err := requireShell(base); err != nil {
+			return nil, err
+		}
+	}
 	port, err := optInt(base.name, opts, "port", 0)
 	if err != nil {
 		return nil, err
@@ -14,6 +14,9 @@ import (
 // "inactive" or "failed" can be asserted too). Other evaluate keys fall
 // through to the standard evaluators.
 func newServiceStatusTest(base BaseTest, opts map[string]interface{}) (ifaces.Test, error) {
+	if err := requireShell(base); err != nil {
+		return nil, err
+	}
 	service, err := requiredString(base.name, opts, "service")
 	if err != nil {
 		return nil, err
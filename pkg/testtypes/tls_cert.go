@@ -136,6 +136,11 @@ func newTLSCertTest(base BaseTest, opts map[string]interface{}) (ifaces.Test, er
 	if err != nil {
 		return nil, err
 	}
+	if from == VantageNode {
+		if err := requireShell(base); err != nil {
+			return nil, err
+		}
+	}
 
 	base.evaluations = evaluations
 	if from == VantageNode {
@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"github.com/bgrewell/dart/internal/probe"
+	"github.com/bgrewell/dart/pkg/nodetypes"
 )
 
 // Vantage aliases the shared type so test option parsing reads naturally.
@@ -33,3 +34,14 @@ func parseVantage(testName string, opts map[string]interface{}) (Vantage, error)
 func requireTool(tool string) string {
 	return probe.RequireTool(tool)
 }
+
+// requireShell rejects a node without a POSIX shell for the test types
+// that build shell commands — file checks, service checks, node-side
+// probes — at construction, so --check reports it.
+func requireShell(base BaseTest) error {
+	if nodetypes.HasShell(base.node) {
+		return nil
+	}
+	return fmt.Errorf("node %q has no POSIX shell, which a %s test needs (node types with one: %s) in test %q",
+		base.nodeName, base.testType, nodetypes.SupportingTypes(nodetypes.CapabilityShell), base.name)
+}
@@ -128,3 +128,26 @@ func shellSingleQuote(text string) string {
 	}
 	return quoted + "'"
 }
+
+// A node with no POSIX shell cannot run a probe, so a probe from it is
+// rejected at construction — and therefore by --check — while from: host
+// and command tests still work.
+func TestShellTestsRejectShellLessNode(t *testing.T) {
+	node := nodetypes.NewCheckNode("cli")
+
+	for testType, options := range map[string]map[string]interface{}{
+		TypeHTTPRequest:   {"url": "http://localhost/"},
+		TypePortCheck:     {"host": "localhost", "port": 80},
+		TypeFileContent:   {"path": "/etc/hostname", "evaluate": map[string]interface{}{"contains": "x"}},
+		TypePing:          {"target": "10.0.0.1"},
+		TypeServiceStatus: {"service": "sshd"},
+	} {
+		_, err := makeTest(t, node, testType, options)
+		assert.ErrorContains(t, err, "has no POSIX shell", testType)
+	}
+
+	_, err := makeTest(t, node, TypeHTTPRequest, map[string]interface{}{"url": "http://localhost/", "from": "host"})
+	assert.NoError(t, err)
+	_, err = makeTest(t, node, TypeExecute, map[string]interface{}{"command": "show version"})
+	assert.NoError(t, err)
+}